@@ -0,0 +1,182 @@
+package aggregator
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"vchan.in/doctor-metrics/types"
+)
+
+// DefaultStaleAfter is how long the last batch of an agent is served without a newer one.
+const DefaultStaleAfter = 5 * time.Minute
+
+// agentState is the newest batch of an agent and when it was received.
+type agentState struct {
+	token    string
+	lastSeen time.Time
+	batch    *types.IngestBatch
+}
+
+// IngestStore keeps the newest batch of container metrics pushed by each agent.
+type IngestStore struct {
+	staleAfter time.Duration
+	now        func() time.Time
+
+	mu     sync.Mutex
+	agents map[string]*agentState
+}
+
+func ParseIngestTokens(value string) (map[string]string, error) {
+	/*
+		ParseIngestTokens parses a comma-separated list of agent names and tokens.
+
+		web-01=3f9c2a...,web-02=8b1d7e...
+
+		Function returns the tokens keyed by agent name, or an error for malformed entries,
+		duplicate names and tokens shared by several agents.
+	*/
+	tokens := make(map[string]string)
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, token, ok := strings.Cut(entry, "=")
+		name, token = strings.TrimSpace(name), strings.TrimSpace(token)
+		if !ok || name == "" || token == "" {
+			return nil, fmt.Errorf("invalid agent token entry %q, expected name=token", entry)
+		}
+		if _, ok := tokens[name]; ok {
+			return nil, fmt.Errorf("duplicate agent name %q", name)
+		}
+		if seen[token] {
+			return nil, fmt.Errorf("token of agent %q is used by another agent", name)
+		}
+		tokens[name] = token
+		seen[token] = true
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("no agent tokens configured")
+	}
+	return tokens, nil
+}
+
+func NewIngestStore(tokens map[string]string, staleAfter time.Duration) *IngestStore {
+	/*
+		NewIngestStore returns a store accepting batches from the agents with the given tokens, keyed by agent name.
+		The metrics of an agent are no longer served once its last batch is older than staleAfter, DefaultStaleAfter if 0.
+	*/
+	if staleAfter <= 0 {
+		staleAfter = DefaultStaleAfter
+	}
+	store := &IngestStore{staleAfter: staleAfter, now: time.Now, agents: make(map[string]*agentState)}
+	for name, token := range tokens {
+		store.agents[name] = &agentState{token: token}
+	}
+	return store
+}
+
+func (s *IngestStore) Authenticate(token string) (string, bool) {
+	// Return the agent a token belongs to, comparing every token in constant time.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	agent := ""
+	for name, state := range s.agents {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(state.token)) == 1 {
+			agent = name
+		}
+	}
+	return agent, agent != ""
+}
+
+func (s *IngestStore) Ingest(agent string, batch types.IngestBatch) bool {
+	/*
+		Store a batch of an authenticated agent and update its last-seen time.
+
+		Batches are ordered by epoch and sequence. Older batches, like duplicates sent again after a lost
+		response, only update the last-seen time. Function returns whether the batch was newer than the stored one.
+	*/
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.agents[agent]
+	if !ok {
+		return false
+	}
+	state.lastSeen = s.now()
+	if current := state.batch; current != nil &&
+		(batch.Epoch < current.Epoch || (batch.Epoch == current.Epoch && batch.Sequence <= current.Sequence)) {
+		return false
+	}
+	state.batch = &batch
+	return true
+}
+
+func (s *IngestStore) stale(state *agentState) bool {
+	return state.batch == nil || s.now().Sub(state.lastSeen) > s.staleAfter
+}
+
+func (s *IngestStore) Agents() []types.AgentStatus {
+	// Return the status of every configured agent ordered by name.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	agents := []types.AgentStatus{}
+	for name, state := range s.agents {
+		status := types.AgentStatus{Agent: name, Stale: s.stale(state)}
+		if !state.lastSeen.IsZero() {
+			status.LastSeen = state.lastSeen.UTC().Format(time.RFC3339)
+		}
+		if state.batch != nil {
+			status.LastCollectedAt = state.batch.CollectedAt
+			status.Epoch = state.batch.Epoch
+			status.Sequence = state.batch.Sequence
+			status.Containers = len(state.batch.ContainerMetrics)
+		}
+		agents = append(agents, status)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Agent < agents[j].Agent })
+	return agents
+}
+
+func (s *IngestStore) Collect(filter types.ContainerFilter) ([]types.ContainerMetrics, []types.HostError) {
+	/*
+		Return the metrics of the newest batch of every agent that match the filter, tagged with the agent name and ordered by agent.
+		Agents that never pushed or whose last batch is stale are returned as host errors.
+	*/
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.agents))
+	for name := range s.agents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	listMetrics := []types.ContainerMetrics{}
+	var hostErrors []types.HostError
+	for _, name := range names {
+		state := s.agents[name]
+		switch {
+		case state.batch == nil:
+			hostErrors = append(hostErrors, types.HostError{Host: name, Error: "no batch received"})
+			continue
+		case s.stale(state):
+			hostErrors = append(hostErrors, types.HostError{
+				Host:  name,
+				Error: "no batch received since " + state.lastSeen.UTC().Format(time.RFC3339),
+			})
+			continue
+		}
+		for _, metrics := range state.batch.ContainerMetrics {
+			if filter.Matches(metrics.ContainerLabels, metrics.ContainerState) {
+				metrics.Host = tagHost(name, metrics.Host)
+				listMetrics = append(listMetrics, metrics)
+			}
+		}
+	}
+	return listMetrics, hostErrors
+}
@@ -0,0 +1,102 @@
+package aggregator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/types"
+)
+
+func TestParseIngestTokens(t *testing.T) {
+	tokens, err := ParseIngestTokens("web-01=abc, web-02 = def")
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]string{"web-01": "abc", "web-02": "def"}, tokens)
+	}
+
+	for _, value := range []string{"", "web-01", "web-01=", "=abc", "a=abc,a=def", "a=abc,b=abc"} {
+		_, err := ParseIngestTokens(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestIngestStore(t *testing.T) {
+	store := NewIngestStore(map[string]string{"web-01": "abc", "nat-01": "def"}, time.Minute)
+	now := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	_, ok := store.Authenticate("wrong")
+	assert.False(t, ok)
+	agent, ok := store.Authenticate("def")
+	assert.True(t, ok)
+	assert.Equal(t, "nat-01", agent)
+
+	batch := func(epoch int64, sequence uint64, names ...string) types.IngestBatch {
+		batch := types.IngestBatch{Epoch: epoch, Sequence: sequence, CollectedAt: "2021-09-01T12:00:00Z", ContainerMetrics: []types.ContainerMetrics{}}
+		for _, name := range names {
+			batch.ContainerMetrics = append(batch.ContainerMetrics, types.ContainerMetrics{ContainerID: name + "-id", ContainerName: name, ContainerState: "running"})
+		}
+		return batch
+	}
+	assert.True(t, store.Ingest("nat-01", batch(1, 2, "nginx", "redis")))
+	// A replayed older batch only updates the last-seen time.
+	now = now.Add(30 * time.Second)
+	assert.False(t, store.Ingest("nat-01", batch(1, 1, "nginx")))
+	// A restarted agent starts a new epoch.
+	assert.True(t, store.Ingest("nat-01", batch(2, 1, "nginx")))
+
+	agents := store.Agents()
+	if assert.Len(t, agents, 2) {
+		assert.Equal(t, types.AgentStatus{
+			Agent: "nat-01", LastSeen: "2021-09-01T12:00:30Z", LastCollectedAt: "2021-09-01T12:00:00Z",
+			Epoch: 2, Sequence: 1, Containers: 1,
+		}, agents[0])
+		assert.Equal(t, types.AgentStatus{Agent: "web-01", Stale: true}, agents[1])
+	}
+
+	list, hostErrors := store.Collect(types.ContainerFilter{})
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, "nat-01", list[0].Host)
+	}
+	if assert.Len(t, hostErrors, 1) {
+		assert.Equal(t, "web-01", hostErrors[0].Host)
+	}
+
+	// Metrics are no longer served once the agent stops pushing.
+	now = now.Add(2 * time.Minute)
+	list, hostErrors = store.Collect(types.ContainerFilter{})
+	assert.Empty(t, list)
+	assert.Len(t, hostErrors, 2)
+	assert.True(t, store.Agents()[0].Stale)
+}
+
+func TestAggregatorWithIngest(t *testing.T) {
+	web := fakeAgent(t, "", "", types.ContainerMetrics{ContainerID: "c1", ContainerName: "nginx", ContainerState: "running"})
+	store := NewIngestStore(map[string]string{"nat-01": "def"}, time.Minute)
+	store.Ingest("nat-01", types.IngestBatch{Epoch: 1, Sequence: 1, ContainerMetrics: []types.ContainerMetrics{
+		{ContainerID: "0123456789ab", ContainerName: "postgres", ContainerState: "running"},
+	}})
+
+	aggregator := New([]Upstream{{Name: "web-01", URL: web.URL}}, time.Second)
+	aggregator.SetIngestStore(store)
+	list, hostErrors, err := aggregator.CollectHosts(context.Background(), types.ContainerFilter{})
+	if assert.NoError(t, err) && assert.Len(t, list, 2) {
+		assert.Equal(t, "web-01", list[0].Host)
+		assert.Equal(t, "nat-01", list[1].Host)
+	}
+	assert.Empty(t, hostErrors)
+
+	metrics, err := aggregator.CollectContainer(context.Background(), "0123")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "postgres", metrics.ContainerName)
+	}
+
+	// Without upstreams only the pushed metrics are served.
+	central := New(nil, time.Second)
+	central.SetIngestStore(store)
+	list, _, err = central.CollectHosts(context.Background(), types.ContainerFilter{})
+	if assert.NoError(t, err) {
+		assert.Len(t, list, 1)
+	}
+}
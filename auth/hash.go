@@ -0,0 +1,130 @@
+// Package auth stores the API users of dh and checks their passwords in constant time,
+// against a plaintext password or a bcrypt or argon2id hash.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing schemes.
+const (
+	SchemeArgon2id = "argon2id"
+	SchemeBcrypt   = "bcrypt"
+)
+
+// Parameters of the argon2id hashes written by Hash, the OWASP recommendation for a server
+// checking a password on every request: 19 MiB of memory, 2 iterations and 1 thread.
+const (
+	argon2Memory  = 19 * 1024
+	argon2Time    = 2
+	argon2Threads = 1
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// Cost of the bcrypt hashes written by Hash.
+const bcryptCost = bcrypt.DefaultCost
+
+// argon2Hash struct to store a decoded argon2id hash in the PHC string format.
+type argon2Hash struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func Hash(password, scheme string) (string, error) {
+	/*
+		Hash returns the hash of a password with the scheme SchemeArgon2id or SchemeBcrypt, with a random salt.
+		Argon2id hashes use the PHC string format e.g. "$argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>",
+		bcrypt hashes the "$2a$" format, which htpasswd -B also writes as "$2y$".
+	*/
+	switch scheme {
+	case SchemeArgon2id:
+		salt := make([]byte, argon2SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	case SchemeBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+		return string(hash), err
+	}
+	return "", fmt.Errorf("unknown password hashing scheme %q, expected argon2id or bcrypt", scheme)
+}
+
+func CheckHash(hash string) error {
+	// CheckHash returns an error when hash is not a bcrypt or argon2id hash that Verify can check.
+	switch {
+	case isBcrypt(hash):
+		_, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			return fmt.Errorf("invalid bcrypt hash: %w", err)
+		}
+		return nil
+	case strings.HasPrefix(hash, "$argon2id$"):
+		_, err := decodeArgon2(hash)
+		return err
+	}
+	return errors.New("unknown password hash, expected a bcrypt ($2a$, $2b$, $2y$) or argon2id ($argon2id$) hash")
+}
+
+func Verify(hash, password string) bool {
+	// Verify returns whether password matches a hash checked by CheckHash, in constant time.
+	if isBcrypt(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	decoded, err := decodeArgon2(hash)
+	if err != nil {
+		return false
+	}
+	key := argon2.IDKey([]byte(password), decoded.salt, decoded.time, decoded.memory, decoded.threads, uint32(len(decoded.key)))
+	return subtle.ConstantTimeCompare(key, decoded.key) == 1
+}
+
+func equalPasswords(a, b string) bool {
+	// Compare plaintext passwords in constant time, also for passwords of different lengths.
+	hashA, hashB := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(hashA[:], hashB[:]) == 1
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func decodeArgon2(hash string) (*argon2Hash, error) {
+	// Decode "$argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>" with unpadded base64 salt and key.
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, errors.New("invalid argon2id hash, expected $argon2id$v=19$m=...,t=...,p=...$<salt>$<key>")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2id version %q, expected v=%d", parts[2], argon2.Version)
+	}
+	decoded := &argon2Hash{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &decoded.memory, &decoded.time, &decoded.threads); err != nil ||
+		decoded.memory == 0 || decoded.time == 0 || decoded.threads == 0 {
+		return nil, fmt.Errorf("invalid argon2id parameters %q", parts[3])
+	}
+	var err error
+	if decoded.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, errors.New("invalid argon2id salt")
+	}
+	if decoded.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(decoded.key) == 0 {
+		return nil, errors.New("invalid argon2id key")
+	}
+	return decoded, nil
+}
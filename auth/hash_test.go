@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHash(t *testing.T) {
+	for _, scheme := range []string{SchemeArgon2id, SchemeBcrypt} {
+		hash, err := Hash("s3cret", scheme)
+		if !assert.NoError(t, err, scheme) {
+			continue
+		}
+		assert.NoError(t, CheckHash(hash), scheme)
+		assert.True(t, Verify(hash, "s3cret"), scheme)
+		assert.False(t, Verify(hash, "s3cret "), scheme)
+		assert.False(t, Verify(hash, ""), scheme)
+
+		// Every hash has its own salt
+		other, _ := Hash("s3cret", scheme)
+		assert.NotEqual(t, hash, other, scheme)
+	}
+	hash, _ := Hash("s3cret", SchemeArgon2id)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$"), hash)
+
+	_, err := Hash("s3cret", "md5")
+	assert.EqualError(t, err, `unknown password hashing scheme "md5", expected argon2id or bcrypt`)
+}
+
+func TestVerifyExternalHashes(t *testing.T) {
+	// Reference vectors of bcrypt, also in the "$2y$" prefix of htpasswd -B, and of the argon2 command line tool.
+	assert.True(t, Verify("$2a$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga", "allmine"))
+	assert.True(t, Verify("$2y$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga", "allmine"))
+	assert.True(t, Verify("$argon2id$v=19$m=64,t=2,p=1$c29tZXNhbHQ$Bo1ismRVk2qm6+YAYLCmWHDb+j3fjUH3", "password"))
+	assert.False(t, Verify("$argon2id$v=19$m=64,t=2,p=1$c29tZXNhbHQ$Bo1ismRVk2qm6+YAYLCmWHDb+j3fjUH3", "Password"))
+}
+
+func TestCheckHash(t *testing.T) {
+	for hash, message := range map[string]string{
+		"s3cret":      "unknown password hash, expected a bcrypt ($2a$, $2b$, $2y$) or argon2id ($argon2id$) hash",
+		"$2y$05$abc":  "invalid bcrypt hash: crypto/bcrypt: hashedSecret too short to be a bcrypted password",
+		"$argon2id$x": "invalid argon2id hash, expected $argon2id$v=19$m=...,t=...,p=...$<salt>$<key>",
+		"$argon2id$v=16$m=64,t=2,p=1$c29tZXNhbHQ$Bo1ismRVk2qm6+YAYLCmWHDb+j3fjUH3": `unsupported argon2id version "v=16", expected v=19`,
+		"$argon2id$v=19$m=0,t=2,p=1$c29tZXNhbHQ$Bo1ismRVk2qm6+YAYLCmWHDb+j3fjUH3":  `invalid argon2id parameters "m=0,t=2,p=1"`,
+		"$argon2id$v=19$m=64,t=2,p=1$c29tZXNhbHQ$":                                 "invalid argon2id key",
+	} {
+		assert.EqualError(t, CheckHash(hash), message, hash)
+		assert.False(t, Verify(hash, "password"), hash)
+	}
+}
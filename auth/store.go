@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Successful checks of hashed passwords remembered by a Store, forgotten all at once beyond this number.
+const verifiedCacheSize = 1024
+
+// User struct to store the credentials of an API user, a plaintext password or the hash of one.
+type User struct {
+	Username     string // e.g. "admin"
+	Password     string // Plaintext password, empty when PasswordHash is set
+	PasswordHash string // bcrypt or argon2id hash, see CheckHash
+}
+
+// Store struct to store the API users and check their credentials.
+type Store struct {
+	users map[string]User
+	dummy User // Checked for unknown usernames, so they take as long as known ones
+
+	mu       sync.Mutex
+	verified map[[sha256.Size]byte]bool // Digests of username, hash and password of successful hash checks
+}
+
+func NewStore(users []User) (*Store, error) {
+	/*
+		NewStore returns a store of the users.
+		Function returns an error for an empty username or one containing ":", a duplicate username,
+		a user without password or with both a password and a hash, or an invalid hash.
+	*/
+	s := &Store{users: make(map[string]User, len(users)), verified: make(map[[sha256.Size]byte]bool)}
+	s.dummy = User{Password: "dummy"}
+	for _, user := range users {
+		if err := user.check(); err != nil {
+			return nil, err
+		}
+		if _, ok := s.users[user.Username]; ok {
+			return nil, fmt.Errorf("duplicate user %q", user.Username)
+		}
+		s.users[user.Username] = user
+		if user.PasswordHash != "" && s.dummy.PasswordHash == "" {
+			s.dummy = User{PasswordHash: user.PasswordHash}
+		}
+	}
+	return s, nil
+}
+
+func (u User) check() error {
+	switch {
+	case u.Username == "":
+		return errors.New("empty username")
+	case strings.Contains(u.Username, ":"):
+		return fmt.Errorf("username %q must not contain \":\"", u.Username)
+	case u.Password == "" && u.PasswordHash == "":
+		return fmt.Errorf("user %q has no password", u.Username)
+	case u.Password != "" && u.PasswordHash != "":
+		return fmt.Errorf("user %q has both a password and a password hash", u.Username)
+	case u.PasswordHash != "":
+		if err := CheckHash(u.PasswordHash); err != nil {
+			return fmt.Errorf("user %q: %w", u.Username, err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) Authenticate(username, password string) bool {
+	/*
+		Authenticate returns whether the password of the user is correct, in constant time.
+		Unknown users are checked against another user so that usernames cannot be found from the response time.
+		Successful checks of hashed passwords are remembered, since clients like the web dashboard send
+		the same credentials every few seconds and each check of a hash takes tens of milliseconds.
+	*/
+	if s == nil {
+		return false
+	}
+	user, known := s.users[username]
+	if !known {
+		user = s.dummy
+	}
+	if user.PasswordHash == "" {
+		return equalPasswords(user.Password, password) && known
+	}
+
+	digest := sha256.Sum256([]byte(username + "\x00" + user.PasswordHash + "\x00" + password))
+	s.mu.Lock()
+	cached := s.verified[digest]
+	s.mu.Unlock()
+	if cached {
+		return known
+	}
+	if !Verify(user.PasswordHash, password) || !known {
+		return false
+	}
+	s.mu.Lock()
+	if len(s.verified) >= verifiedCacheSize {
+		clear(s.verified)
+	}
+	s.verified[digest] = true
+	s.mu.Unlock()
+	return true
+}
+
+func (s *Store) Len() int {
+	// Len returns the number of users.
+	if s == nil {
+		return 0
+	}
+	return len(s.users)
+}
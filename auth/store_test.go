@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	hash, err := Hash("readonly", SchemeBcrypt)
+	if !assert.NoError(t, err) {
+		return
+	}
+	store, err := NewStore([]User{{Username: "admin", Password: "s3cret"}, {Username: "grafana", PasswordHash: hash}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 2, store.Len())
+	for credentials, allowed := range map[[2]string]bool{
+		{"admin", "s3cret"}:     true,
+		{"admin", "s3cret2"}:    false,
+		{"admin", ""}:           false,
+		{"grafana", "readonly"}: true,
+		{"grafana", "s3cret"}:   false,
+		{"unknown", "readonly"}: false,
+		{"unknown", "dummy"}:    false,
+		{"", ""}:                false,
+	} {
+		assert.Equal(t, allowed, store.Authenticate(credentials[0], credentials[1]), credentials)
+	}
+
+	// Successful checks of hashes are remembered, a cached check still needs the right password
+	assert.Len(t, store.verified, 1)
+	assert.True(t, store.Authenticate("grafana", "readonly"))
+	assert.False(t, store.Authenticate("grafana", "readonly "))
+	assert.Len(t, store.verified, 1)
+
+	var none *Store
+	assert.False(t, none.Authenticate("admin", "s3cret"))
+	assert.Equal(t, 0, none.Len())
+}
+
+func TestNewStoreErrors(t *testing.T) {
+	for _, test := range []struct {
+		users   []User
+		message string
+	}{
+		{[]User{{Password: "s3cret"}}, "empty username"},
+		{[]User{{Username: "ad:min", Password: "s3cret"}}, `username "ad:min" must not contain ":"`},
+		{[]User{{Username: "admin"}}, `user "admin" has no password`},
+		{[]User{{Username: "admin", Password: "s3cret", PasswordHash: "$2a$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga"}}, `user "admin" has both a password and a password hash`},
+		{[]User{{Username: "admin", PasswordHash: "s3cret"}}, `user "admin": unknown password hash, expected a bcrypt ($2a$, $2b$, $2y$) or argon2id ($argon2id$) hash`},
+		{[]User{{Username: "admin", Password: "a"}, {Username: "admin", Password: "b"}}, `duplicate user "admin"`},
+	} {
+		_, err := NewStore(test.users)
+		assert.EqualError(t, err, test.message)
+	}
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Errors of the users file updates.
+var (
+	ErrUserExists   = errors.New("user already exists")
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// LineError is an invalid line of a users file.
+type LineError struct {
+	Line int // Line number starting at 1
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+func ParseUsersFile(r io.Reader) ([]User, error) {
+	/*
+		ParseUsersFile reads users in the htpasswd format: one "username:hash" per line with a bcrypt or argon2id hash.
+		Empty lines and lines starting with "#" are ignored. Files written by htpasswd -B can be used as is.
+		Function returns a LineError for the first invalid line.
+	*/
+	var users []User
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		username, hash, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, &LineError{Line: line, Err: errors.New(`expected "username:hash"`)}
+		}
+		user := User{Username: username, PasswordHash: hash}
+		if err := user.check(); err != nil {
+			return nil, &LineError{Line: line, Err: err}
+		}
+		users = append(users, user)
+	}
+	return users, scanner.Err()
+}
+
+func ReadUsersFile(path string) ([]User, error) {
+	// ReadUsersFile reads the users file at path, see ParseUsersFile.
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseUsersFile(file)
+}
+
+func AddUser(path, username, hash string) error {
+	// AddUser appends a user to the users file at path, creating it if needed, ErrUserExists if the user is already in it.
+	return updateUsersFile(path, username, hash, false)
+}
+
+func SetPasswordHash(path, username, hash string) error {
+	// SetPasswordHash replaces the hash of a user of the users file at path, ErrUserNotFound if the user is not in it.
+	return updateUsersFile(path, username, hash, true)
+}
+
+func updateUsersFile(path, username, hash string, replace bool) error {
+	/*
+		Write the hash of a user, keeping the other lines and the comments.
+		The file is replaced atomically so that a dh reloading it never reads a partial file.
+	*/
+	if err := (User{Username: username, PasswordHash: hash}).check(); err != nil {
+		return err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil && !(errors.Is(err, os.ErrNotExist) && !replace) {
+		return err
+	}
+	mode := os.FileMode(0o600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	if len(content) == 0 {
+		lines = nil
+	}
+	found := false
+	for i, line := range lines {
+		if name, _, ok := strings.Cut(strings.TrimSpace(line), ":"); ok && name == username && !strings.HasPrefix(name, "#") {
+			if !replace {
+				return fmt.Errorf("%w: %s", ErrUserExists, username)
+			}
+			lines[i], found = username+":"+hash, true
+		}
+	}
+	if replace && !found {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, username)
+	}
+	if !replace {
+		lines = append(lines, username+":"+hash)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Chmod(mode); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
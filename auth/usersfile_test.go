@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const bcryptAllmine = "$2y$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga"
+
+func TestParseUsersFile(t *testing.T) {
+	users, err := ParseUsersFile(strings.NewReader("# dh users\n\nadmin:" + bcryptAllmine + "\n  ops:$argon2id$v=19$m=64,t=2,p=1$c29tZXNhbHQ$Bo1ismRVk2qm6+YAYLCmWHDb+j3fjUH3\n"))
+	if assert.NoError(t, err) && assert.Len(t, users, 2) {
+		assert.Equal(t, User{Username: "admin", PasswordHash: bcryptAllmine}, users[0])
+		assert.Equal(t, "ops", users[1].Username)
+	}
+
+	_, err = ParseUsersFile(strings.NewReader("admin:" + bcryptAllmine + "\nops\n"))
+	var lineErr *LineError
+	if assert.ErrorAs(t, err, &lineErr) {
+		assert.Equal(t, 2, lineErr.Line)
+		assert.EqualError(t, err, `line 2: expected "username:hash"`)
+	}
+	// Plaintext passwords are not accepted in a users file
+	_, err = ParseUsersFile(strings.NewReader("admin:s3cret\n"))
+	assert.ErrorContains(t, err, "line 1: user \"admin\": unknown password hash")
+}
+
+func TestUpdateUsersFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users")
+	assert.ErrorIs(t, SetPasswordHash(path, "admin", bcryptAllmine), os.ErrNotExist)
+
+	assert.NoError(t, AddUser(path, "admin", bcryptAllmine))
+	assert.NoError(t, os.WriteFile(path, []byte("# dh users\nadmin:"+bcryptAllmine+"\n"), 0o600))
+	assert.NoError(t, os.Chmod(path, 0o640))
+	assert.NoError(t, AddUser(path, "ops", bcryptAllmine))
+	assert.ErrorIs(t, AddUser(path, "admin", bcryptAllmine), ErrUserExists)
+
+	hash, _ := Hash("changed", SchemeArgon2id)
+	assert.NoError(t, SetPasswordHash(path, "admin", hash))
+	assert.ErrorIs(t, SetPasswordHash(path, "grafana", hash), ErrUserNotFound)
+	assert.Error(t, AddUser(path, "grafana", "s3cret"))
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "# dh users\nadmin:"+hash+"\nops:"+bcryptAllmine+"\n", string(content))
+	info, err := os.Stat(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+	}
+
+	users, err := ReadUsersFile(path)
+	if assert.NoError(t, err) {
+		store, err := NewStore(users)
+		assert.NoError(t, err)
+		assert.True(t, store.Authenticate("admin", "changed"))
+		assert.True(t, store.Authenticate("ops", "allmine"))
+	}
+}
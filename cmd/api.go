@@ -1,53 +1,123 @@
 package cmd
 
 import (
+	"context"
+	"io"
 	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	"golang.org/x/exp/slog"
-	"golang.org/x/time/rate"
+	"vchan.in/doctor-metrics/auth"
 	"vchan.in/doctor-metrics/handlers"
+	"vchan.in/doctor-metrics/logging"
+	"vchan.in/doctor-metrics/ui"
 )
 
-func Server(version string) {
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
+func serve(args []string, build BuildInfo, stderr io.Writer) int {
+	/*
+		Start the metrics server and block until it stops.
+		On SIGINT or SIGTERM the server drains the requests in progress and flushes the push exporter, see shutdown.
+		Function returns ExitConfig for an invalid configuration, ExitError when the server fails and ExitOK after a clean shutdown.
+	*/
+	flags := newFlagSet("serve", stderr)
+	configFile := addConfigFlags(flags)
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
 	}
-	requiredEnvVar("DM_USERNAME")
-	requiredEnvVar("DM_PASSWORD")
-	requiredEnvVar("DM_ALLOWED_IPS")
+	source, err := newConfigSource(flags, *configFile)
+	if err != nil {
+		log.Printf("FATAL %v", err)
+		return ExitConfig
+	}
+	cfg, err := source.load()
+	if err != nil {
+		log.Printf("FATAL %v", err)
+		return ExitConfig
+	}
+	if err := logging.Configure(cfg.LogConfig(), stderr); err != nil {
+		log.Printf("FATAL Invalid log configuration: %v", err)
+		return ExitConfig
+	}
+	defer logging.Close()
+	setFilesystemRoots(cfg)
+
+	// Samplers and watches stop on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	users, err := auth.NewStore(cfg.Users())
+	if err != nil {
+		slog.Log(context.Background(), logging.LevelFatal, "Invalid users: "+err.Error())
+		return ExitConfig
+	}
+	handlers.SetAccessControl(users, cfg.Auth.AllowedIPs)
+	handlers.SetRateLimit(cfg.RateLimit.RequestsPerSecond, cfg.RateLimit.Burst)
+
+	// Set the healthcheck log length and flapping detection before the docker events stream records to it
+	configureHealthChecks(cfg)
+	// Select where container metrics are collected from
+	configureCollector(ctx, cfg)
+	// Collect the containers once before /readyz reports ready
+	go handlers.TakeFirstSample(ctx)
+	// Push the collected metrics to a central dh if configured
+	exporter := startPushAgent(cfg)
+	// Refresh the Docker disk usage on a slow schedule
+	startDiskUsageWatch(ctx, cfg)
+	// Apply a new configuration on SIGHUP and when the file changes if server.watch_config is set
+	reload := newReloader(source, cfg, exporter, stderr)
+	go reload.watch(ctx)
 
 	e := echo.New()
 	e.HideBanner = true // Hide the echo server banner to avoid server version disclosure in logs
 
 	// Root level middleware
-	e.Use(middleware.Secure())  // Use secure middleware to set security headers
-	e.Use(middleware.Recover()) // Recover middleware recovers from panics anywhere in the chain
-	e.Use(handlers.FilterIP)    // Filter IP middleware
+	e.Use(handlers.RequestMetrics) // Self metrics of every request, first to also count the rejected ones
+	e.Use(middleware.RequestID())  // X-Request-Id of the request, or a new one, echoed in the response and the logs
+	e.Use(handlers.AccessLog)      // Access log of every request if log.access is set
+	e.Use(middleware.Secure())     // Use secure middleware to set security headers
+	e.Use(middleware.Recover())    // Recover middleware recovers from panics anywhere in the chain
+	e.Use(handlers.FilterIP)       // Filter IP middleware
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins:     []string{"*"},
 		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
 		AllowMethods:     []string{echo.GET},
 		AllowCredentials: true,
 	})) // CORS middleware
-	e.Use(middleware.RateLimiter(middleware.NewRateLimiterMemoryStore(rate.Limit(5)))) // Rate limiter middleware with a limit of 5 requests per second
-	e.Use(handlers.HandleAuthMiddleware)                                               // Auth middleware
+	e.Use(handlers.RateLimiter())        // Rate limiter middleware with rate_limit.requests_per_second per client
+	e.Use(handlers.HandleAuthMiddleware) // Auth middleware
 
 	// Routes
 	e.GET("/", func(c echo.Context) error {
-		return handlers.GetRoot(c, version)
+		return handlers.GetRoot(c, build.Version)
 	})
+	e.GET("/healthz", handlers.GetHealthz) // Liveness probe, not authenticated
+	e.GET("/readyz", handlers.GetReadyz)   // Readiness probe, not authenticated
 	e.GET("api/metrics", handlers.GetDockerMetrics)
 	e.GET("api/metrics/:containerName", handlers.GetMetricsContainerByName)
 	e.GET("api/metrics/:containerID", handlers.GetMetricsContainerByID)
-
-	httpPort := os.Getenv("DM_SERVER_PORT")
-	if httpPort == "" {
-		httpPort = ":9095" // Default port if not provided
+	e.GET("api/swarm/services", handlers.GetSwarmServices)
+	e.GET("api/pods", handlers.GetKubernetesPods)
+	e.GET("api/podman/pods", handlers.GetPodmanPods)
+	e.GET("api/pressure", handlers.GetHostPressure)
+	e.GET("api/host", handlers.GetHostMetrics)
+	e.GET("api/disk", handlers.GetDiskUsage)
+	e.GET("api/containers/:id/processes", handlers.GetContainerProcesses)
+	e.GET("api/health/containers", handlers.GetContainerHealth)
+	e.POST("api/ingest", handlers.PostIngest, middleware.BodyLimit("10M"))
+	e.GET("api/agents", handlers.GetAgents)
+	e.GET("api/projects", handlers.GetComposeProjects)
+	e.GET("api/projects/:project/services", handlers.GetComposeServices)
+	e.GET("api/self", handlers.GetSelfMetrics)
+	e.GET("/metrics", handlers.GetPrometheusMetrics) // Self metrics in the Prometheus text format
+	if cfg.Server.UI {
+		e.StaticFS("/ui", ui.Files()) // Web dashboard, /ui redirects to /ui/
 	}
+
 	slog.Info(`
     ____             __             
    / __ \____  _____/ /_____  _____ 
@@ -58,17 +128,47 @@ func Server(version string) {
   / /|_/ / _ \/ __/ ___/ / ___/ ___/
  / /  / /  __/ /_/ /  / / /__(__  ) 
 /_/  /_/\___/\__/_/  /_/\___/____/  
-				v` + version + `
+				v` + build.Version + `
 	`)
-	slog.Info("Server started at 0.0.0.0:" + httpPort)
-	server := e.Start(":" + httpPort)
-	if server != nil {
-		slog.Error(server.Error())
+	slog.Info("Server started", "listen", cfg.Server.Listen)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- e.Start(cfg.Server.Listen)
+	}()
+	select {
+	case err := <-serverErr:
+		slog.Error(err.Error())
+		return ExitError
+	case <-ctx.Done():
 	}
+	stop() // A second signal stops dh without waiting for the drain
+	return shutdown(e, reload)
 }
 
-func requiredEnvVar(envVar string) {
-	if os.Getenv(envVar) == "" {
-		log.Fatalf("FATAL Required environment variable %s not set", envVar)
+func shutdown(e *echo.Echo, r *reloader) int {
+	/*
+		Fail /readyz for server.drain_delay while still serving, so load balancers stop sending requests first.
+		Then stop accepting connections, wait for the requests in progress and flush the push exporter,
+		all within server.shutdown_timeout. Samplers and watches already stopped with the serve context.
+		Function returns ExitError when the drain or the flush did not complete in time.
+	*/
+	cfg := r.currentConfig()
+	timeout := cfg.Server.ShutdownTimeout.Value()
+	slog.Info("Shutting down, draining requests", "drain_delay", cfg.Server.DrainDelay.Value().String(), "timeout", timeout.String())
+	handlers.StartDraining()
+	time.Sleep(cfg.Server.DrainDelay.Value())
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	code := ExitOK
+	if err := e.Shutdown(ctx); err != nil {
+		slog.Error("Failed to drain the requests in progress", "error", err)
+		code = ExitError
+	}
+	if err := r.shutdown(ctx); err != nil {
+		slog.Error("Failed to flush the push exporter", "error", err)
+		code = ExitError
 	}
+	slog.Info("Server stopped")
+	return code
 }
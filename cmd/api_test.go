@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/config"
+	"vchan.in/doctor-metrics/handlers"
+)
+
+func TestShutdown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	started := make(chan struct{})
+	e := echo.New()
+	e.HideBanner, e.HidePort = true, true
+	e.Listener = listener
+	e.GET("/slow", func(c echo.Context) error {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		return c.String(http.StatusOK, "done")
+	})
+	go func() { _ = e.Start("") }()
+
+	// A request in progress when the shutdown starts completes.
+	status := make(chan int, 1)
+	go func() {
+		response, err := http.Get("http://" + listener.Addr().String() + "/slow")
+		if err != nil {
+			status <- 0
+			return
+		}
+		response.Body.Close()
+		status <- response.StatusCode
+	}()
+	<-started
+
+	cfg := config.Default()
+	assert.Equal(t, ExitOK, shutdown(e, newReloader(&configSource{}, cfg, nil, io.Discard)))
+	assert.Equal(t, http.StatusOK, <-status)
+
+	// New connections are refused once shut down.
+	_, err = http.Get("http://" + listener.Addr().String() + "/slow")
+	assert.Error(t, err)
+}
+
+func TestShutdownDrainDelay(t *testing.T) {
+	// During the drain delay /readyz fails while new connections are still accepted.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	e := echo.New()
+	e.HideBanner, e.HidePort = true, true
+	e.Listener = listener
+	e.GET("/readyz", handlers.GetReadyz)
+	go func() { _ = e.Start("") }()
+
+	cfg := config.Default()
+	cfg.Server.DrainDelay = "300ms"
+	code := make(chan int, 1)
+	go func() { code <- shutdown(e, newReloader(&configSource{}, cfg, nil, io.Discard)) }()
+
+	time.Sleep(100 * time.Millisecond)
+	response, err := http.Get("http://" + listener.Addr().String() + "/readyz")
+	if assert.NoError(t, err) {
+		response.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+	}
+	assert.Equal(t, ExitOK, <-code)
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// Exit codes of dh, stable for scripts.
+const (
+	ExitOK          = 0 // Success
+	ExitError       = 1 // The command failed e.g. the server could not start or the API returned an error
+	ExitUsage       = 2 // Unknown command, flag or argument
+	ExitConfig      = 3 // The configuration is invalid
+	ExitUnavailable = 4 // The dh instance could not be reached
+	ExitNotFound    = 5 // The container was not found
+)
+
+// BuildInfo struct to store the version information injected at build time with -ldflags.
+type BuildInfo struct {
+	Version   string // Release version e.g. "1.3.0"
+	Commit    string // Git commit e.g. "a8f8c54"
+	BuildDate string // Build time in RFC3339 format e.g. "2026-10-18T12:00:00Z"
+}
+
+const usage = `Usage: dh <command> [flags]
+
+Commands:
+  serve          Start the metrics server, the default without a command
+  version        Print the version, commit and build date
+  config check   Validate the configuration without starting the server
+  metrics        Print the container metrics of a running dh
+  top            Show a live dashboard of the local containers or of a running dh
+  user add       Add a user with a hashed password to the users file
+  user passwd    Change the password of a user of the users file
+
+Run "dh <command> -h" for the flags of a command.
+
+Exit codes:
+  0  Success
+  1  The command failed
+  2  Invalid command, flag or argument
+  3  Invalid configuration
+  4  The dh instance could not be reached
+  5  The container was not found
+`
+
+func Execute(args []string, build BuildInfo) int {
+	// Execute runs the command given by the command line arguments without the program name, and returns its exit code.
+	return run(args, build, os.Stdout, os.Stderr)
+}
+
+func run(args []string, build BuildInfo, stdout, stderr io.Writer) int {
+	/*
+		Run a command writing its output to stdout and its errors to stderr.
+		Without a command, or with flags only e.g. "dh --config dh.yaml", the server is started like with dh serve.
+	*/
+	if len(args) == 0 || (strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "--help") {
+		return serve(args, build, stderr)
+	}
+
+	switch args[0] {
+	case "serve":
+		return serve(args[1:], build, stderr)
+	case "version":
+		return version(args[1:], build, stdout, stderr)
+	case "config":
+		if len(args) > 1 && args[1] == "check" {
+			return configCheck(args[2:], stdout, stderr)
+		}
+		fmt.Fprint(stderr, "Usage: dh config check [flags]\n")
+		return ExitUsage
+	case "metrics":
+		return metrics(args[1:], stdout, stderr)
+	case "top":
+		return top(args[1:], stderr)
+	case "user":
+		return user(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return ExitOK
+	}
+	fmt.Fprintf(stderr, "dh: unknown command %q\n\n%s", args[0], usage)
+	return ExitUsage
+}
+
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	// Flags of a command, parse errors are returned to exit with ExitUsage.
+	flags := flag.NewFlagSet("dh "+name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	return flags
+}
+
+func parseFlags(flags *flag.FlagSet, args []string) (int, bool) {
+	// Parse the flags of a command, returning the exit code when the command must not run e.g. for -h.
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK, false
+		}
+		return ExitUsage, false
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(flags.Output(), "%s: unexpected argument %q\n", flags.Name(), flags.Arg(0))
+		return ExitUsage, false
+	}
+	return ExitOK, true
+}
+
+func version(args []string, build BuildInfo, stdout, stderr io.Writer) int {
+	flags := newFlagSet("version", stderr)
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	fmt.Fprintf(stdout, "dh %s\ncommit: %s\nbuilt: %s\ngo: %s %s/%s\n",
+		build.Version, build.Commit, build.BuildDate, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return ExitOK
+}
+
+func configCheck(args []string, stdout, stderr io.Writer) int {
+	/*
+		Validate the configuration like dh serve would load it, from the same file, environment and flags.
+		Every problem is printed with where the value was set, and dh exits with ExitConfig.
+	*/
+	flags := newFlagSet("config check", stderr)
+	configFile := addConfigFlags(flags)
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+
+	source, err := newConfigSource(flags, *configFile)
+	if err == nil {
+		_, err = source.load()
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return ExitConfig
+	}
+	fmt.Fprintln(stdout, "Configuration is valid")
+	return ExitOK
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/auth"
+	"vchan.in/doctor-metrics/types"
+)
+
+func runCommand(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, BuildInfo{Version: "1.3.0", Commit: "a8f8c54", BuildDate: "2026-10-18T12:00:00Z"}, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun(t *testing.T) {
+	code, stdout, _ := runCommand("version")
+	assert.Equal(t, ExitOK, code)
+	assert.Contains(t, stdout, "dh 1.3.0\ncommit: a8f8c54\nbuilt: 2026-10-18T12:00:00Z\n")
+
+	code, stdout, _ = runCommand("help")
+	assert.Equal(t, ExitOK, code)
+	assert.Contains(t, stdout, "config check")
+
+	code, _, stderr := runCommand("stats")
+	assert.Equal(t, ExitUsage, code)
+	assert.Contains(t, stderr, `unknown command "stats"`)
+
+	code, _, _ = runCommand("version", "--short")
+	assert.Equal(t, ExitUsage, code)
+	code, _, _ = runCommand("config")
+	assert.Equal(t, ExitUsage, code)
+}
+
+func TestConfigCheck(t *testing.T) {
+	code, stdout, _ := runCommand("config", "check", "--config", "../config/testdata/config.yaml")
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "Configuration is valid\n", stdout)
+
+	code, _, stderr := runCommand("config", "check", "--config", "../config/testdata/config.yaml", "--runtime", "lxc")
+	assert.Equal(t, ExitConfig, code)
+	assert.Contains(t, stderr, `--runtime: collector.runtime: unknown container runtime "lxc"`)
+}
+
+func TestMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, _ := r.BasicAuth(); username != "admin" || password != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"message":"Unauthorized"}`))
+			return
+		}
+		var response metricsResponse
+		response.Data.ContainerMetrics = []types.ContainerMetrics{}
+		if name := r.URL.Query().Get("name"); name == "" || name == "web-1" {
+			response.Data.ContainerMetrics = append(response.Data.ContainerMetrics, types.ContainerMetrics{
+				ContainerID:                 "f3f177b2b3b4",
+				ContainerName:               "web-1",
+				ContainerState:              "running",
+				ContainerCpuUsagePercent:    12.5,
+				ContainerMemoryUsageBytes:   36175872,
+				ContainerMemoryLimitBytes:   2088763392,
+				ContainerMemoryUsagePercent: 1.73,
+				ContainerPIDs:               4,
+			})
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+	host := strings.Replace(server.URL, "http://", "http://admin:s3cret@", 1)
+
+	code, stdout, _ := runCommand("metrics", "--host", host)
+	if assert.Equal(t, ExitOK, code) {
+		lines := strings.Split(strings.TrimSpace(stdout), "\n")
+		assert.Len(t, lines, 2)
+		assert.Regexp(t, `^-\s+f3f177b2b3b4\s+web-1\s+running\s+12.50%\s+34.5MiB\s+1.9GiB\s+1.73%\s+0B`, lines[1])
+	}
+
+	code, stdout, _ = runCommand("metrics", "--host", host, "--container", "web-1", "--format", "csv")
+	assert.Equal(t, ExitOK, code)
+	assert.Contains(t, stdout, ",f3f177b2b3b4,web-1,running,12.5,36175872,2088763392,1.73,0,0,0,0,4\n")
+
+	code, stdout, _ = runCommand("metrics", "--host", host, "--format", "json")
+	var listMetrics []types.ContainerMetrics
+	if assert.Equal(t, ExitOK, code) && assert.NoError(t, json.Unmarshal([]byte(stdout), &listMetrics)) {
+		assert.Equal(t, "web-1", listMetrics[0].ContainerName)
+	}
+
+	// Exit codes tell failures apart.
+	code, _, _ = runCommand("metrics", "--host", host, "--container", "db")
+	assert.Equal(t, ExitNotFound, code)
+	code, _, stderr := runCommand("metrics", "--host", server.URL)
+	assert.Equal(t, ExitError, code)
+	assert.Contains(t, stderr, "dh returned 401: Unauthorized")
+	code, _, _ = runCommand("metrics", "--host", host, "--format", "yaml")
+	assert.Equal(t, ExitUsage, code)
+
+	server.Close()
+	code, _, _ = runCommand("metrics", "--host", host)
+	assert.Equal(t, ExitUnavailable, code)
+}
+
+func TestUser(t *testing.T) {
+	t.Setenv("DM_USERS_FILE", "")
+	defer func(input io.Reader) { stdin = input }(stdin)
+	file := filepath.Join(t.TempDir(), "users")
+	withPassword := func(password string, args ...string) (int, string, string) {
+		stdin = strings.NewReader(password + "\n")
+		return runCommand(args...)
+	}
+
+	code, stdout, _ := withPassword("s3cret", "user", "add", "admin", "--file", file)
+	if assert.Equal(t, ExitOK, code) {
+		assert.Equal(t, "User admin added to "+file+"\n", stdout)
+	}
+	code, _, _ = withPassword("readonly", "user", "add", "--file", file, "--scheme", "bcrypt", "grafana")
+	assert.Equal(t, ExitOK, code)
+	code, _, stderr := withPassword("other", "user", "add", "admin", "--file", file)
+	assert.Equal(t, ExitError, code)
+	assert.Contains(t, stderr, "user already exists: admin")
+
+	code, _, _ = withPassword("changed", "user", "passwd", "admin", "--file", file)
+	assert.Equal(t, ExitOK, code)
+	code, _, stderr = withPassword("changed", "user", "passwd", "ops", "--file", file)
+	assert.Equal(t, ExitError, code)
+	assert.Contains(t, stderr, "user not found: ops")
+
+	users, err := auth.ReadUsersFile(file)
+	if assert.NoError(t, err) && assert.Len(t, users, 2) {
+		assert.True(t, strings.HasPrefix(users[0].PasswordHash, "$argon2id$"))
+		assert.True(t, strings.HasPrefix(users[1].PasswordHash, "$2a$"))
+		store, err := auth.NewStore(users)
+		if assert.NoError(t, err) {
+			assert.True(t, store.Authenticate("admin", "changed"))
+			assert.True(t, store.Authenticate("grafana", "readonly"))
+		}
+	}
+
+	// Invalid arguments and input.
+	for _, args := range [][]string{
+		{"user"},
+		{"user", "remove", "admin"},
+		{"user", "add", "--file", file},
+		{"user", "add", "admin"},
+		{"user", "add", "admin", "--file", file, "--scheme", "md5"},
+		{"user", "add", "admin", "ops", "--file", file},
+	} {
+		code, _, _ = withPassword("s3cret", args...)
+		assert.Equal(t, ExitUsage, code, args)
+	}
+	code, _, stderr = withPassword("", "user", "add", "ops", "--file", file)
+	assert.Equal(t, ExitError, code)
+	assert.Contains(t, stderr, "empty password")
+}
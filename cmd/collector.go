@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"vchan.in/doctor-metrics/aggregator"
+	"vchan.in/doctor-metrics/config"
+	"vchan.in/doctor-metrics/containerd"
+	"vchan.in/doctor-metrics/handlers"
+	"vchan.in/doctor-metrics/logging"
+)
+
+func configureCollector(ctx context.Context, cfg *config.Config) {
+	/*
+		Configure the collector used by the metrics handlers.
+
+		With upstreams or ingest tokens configured, dh runs in aggregator mode and merges the metrics of the
+		listed dh agents, polled from the upstreams or pushed by the agents to POST /api/ingest.
+		Otherwise metrics are collected from the local container runtime selected by collector.runtime.
+		Background watches of the collector stop when the context is cancelled.
+	*/
+	if len(cfg.Aggregator.Upstreams) > 0 || len(cfg.Aggregator.IngestTokens) > 0 {
+		upstreams, err := cfg.Upstreams()
+		if err != nil {
+			logging.Fatal("Invalid upstreams", "error", err)
+		}
+		merged := aggregator.New(upstreams, cfg.Aggregator.UpstreamTimeout.Value())
+
+		if len(cfg.Aggregator.IngestTokens) > 0 {
+			store := aggregator.NewIngestStore(cfg.IngestTokens(), cfg.Retention.AgentStaleAfter.Value())
+			merged.SetIngestStore(store)
+			handlers.SetIngestStore(store)
+		}
+		handlers.SetCollector(merged)
+		return
+	}
+
+	switch cfg.Collector.Runtime {
+	case "docker":
+		if len(cfg.Collector.Docker.Endpoints) > 0 {
+			configureDockerEndpoints(cfg)
+			return
+		}
+		// The disk usage of a tcp:// DOCKER_HOST is read with the certificates of the configuration
+		handlers.SetDockerTLS(cfg.DockerTLS())
+		// Keep the container inspect cache in sync with container changes
+		go handlers.WatchContainerEvents(ctx)
+	case "containerd":
+		address := cfg.Collector.Containerd.Address
+		collector, err := containerd.NewCollector(address, cfg.Collector.Containerd.Namespaces)
+		if err != nil {
+			logging.Fatal("Failed to connect to containerd", "address", address, "error", err)
+		}
+		handlers.SetCollector(collector)
+	case "podman":
+		handlers.SetCollector(handlers.NewPodmanCollector(cfg.Collector.Podman.Socket))
+	}
+}
+
+func configureDockerEndpoints(cfg *config.Config) {
+	/*
+		Collect the configured Docker daemons through the Engine API, each tagged with its name.
+		TCP endpoints use TLS with the client certificates in DOCKER_CERT_PATH, and the daemon certificate is verified
+		unless collector.docker.tls_skip_verify is set. Endpoints that are not verified are logged as a warning.
+	*/
+	endpoints, err := cfg.DockerEndpoints()
+	if err != nil {
+		logging.Fatal("Invalid Docker endpoints", "error", err)
+	}
+	var hosts []handlers.NamedCollector
+	for _, endpoint := range endpoints {
+		engine, err := handlers.NewEngineCollector(endpoint)
+		if err != nil {
+			logging.Fatal("Invalid Docker endpoint", "endpoint", endpoint.Name, "error", err)
+		}
+		switch {
+		case !strings.HasPrefix(endpoint.Host, "tcp://"):
+		case endpoint.CertPath == "":
+			slog.Warn("Docker endpoint uses plain TCP, the daemon is not authenticated", "endpoint", endpoint.Name, "host", endpoint.Host)
+		case endpoint.TLSSkipVerify:
+			slog.Warn("Docker endpoint skips TLS verification, the daemon certificate is not checked", "endpoint", endpoint.Name, "host", endpoint.Host)
+		}
+		hosts = append(hosts, handlers.NamedCollector{Name: endpoint.Name, Collector: engine})
+	}
+	handlers.SetCollector(handlers.NewHostsCollector(hosts, cfg.Collector.Docker.EndpointTimeout.Value()))
+}
+
+func startDiskUsageWatch(ctx context.Context, cfg *config.Config) {
+	/*
+		Collect the disk usage of the Docker objects every collector.disk_usage_interval for GET /api/disk.
+		Collectors that cannot report disk usage, like containerd and aggregators, are not watched.
+	*/
+	go handlers.WatchDiskUsage(ctx, cfg.Collector.DiskUsageInterval.Value())
+}
+
+func configureHealthChecks(cfg *config.Config) {
+	/*
+		Report the last collector.health.log_entries healthcheck results per container, and flag containers
+		whose health status changed more than collector.health.flap_changes times within collector.health.flap_interval.
+	*/
+	health := cfg.Collector.Health
+	handlers.ConfigureHealthChecks(health.LogEntries, health.FlapChanges, health.FlapInterval.Value())
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"vchan.in/doctor-metrics/config"
+)
+
+// configSource struct to store where the configuration is loaded from, so it can be loaded again on reload.
+type configSource struct {
+	path      string            // Configuration file given with --config, none if empty e.g. "/etc/dh/config.yaml"
+	overrides []config.Override // Values of the command line flags
+	inherited map[string]bool   // Environment variables set before the .env file was loaded
+}
+
+// Configuration keys set by the flags of addConfigFlags.
+var configFlagKeys = map[string]string{"listen": "server.listen", "runtime": "collector.runtime"}
+
+func addConfigFlags(flags *flag.FlagSet) *string {
+	// Add the flags selecting and overriding the configuration, returning the configuration file flag.
+	configFile := flags.String("config", "", "YAML or TOML configuration file e.g. /etc/dh/config.yaml")
+	flags.String("listen", "", "Listen address e.g. :9095, overrides server.listen")
+	flags.String("runtime", "", "Container runtime docker, containerd or podman, overrides collector.runtime")
+	return configFile
+}
+
+func newConfigSource(flags *flag.FlagSet, path string) (*configSource, error) {
+	/*
+		Return the source of the configuration from the parsed flags of addConfigFlags.
+
+		A .env file in the working directory is loaded into the environment if it exists, without overriding
+		variables that are already set.
+	*/
+	source := &configSource{path: path, inherited: make(map[string]bool)}
+	for _, entry := range os.Environ() {
+		name, _, _ := strings.Cut(entry, "=")
+		source.inherited[name] = true
+	}
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load .env file: %w", err)
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		if key, ok := configFlagKeys[f.Name]; ok {
+			source.overrides = append(source.overrides, config.Override{Key: key, Value: f.Value.String(), Source: "--" + f.Name})
+		}
+	})
+	return source, nil
+}
+
+func (s *configSource) load() (*config.Config, error) {
+	/*
+		Load the configuration from the defaults, the file, the environment and the flags, validating every value.
+		The file and the .env file are read again on every call, variables set in the environment of dh keep
+		precedence over the .env file.
+	*/
+	dotenv, err := godotenv.Read()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load .env file: %w", err)
+	}
+	lookupEnv := func(key string) (string, bool) {
+		if s.inherited[key] {
+			return os.LookupEnv(key)
+		}
+		value, ok := dotenv[key]
+		return value, ok
+	}
+	return config.Load(s.path, lookupEnv, s.overrides)
+}
+
+func setFilesystemRoots(cfg *config.Config) {
+	// procfs and the host metrics read the filesystem roots from the environment.
+	os.Setenv("DM_PROC_ROOT", cfg.Collector.ProcRoot)
+	os.Setenv("DM_CGROUP_ROOT", cfg.Collector.CgroupRoot)
+	os.Setenv("DM_SYS_ROOT", cfg.Collector.SysRoot)
+	os.Setenv("DM_DOCKER_DATA_ROOT", cfg.Collector.DockerDataRoot)
+}
@@ -0,0 +1,583 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"vchan.in/doctor-metrics/types"
+)
+
+// Number of samples kept per container for the sparklines of dh top.
+const dashboardHistory = 60
+
+// Levels of a sparkline, lowest first.
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+// Label Docker Compose sets to the project of a container.
+const composeProjectLabel = "com.docker.compose.project"
+
+// metricsSource returns the metrics of all containers, from a local collector or a remote dh.
+type metricsSource func(ctx context.Context) ([]types.ContainerMetrics, error)
+
+// dashboardSample struct to store the result of one collection, posted to the event loop of the dashboard.
+type dashboardSample struct {
+	metrics []types.ContainerMetrics
+	err     error
+	at      time.Time
+}
+
+// dashboardRow struct to store a container of the dashboard with its recent samples.
+type dashboardRow struct {
+	key     string // Host and container ID e.g. "web-01/f3f177b2b3b4"
+	metrics types.ContainerMetrics
+	cpu     []float64 // CPU usage percentages, oldest first
+	memory  []float64 // Memory usage percentages, oldest first
+	netRx   float64   // Received bytes per second
+	netTx   float64   // Transmitted bytes per second
+	blkRead float64   // Block bytes read per second
+	blkWrt  float64   // Block bytes written per second
+	seenAt  time.Time // Time of the last sample
+}
+
+func (r *dashboardRow) project() string {
+	return r.metrics.ContainerLabels[composeProjectLabel]
+}
+
+// dashboardColumn struct to store a column of the container table.
+type dashboardColumn struct {
+	title string
+	width int                                     // Width in cells, 0 for the name column taking the remaining width
+	less  func(a, b *dashboardRow) bool           // Order of the rows when sorted by this column, nil if it cannot be sorted
+	cell  func(r *dashboardRow, width int) string // Content of the column for a row
+}
+
+func byValue(value func(r *dashboardRow) float64) func(a, b *dashboardRow) bool {
+	// Numeric columns sort the largest values first.
+	return func(a, b *dashboardRow) bool { return value(a) > value(b) }
+}
+
+var dashboardColumns = []dashboardColumn{
+	{title: "NAME", less: func(a, b *dashboardRow) bool { return a.metrics.ContainerName < b.metrics.ContainerName },
+		cell: func(r *dashboardRow, width int) string { return r.metrics.ContainerName }},
+	{title: "CPU %", width: 8, less: byValue(func(r *dashboardRow) float64 { return r.metrics.ContainerCpuUsagePercent }),
+		cell: func(r *dashboardRow, width int) string {
+			return fmt.Sprintf("%.2f", r.metrics.ContainerCpuUsagePercent)
+		}},
+	{title: "CPU HISTORY", width: 22,
+		cell: func(r *dashboardRow, width int) string { return sparkline(r.cpu, width-2, 100) }},
+	{title: "MEM", width: 10, less: byValue(func(r *dashboardRow) float64 { return float64(r.metrics.ContainerMemoryUsageBytes) }),
+		cell: func(r *dashboardRow, width int) string { return formatBytes(r.metrics.ContainerMemoryUsageBytes) }},
+	{title: "MEM %", width: 8, less: byValue(func(r *dashboardRow) float64 { return r.metrics.ContainerMemoryUsagePercent }),
+		cell: func(r *dashboardRow, width int) string {
+			return fmt.Sprintf("%.2f", r.metrics.ContainerMemoryUsagePercent)
+		}},
+	{title: "NET RX/TX", width: 22, less: byValue(func(r *dashboardRow) float64 { return r.netRx + r.netTx }),
+		cell: func(r *dashboardRow, width int) string { return formatRate(r.netRx) + " " + formatRate(r.netTx) }},
+	{title: "BLOCK R/W", width: 22, less: byValue(func(r *dashboardRow) float64 { return r.blkRead + r.blkWrt }),
+		cell: func(r *dashboardRow, width int) string { return formatRate(r.blkRead) + " " + formatRate(r.blkWrt) }},
+	{title: "PIDS", width: 6, less: byValue(func(r *dashboardRow) float64 { return float64(r.metrics.ContainerPIDs) }),
+		cell: func(r *dashboardRow, width int) string { return fmt.Sprint(r.metrics.ContainerPIDs) }},
+}
+
+// dashboard struct to store the state of dh top, only used from its event loop.
+type dashboard struct {
+	screen tcell.Screen
+	source string // What the metrics come from e.g. "local docker" or "http://10.0.0.1:9095"
+
+	rows      map[string]*dashboardRow // Containers of the last sample by key
+	err       error                    // Error of the last collection
+	updatedAt time.Time                // Time of the last successful collection
+
+	sortColumn int    // Index in dashboardColumns
+	reverse    bool   // Whether the sort order of the column is reversed
+	filter     string // Case-insensitive text the name, image, project or host must contain
+	filtering  bool   // Whether keys are typed into the filter
+	grouped    bool   // Whether containers are grouped by Compose project
+	selected   string // Key of the selected container
+	detail     bool   // Whether the detail pane of the selected container is shown
+	offset     int    // First visible line of the table
+}
+
+func newDashboard(screen tcell.Screen, source string) *dashboard {
+	return &dashboard{screen: screen, source: source, rows: make(map[string]*dashboardRow), sortColumn: 1}
+}
+
+func (d *dashboard) run(ctx context.Context, source metricsSource, interval time.Duration) {
+	/*
+		Run the dashboard until q or Ctrl+C is pressed or the context is cancelled.
+		Metrics are collected every interval in the background and handed to the event loop as events,
+		so the state of the dashboard is only changed by the event loop.
+	*/
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			listMetrics, err := source(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			_ = d.screen.PostEvent(tcell.NewEventInterrupt(dashboardSample{metrics: listMetrics, err: err, at: time.Now()}))
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		_ = d.screen.PostEvent(tcell.NewEventInterrupt(nil))
+	}()
+
+	d.draw()
+	for {
+		event := d.screen.PollEvent()
+		if event == nil || ctx.Err() != nil || !d.handleEvent(event) {
+			return
+		}
+		d.draw()
+	}
+}
+
+func (d *dashboard) update(sample dashboardSample) {
+	/*
+		Record a sample: append the CPU and memory usage to the history of each container and compute
+		the network and block IO rates from the counters of the previous sample.
+		Containers missing from the sample are removed, a failed collection keeps the last metrics.
+	*/
+	d.err = sample.err
+	if sample.err != nil && len(sample.metrics) == 0 {
+		return
+	}
+	d.updatedAt = sample.at
+
+	seen := make(map[string]bool, len(sample.metrics))
+	for _, metrics := range sample.metrics {
+		key := metrics.ContainerID
+		if metrics.Host != "" {
+			key = metrics.Host + "/" + key
+		}
+		seen[key] = true
+
+		row, ok := d.rows[key]
+		if !ok {
+			row = &dashboardRow{key: key}
+			d.rows[key] = row
+		} else if elapsed := sample.at.Sub(row.seenAt).Seconds(); elapsed > 0 {
+			row.netRx = rate(row.metrics.ContainerNetworkReceiveBytesTotal, metrics.ContainerNetworkReceiveBytesTotal, elapsed)
+			row.netTx = rate(row.metrics.ContainerNetworkTransmitBytesTotal, metrics.ContainerNetworkTransmitBytesTotal, elapsed)
+			row.blkRead = rate(row.metrics.ContainerBlockReadBytes, metrics.ContainerBlockReadBytes, elapsed)
+			row.blkWrt = rate(row.metrics.ContainerBlockWriteBytes, metrics.ContainerBlockWriteBytes, elapsed)
+		}
+		row.metrics = metrics
+		row.seenAt = sample.at
+		row.cpu = appendHistory(row.cpu, metrics.ContainerCpuUsagePercent)
+		row.memory = appendHistory(row.memory, metrics.ContainerMemoryUsagePercent)
+	}
+	for key := range d.rows {
+		if !seen[key] {
+			delete(d.rows, key)
+		}
+	}
+}
+
+func rate(previous, current int64, seconds float64) float64 {
+	// A counter lower than before was reset by a container restart.
+	if current < previous {
+		return 0
+	}
+	return float64(current-previous) / seconds
+}
+
+func appendHistory(history []float64, value float64) []float64 {
+	history = append(history, value)
+	if len(history) > dashboardHistory {
+		history = history[len(history)-dashboardHistory:]
+	}
+	return history
+}
+
+func (d *dashboard) handleEvent(event tcell.Event) bool {
+	// Apply an event to the dashboard, returning false to quit.
+	switch event := event.(type) {
+	case *tcell.EventInterrupt:
+		if sample, ok := event.Data().(dashboardSample); ok {
+			d.update(sample)
+		}
+	case *tcell.EventResize:
+		d.screen.Sync()
+	case *tcell.EventKey:
+		if event.Key() == tcell.KeyCtrlC {
+			return false
+		}
+		if d.filtering {
+			d.handleFilterKey(event)
+			return true
+		}
+		return d.handleKey(event)
+	}
+	return true
+}
+
+func (d *dashboard) handleFilterKey(event *tcell.EventKey) {
+	// The list is filtered while typing, Enter keeps the filter and Escape clears it.
+	switch event.Key() {
+	case tcell.KeyEnter:
+		d.filtering = false
+	case tcell.KeyEscape:
+		d.filtering, d.filter = false, ""
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if runes := []rune(d.filter); len(runes) > 0 {
+			d.filter = string(runes[:len(runes)-1])
+		}
+	case tcell.KeyRune:
+		d.filter += string(event.Rune())
+	}
+	d.offset = 0
+}
+
+func (d *dashboard) handleKey(event *tcell.EventKey) bool {
+	switch event.Key() {
+	case tcell.KeyUp:
+		d.moveSelection(-1)
+	case tcell.KeyDown:
+		d.moveSelection(1)
+	case tcell.KeyLeft:
+		d.moveSort(-1)
+	case tcell.KeyRight:
+		d.moveSort(1)
+	case tcell.KeyEnter:
+		d.detail = !d.detail && d.selected != ""
+	case tcell.KeyEscape:
+		d.detail, d.filter = false, ""
+	case tcell.KeyRune:
+		switch event.Rune() {
+		case 'q':
+			return false
+		case '/':
+			d.filtering = true
+		case 'r':
+			d.reverse = !d.reverse
+		case 'g':
+			d.grouped = !d.grouped
+		case 'k':
+			d.moveSelection(-1)
+		case 'j':
+			d.moveSelection(1)
+		}
+	}
+	return true
+}
+
+func (d *dashboard) moveSort(step int) {
+	// Select the previous or next column that can be sorted, in its default order.
+	for i := d.sortColumn + step; i >= 0 && i < len(dashboardColumns); i += step {
+		if dashboardColumns[i].less != nil {
+			d.sortColumn, d.reverse = i, false
+			return
+		}
+	}
+}
+
+func (d *dashboard) moveSelection(step int) {
+	rows := d.visibleRows()
+	if len(rows) == 0 {
+		d.selected = ""
+		return
+	}
+	index := -1
+	for i, row := range rows {
+		if row.key == d.selected {
+			index = i
+		}
+	}
+	index = min(max(index+step, 0), len(rows)-1)
+	d.selected = rows[index].key
+}
+
+func (d *dashboard) visibleRows() []*dashboardRow {
+	/*
+		Return the containers matching the filter in display order: sorted by the sort column, then by name,
+		and when grouped, by Compose project first with containers outside a project last.
+	*/
+	filter := strings.ToLower(d.filter)
+	var rows []*dashboardRow
+	for _, row := range d.rows {
+		m := row.metrics
+		text := strings.ToLower(strings.Join([]string{m.ContainerName, m.ContainerID, m.ContainerImage, row.project(), m.Host}, " "))
+		if strings.Contains(text, filter) {
+			rows = append(rows, row)
+		}
+	}
+
+	less := dashboardColumns[d.sortColumn].less
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if d.grouped && a.project() != b.project() {
+			if a.project() == "" || b.project() == "" {
+				return b.project() == ""
+			}
+			return a.project() < b.project()
+		}
+		if d.reverse {
+			a, b = b, a
+		}
+		if less(a, b) != less(b, a) {
+			return less(a, b)
+		}
+		if a.metrics.ContainerName != b.metrics.ContainerName {
+			return a.metrics.ContainerName < b.metrics.ContainerName
+		}
+		return a.key < b.key
+	})
+	return rows
+}
+
+// dashboardLine struct to store a line of the container table, a container or the header of a Compose project.
+type dashboardLine struct {
+	row     *dashboardRow
+	project string
+	members []*dashboardRow // Containers of the project, for its header
+}
+
+func (d *dashboard) lines(rows []*dashboardRow) []dashboardLine {
+	if !d.grouped {
+		lines := make([]dashboardLine, len(rows))
+		for i, row := range rows {
+			lines[i] = dashboardLine{row: row}
+		}
+		return lines
+	}
+	var lines []dashboardLine
+	header := 0
+	for i, row := range rows {
+		if i == 0 || row.project() != rows[i-1].project() {
+			lines = append(lines, dashboardLine{project: row.project()})
+			header = len(lines) - 1
+		}
+		lines[header].members = append(lines[header].members, row)
+		lines = append(lines, dashboardLine{row: row})
+	}
+	return lines
+}
+
+func (d *dashboard) draw() {
+	/*
+		Draw the whole screen: a title bar, the container table, the detail pane of the selected container
+		when open, and a status line with the filter, the last error or the key bindings.
+	*/
+	d.screen.Clear()
+	width, height := d.screen.Size()
+	rows := d.visibleRows()
+	if d.selected == "" || d.rows[d.selected] == nil || !containsRow(rows, d.selected) {
+		d.selected = ""
+		if len(rows) > 0 {
+			d.selected = rows[0].key
+		}
+	}
+	if d.selected == "" {
+		d.detail = false
+	}
+
+	reverse := tcell.StyleDefault.Reverse(true)
+	bold := tcell.StyleDefault.Bold(true)
+	order := "↓"
+	if d.reverse {
+		order = "↑"
+	}
+	updated := "never"
+	if !d.updatedAt.IsZero() {
+		updated = d.updatedAt.Format("15:04:05")
+	}
+	title := fmt.Sprintf(" dh top - %s - %d/%d containers - sort %s %s - updated %s",
+		d.source, len(rows), len(d.rows), dashboardColumns[d.sortColumn].title, order, updated)
+	drawText(d.screen, 0, 0, width, title, reverse)
+
+	tableHeight := height - 3
+	if d.detail {
+		tableHeight -= detailHeight
+	}
+	widths := columnWidths(width)
+	x := 0
+	for i, column := range dashboardColumns {
+		heading := column.title
+		if i == d.sortColumn {
+			heading += " " + order
+		}
+		drawText(d.screen, x, 1, widths[i], heading, bold)
+		x += widths[i]
+	}
+
+	lines := d.lines(rows)
+	selectedLine := 0
+	for i, line := range lines {
+		if line.row != nil && line.row.key == d.selected {
+			selectedLine = i
+		}
+	}
+	if selectedLine < d.offset {
+		d.offset = selectedLine
+	}
+	if tableHeight > 0 && selectedLine >= d.offset+tableHeight {
+		d.offset = selectedLine - tableHeight + 1
+	}
+	for i := 0; i < tableHeight && d.offset+i < len(lines); i++ {
+		d.drawLine(2+i, widths, lines[d.offset+i])
+	}
+
+	if d.detail {
+		d.drawDetail(height-1-detailHeight, width, d.rows[d.selected])
+	}
+
+	status := " / filter  ←/→ sort  r reverse  g group by project  ↑/↓ select  enter details  q quit"
+	style := tcell.StyleDefault
+	switch {
+	case d.filtering:
+		status = " Filter: " + d.filter + "█"
+	case d.err != nil:
+		status, style = " Error: "+d.err.Error(), style.Foreground(tcell.ColorRed)
+	case d.filter != "":
+		status = fmt.Sprintf(" Filter %q, esc to clear", d.filter)
+	}
+	drawText(d.screen, 0, height-1, width, status, style)
+	d.screen.Show()
+}
+
+func containsRow(rows []*dashboardRow, key string) bool {
+	for _, row := range rows {
+		if row.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func columnWidths(width int) []int {
+	// The name column takes the width left by the other columns, at least 12 cells.
+	widths := make([]int, len(dashboardColumns))
+	fixed := 0
+	for i, column := range dashboardColumns {
+		widths[i] = column.width
+		fixed += column.width
+	}
+	widths[0] = max(width-fixed, 12)
+	return widths
+}
+
+func (d *dashboard) drawLine(y int, widths []int, line dashboardLine) {
+	if line.row == nil {
+		var cpu float64
+		var memory int64
+		for _, row := range line.members {
+			cpu += row.metrics.ContainerCpuUsagePercent
+			memory += row.metrics.ContainerMemoryUsageBytes
+		}
+		name := line.project
+		if name == "" {
+			name = "(no project)"
+		}
+		text := fmt.Sprintf("▾ %s - %d containers, CPU %.2f%%, MEM %s", name, len(line.members), cpu, formatBytes(memory))
+		width, _ := d.screen.Size()
+		drawText(d.screen, 0, y, width, text, tcell.StyleDefault.Bold(true).Foreground(tcell.ColorTeal))
+		return
+	}
+
+	style := tcell.StyleDefault
+	if line.row.key == d.selected {
+		style = style.Reverse(true)
+	}
+	x := 0
+	for i, column := range dashboardColumns {
+		text := column.cell(line.row, widths[i])
+		if i == 0 && d.grouped {
+			text = "  " + text
+		}
+		drawText(d.screen, x, y, widths[i], text, style)
+		x += widths[i]
+	}
+}
+
+// Lines of the detail pane, including its title.
+const detailHeight = 8
+
+func (d *dashboard) drawDetail(y, width int, row *dashboardRow) {
+	m := row.metrics
+	title := fmt.Sprintf(" %s (%s)", m.ContainerName, m.ContainerID)
+	if m.Host != "" {
+		title += " on " + m.Host
+	}
+	drawText(d.screen, 0, y, width, title, tcell.StyleDefault.Reverse(true))
+
+	state := m.ContainerState
+	if m.ContainerUptimeSeconds > 0 {
+		state += ", up " + (time.Duration(m.ContainerUptimeSeconds) * time.Second).String()
+	}
+	state += fmt.Sprintf(", %d restarts", m.ContainerRestartCount)
+	if m.ContainerHealthStatus != "" {
+		state += ", " + m.ContainerHealthStatus
+	}
+	project := row.project()
+	if service := m.ContainerLabels["com.docker.compose.service"]; service != "" {
+		project += " / " + service
+	}
+	spark := max(width-40, 10)
+	details := []string{
+		"State    " + state,
+		"Image    " + m.ContainerImage,
+		"Project  " + project,
+		fmt.Sprintf("CPU      %-24s %s", fmt.Sprintf("%.2f%%", m.ContainerCpuUsagePercent), sparkline(row.cpu, spark, 100)),
+		fmt.Sprintf("Memory   %-24s %s", fmt.Sprintf("%s / %s", formatBytes(m.ContainerMemoryUsageBytes), formatBytes(m.ContainerMemoryLimitBytes)), sparkline(row.memory, spark, 100)),
+		fmt.Sprintf("Network  rx %s tx %s, block read %s write %s, %d PIDs, %d open files",
+			formatBytes(m.ContainerNetworkReceiveBytesTotal), formatBytes(m.ContainerNetworkTransmitBytesTotal),
+			formatBytes(m.ContainerBlockReadBytes), formatBytes(m.ContainerBlockWriteBytes), m.ContainerPIDs, m.ContainerOpenFDs),
+	}
+	for i, text := range details {
+		drawText(d.screen, 1, y+1+i, width-1, text, tcell.StyleDefault)
+	}
+}
+
+func drawText(screen tcell.Screen, x, y, width int, text string, style tcell.Style) {
+	// Draw text truncated and padded to width cells, the padding uses the style too.
+	runes := []rune(text)
+	for i := 0; i < width; i++ {
+		r := ' '
+		if i < len(runes) {
+			r = runes[i]
+		}
+		screen.SetContent(x+i, y, r, nil, style)
+	}
+}
+
+func sparkline(values []float64, width int, ceiling float64) string {
+	// Draw the last width values scaled to the ceiling, or to the largest value if it exceeds the ceiling.
+	if width <= 0 {
+		return ""
+	}
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+	peak := ceiling
+	for _, value := range values {
+		peak = math.Max(peak, value)
+	}
+	line := make([]rune, len(values))
+	for i, value := range values {
+		level := 0
+		if peak > 0 {
+			level = int(math.Round(value / peak * float64(len(sparkLevels)-1)))
+		}
+		line[i] = sparkLevels[min(max(level, 0), len(sparkLevels)-1)]
+	}
+	return string(line)
+}
+
+func formatRate(bytesPerSecond float64) string {
+	return formatBytes(int64(bytesPerSecond)) + "/s"
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/types"
+)
+
+func newTestDashboard(t *testing.T) (*dashboard, tcell.SimulationScreen) {
+	screen := tcell.NewSimulationScreen("UTF-8")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("Failed to initialize the screen: %v", err)
+	}
+	t.Cleanup(screen.Fini)
+	screen.SetSize(140, 24)
+	return newDashboard(screen, "test"), screen
+}
+
+func screenLines(screen tcell.SimulationScreen) []string {
+	cells, width, height := screen.GetContents()
+	lines := make([]string, height)
+	for y := range lines {
+		var line strings.Builder
+		for x := 0; x < width; x++ {
+			if runes := cells[y*width+x].Runes; len(runes) > 0 {
+				line.WriteString(string(runes))
+			} else {
+				line.WriteRune(' ')
+			}
+		}
+		lines[y] = strings.TrimRight(line.String(), " ")
+	}
+	return lines
+}
+
+func tableNames(screen tcell.SimulationScreen) []string {
+	// Names of the containers in the table, in display order.
+	var names []string
+	for _, line := range screenLines(screen)[2:] {
+		if fields := strings.Fields(line); len(fields) > 1 && strings.Contains(line, "/s") {
+			names = append(names, fields[0])
+		}
+	}
+	return names
+}
+
+func press(d *dashboard, keys ...any) bool {
+	// Send keys to the dashboard, runes as typed characters, then redraw.
+	running := true
+	for _, key := range keys {
+		switch key := key.(type) {
+		case rune:
+			running = d.handleEvent(tcell.NewEventKey(tcell.KeyRune, key, tcell.ModNone))
+		case string:
+			for _, r := range key {
+				running = d.handleEvent(tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone))
+			}
+		case tcell.Key:
+			running = d.handleEvent(tcell.NewEventKey(key, 0, tcell.ModNone))
+		}
+	}
+	d.draw()
+	return running
+}
+
+var dashboardMetrics = []types.ContainerMetrics{
+	{ContainerID: "a1", ContainerName: "shop-web-1", ContainerImage: "nginx:1.27", ContainerState: "running",
+		ContainerCpuUsagePercent: 12.5, ContainerMemoryUsageBytes: 64 << 20, ContainerPIDs: 4,
+		ContainerNetworkReceiveBytesTotal: 1000, ContainerLabels: map[string]string{composeProjectLabel: "shop", "com.docker.compose.service": "web"}},
+	{ContainerID: "b2", ContainerName: "shop-db-1", ContainerImage: "postgres:17", ContainerState: "running",
+		ContainerCpuUsagePercent: 40, ContainerMemoryUsageBytes: 512 << 20, ContainerPIDs: 12,
+		ContainerLabels: map[string]string{composeProjectLabel: "shop"}},
+	{ContainerID: "c3", ContainerName: "registry", ContainerImage: "registry:2", ContainerState: "running",
+		ContainerCpuUsagePercent: 1, ContainerMemoryUsageBytes: 16 << 20, ContainerPIDs: 30},
+}
+
+func TestDashboard(t *testing.T) {
+	d, screen := newTestDashboard(t)
+	at := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	d.update(dashboardSample{metrics: dashboardMetrics, at: at})
+	next := append([]types.ContainerMetrics(nil), dashboardMetrics...)
+	next[0].ContainerNetworkReceiveBytesTotal = 3048 // 1 KiB/s over 2 seconds
+	next[0].ContainerCpuUsagePercent = 25
+	d.update(dashboardSample{metrics: next, at: at.Add(2 * time.Second)})
+	d.draw()
+
+	lines := screenLines(screen)
+	assert.Contains(t, lines[0], "3/3 containers - sort CPU % ↓ - updated 12:00:02")
+	assert.Equal(t, []string{"shop-db-1", "shop-web-1", "registry"}, tableNames(screen))
+	assert.Contains(t, lines[3], "25.00   ▂▃")
+	assert.Contains(t, lines[3], "1.0KiB/s 0B/s")
+
+	// Sorting by another column and reversing the order.
+	press(d, tcell.KeyRight)
+	assert.Contains(t, screenLines(screen)[0], "sort MEM ↓")
+	assert.Contains(t, screenLines(screen)[1], "MEM ↓")
+	assert.Equal(t, []string{"shop-db-1", "shop-web-1", "registry"}, tableNames(screen))
+	press(d, tcell.KeyRight, tcell.KeyRight, tcell.KeyRight, tcell.KeyRight, tcell.KeyRight)
+	assert.Contains(t, screenLines(screen)[0], "sort PIDS ↓")
+	assert.Equal(t, []string{"registry", "shop-db-1", "shop-web-1"}, tableNames(screen))
+	press(d, 'r')
+	assert.Equal(t, []string{"shop-web-1", "shop-db-1", "registry"}, tableNames(screen))
+
+	// The list is filtered while typing.
+	press(d, '/', "SHOP-")
+	assert.Equal(t, []string{"shop-web-1", "shop-db-1"}, tableNames(screen))
+	assert.Equal(t, " Filter: SHOP-█", screenLines(screen)[23])
+	press(d, "w")
+	assert.Equal(t, []string{"shop-web-1"}, tableNames(screen))
+	press(d, tcell.KeyBackspace2, tcell.KeyEnter)
+	assert.Equal(t, []string{"shop-web-1", "shop-db-1"}, tableNames(screen))
+	press(d, tcell.KeyEscape)
+	assert.Len(t, tableNames(screen), 3)
+
+	// Grouping by Compose project, containers outside a project last.
+	press(d, tcell.KeyLeft, tcell.KeyLeft, tcell.KeyLeft, tcell.KeyLeft, tcell.KeyLeft, 'g')
+	assert.Contains(t, screenLines(screen)[0], "sort CPU % ↓")
+	lines = screenLines(screen)
+	assert.Equal(t, "▾ shop - 2 containers, CPU 65.00%, MEM 576.0MiB", lines[2])
+	assert.Equal(t, "▾ (no project) - 1 containers, CPU 1.00%, MEM 16.0MiB", lines[5])
+	assert.Equal(t, []string{"shop-db-1", "shop-web-1", "registry"}, tableNames(screen))
+
+	// Details of the selected container, the last one left by the filter.
+	press(d, tcell.KeyEnter)
+	detail := strings.Join(screenLines(screen), "\n")
+	assert.Contains(t, detail, " shop-web-1 (a1)")
+	assert.Contains(t, detail, "Image    nginx:1.27")
+	assert.Contains(t, detail, "Project  shop / web")
+	press(d, tcell.KeyDown)
+	assert.Contains(t, strings.Join(screenLines(screen), "\n"), " registry (c3)")
+
+	assert.False(t, press(d, 'q'))
+}
+
+func TestDashboardErrors(t *testing.T) {
+	d, screen := newTestDashboard(t)
+	at := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	d.update(dashboardSample{metrics: dashboardMetrics, at: at})
+
+	// A failed collection keeps the last metrics and shows the error.
+	d.update(dashboardSample{err: errors.New("connection refused"), at: at.Add(2 * time.Second)})
+	d.draw()
+	lines := screenLines(screen)
+	assert.Contains(t, lines[0], "updated 12:00:00")
+	assert.Equal(t, " Error: connection refused", lines[23])
+	assert.Len(t, tableNames(screen), 3)
+
+	// Containers missing from a sample are removed.
+	d.update(dashboardSample{metrics: dashboardMetrics[:1], at: at.Add(4 * time.Second)})
+	d.draw()
+	assert.Equal(t, []string{"shop-web-1"}, tableNames(screen))
+}
+
+func TestDashboardRun(t *testing.T) {
+	d, screen := newTestDashboard(t)
+	collected := make(chan struct{}, 1)
+	source := func(ctx context.Context) ([]types.ContainerMetrics, error) {
+		select {
+		case collected <- struct{}{}:
+		default:
+		}
+		return dashboardMetrics, nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.run(context.Background(), source, time.Hour)
+	}()
+	<-collected
+	screen.InjectKey(tcell.KeyRune, 'q', tcell.ModNone)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The dashboard did not quit")
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	assert.Equal(t, "▁▅█", sparkline([]float64{0, 50, 100}, 10, 100))
+	assert.Equal(t, "▅█", sparkline([]float64{0, 50, 100}, 2, 100))
+	// Values above the ceiling scale the line down.
+	assert.Equal(t, "▁▃▅█", sparkline([]float64{0, 50, 100, 200}, 10, 100))
+	assert.Equal(t, "▁▁", sparkline([]float64{0, 0}, 5, 0))
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"vchan.in/doctor-metrics/config"
+	"vchan.in/doctor-metrics/handlers"
+	"vchan.in/doctor-metrics/logging"
+	"vchan.in/doctor-metrics/push"
+	"vchan.in/doctor-metrics/selfmetrics"
+)
+
+// pushExporter struct to store a push agent and stop it when the push configuration is reloaded.
+type pushExporter struct {
+	config push.Config
+	agent  *push.Agent
+	cancel context.CancelFunc
+	done   chan struct{} // Closed when the agent stopped
+}
+
+func startPushAgent(cfg *config.Config) *pushExporter {
+	/*
+		Start pushing the collected metrics to a central dh when exporters.push.url is set.
+
+		Agents behind NAT cannot be polled by an aggregator, so they push a batch every exporters.push.interval
+		with the token exporters.push.token. Batches are buffered in exporters.push.buffer_dir, or in memory,
+		while the central server is unreachable and replayed in order.
+	*/
+	exporter, err := newPushExporter(cfg.PushConfig())
+	if err != nil {
+		logging.Fatal("Invalid push configuration", "error", err)
+	}
+	exporter.start()
+	return exporter
+}
+
+func newPushExporter(pushConfig push.Config) (*pushExporter, error) {
+	// Prepare the agent of a push configuration without starting it, nil if the URL is empty.
+	if pushConfig.URL == "" {
+		return nil, nil
+	}
+	agent, err := push.NewAgent(pushConfig, handlers.CurrentCollector())
+	if err != nil {
+		return nil, err
+	}
+	return &pushExporter{config: pushConfig, agent: agent}, nil
+}
+
+func (p *pushExporter) start() {
+	if p == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel, p.done = cancel, make(chan struct{})
+	slog.Info("Pushing metrics", "url", p.config.URL)
+	selfmetrics.SetQueue("push", p.agent.Buffered)
+	go func() {
+		defer close(p.done)
+		p.agent.Run(ctx)
+	}()
+}
+
+func (p *pushExporter) stop() {
+	// Stop the agent and wait for the push in progress, batches buffered in memory are dropped.
+	if p == nil {
+		return
+	}
+	p.cancel()
+	<-p.done
+	selfmetrics.SetQueue("push", nil)
+}
+
+func (p *pushExporter) handOver(next *pushExporter, timeout time.Duration) {
+	/*
+		Stop the agent for a reloaded push configuration and carry its undelivered batches over to the next agent.
+		When push is disabled, the buffered batches are sent until the timeout instead.
+	*/
+	if p == nil {
+		return
+	}
+	if next == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := p.shutdown(ctx); err != nil {
+			slog.Warn("Failed to send the buffered batches before disabling push", "buffered", p.agent.Buffered(), "error", err)
+		}
+		return
+	}
+	p.stop()
+	if err := next.agent.Adopt(p.agent); err != nil {
+		slog.Warn("Failed to carry the buffered batches over to the new push configuration", "buffered", p.agent.Buffered(), "error", err)
+	}
+}
+
+func (p *pushExporter) shutdown(ctx context.Context) error {
+	/*
+		Stop the agent and send the buffered batches until the context is done.
+		Batches still undelivered are kept in exporters.push.buffer_dir for the next start, or dropped if buffered in memory.
+	*/
+	if p == nil {
+		return nil
+	}
+	p.stop()
+	return p.agent.Flush(ctx)
+}
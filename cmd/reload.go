@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"vchan.in/doctor-metrics/auth"
+	"vchan.in/doctor-metrics/config"
+	"vchan.in/doctor-metrics/handlers"
+	"vchan.in/doctor-metrics/logging"
+)
+
+// Time between two checks of the configuration file for changes when server.watch_config is set.
+const configWatchInterval = 2 * time.Second
+
+// reloader struct to store the running configuration and replace it on SIGHUP or when the file changes.
+type reloader struct {
+	source  *configSource
+	started *config.Config // Configuration dh started with, for the keys that are only read on startup
+	stderr  io.Writer      // Output of the main log
+
+	mu      sync.Mutex // Serializes reloads
+	current *config.Config
+	push    *pushExporter
+}
+
+func newReloader(source *configSource, cfg *config.Config, push *pushExporter, stderr io.Writer) *reloader {
+	return &reloader{source: source, started: cfg, current: cfg, push: push, stderr: stderr}
+}
+
+func (r *reloader) watch(ctx context.Context) {
+	/*
+		Reload the configuration on SIGHUP, and when the configuration file changes if server.watch_config is set.
+		The file is polled for a new modification time or size, which also catches files replaced through a symlink.
+	*/
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+	last, _ := os.Stat(r.source.path)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			_ = r.reload("SIGHUP")
+		case <-ticker.C:
+			if r.source.path == "" || !r.watching() {
+				continue
+			}
+			info, err := os.Stat(r.source.path)
+			if err != nil || (last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size()) {
+				continue
+			}
+			last = info
+			_ = r.reload("change of " + r.source.path)
+		}
+	}
+}
+
+func (r *reloader) watching() bool {
+	return r.currentConfig().Server.WatchConfig
+}
+
+func (r *reloader) reload(trigger string) error {
+	/*
+		Load and validate the configuration again, then apply it.
+		An invalid configuration is logged with every error and the current one is kept.
+	*/
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := r.source.load()
+	if err == nil {
+		err = r.apply(cfg)
+	}
+	if err != nil {
+		slog.Error("Failed to reload the configuration, keeping the current configuration", "trigger", trigger, "error", err)
+		return err
+	}
+	slog.Info("Configuration reloaded", "trigger", trigger)
+	return nil
+}
+
+func (r *reloader) apply(cfg *config.Config) error {
+	/*
+		Apply a valid configuration: the API users including the users file, the allowed IPs, the rate limit, the push exporter and the logs.
+		The users are checked and the new logs are opened before the new push agent is prepared, and the logs are restored
+		when the push agent fails, so a configuration that fails is not applied at all.
+		The buffered batches of the previous push agent are carried over to the new one.
+		Changed keys that are only read on startup are logged, they take effect on the next restart.
+	*/
+	users, err := auth.NewStore(cfg.Users())
+	if err != nil {
+		return fmt.Errorf("invalid users: %w", err)
+	}
+	logsChanged := cfg.LogConfig() != r.current.LogConfig()
+	if logsChanged {
+		if err := logging.Configure(cfg.LogConfig(), r.stderr); err != nil {
+			return fmt.Errorf("invalid log configuration: %w", err)
+		}
+	}
+	exporter := r.push
+	pushChanged := cfg.PushConfig() != r.current.PushConfig()
+	if pushChanged {
+		next, err := newPushExporter(cfg.PushConfig())
+		if err != nil {
+			if logsChanged {
+				_ = logging.Configure(r.current.LogConfig(), r.stderr)
+			}
+			return fmt.Errorf("invalid push configuration: %w", err)
+		}
+		exporter = next
+	}
+
+	handlers.SetAccessControl(users, cfg.Auth.AllowedIPs)
+	if cfg.RateLimit != r.current.RateLimit {
+		// The request counts of the clients start over, so the limiter is only replaced when it changed
+		handlers.SetRateLimit(cfg.RateLimit.RequestsPerSecond, cfg.RateLimit.Burst)
+	}
+	if pushChanged {
+		r.push.handOver(exporter, cfg.Server.ShutdownTimeout.Value())
+		exporter.start()
+		r.push = exporter
+	}
+	r.current = cfg
+
+	for _, key := range restartRequired(r.started, cfg) {
+		slog.Warn("Configuration key changed, restart dh to apply it", "key", key)
+	}
+	return nil
+}
+
+func (r *reloader) currentConfig() *config.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+func (r *reloader) shutdown(ctx context.Context) error {
+	// Flush the current push exporter, a reload in progress completes first.
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.push.shutdown(ctx)
+}
+
+func restartRequired(started, cfg *config.Config) []string {
+	// List the keys changed since startup that are only read on startup.
+	var keys []string
+	if started.Server.Listen != cfg.Server.Listen {
+		keys = append(keys, "server.listen")
+	}
+	if started.Server.UI != cfg.Server.UI {
+		keys = append(keys, "server.ui")
+	}
+	if !reflect.DeepEqual(started.Collector, cfg.Collector) {
+		keys = append(keys, "collector")
+	}
+	if !reflect.DeepEqual(started.Aggregator, cfg.Aggregator) {
+		keys = append(keys, "aggregator")
+	}
+	if started.Retention.AgentStaleAfter != cfg.Retention.AgentStaleAfter {
+		keys = append(keys, "retention.agent_stale_after")
+	}
+	return keys
+}
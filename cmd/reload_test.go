@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/auth"
+	"vchan.in/doctor-metrics/config"
+	"vchan.in/doctor-metrics/handlers"
+	"vchan.in/doctor-metrics/logging"
+)
+
+const reloadConfig = `
+auth:
+  users:
+    - username: %s
+      password: s3cret
+  allowed_ips: [127.0.0.1]
+rate_limit:
+  requests_per_second: 10
+`
+
+func writeConfig(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write configuration: %v", err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	defer handlers.SetAccessControl(nil, nil)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, fmt.Sprintf(reloadConfig, "admin"))
+
+	source := &configSource{path: path}
+	cfg, err := source.load()
+	if !assert.NoError(t, err) {
+		return
+	}
+	r := newReloader(source, cfg, nil, io.Discard)
+
+	// A valid configuration replaces the current one.
+	writeConfig(t, path, fmt.Sprintf(reloadConfig, "ops")+"  burst: 20\n")
+	if assert.NoError(t, r.reload("test")) {
+		assert.Equal(t, []auth.User{{Username: "ops", Password: "s3cret"}}, r.current.Users())
+		assert.Equal(t, 20, r.current.RateLimit.Burst)
+	}
+
+	// An invalid configuration is rejected as a whole and the current one is kept.
+	writeConfig(t, path, fmt.Sprintf(reloadConfig, "ops:admin"))
+	err = r.reload("test")
+	var errs config.Errors
+	if assert.ErrorAs(t, err, &errs) {
+		assert.Equal(t, "auth.users[0].username", errs[0].Key)
+	}
+	assert.Equal(t, []auth.User{{Username: "ops", Password: "s3cret"}}, r.current.Users())
+}
+
+func TestReloadUsersFile(t *testing.T) {
+	// A reload reads the users file again, even when the configuration file did not change.
+	defer handlers.SetAccessControl(nil, nil)
+	dir := t.TempDir()
+	path, usersFile := filepath.Join(dir, "config.yaml"), filepath.Join(dir, "users")
+	writeConfig(t, path, "auth: {users_file: "+usersFile+", allowed_ips: [127.0.0.1]}\n")
+	hash, err := auth.Hash("s3cret", auth.SchemeBcrypt)
+	if err != nil {
+		t.Fatalf("Failed to hash the password: %v", err)
+	}
+	if err := auth.AddUser(usersFile, "admin", hash); err != nil {
+		t.Fatalf("Failed to add the user: %v", err)
+	}
+
+	source := &configSource{path: path}
+	cfg, err := source.load()
+	if !assert.NoError(t, err) {
+		return
+	}
+	r := newReloader(source, cfg, nil, io.Discard)
+
+	if err := auth.AddUser(usersFile, "ops", hash); err != nil {
+		t.Fatalf("Failed to add the user: %v", err)
+	}
+	if assert.NoError(t, r.reload("test")) {
+		assert.Equal(t, []auth.User{{Username: "admin", PasswordHash: hash}, {Username: "ops", PasswordHash: hash}}, r.current.Users())
+	}
+
+	// An invalid users file keeps the current users.
+	writeConfig(t, usersFile, "admin\n")
+	assert.Error(t, r.reload("test"))
+	assert.Len(t, r.current.Users(), 2)
+}
+
+func TestRestartRequired(t *testing.T) {
+	started, cfg := config.Default(), config.Default()
+	cfg.Auth.AllowedIPs = []string{"10.0.0.0/8"}
+	assert.Empty(t, restartRequired(started, cfg))
+
+	cfg.Server.Listen = ":9100"
+	cfg.Collector.Health.FlapChanges = 5
+	assert.Equal(t, []string{"server.listen", "collector"}, restartRequired(started, cfg))
+}
+
+func TestReloadLogs(t *testing.T) {
+	defer handlers.SetAccessControl(nil, nil)
+	defer slog.SetDefault(slog.Default())
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeConfig(t, path, fmt.Sprintf(reloadConfig, "admin"))
+
+	source := &configSource{path: path}
+	cfg, err := source.load()
+	if !assert.NoError(t, err) {
+		return
+	}
+	var out bytes.Buffer
+	r := newReloader(source, cfg, nil, &out)
+
+	// An audit log that cannot be opened rejects the whole configuration before a push agent is prepared.
+	bufferDir := filepath.Join(dir, "buffer")
+	push := "exporters: {push: {url: \"https://central:9095/api/ingest\", token: secret, buffer_dir: " + bufferDir + "}}\n"
+	writeConfig(t, path, fmt.Sprintf(reloadConfig, "ops")+push+"log: {audit: {file: "+filepath.Join(path, "audit.log")+"}}\n")
+	assert.ErrorContains(t, r.reload("test"), "invalid log configuration")
+	assert.Equal(t, []auth.User{{Username: "admin", Password: "s3cret"}}, r.current.Users())
+	assert.NoDirExists(t, bufferDir)
+
+	audit := filepath.Join(dir, "audit.log")
+	writeConfig(t, path, fmt.Sprintf(reloadConfig, "ops")+"log: {level: warn, audit: {file: "+audit+"}}\n")
+	if assert.NoError(t, r.reload("test")) {
+		defer logging.Close()
+		slog.Info("dropped")
+		slog.Warn("kept")
+		assert.NotContains(t, out.String(), "dropped")
+		assert.Contains(t, out.String(), "msg=kept")
+		assert.FileExists(t, audit)
+	}
+}
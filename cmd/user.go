@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+	"vchan.in/doctor-metrics/auth"
+)
+
+// Input of the passwords of dh user, replaced in tests.
+var stdin io.Reader = os.Stdin
+
+func user(args []string, stdout, stderr io.Writer) int {
+	/*
+		Add a user to the users file, or change the password of one, writing a bcrypt or argon2id hash.
+
+		dh user add grafana --file /etc/dh/users
+		echo "$PASSWORD" | dh user passwd grafana --scheme bcrypt
+
+		The password is read from the terminal without echo and confirmed, or from the first line of the standard input.
+		Function returns ExitError when the user already exists for add or does not exist for passwd.
+	*/
+	if len(args) == 0 || (args[0] != "add" && args[0] != "passwd") {
+		fmt.Fprint(stderr, "Usage: dh user add|passwd <username> [flags]\n")
+		return ExitUsage
+	}
+	action := args[0]
+	flags := newFlagSet("user "+action, stderr)
+	file := flags.String("file", os.Getenv("DM_USERS_FILE"), "Users file to update, created by add if missing (env: DM_USERS_FILE)")
+	scheme := flags.String("scheme", auth.SchemeArgon2id, "Password hashing scheme argon2id or bcrypt")
+
+	// The username may come before or after the flags
+	args = args[1:]
+	var username string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		username, args = args[0], args[1:]
+	}
+	if username == "" {
+		// Flags first, the username ends the flags
+		if err := flags.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return ExitOK
+			}
+			return ExitUsage
+		}
+		username, args = flags.Arg(0), flags.Args()[min(1, flags.NArg()):]
+	}
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	switch {
+	case username == "":
+		fmt.Fprintf(stderr, "dh user %s: missing username\n", action)
+		return ExitUsage
+	case *file == "":
+		fmt.Fprintf(stderr, "dh user %s: missing --file or DM_USERS_FILE\n", action)
+		return ExitUsage
+	case *scheme != auth.SchemeArgon2id && *scheme != auth.SchemeBcrypt:
+		fmt.Fprintf(stderr, "dh user %s: invalid scheme %q, expected argon2id or bcrypt\n", action, *scheme)
+		return ExitUsage
+	}
+
+	password, err := readPassword(stdin, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "dh user %s: %v\n", action, err)
+		return ExitError
+	}
+	hash, err := auth.Hash(password, *scheme)
+	if err == nil && action == "add" {
+		err = auth.AddUser(*file, username, hash)
+	} else if err == nil {
+		err = auth.SetPasswordHash(*file, username, hash)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "dh user %s: %v\n", action, err)
+		return ExitError
+	}
+	if action == "add" {
+		fmt.Fprintf(stdout, "User %s added to %s\n", username, *file)
+	} else {
+		fmt.Fprintf(stdout, "Password of %s changed in %s\n", username, *file)
+	}
+	return ExitOK
+}
+
+func readPassword(input io.Reader, prompt io.Writer) (string, error) {
+	// Read a password from the terminal twice without echo, or once from the first line of a pipe or file.
+	if file, ok := input.(*os.File); ok && term.IsTerminal(int(file.Fd())) {
+		fmt.Fprint(prompt, "Password: ")
+		password, err := term.ReadPassword(int(file.Fd()))
+		fmt.Fprintln(prompt)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprint(prompt, "Confirm password: ")
+		confirmation, err := term.ReadPassword(int(file.Fd()))
+		fmt.Fprintln(prompt)
+		if err != nil {
+			return "", err
+		}
+		if string(password) != string(confirmation) {
+			return "", errors.New("passwords do not match")
+		}
+		return checkPassword(string(password))
+	}
+
+	line, err := bufio.NewReader(input).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return checkPassword(strings.TrimRight(line, "\r\n"))
+}
+
+func checkPassword(password string) (string, error) {
+	if password == "" {
+		return "", errors.New("empty password")
+	}
+	return password, nil
+}
@@ -0,0 +1,282 @@
+// Package config loads the dh configuration from defaults, an optional YAML or TOML file,
+// environment variables and command line flags, in increasing order of precedence.
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"vchan.in/doctor-metrics/aggregator"
+	"vchan.in/doctor-metrics/auth"
+	"vchan.in/doctor-metrics/containerd"
+	"vchan.in/doctor-metrics/handlers"
+	"vchan.in/doctor-metrics/logging"
+	"vchan.in/doctor-metrics/push"
+)
+
+// Config struct to store the dh configuration.
+type Config struct {
+	Server     Server     `yaml:"server" toml:"server"`
+	Auth       Auth       `yaml:"auth" toml:"auth"`
+	RateLimit  RateLimit  `yaml:"rate_limit" toml:"rate_limit"`
+	Collector  Collector  `yaml:"collector" toml:"collector"`
+	Aggregator Aggregator `yaml:"aggregator" toml:"aggregator"`
+	Retention  Retention  `yaml:"retention" toml:"retention"`
+	Exporters  Exporters  `yaml:"exporters" toml:"exporters"`
+	Log        Log        `yaml:"log" toml:"log"`
+
+	sources   map[string]string // Where each key was set e.g. {"server.listen": "/etc/dh/config.yaml:2"}
+	fileUsers []auth.User       // Users read from auth.users_file
+}
+
+// Server struct to store the HTTP server configuration.
+type Server struct {
+	Listen          string   `yaml:"listen" toml:"listen"`                     // Listen address e.g. ":9095" or "127.0.0.1:9095"
+	WatchConfig     bool     `yaml:"watch_config" toml:"watch_config"`         // Whether changes to the configuration file are reloaded without SIGHUP
+	UI              bool     `yaml:"ui" toml:"ui"`                             // Whether the web dashboard is served at /ui
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"` // Time allowed to drain requests and flush the exporters on SIGTERM e.g. "15s"
+	DrainDelay      Duration `yaml:"drain_delay" toml:"drain_delay"`           // Time /readyz fails before the listener closes on SIGTERM e.g. "5s"
+}
+
+// Auth struct to store the users and client addresses allowed to use the API.
+type Auth struct {
+	Users      []User   `yaml:"users" toml:"users"`             // Basic authentication users
+	UsersFile  string   `yaml:"users_file" toml:"users_file"`   // htpasswd-style file of more users with hashed passwords e.g. "/etc/dh/users"
+	AllowedIPs []string `yaml:"allowed_ips" toml:"allowed_ips"` // Client IPs and CIDRs e.g. ["10.0.0.0/8", "127.0.0.1"]
+}
+
+// User struct to store the credentials of an API user, a password or the hash of one.
+type User struct {
+	Username     string `yaml:"username" toml:"username"`           // e.g. "admin"
+	Password     string `yaml:"password" toml:"password"`           // e.g. "s3cret"
+	PasswordHash string `yaml:"password_hash" toml:"password_hash"` // bcrypt or argon2id hash e.g. "$argon2id$v=19$m=19456,t=2,p=1$..."
+}
+
+// RateLimit struct to store the per-client request rate limit.
+type RateLimit struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second" toml:"requests_per_second"` // Sustained requests per second per client e.g. 5
+	Burst             int     `yaml:"burst" toml:"burst"`                             // Requests allowed at once, the rounded rate if 0
+}
+
+// Collector struct to store where container metrics are collected from.
+type Collector struct {
+	Runtime           string     `yaml:"runtime" toml:"runtime"`                         // One of "docker", "containerd", "podman"
+	ProcRoot          string     `yaml:"proc_root" toml:"proc_root"`                     // Mount point of the host procfs e.g. "/proc"
+	CgroupRoot        string     `yaml:"cgroup_root" toml:"cgroup_root"`                 // Mount point of the host cgroup filesystem e.g. "/sys/fs/cgroup"
+	SysRoot           string     `yaml:"sys_root" toml:"sys_root"`                       // Mount point of the host sysfs e.g. "/sys"
+	DockerDataRoot    string     `yaml:"docker_data_root" toml:"docker_data_root"`       // Directory whose filesystem usage is reported e.g. "/var/lib/docker"
+	DiskUsageInterval Duration   `yaml:"disk_usage_interval" toml:"disk_usage_interval"` // Time between two disk usage collections e.g. "5m"
+	Docker            Docker     `yaml:"docker" toml:"docker"`
+	Containerd        Containerd `yaml:"containerd" toml:"containerd"`
+	Podman            Podman     `yaml:"podman" toml:"podman"`
+	Health            Health     `yaml:"health" toml:"health"`
+}
+
+// Docker struct to store the Docker daemons collected through the Engine API.
+type Docker struct {
+	Endpoints       []Endpoint `yaml:"endpoints" toml:"endpoints"`               // Daemons to collect, the local docker CLI if empty
+	CertPath        string     `yaml:"cert_path" toml:"cert_path"`               // Directory with the TLS client certificates of tcp:// endpoints
+	TLSVerify       bool       `yaml:"tls_verify" toml:"tls_verify"`             // Whether tcp:// endpoints require TLS, with the certificates of ~/.docker if cert_path is empty
+	TLSSkipVerify   bool       `yaml:"tls_skip_verify" toml:"tls_skip_verify"`   // Whether the daemon certificate of tcp:// endpoints is not verified, not recommended
+	EndpointTimeout Duration   `yaml:"endpoint_timeout" toml:"endpoint_timeout"` // Timeout of each request to an endpoint e.g. "10s"
+}
+
+// Endpoint struct to store a Docker daemon address.
+type Endpoint struct {
+	Name string `yaml:"name" toml:"name"` // Host name the metrics are tagged with, the host of the address if empty e.g. "build-01"
+	Host string `yaml:"host" toml:"host"` // Daemon address e.g. "tcp://10.0.0.1:2376", "ssh://dh@10.0.0.2" or "unix:///var/run/docker.sock"
+}
+
+// Containerd struct to store the containerd runtime configuration.
+type Containerd struct {
+	Address    string   `yaml:"address" toml:"address"`       // containerd socket e.g. "/run/containerd/containerd.sock"
+	Namespaces []string `yaml:"namespaces" toml:"namespaces"` // Namespaces to collect, all if empty e.g. ["k8s.io"]
+}
+
+// Podman struct to store the Podman runtime configuration.
+type Podman struct {
+	Socket string `yaml:"socket" toml:"socket"` // Podman API socket e.g. "/run/podman/podman.sock"
+}
+
+// Health struct to store the healthcheck reporting configuration.
+type Health struct {
+	LogEntries   int      `yaml:"log_entries" toml:"log_entries"`     // Healthcheck results reported per container e.g. 5
+	FlapChanges  int      `yaml:"flap_changes" toml:"flap_changes"`   // Status changes within the interval above which a container is flapping e.g. 3
+	FlapInterval Duration `yaml:"flap_interval" toml:"flap_interval"` // Period status changes are counted over e.g. "10m"
+}
+
+// Aggregator struct to store the dh agents merged in aggregator mode.
+type Aggregator struct {
+	Upstreams       []Upstream    `yaml:"upstreams" toml:"upstreams"`               // Agents polled for their metrics
+	UpstreamTimeout Duration      `yaml:"upstream_timeout" toml:"upstream_timeout"` // Timeout of each request to an agent e.g. "10s"
+	IngestTokens    []IngestToken `yaml:"ingest_tokens" toml:"ingest_tokens"`       // Agents allowed to push their metrics
+}
+
+// Upstream struct to store a dh agent polled in aggregator mode.
+type Upstream struct {
+	Name     string `yaml:"name" toml:"name"`         // Host name the metrics are tagged with, the host of the URL if empty e.g. "web-01"
+	URL      string `yaml:"url" toml:"url"`           // Base URL of the agent e.g. "https://10.0.0.1:9095"
+	Username string `yaml:"username" toml:"username"` // Basic authentication username of the agent
+	Password string `yaml:"password" toml:"password"` // Basic authentication password of the agent
+}
+
+// IngestToken struct to store the token of an agent pushing its metrics.
+type IngestToken struct {
+	Name  string `yaml:"name" toml:"name"`   // Agent name the metrics are tagged with e.g. "edge-01"
+	Token string `yaml:"token" toml:"token"` // Bearer token of the agent
+}
+
+// Retention struct to store how long data is kept.
+type Retention struct {
+	AgentStaleAfter   Duration `yaml:"agent_stale_after" toml:"agent_stale_after"`     // Time after which the metrics of a silent agent are dropped e.g. "5m"
+	PushBufferBatches int      `yaml:"push_buffer_batches" toml:"push_buffer_batches"` // Undelivered batches kept by the push exporter e.g. 1000
+}
+
+// Exporters struct to store where collected metrics are sent.
+type Exporters struct {
+	Push Push `yaml:"push" toml:"push"`
+}
+
+// Push struct to store the push exporter configuration.
+type Push struct {
+	URL       string   `yaml:"url" toml:"url"`               // Ingest endpoint of a central dh, push is disabled if empty e.g. "https://central:9095/api/ingest"
+	Token     string   `yaml:"token" toml:"token"`           // Token of this agent on the central dh
+	Interval  Duration `yaml:"interval" toml:"interval"`     // Time between two batches e.g. "15s"
+	BufferDir string   `yaml:"buffer_dir" toml:"buffer_dir"` // Directory buffering undelivered batches, in memory if empty
+	CAFile    string   `yaml:"ca_file" toml:"ca_file"`       // PEM file with the CA certificates trusted for the central dh
+}
+
+// Log struct to store the logging configuration.
+type Log struct {
+	Level  string   `yaml:"level" toml:"level"`   // Minimum level of the logs, one of "debug", "info", "warn", "error", "fatal"
+	Format string   `yaml:"format" toml:"format"` // One of "text", "json"
+	Access bool     `yaml:"access" toml:"access"` // Whether every HTTP request is logged
+	Audit  AuditLog `yaml:"audit" toml:"audit"`
+}
+
+// AuditLog struct to store where the rejected requests are logged.
+type AuditLog struct {
+	File       string `yaml:"file" toml:"file"`               // Audit log file, the main log if empty e.g. "/var/log/dh/audit.log"
+	MaxSizeMB  int    `yaml:"max_size_mb" toml:"max_size_mb"` // Size in megabytes above which the file is rotated e.g. 100
+	MaxBackups int    `yaml:"max_backups" toml:"max_backups"` // Rotated files kept e.g. 5
+}
+
+// Duration is a duration in the format of time.ParseDuration e.g. "1m30s", checked by Validate.
+type Duration string
+
+// Value returns the duration, 0 if it is invalid.
+func (d Duration) Value() time.Duration {
+	value, _ := time.ParseDuration(string(d))
+	return value
+}
+
+// Override is a value set on the command line, which takes precedence over the file and the environment.
+type Override struct {
+	Key    string // Configuration key e.g. "server.listen"
+	Value  string // Value in the format of the matching environment variable e.g. ":8080"
+	Source string // Flag that set the value e.g. "--listen"
+}
+
+// Error is an invalid configuration value and where it was set.
+type Error struct {
+	Location string // File and line, environment variable or flag e.g. "/etc/dh/config.yaml:12" or "DM_PUSH_INTERVAL"
+	Key      string // Configuration key e.g. "exporters.push.interval"
+	Message  string // What is wrong e.g. "invalid duration \"15\""
+}
+
+func (e Error) Error() string {
+	if e.Key == "" {
+		return e.Location + ": " + e.Message
+	}
+	return e.Location + ": " + e.Key + ": " + e.Message
+}
+
+// Errors lists every problem found while loading a configuration.
+type Errors []Error
+
+func (e Errors) Error() string {
+	lines := make([]string, 0, len(e)+1)
+	lines = append(lines, fmt.Sprintf("invalid configuration, %d error(s):", len(e)))
+	for _, err := range e {
+		lines = append(lines, "  "+err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func Default() *Config {
+	// Default returns the configuration used when nothing else is set.
+	c := &Config{sources: make(map[string]string)}
+	c.Server.Listen = ":9095"
+	c.Server.UI = true
+	c.Server.ShutdownTimeout = "15s"
+	c.Server.DrainDelay = "0s"
+	c.RateLimit.RequestsPerSecond = 5
+	c.Collector.Runtime = "docker"
+	c.Collector.ProcRoot = "/proc"
+	c.Collector.CgroupRoot = "/sys/fs/cgroup"
+	c.Collector.SysRoot = "/sys"
+	c.Collector.DockerDataRoot = handlers.DefaultDockerDataRoot
+	c.Collector.DiskUsageInterval = Duration(handlers.DefaultDiskUsageInterval.String())
+	c.Collector.Containerd.Address = containerd.DefaultAddress
+	c.Collector.Podman.Socket = handlers.DefaultPodmanSocket()
+	c.Collector.Docker.EndpointTimeout = Duration(handlers.DefaultEndpointTimeout.String())
+	c.Collector.Health.LogEntries = handlers.DefaultHealthLogEntries
+	c.Collector.Health.FlapChanges = handlers.DefaultHealthFlapChanges
+	c.Collector.Health.FlapInterval = Duration(handlers.DefaultHealthFlapInterval.String())
+	c.Aggregator.UpstreamTimeout = Duration(aggregator.DefaultTimeout.String())
+	c.Retention.AgentStaleAfter = Duration(aggregator.DefaultStaleAfter.String())
+	c.Retention.PushBufferBatches = push.DefaultBufferMax
+	c.Exporters.Push.Interval = Duration(push.DefaultInterval.String())
+	c.Log.Level = "info"
+	c.Log.Format = logging.FormatText
+	c.Log.Access = true
+	c.Log.Audit.MaxSizeMB = logging.DefaultAuditMaxSizeMB
+	c.Log.Audit.MaxBackups = logging.DefaultAuditMaxBackups
+	return c
+}
+
+func Load(path string, lookupEnv func(string) (string, bool), overrides []Override) (*Config, error) {
+	/*
+		Load returns the configuration from the defaults, the file at path if it is not empty,
+		the environment variables found by lookupEnv and the overrides, each taking precedence over the previous ones.
+
+		The file format is YAML, or TOML for files ending in ".toml". Unknown keys are errors.
+		Function returns Errors listing every invalid value with where it was set, so all of them can be fixed at once.
+	*/
+	c := Default()
+	var errs Errors
+	if path != "" {
+		errs = append(errs, c.loadFile(path)...)
+	}
+	errs = append(errs, c.applyEnv(lookupEnv)...)
+	for _, override := range overrides {
+		if err := c.set(override.Key, override.Value, override.Source); err != nil {
+			errs = append(errs, *err)
+		}
+	}
+	errs = append(errs, c.loadUsersFile()...)
+	errs = append(errs, c.Validate()...)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return c, nil
+}
+
+func (c *Config) location(key string) string {
+	/*
+		Return where a key was set, walking up to its parents for keys set as a whole,
+		e.g. "auth.users[0].password" set through DM_USERNAME and DM_PASSWORD.
+	*/
+	for key != "" {
+		if source, ok := c.sources[key]; ok {
+			return source
+		}
+		if i := strings.LastIndexAny(key, ".["); i >= 0 {
+			key = key[:i]
+		} else {
+			key = ""
+		}
+	}
+	return "default"
+}
@@ -0,0 +1,241 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"vchan.in/doctor-metrics/aggregator"
+	"vchan.in/doctor-metrics/handlers"
+)
+
+// setting is a configuration key that can be set from an environment variable or a flag.
+type setting struct {
+	key   string                              // Configuration key e.g. "exporters.push.interval"
+	env   string                              // Environment variable e.g. "DM_PUSH_INTERVAL"
+	parse func(c *Config, value string) error // Sets the key from a value in the format of the environment variable
+}
+
+// Settings in the order they are applied, DM_USERNAME, DM_PASSWORD and DM_PASSWORD_HASH are handled by applyEnv.
+var settings = []setting{
+	{"server.listen", "DM_SERVER_PORT", parseListen},
+	{"server.watch_config", "DM_WATCH_CONFIG", boolValue(func(c *Config) *bool { return &c.Server.WatchConfig })},
+	{"server.ui", "DM_UI", boolValue(func(c *Config) *bool { return &c.Server.UI })},
+	{"server.shutdown_timeout", "DM_SHUTDOWN_TIMEOUT", durationValue(func(c *Config) *Duration { return &c.Server.ShutdownTimeout })},
+	{"server.drain_delay", "DM_DRAIN_DELAY", durationValue(func(c *Config) *Duration { return &c.Server.DrainDelay })},
+	{"auth.users_file", "DM_USERS_FILE", stringValue(func(c *Config) *string { return &c.Auth.UsersFile })},
+	{"auth.allowed_ips", "DM_ALLOWED_IPS", listValue(func(c *Config) *[]string { return &c.Auth.AllowedIPs })},
+	{"rate_limit.requests_per_second", "DM_RATE_LIMIT", floatValue(func(c *Config) *float64 { return &c.RateLimit.RequestsPerSecond })},
+	{"rate_limit.burst", "DM_RATE_BURST", intValue(func(c *Config) *int { return &c.RateLimit.Burst })},
+	{"collector.runtime", "DM_RUNTIME", stringValue(func(c *Config) *string { return &c.Collector.Runtime })},
+	{"collector.proc_root", "DM_PROC_ROOT", stringValue(func(c *Config) *string { return &c.Collector.ProcRoot })},
+	{"collector.cgroup_root", "DM_CGROUP_ROOT", stringValue(func(c *Config) *string { return &c.Collector.CgroupRoot })},
+	{"collector.sys_root", "DM_SYS_ROOT", stringValue(func(c *Config) *string { return &c.Collector.SysRoot })},
+	{"collector.docker_data_root", "DM_DOCKER_DATA_ROOT", stringValue(func(c *Config) *string { return &c.Collector.DockerDataRoot })},
+	{"collector.disk_usage_interval", "DM_DISK_USAGE_INTERVAL", durationValue(func(c *Config) *Duration { return &c.Collector.DiskUsageInterval })},
+	{"collector.docker.endpoints", "DM_DOCKER_ENDPOINTS", parseDockerEndpoints},
+	{"collector.docker.cert_path", "DOCKER_CERT_PATH", stringValue(func(c *Config) *string { return &c.Collector.Docker.CertPath })},
+	{"collector.docker.tls_verify", "DOCKER_TLS_VERIFY", parseTLSVerify},
+	{"collector.docker.tls_skip_verify", "DM_DOCKER_TLS_SKIP_VERIFY", boolValue(func(c *Config) *bool { return &c.Collector.Docker.TLSSkipVerify })},
+	{"collector.docker.endpoint_timeout", "DM_DOCKER_ENDPOINT_TIMEOUT", durationValue(func(c *Config) *Duration { return &c.Collector.Docker.EndpointTimeout })},
+	{"collector.containerd.address", "DM_CONTAINERD_ADDRESS", stringValue(func(c *Config) *string { return &c.Collector.Containerd.Address })},
+	{"collector.containerd.namespaces", "DM_CONTAINERD_NAMESPACES", listValue(func(c *Config) *[]string { return &c.Collector.Containerd.Namespaces })},
+	{"collector.podman.socket", "DM_PODMAN_SOCKET", stringValue(func(c *Config) *string { return &c.Collector.Podman.Socket })},
+	{"collector.health.log_entries", "DM_HEALTH_LOG_ENTRIES", intValue(func(c *Config) *int { return &c.Collector.Health.LogEntries })},
+	{"collector.health.flap_changes", "DM_HEALTH_FLAP_CHANGES", intValue(func(c *Config) *int { return &c.Collector.Health.FlapChanges })},
+	{"collector.health.flap_interval", "DM_HEALTH_FLAP_INTERVAL", durationValue(func(c *Config) *Duration { return &c.Collector.Health.FlapInterval })},
+	{"aggregator.upstreams", "DM_UPSTREAMS", parseUpstreams},
+	{"aggregator.upstream_timeout", "DM_UPSTREAM_TIMEOUT", durationValue(func(c *Config) *Duration { return &c.Aggregator.UpstreamTimeout })},
+	{"aggregator.ingest_tokens", "DM_INGEST_TOKENS", parseIngestTokens},
+	{"retention.agent_stale_after", "DM_INGEST_STALE_AFTER", durationValue(func(c *Config) *Duration { return &c.Retention.AgentStaleAfter })},
+	{"retention.push_buffer_batches", "DM_PUSH_BUFFER_MAX", intValue(func(c *Config) *int { return &c.Retention.PushBufferBatches })},
+	{"exporters.push.url", "DM_PUSH_URL", stringValue(func(c *Config) *string { return &c.Exporters.Push.URL })},
+	{"exporters.push.token", "DM_PUSH_TOKEN", stringValue(func(c *Config) *string { return &c.Exporters.Push.Token })},
+	{"exporters.push.interval", "DM_PUSH_INTERVAL", durationValue(func(c *Config) *Duration { return &c.Exporters.Push.Interval })},
+	{"exporters.push.buffer_dir", "DM_PUSH_BUFFER_DIR", stringValue(func(c *Config) *string { return &c.Exporters.Push.BufferDir })},
+	{"exporters.push.ca_file", "DM_PUSH_CA_FILE", stringValue(func(c *Config) *string { return &c.Exporters.Push.CAFile })},
+	{"log.level", "DM_LOG_LEVEL", stringValue(func(c *Config) *string { return &c.Log.Level })},
+	{"log.format", "DM_LOG_FORMAT", stringValue(func(c *Config) *string { return &c.Log.Format })},
+	{"log.access", "DM_ACCESS_LOG", boolValue(func(c *Config) *bool { return &c.Log.Access })},
+	{"log.audit.file", "DM_AUDIT_LOG", stringValue(func(c *Config) *string { return &c.Log.Audit.File })},
+	{"log.audit.max_size_mb", "DM_AUDIT_LOG_MAX_SIZE_MB", intValue(func(c *Config) *int { return &c.Log.Audit.MaxSizeMB })},
+	{"log.audit.max_backups", "DM_AUDIT_LOG_MAX_BACKUPS", intValue(func(c *Config) *int { return &c.Log.Audit.MaxBackups })},
+}
+
+func (c *Config) applyEnv(lookupEnv func(string) (string, bool)) Errors {
+	/*
+		Apply the environment variables over the current values, empty variables are ignored.
+		DM_USERNAME and DM_PASSWORD, or DM_PASSWORD_HASH, replace the users of the file with a single user.
+	*/
+	var errs Errors
+	username, _ := lookupEnv("DM_USERNAME")
+	password, _ := lookupEnv("DM_PASSWORD")
+	passwordHash, _ := lookupEnv("DM_PASSWORD_HASH")
+	if username != "" || password != "" || passwordHash != "" {
+		source := "DM_USERNAME"
+		switch {
+		case username != "":
+		case password != "":
+			source = "DM_PASSWORD"
+		default:
+			source = "DM_PASSWORD_HASH"
+		}
+		c.Auth.Users = []User{{Username: username, Password: password, PasswordHash: passwordHash}}
+		c.setSource("auth.users", source)
+	}
+
+	for _, s := range settings {
+		if value, _ := lookupEnv(s.env); value != "" {
+			if err := c.apply(s, value, s.env); err != nil {
+				errs = append(errs, *err)
+			}
+		}
+	}
+	return errs
+}
+
+func (c *Config) set(key, value, source string) *Error {
+	// Set a key from a flag, in the format of its environment variable.
+	for _, s := range settings {
+		if s.key == key {
+			return c.apply(s, value, source)
+		}
+	}
+	return &Error{Location: source, Key: key, Message: "unknown key"}
+}
+
+func (c *Config) apply(s setting, value, source string) *Error {
+	if err := s.parse(c, value); err != nil {
+		return &Error{Location: source, Key: s.key, Message: err.Error()}
+	}
+	c.setSource(s.key, source)
+	return nil
+}
+
+func (c *Config) setSource(key, source string) {
+	// Record where a key was set, forgetting the locations of the list entries and keys it replaced.
+	for existing := range c.sources {
+		if strings.HasPrefix(existing, key+".") || strings.HasPrefix(existing, key+"[") {
+			delete(c.sources, existing)
+		}
+	}
+	c.sources[key] = source
+}
+
+func stringValue(field func(c *Config) *string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func durationValue(field func(c *Config) *Duration) func(c *Config, value string) error {
+	// Durations are checked by Validate, like the durations of the file.
+	return func(c *Config, value string) error {
+		*field(c) = Duration(value)
+		return nil
+	}
+}
+
+func intValue(field func(c *Config) *int) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+func boolValue(field func(c *Config) *bool) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q, expected true or false", value)
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+func floatValue(field func(c *Config) *float64) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+func listValue(field func(c *Config) *[]string) func(c *Config, value string) error {
+	// Split a comma-separated list, ignoring empty entries.
+	return func(c *Config, value string) error {
+		var list []string
+		for _, entry := range strings.Split(value, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				list = append(list, entry)
+			}
+		}
+		*field(c) = list
+		return nil
+	}
+}
+
+func parseTLSVerify(c *Config, value string) error {
+	// Like the docker CLI, any non-empty DOCKER_TLS_VERIFY requires TLS.
+	c.Collector.Docker.TLSVerify = value != ""
+	return nil
+}
+
+func parseListen(c *Config, value string) error {
+	// DM_SERVER_PORT is a port e.g. "9095", a full listen address e.g. "127.0.0.1:9095" is accepted as well.
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, ":") {
+		value = ":" + value
+	}
+	c.Server.Listen = value
+	return nil
+}
+
+func parseDockerEndpoints(c *Config, value string) error {
+	endpoints, err := handlers.ParseDockerEndpoints(value, handlers.DockerTLS{})
+	if err != nil {
+		return err
+	}
+	c.Collector.Docker.Endpoints = nil
+	for _, endpoint := range endpoints {
+		c.Collector.Docker.Endpoints = append(c.Collector.Docker.Endpoints, Endpoint{Name: endpoint.Name, Host: endpoint.Host})
+	}
+	return nil
+}
+
+func parseUpstreams(c *Config, value string) error {
+	upstreams, err := aggregator.ParseUpstreams(value)
+	if err != nil {
+		return err
+	}
+	c.Aggregator.Upstreams = nil
+	for _, upstream := range upstreams {
+		c.Aggregator.Upstreams = append(c.Aggregator.Upstreams, Upstream(upstream))
+	}
+	return nil
+}
+
+func parseIngestTokens(c *Config, value string) error {
+	tokens, err := aggregator.ParseIngestTokens(value)
+	if err != nil {
+		return err
+	}
+	c.Aggregator.IngestTokens = nil
+	for name, token := range tokens {
+		c.Aggregator.IngestTokens = append(c.Aggregator.IngestTokens, IngestToken{Name: name, Token: token})
+	}
+	sort.Slice(c.Aggregator.IngestTokens, func(i, j int) bool {
+		return c.Aggregator.IngestTokens[i].Name < c.Aggregator.IngestTokens[j].Name
+	})
+	return nil
+}
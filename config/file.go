@@ -0,0 +1,133 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"vchan.in/doctor-metrics/auth"
+)
+
+// Line prefix of the errors in a yaml.TypeError e.g. "line 3: field listn not found in type config.Server".
+var yamlErrorLine = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+func (c *Config) loadFile(path string) Errors {
+	// Decode a YAML or TOML file over the current values and record where each key was set.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Errors{{Location: path, Message: err.Error()}}
+	}
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		return c.loadTOML(path, data)
+	}
+	return c.loadYAML(path, data)
+}
+
+func (c *Config) loadUsersFile() Errors {
+	// Read the users of auth.users_file, an invalid entry is reported with its line in the users file.
+	if c.Auth.UsersFile == "" {
+		return nil
+	}
+	users, err := auth.ReadUsersFile(c.Auth.UsersFile)
+	var lineErr *auth.LineError
+	switch {
+	case errors.As(err, &lineErr):
+		return Errors{{Location: fmt.Sprintf("%s:%d", c.Auth.UsersFile, lineErr.Line), Message: lineErr.Err.Error()}}
+	case err != nil:
+		return Errors{{Location: c.location("auth.users_file"), Key: "auth.users_file", Message: err.Error()}}
+	}
+	c.fileUsers = users
+	return nil
+}
+
+func (c *Config) loadYAML(path string, data []byte) Errors {
+	/*
+		Decode a YAML file, rejecting unknown keys.
+		yaml.v3 reports every type error and unknown key of a document at once, each with its line.
+	*/
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return Errors{yamlError(path, err.Error())}
+	}
+	if len(root.Content) == 0 {
+		return nil // Empty file
+	}
+	recordYAMLSources(c.sources, path, "", root.Content[0])
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err := decoder.Decode(c)
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		var errs Errors
+		for _, message := range typeErr.Errors {
+			errs = append(errs, yamlError(path, message))
+		}
+		return errs
+	}
+	if err != nil {
+		return Errors{yamlError(path, err.Error())}
+	}
+	return nil
+}
+
+func yamlError(path, message string) Error {
+	// Move the line of a yaml error message into the location.
+	message = strings.TrimPrefix(message, "yaml: ")
+	if match := yamlErrorLine.FindStringSubmatch(message); match != nil {
+		return Error{Location: path + ":" + match[1], Message: match[2]}
+	}
+	return Error{Location: path, Message: message}
+}
+
+func recordYAMLSources(sources map[string]string, path, key string, node *yaml.Node) {
+	// Record the line of every key and list entry of a YAML node, e.g. "auth.users[1].password".
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			child := node.Content[i].Value
+			if key != "" {
+				child = key + "." + child
+			}
+			sources[child] = fmt.Sprintf("%s:%d", path, node.Content[i].Line)
+			recordYAMLSources(sources, path, child, node.Content[i+1])
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			child := key + "[" + strconv.Itoa(i) + "]"
+			sources[child] = fmt.Sprintf("%s:%d", path, item.Line)
+			recordYAMLSources(sources, path, child, item)
+		}
+	}
+}
+
+func (c *Config) loadTOML(path string, data []byte) Errors {
+	/*
+		Decode a TOML file, rejecting unknown keys.
+		Syntax and type errors carry their line, other values are located by file and key.
+	*/
+	meta, err := toml.Decode(string(data), c)
+	var parseErr toml.ParseError
+	if errors.As(err, &parseErr) {
+		return Errors{{Location: fmt.Sprintf("%s:%d", path, parseErr.Position.Line), Message: parseErr.Message}}
+	}
+	if err != nil {
+		return Errors{{Location: path, Message: err.Error()}}
+	}
+
+	for _, key := range meta.Keys() {
+		c.sources[strings.Join(key, ".")] = path
+	}
+	var errs Errors
+	for _, key := range meta.Undecoded() {
+		errs = append(errs, Error{Location: path, Key: key.String(), Message: "unknown key"})
+	}
+	return errs
+}
@@ -0,0 +1,297 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"vchan.in/doctor-metrics/aggregator"
+	"vchan.in/doctor-metrics/auth"
+	"vchan.in/doctor-metrics/handlers"
+	"vchan.in/doctor-metrics/logging"
+	"vchan.in/doctor-metrics/push"
+)
+
+// Container runtimes metrics can be collected from.
+var runtimes = map[string]bool{"docker": true, "containerd": true, "podman": true}
+
+func (c *Config) Validate() Errors {
+	/*
+		Validate checks every value and returns all problems found, each with where the value was set.
+		An empty result means the configuration can be used.
+	*/
+	var errs Errors
+	fail := func(key, format string, args ...any) {
+		errs = append(errs, Error{Location: c.location(key), Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	_, port, err := net.SplitHostPort(c.Server.Listen)
+	if number, portErr := strconv.Atoi(port); err != nil || portErr != nil || number < 0 || number > 65535 {
+		fail("server.listen", "invalid listen address %q, expected host:port or :port", c.Server.Listen)
+	}
+
+	if len(c.Auth.Users) == 0 && len(c.fileUsers) == 0 {
+		fail("auth.users", "at least one user is required, set DM_USERNAME and DM_PASSWORD, auth.users or auth.users_file")
+	}
+	usernames := make(map[string]bool)
+	for i, user := range c.Auth.Users {
+		key := fmt.Sprintf("auth.users[%d]", i)
+		switch {
+		case user.Username == "":
+			fail(key+".username", "must not be empty")
+		case strings.Contains(user.Username, ":"):
+			fail(key+".username", "must not contain \":\"")
+		case usernames[user.Username]:
+			fail(key+".username", "duplicate user %q", user.Username)
+		}
+		usernames[user.Username] = true
+		switch {
+		case user.Password == "" && user.PasswordHash == "":
+			fail(key+".password", "must not be empty")
+		case user.Password != "" && user.PasswordHash != "":
+			fail(key+".password_hash", "must not be set with password")
+		case user.PasswordHash != "":
+			if err := auth.CheckHash(user.PasswordHash); err != nil {
+				fail(key+".password_hash", "%v", err)
+			}
+		}
+	}
+	for _, user := range c.fileUsers {
+		if usernames[user.Username] {
+			fail("auth.users_file", "duplicate user %q", user.Username)
+		}
+		usernames[user.Username] = true
+	}
+	if len(c.Auth.AllowedIPs) == 0 {
+		fail("auth.allowed_ips", "at least one IP or CIDR is required, set DM_ALLOWED_IPS or auth.allowed_ips")
+	}
+	for i, entry := range c.Auth.AllowedIPs {
+		if net.ParseIP(entry) == nil {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				fail(fmt.Sprintf("auth.allowed_ips[%d]", i), "invalid IP or CIDR %q", entry)
+			}
+		}
+	}
+
+	if c.RateLimit.RequestsPerSecond <= 0 {
+		fail("rate_limit.requests_per_second", "must be greater than 0")
+	}
+	if c.RateLimit.Burst < 0 {
+		fail("rate_limit.burst", "must not be negative")
+	} else if c.RateLimit.Burst == 0 && c.RateLimit.RequestsPerSecond > 0 && c.RateLimit.RequestsPerSecond < 1 {
+		fail("rate_limit.burst", "must be set when requests_per_second is below 1")
+	}
+
+	if !runtimes[c.Collector.Runtime] {
+		fail("collector.runtime", "unknown container runtime %q, expected docker, containerd or podman", c.Collector.Runtime)
+	}
+	names := make(map[string]bool)
+	for i, endpoint := range c.Collector.Docker.Endpoints {
+		key := fmt.Sprintf("collector.docker.endpoints[%d]", i)
+		parsed, err := handlers.ParseDockerEndpoints(endpointEntry(endpoint), handlers.DockerTLS{})
+		if err != nil {
+			fail(key, "%v", err)
+			continue
+		}
+		if names[parsed[0].Name] {
+			fail(key, "duplicate Docker endpoint name %q", parsed[0].Name)
+		}
+		names[parsed[0].Name] = true
+	}
+	if c.Collector.Docker.TLSVerify && c.Collector.Docker.TLSSkipVerify {
+		fail("collector.docker.tls_skip_verify", "must not be set with collector.docker.tls_verify")
+	} else if _, err := c.DockerEndpoints(); err != nil && len(names) == len(c.Collector.Docker.Endpoints) {
+		// Endpoints are valid on their own, only the certificates required by tls_verify can be missing
+		fail("collector.docker.cert_path", "%v", err)
+	}
+	if c.Collector.Health.LogEntries < 0 {
+		fail("collector.health.log_entries", "must not be negative")
+	}
+	if c.Collector.Health.FlapChanges <= 0 {
+		fail("collector.health.flap_changes", "must be greater than 0")
+	}
+
+	names = make(map[string]bool)
+	for i, upstream := range c.Aggregator.Upstreams {
+		key := fmt.Sprintf("aggregator.upstreams[%d]", i)
+		parsed, err := upstream.resolve()
+		if err != nil {
+			fail(key, "%v", err)
+			continue
+		}
+		if names[parsed.Name] {
+			fail(key, "duplicate upstream name %q", parsed.Name)
+		}
+		names[parsed.Name] = true
+	}
+	names = make(map[string]bool)
+	tokens := make(map[string]bool)
+	for i, token := range c.Aggregator.IngestTokens {
+		key := fmt.Sprintf("aggregator.ingest_tokens[%d]", i)
+		switch {
+		case token.Name == "":
+			fail(key+".name", "must not be empty")
+		case names[token.Name]:
+			fail(key+".name", "duplicate agent name %q", token.Name)
+		}
+		switch {
+		case token.Token == "":
+			fail(key+".token", "must not be empty")
+		case tokens[token.Token]:
+			fail(key+".token", "token of agent %q is used by another agent", token.Name)
+		}
+		names[token.Name], tokens[token.Token] = true, true
+	}
+
+	if c.Retention.PushBufferBatches <= 0 {
+		fail("retention.push_buffer_batches", "must be greater than 0")
+	}
+	if c.Exporters.Push.URL != "" {
+		if parsed, err := url.Parse(c.Exporters.Push.URL); err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			fail("exporters.push.url", "invalid push URL %q, expected https://host:port/api/ingest", c.Exporters.Push.URL)
+		}
+		if c.Exporters.Push.Token == "" {
+			fail("exporters.push.token", "must be set when exporters.push.url is set")
+		}
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		fail("log.level", "%v", err)
+	}
+	if c.Log.Format != logging.FormatText && c.Log.Format != logging.FormatJSON {
+		fail("log.format", "unknown log format %q, expected text or json", c.Log.Format)
+	}
+	if c.Log.Audit.MaxSizeMB <= 0 {
+		fail("log.audit.max_size_mb", "must be greater than 0")
+	}
+	if c.Log.Audit.MaxBackups < 0 {
+		fail("log.audit.max_backups", "must not be negative")
+	}
+
+	durations := []struct {
+		key   string
+		value Duration
+	}{
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+		{"collector.disk_usage_interval", c.Collector.DiskUsageInterval},
+		{"collector.docker.endpoint_timeout", c.Collector.Docker.EndpointTimeout},
+		{"collector.health.flap_interval", c.Collector.Health.FlapInterval},
+		{"aggregator.upstream_timeout", c.Aggregator.UpstreamTimeout},
+		{"retention.agent_stale_after", c.Retention.AgentStaleAfter},
+		{"exporters.push.interval", c.Exporters.Push.Interval},
+	}
+	for _, d := range durations {
+		if d.value.Value() <= 0 {
+			fail(d.key, "invalid duration %q, expected a positive duration e.g. \"30s\" or \"5m\"", string(d.value))
+		}
+	}
+	// The drain delay is optional, 0 closes the listener right away
+	if delay, err := time.ParseDuration(string(c.Server.DrainDelay)); err != nil || delay < 0 {
+		fail("server.drain_delay", "invalid duration %q, expected 0 or a positive duration e.g. \"5s\"", string(c.Server.DrainDelay))
+	}
+	return errs
+}
+
+func endpointEntry(endpoint Endpoint) string {
+	// Format an endpoint like an entry of DM_DOCKER_ENDPOINTS.
+	if endpoint.Name == "" {
+		return endpoint.Host
+	}
+	return endpoint.Name + "=" + endpoint.Host
+}
+
+func (u Upstream) resolve() (aggregator.Upstream, error) {
+	// Resolve the name and credentials of an upstream like an entry of DM_UPSTREAMS.
+	entry := u.URL
+	if u.Name != "" {
+		entry = u.Name + "=" + u.URL
+	}
+	upstreams, err := aggregator.ParseUpstreams(entry)
+	if err != nil {
+		return aggregator.Upstream{}, err
+	}
+	upstream := upstreams[0]
+	if u.Username != "" || u.Password != "" {
+		upstream.Username, upstream.Password = u.Username, u.Password
+	}
+	return upstream, nil
+}
+
+func (c *Config) DockerEndpoints() ([]handlers.DockerEndpoint, error) {
+	// DockerEndpoints returns the Docker daemons to collect through the Engine API, none for the local docker CLI.
+	if len(c.Collector.Docker.Endpoints) == 0 {
+		return nil, nil
+	}
+	entries := make([]string, 0, len(c.Collector.Docker.Endpoints))
+	for _, endpoint := range c.Collector.Docker.Endpoints {
+		entries = append(entries, endpointEntry(endpoint))
+	}
+	return handlers.ParseDockerEndpoints(strings.Join(entries, ","), c.DockerTLS())
+}
+
+func (c *Config) DockerTLS() handlers.DockerTLS {
+	// DockerTLS returns the TLS configuration of the tcp:// Docker endpoints and of a tcp:// DOCKER_HOST.
+	return handlers.DockerTLS{
+		CertPath:   c.Collector.Docker.CertPath,
+		Verify:     c.Collector.Docker.TLSVerify,
+		SkipVerify: c.Collector.Docker.TLSSkipVerify,
+	}
+}
+
+func (c *Config) Upstreams() ([]aggregator.Upstream, error) {
+	// Upstreams returns the agents polled in aggregator mode.
+	var upstreams []aggregator.Upstream
+	for _, u := range c.Aggregator.Upstreams {
+		upstream, err := u.resolve()
+		if err != nil {
+			return nil, err
+		}
+		upstreams = append(upstreams, upstream)
+	}
+	return upstreams, nil
+}
+
+func (c *Config) IngestTokens() map[string]string {
+	// IngestTokens returns the tokens of the agents allowed to push metrics, keyed by agent name.
+	tokens := make(map[string]string, len(c.Aggregator.IngestTokens))
+	for _, token := range c.Aggregator.IngestTokens {
+		tokens[token.Name] = token.Token
+	}
+	return tokens
+}
+
+func (c *Config) Users() []auth.User {
+	// Users returns the API users of auth.users followed by the ones of auth.users_file.
+	users := make([]auth.User, 0, len(c.Auth.Users)+len(c.fileUsers))
+	for _, user := range c.Auth.Users {
+		users = append(users, auth.User(user))
+	}
+	return append(users, c.fileUsers...)
+}
+
+func (c *Config) LogConfig() logging.Config {
+	// LogConfig returns the configuration of the main, access and audit logs.
+	return logging.Config{
+		Level:           c.Log.Level,
+		Format:          c.Log.Format,
+		Access:          c.Log.Access,
+		AuditFile:       c.Log.Audit.File,
+		AuditMaxSizeMB:  c.Log.Audit.MaxSizeMB,
+		AuditMaxBackups: c.Log.Audit.MaxBackups,
+	}
+}
+
+func (c *Config) PushConfig() push.Config {
+	// PushConfig returns the configuration of the push exporter, which is disabled if the URL is empty.
+	return push.Config{
+		URL:       c.Exporters.Push.URL,
+		Token:     c.Exporters.Push.Token,
+		CAFile:    c.Exporters.Push.CAFile,
+		Interval:  c.Exporters.Push.Interval.Value(),
+		BufferDir: c.Exporters.Push.BufferDir,
+		BufferMax: c.Retention.PushBufferBatches,
+	}
+}
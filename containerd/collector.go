@@ -0,0 +1,501 @@
+package containerd
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cgroup1 "github.com/containerd/cgroups/v3/cgroup1/stats"
+	cgroup2 "github.com/containerd/cgroups/v3/cgroup2/stats"
+	containersapi "github.com/containerd/containerd/api/services/containers/v1"
+	imagesapi "github.com/containerd/containerd/api/services/images/v1"
+	namespacesapi "github.com/containerd/containerd/api/services/namespaces/v1"
+	tasksapi "github.com/containerd/containerd/api/services/tasks/v1"
+	apitypes "github.com/containerd/containerd/api/types"
+	"github.com/containerd/containerd/api/types/task"
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/anypb"
+	"vchan.in/doctor-metrics/procfs"
+	"vchan.in/doctor-metrics/selfmetrics"
+	"vchan.in/doctor-metrics/types"
+)
+
+// Labels set by nerdctl on the containers it creates.
+const (
+	nameLabel          = "nerdctl/name"
+	restartPolicyLabel = "containerd.io/restart.policy"
+	restartCountLabel  = "containerd.io/restart.count"
+)
+
+// Metadata key selecting the containerd namespace of a request.
+const namespaceHeader = "containerd-namespace"
+
+// DefaultAddress is the containerd socket on most distributions.
+const DefaultAddress = "/run/containerd/containerd.sock"
+
+// CPU samples older than this are not used to compute the CPU usage percentage and are discarded,
+// like the samples of the Podman collector and of the process sampler.
+const maxSampleAge = time.Minute
+
+// cpuSample is the cumulative CPU time of a task at a point in time.
+type cpuSample struct {
+	usage    uint64    // Cumulative CPU time in nanoseconds
+	at       time.Time // Time containerd took the sample
+	recorded time.Time // Time the sample was received, used to discard old samples
+}
+
+// Collector collects container metrics from the containerd gRPC API.
+type Collector struct {
+	conn       *grpc.ClientConn
+	containers containersapi.ContainersClient
+	tasks      tasksapi.TasksClient
+	images     imagesapi.ImagesClient
+	namespaces namespacesapi.NamespacesClient
+
+	namespaceList  []string      // Namespaces to collect, all namespaces if empty
+	sampleInterval time.Duration // Wait between two CPU samples when no recent sample exists
+	fs             procfs.FS
+
+	mu      sync.Mutex
+	samples map[string]cpuSample // Last CPU sample by namespace and container ID
+}
+
+func NewCollector(address string, namespaces []string) (*Collector, error) {
+	/*
+		NewCollector returns a collector for the containerd socket at address, e.g. "/run/containerd/containerd.sock".
+
+		Containers are collected from the given namespaces, or from every namespace when none are given.
+		The connection is established lazily, so a missing socket is only reported by the first collection.
+	*/
+	conn, err := grpc.NewClient("unix://"+address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	return &Collector{
+		conn:           conn,
+		containers:     containersapi.NewContainersClient(conn),
+		tasks:          tasksapi.NewTasksClient(conn),
+		images:         imagesapi.NewImagesClient(conn),
+		namespaces:     namespacesapi.NewNamespacesClient(conn),
+		namespaceList:  namespaces,
+		sampleInterval: time.Second,
+		fs:             procfs.NewFS(),
+		samples:        make(map[string]cpuSample),
+	}, nil
+}
+
+func (c *Collector) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Collector) Ping(ctx context.Context) error {
+	// Listing the namespaces is the cheapest request that needs containerd to answer.
+	_, err := c.namespaces.List(ctx, &namespacesapi.ListNamespacesRequest{})
+	return err
+}
+
+func (c *Collector) listNamespaces(ctx context.Context) ([]string, error) {
+	if len(c.namespaceList) > 0 {
+		return c.namespaceList, nil
+	}
+	response, err := c.namespaces.List(ctx, &namespacesapi.ListNamespacesRequest{})
+	if err != nil {
+		return nil, err
+	}
+	var namespaces []string
+	for _, namespace := range response.Namespaces {
+		namespaces = append(namespaces, namespace.Name)
+	}
+	return namespaces, nil
+}
+
+func (c *Collector) Collect(ctx context.Context, filter types.ContainerFilter) (_ []types.ContainerMetrics, err error) {
+	/*
+		Collect metrics for all containers matching the filter in the configured namespaces, including stopped ones.
+
+		Containers are listed with their tasks first, so excluded containers are never sampled.
+		Function returns the metrics of every matching container in no particular order.
+	*/
+	defer selfmetrics.ObserveCollection("containerd", time.Now(), &err)
+	namespaces, err := c.listNamespaces(ctx)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve containerd namespaces")
+	}
+
+	listMetrics := []types.ContainerMetrics{}
+	for _, namespace := range namespaces {
+		metrics, err := c.collectNamespace(metadata.AppendToOutgoingContext(ctx, namespaceHeader, namespace), namespace, filter)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve container metrics")
+		}
+		listMetrics = append(listMetrics, metrics...)
+	}
+	return listMetrics, nil
+}
+
+func (c *Collector) CollectContainer(ctx context.Context, idOrName string) (types.ContainerMetrics, error) {
+	/*
+		Collect metrics for a single container by full ID, name or ID prefix, in that order like Docker.
+
+		A prefix matches only if a single container ID starts with it.
+		Function returns an HTTP 400 error for an ambiguous prefix and an HTTP 404 error when no container matches.
+	*/
+	listMetrics, err := c.Collect(ctx, types.ContainerFilter{})
+	if err != nil {
+		return types.ContainerMetrics{}, err
+	}
+	for _, metrics := range listMetrics {
+		if metrics.ContainerID == shortID(idOrName) {
+			return metrics, nil
+		}
+	}
+	for _, metrics := range listMetrics {
+		if metrics.ContainerName == idOrName {
+			return metrics, nil
+		}
+	}
+	var matches []types.ContainerMetrics
+	for _, metrics := range listMetrics {
+		if strings.HasPrefix(metrics.ContainerID, idOrName) {
+			matches = append(matches, metrics)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return types.ContainerMetrics{}, echo.NewHTTPError(http.StatusNotFound, "Container not found")
+	case 1:
+		return matches[0], nil
+	}
+	return types.ContainerMetrics{}, echo.NewHTTPError(http.StatusBadRequest, "Ambiguous container ID prefix "+idOrName)
+}
+
+func (c *Collector) collectNamespace(ctx context.Context, namespace string, filter types.ContainerFilter) ([]types.ContainerMetrics, error) {
+	containers, err := c.containers.List(ctx, &containersapi.ListContainersRequest{})
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := c.tasks.List(ctx, &tasksapi.ListTasksRequest{})
+	if err != nil {
+		return nil, err
+	}
+	processes := make(map[string]*task.Process)
+	for _, process := range tasks.Tasks {
+		id := process.ContainerID
+		if id == "" {
+			id = process.ID
+		}
+		processes[id] = process
+	}
+
+	now := time.Now()
+	var selected []types.ContainerMetrics
+	var ids []string
+	var pids []int
+	for _, container := range containers.Containers {
+		metrics := types.ContainerMetrics{
+			Timestamp:              now.UTC().Format(time.RFC3339),
+			ContainerID:            shortID(container.ID),
+			ContainerName:          container.ID,
+			ContainerNamespace:     namespace,
+			ContainerImage:         container.Image,
+			ContainerLabels:        container.Labels,
+			ContainerState:         "created",
+			ContainerRestartPolicy: "no",
+		}
+		if name := container.Labels[nameLabel]; name != "" {
+			metrics.ContainerName = name
+		}
+		if policy := container.Labels[restartPolicyLabel]; policy != "" {
+			metrics.ContainerRestartPolicy = policy
+		}
+		metrics.ContainerRestartCount, _ = strconv.Atoi(container.Labels[restartCountLabel])
+		if container.CreatedAt != nil {
+			metrics.ContainerCreatedAt = container.CreatedAt.AsTime().UTC().Format(time.RFC3339)
+		}
+
+		pid := 0
+		if process, ok := processes[container.ID]; ok {
+			metrics.ContainerState = taskState(process.Status)
+			if process.Status == task.Status_STOPPED {
+				metrics.ContainerExitCode = int(process.ExitStatus)
+			} else {
+				pid = int(process.Pid)
+			}
+		}
+		if !filter.Matches(metrics.ContainerLabels, metrics.ContainerState) {
+			continue
+		}
+		metrics.Active = metrics.ContainerState == "running"
+		selected = append(selected, metrics)
+		ids = append(ids, container.ID)
+		pids = append(pids, pid)
+	}
+	if len(selected) == 0 {
+		return nil, nil
+	}
+
+	// Sample the task cgroups, and sample again after a short wait if a container has no recent sample to compare with.
+	usage, err := c.sampleMetrics(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	memTotal := c.memTotal()
+	cpus, _ := c.fs.CPUCount()
+	digests := make(map[string]string)
+	for i := range selected {
+		metrics := &selected[i]
+		if sample, ok := usage[ids[i]]; ok {
+			applyMetric(metrics, sample.data, memTotal)
+			metrics.ContainerCpuUsagePercent = sample.cpuPercent
+			metrics.SetHostShare(cpus, memTotal)
+		}
+		if pid := pids[i]; pid > 0 {
+			if rx, tx, err := c.fs.NetworkTotals(pid); err == nil {
+				metrics.ContainerNetworkReceiveBytesTotal = rx
+				metrics.ContainerNetworkTransmitBytesTotal = tx
+			}
+			if startedAt, err := c.fs.StartTime(pid); err == nil {
+				metrics.ContainerStartedAt = startedAt.Format(time.RFC3339)
+				if metrics.Active {
+					metrics.ContainerUptimeSeconds = int64(now.Sub(startedAt).Seconds())
+				}
+			}
+			if open, err := c.fs.OpenFDs(pid); err == nil {
+				metrics.ContainerOpenFDs = open
+			}
+			if limit, err := c.fs.NofileLimit(pid); err == nil {
+				metrics.ContainerFDLimit = limit
+			}
+			if connections, err := c.fs.TCPConnections(pid); err == nil {
+				metrics.ContainerTCPConnections = &connections
+			}
+		}
+		if metrics.ContainerImage != "" {
+			if _, ok := digests[metrics.ContainerImage]; !ok {
+				digests[metrics.ContainerImage] = c.imageDigest(ctx, metrics.ContainerImage)
+			}
+			metrics.ContainerImageID = digests[metrics.ContainerImage]
+			if metrics.ContainerImageID != "" {
+				repository, _, _ := strings.Cut(metrics.ContainerImage, ":")
+				metrics.ContainerImageDigest = repository + "@" + metrics.ContainerImageID
+			}
+		}
+	}
+	return selected, nil
+}
+
+// taskSample is the latest cgroup metrics of a task and its CPU usage percentage since the previous sample.
+type taskSample struct {
+	data       *anypb.Any
+	cpuPercent float64
+}
+
+func (c *Collector) sampleMetrics(ctx context.Context, namespace string) (map[string]taskSample, error) {
+	response, err := c.tasks.Metrics(ctx, &tasksapi.MetricsRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	stale := false
+	for _, metric := range response.Metrics {
+		sample, ok := c.samples[namespace+"/"+metric.ID]
+		if !ok || time.Since(sample.recorded) > maxSampleAge {
+			stale = true
+			break
+		}
+	}
+	c.mu.Unlock()
+	if stale {
+		c.record(namespace, response.Metrics)
+		select {
+		case <-time.After(c.sampleInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if response, err = c.tasks.Metrics(ctx, &tasksapi.MetricsRequest{}); err != nil {
+			return nil, err
+		}
+	}
+	return c.record(namespace, response.Metrics), nil
+}
+
+func (c *Collector) record(namespace string, metrics []*apitypes.Metric) map[string]taskSample {
+	/*
+		Store the CPU time of each task and compute the CPU usage percentage since the previous sample,
+		where 100% is one fully used core like docker stats reports it.
+	*/
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	samples := make(map[string]taskSample)
+	for _, metric := range metrics {
+		at := time.Now()
+		if metric.Timestamp != nil {
+			at = metric.Timestamp.AsTime()
+		}
+		current := cpuSample{usage: cpuUsage(metric.Data), at: at, recorded: time.Now()}
+		sample := taskSample{data: metric.Data}
+		key := namespace + "/" + metric.ID
+		if previous, ok := c.samples[key]; ok && current.at.After(previous.at) && current.usage >= previous.usage {
+			elapsed := current.at.Sub(previous.at).Nanoseconds()
+			sample.cpuPercent = math.Round(float64(current.usage-previous.usage)/float64(elapsed)*100*100) / 100
+		}
+		c.samples[key] = current
+		samples[metric.ID] = sample
+	}
+	for key, sample := range c.samples {
+		id, ok := strings.CutPrefix(key, namespace+"/")
+		if _, found := samples[id]; (ok && !found) || time.Since(sample.recorded) > maxSampleAge {
+			delete(c.samples, key) // Tasks that exited or namespaces that are no longer collected
+		}
+	}
+	return samples
+}
+
+func (c *Collector) memTotal() int64 {
+	total, err := c.fs.MemTotal()
+	if err != nil {
+		return 0
+	}
+	return total
+}
+
+func (c *Collector) imageDigest(ctx context.Context, name string) string {
+	// Return the digest of the image manifest, or an empty string for images no longer in the content store.
+	response, err := c.images.Get(ctx, &imagesapi.GetImageRequest{Name: name})
+	if err != nil || response.Image == nil || response.Image.Target == nil {
+		return ""
+	}
+	return response.Image.Target.Digest
+}
+
+func taskState(status task.Status) string {
+	// Map task statuses to the container states Docker reports.
+	switch status {
+	case task.Status_RUNNING:
+		return "running"
+	case task.Status_PAUSED, task.Status_PAUSING:
+		return "paused"
+	case task.Status_STOPPED:
+		return "exited"
+	case task.Status_CREATED:
+		return "created"
+	default:
+		return "unknown"
+	}
+}
+
+func shortID(id string) string {
+	// Shorten 64 character hex IDs to the 12 characters Docker shows, keep user chosen IDs like "redis".
+	if len(id) != 64 {
+		return id
+	}
+	for _, r := range id {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return id
+		}
+	}
+	return id[:12]
+}
+
+func cpuUsage(data *anypb.Any) uint64 {
+	// Return the cumulative CPU time of a task in nanoseconds.
+	var v2 cgroup2.Metrics
+	if data.MessageIs(&v2) && data.UnmarshalTo(&v2) == nil {
+		return v2.GetCPU().GetUsageUsec() * 1000
+	}
+	var v1 cgroup1.Metrics
+	if data.MessageIs(&v1) && data.UnmarshalTo(&v1) == nil {
+		return v1.GetCPU().GetUsage().GetTotal()
+	}
+	return 0
+}
+
+func applyMetric(metrics *types.ContainerMetrics, data *anypb.Any, memTotal int64) {
+	/*
+		Set the memory, block I/O, PIDs and pressure metrics from cgroup v1 or v2 task metrics.
+
+		Memory usage excludes the inactive page cache like docker stats does.
+		Unlimited containers report the host memory as their limit.
+	*/
+	var usage, limit uint64
+	var v2 cgroup2.Metrics
+	var v1 cgroup1.Metrics
+	switch {
+	case data.MessageIs(&v2):
+		if err := data.UnmarshalTo(&v2); err != nil {
+			return
+		}
+		memory := v2.GetMemory()
+		usage, limit = memory.GetUsage(), memory.GetUsageLimit()
+		if inactive := memory.GetInactiveFile(); inactive < usage {
+			usage -= inactive
+		}
+		for _, entry := range v2.GetIo().GetUsage() {
+			metrics.ContainerBlockReadBytes += int64(entry.Rbytes)
+			metrics.ContainerBlockWriteBytes += int64(entry.Wbytes)
+		}
+		metrics.ContainerPIDs = int(v2.GetPids().GetCurrent())
+		if v2.GetCPU().GetPSI() != nil || memory.GetPSI() != nil || v2.GetIo().GetPSI() != nil {
+			metrics.ContainerPressure = &types.PressureMetrics{
+				CPU:    convertPressure(v2.GetCPU().GetPSI()),
+				Memory: convertPressure(memory.GetPSI()),
+				IO:     convertPressure(v2.GetIo().GetPSI()),
+			}
+		}
+	case data.MessageIs(&v1):
+		if err := data.UnmarshalTo(&v1); err != nil {
+			return
+		}
+		memory := v1.GetMemory()
+		usage, limit = memory.GetUsage().GetUsage(), memory.GetUsage().GetLimit()
+		if inactive := memory.GetTotalInactiveFile(); inactive < usage {
+			usage -= inactive
+		}
+		for _, entry := range v1.GetBlkio().GetIoServiceBytesRecursive() {
+			switch strings.ToLower(entry.Op) {
+			case "read":
+				metrics.ContainerBlockReadBytes += int64(entry.Value)
+			case "write":
+				metrics.ContainerBlockWriteBytes += int64(entry.Value)
+			}
+		}
+		metrics.ContainerPIDs = int(v1.GetPids().GetCurrent())
+	default:
+		return
+	}
+
+	metrics.ContainerMemoryUsageBytes = int64(usage)
+	if memTotal > 0 && (limit == 0 || limit > uint64(memTotal)) {
+		limit = uint64(memTotal)
+	}
+	if limit <= math.MaxInt64 {
+		metrics.ContainerMemoryLimitBytes = int64(limit)
+	}
+	if metrics.ContainerMemoryLimitBytes > 0 {
+		metrics.ContainerMemoryUsagePercent = math.Round(float64(usage)/float64(limit)*100*100) / 100
+	}
+}
+
+func convertPressure(psi *cgroup2.PSIStats) *types.Pressure {
+	if psi == nil {
+		return nil
+	}
+	pressure := &types.Pressure{}
+	if some := psi.GetSome(); some != nil {
+		pressure.Some = types.PressureStat{Avg10: some.Avg10, Avg60: some.Avg60, Avg300: some.Avg300, Total: int64(some.Total)}
+	}
+	if full := psi.GetFull(); full != nil {
+		pressure.Full = &types.PressureStat{Avg10: full.Avg10, Avg60: full.Avg60, Avg300: full.Avg300, Total: int64(full.Total)}
+	}
+	return pressure
+}
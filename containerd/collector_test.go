@@ -0,0 +1,318 @@
+package containerd
+
+import (
+	"context"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	cgroup2 "github.com/containerd/cgroups/v3/cgroup2/stats"
+	containersapi "github.com/containerd/containerd/api/services/containers/v1"
+	imagesapi "github.com/containerd/containerd/api/services/images/v1"
+	namespacesapi "github.com/containerd/containerd/api/services/namespaces/v1"
+	tasksapi "github.com/containerd/containerd/api/services/tasks/v1"
+	apitypes "github.com/containerd/containerd/api/types"
+	"github.com/containerd/containerd/api/types/task"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"vchan.in/doctor-metrics/procfs"
+	"vchan.in/doctor-metrics/types"
+)
+
+const webID = "f3f177b2b3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e"
+
+// fakeContainerd serves a running "web" and a stopped "db" container in the "default" namespace.
+type fakeContainerd struct {
+	mu           sync.Mutex
+	metricsCalls int
+	extra        []*containersapi.Container // Stopped containers listed before web and db
+}
+
+func requireNamespace(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(namespaceHeader); len(values) != 1 || values[0] != "default" {
+		return status.Error(codes.FailedPrecondition, "namespace is required")
+	}
+	return nil
+}
+
+type fakeNamespaces struct {
+	namespacesapi.UnimplementedNamespacesServer
+}
+
+func (fakeNamespaces) List(ctx context.Context, _ *namespacesapi.ListNamespacesRequest) (*namespacesapi.ListNamespacesResponse, error) {
+	return &namespacesapi.ListNamespacesResponse{Namespaces: []*namespacesapi.Namespace{{Name: "default"}}}, nil
+}
+
+type fakeContainers struct {
+	containersapi.UnimplementedContainersServer
+	*fakeContainerd
+}
+
+func (f fakeContainers) List(ctx context.Context, _ *containersapi.ListContainersRequest) (*containersapi.ListContainersResponse, error) {
+	if err := requireNamespace(ctx); err != nil {
+		return nil, err
+	}
+	created := timestamppb.New(time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC))
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &containersapi.ListContainersResponse{Containers: append(append([]*containersapi.Container{}, f.extra...),
+		&containersapi.Container{
+			ID:        webID,
+			Image:     "docker.io/library/nginx:1.27",
+			Labels:    map[string]string{nameLabel: "web", restartPolicyLabel: "always", "tier": "frontend"},
+			CreatedAt: created,
+		},
+		&containersapi.Container{ID: "db", Image: "docker.io/library/postgres:16", CreatedAt: created},
+	)}, nil
+}
+
+type fakeTasks struct {
+	tasksapi.UnimplementedTasksServer
+	*fakeContainerd
+}
+
+func (fakeTasks) List(ctx context.Context, _ *tasksapi.ListTasksRequest) (*tasksapi.ListTasksResponse, error) {
+	if err := requireNamespace(ctx); err != nil {
+		return nil, err
+	}
+	return &tasksapi.ListTasksResponse{Tasks: []*task.Process{
+		{ID: webID, ContainerID: webID, Pid: 4242, Status: task.Status_RUNNING},
+		{ID: "db", ContainerID: "db", Status: task.Status_STOPPED, ExitStatus: 137},
+	}}, nil
+}
+
+func (f fakeTasks) Metrics(ctx context.Context, _ *tasksapi.MetricsRequest) (*tasksapi.MetricsResponse, error) {
+	if err := requireNamespace(ctx); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	f.metricsCalls++
+	call := f.metricsCalls
+	f.mu.Unlock()
+
+	// Each sample is one second apart and adds half a second of CPU time.
+	data, err := anypb.New(&cgroup2.Metrics{
+		Pids: &cgroup2.PidsStat{Current: 3},
+		CPU: &cgroup2.CPUStat{
+			UsageUsec: uint64(call) * 500000,
+			PSI:       &cgroup2.PSIStats{Some: &cgroup2.PSIData{Avg10: 1.5, Total: 1000}},
+		},
+		Memory: &cgroup2.MemoryStat{Usage: 150 << 20, InactiveFile: 50 << 20, UsageLimit: ^uint64(0)},
+		Io:     &cgroup2.IOStat{Usage: []*cgroup2.IOEntry{{Rbytes: 4096, Wbytes: 8192}, {Rbytes: 1024}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	at := time.Date(2021, 9, 1, 13, 0, call, 0, time.UTC)
+	return &tasksapi.MetricsResponse{Metrics: []*apitypes.Metric{{ID: webID, Timestamp: timestamppb.New(at), Data: data}}}, nil
+}
+
+type fakeImages struct {
+	imagesapi.UnimplementedImagesServer
+}
+
+func (fakeImages) Get(ctx context.Context, request *imagesapi.GetImageRequest) (*imagesapi.GetImageResponse, error) {
+	if request.Name != "docker.io/library/nginx:1.27" {
+		return nil, status.Error(codes.NotFound, "image not found")
+	}
+	return &imagesapi.GetImageResponse{Image: &imagesapi.Image{
+		Name:   request.Name,
+		Target: &apitypes.Descriptor{Digest: "sha256:0b970013351304af46f322da1263516b188318682b2ab1091862497591189ff1"},
+	}}, nil
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func startFakeContainerd(t *testing.T) (*Collector, *fakeContainerd) {
+	// Serve the fake on a unix socket like containerd and point procfs at a fake /proc with the web task.
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "containerd.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Failed to listen on %s: %v", socket, err)
+	}
+	fake := &fakeContainerd{}
+	server := grpc.NewServer()
+	namespacesapi.RegisterNamespacesServer(server, fakeNamespaces{})
+	containersapi.RegisterContainersServer(server, fakeContainers{fakeContainerd: fake})
+	tasksapi.RegisterTasksServer(server, fakeTasks{fakeContainerd: fake})
+	imagesapi.RegisterImagesServer(server, fakeImages{})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	proc := filepath.Join(dir, "proc")
+	writeFile(t, filepath.Join(proc, "meminfo"), "MemTotal:        2048000 kB\nMemFree:         1024000 kB\n")
+	writeFile(t, filepath.Join(proc, "stat"), "cpu  4 0 4 8 0 0 0 0 0 0\ncpu0 1 0 1 2 0 0 0 0 0 0\ncpu1 1 0 1 2 0 0 0 0 0 0\n"+
+		"cpu2 1 0 1 2 0 0 0 0 0 0\ncpu3 1 0 1 2 0 0 0 0 0 0\nbtime 1630497600\n")
+	writeFile(t, filepath.Join(proc, "4242", "stat"),
+		"4242 (nginx: master) S 4200 4242 4242 0 -1 4194560 1 0 0 0 0 0 0 0 20 0 1 0 180000 1000 100 18446744073709551615\n")
+	writeFile(t, filepath.Join(proc, "4242", "net", "dev"), `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:     500       5    0    0    0     0          0         0      500       5    0    0    0     0       0          0
+  eth0:  123456     100    0    0    0     0          0         0    65432      80    0    0    0     0       0          0
+`)
+
+	// Two descriptors, a listening socket and a connection waiting to be closed.
+	writeFile(t, filepath.Join(proc, "4242", "cgroup"), "0::/default/web\n")
+	writeFile(t, filepath.Join(dir, "cgroup", "cgroup.controllers"), "cpu memory pids\n")
+	writeFile(t, filepath.Join(dir, "cgroup", "default", "web", "cgroup.procs"), "4242\n")
+	writeFile(t, filepath.Join(proc, "4242", "fd", "0"), "")
+	writeFile(t, filepath.Join(proc, "4242", "fd", "1"), "")
+	writeFile(t, filepath.Join(proc, "4242", "limits"), "Limit                     Soft Limit           Hard Limit           Units     \n"+
+		"Max open files            65536                65536                files     \n")
+	writeFile(t, filepath.Join(proc, "4242", "net", "tcp"), `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 31337 1 0000000000000000 100 0 0 10 0
+   1: 020011AC:D2F4 030011AC:1538 08 00000000:00000000 00:00000000 00000000   101        0 31339 1 0000000000000000 20 4 30 10 -1
+`)
+
+	collector, err := NewCollector(socket, nil)
+	if err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+	t.Cleanup(func() { collector.Close() })
+	collector.sampleInterval = time.Millisecond
+	collector.fs = procfs.FS{ProcRoot: proc, CgroupRoot: filepath.Join(dir, "cgroup")}
+	return collector, fake
+}
+
+func TestCollect(t *testing.T) {
+	collector, fake := startFakeContainerd(t)
+
+	list, err := collector.Collect(context.Background(), types.ContainerFilter{})
+	if !assert.NoError(t, err) || !assert.Len(t, list, 2) {
+		return
+	}
+	// Without a previous sample the collector samples twice.
+	assert.Equal(t, 2, fake.metricsCalls)
+
+	web := list[0]
+	assert.True(t, web.Active)
+	assert.Equal(t, "f3f177b2b3b4", web.ContainerID)
+	assert.Equal(t, "web", web.ContainerName)
+	assert.Equal(t, "default", web.ContainerNamespace)
+	assert.Equal(t, "running", web.ContainerState)
+	assert.Equal(t, "always", web.ContainerRestartPolicy)
+	assert.Equal(t, "2021-09-01T12:00:00Z", web.ContainerCreatedAt)
+	assert.Equal(t, "2021-09-01T12:30:00Z", web.ContainerStartedAt)
+	assert.Equal(t, 50.0, web.ContainerCpuUsagePercent)
+	assert.Equal(t, int64(100<<20), web.ContainerMemoryUsageBytes)
+	assert.Equal(t, int64(2048000*1024), web.ContainerMemoryLimitBytes)
+	assert.Equal(t, 5.0, web.ContainerMemoryUsagePercent)
+	// Half a core of a 4 CPU host.
+	assert.Equal(t, 12.5, web.ContainerCpuHostPercent)
+	assert.Equal(t, 5.0, web.ContainerMemoryHostPercent)
+	assert.Equal(t, int64(123456), web.ContainerNetworkReceiveBytesTotal)
+	assert.Equal(t, int64(65432), web.ContainerNetworkTransmitBytesTotal)
+	assert.Equal(t, int64(5120), web.ContainerBlockReadBytes)
+	assert.Equal(t, int64(8192), web.ContainerBlockWriteBytes)
+	assert.Equal(t, 3, web.ContainerPIDs)
+	assert.Equal(t, "sha256:0b970013351304af46f322da1263516b188318682b2ab1091862497591189ff1", web.ContainerImageID)
+	assert.Equal(t, "docker.io/library/nginx@sha256:0b970013351304af46f322da1263516b188318682b2ab1091862497591189ff1", web.ContainerImageDigest)
+	assert.Equal(t, 2, web.ContainerOpenFDs)
+	assert.Equal(t, int64(65536), web.ContainerFDLimit)
+	assert.Equal(t, &types.TCPConnections{Listen: 1, CloseWait: 1, Total: 2}, web.ContainerTCPConnections)
+	if assert.NotNil(t, web.ContainerPressure) && assert.NotNil(t, web.ContainerPressure.CPU) {
+		assert.Equal(t, 1.5, web.ContainerPressure.CPU.Some.Avg10)
+	}
+
+	db := list[1]
+	assert.False(t, db.Active)
+	assert.Equal(t, "db", db.ContainerID)
+	assert.Equal(t, "exited", db.ContainerState)
+	assert.Equal(t, 137, db.ContainerExitCode)
+	assert.Equal(t, "no", db.ContainerRestartPolicy)
+	assert.Empty(t, db.ContainerImageDigest)
+
+	// A recent sample is reused, so the next collection samples once.
+	list, err = collector.Collect(context.Background(), types.ContainerFilter{States: []string{"running"}})
+	if assert.NoError(t, err) && assert.Len(t, list, 1) {
+		assert.Equal(t, "web", list[0].ContainerName)
+		assert.Equal(t, 3, fake.metricsCalls)
+	}
+}
+
+func TestCollectContainer(t *testing.T) {
+	collector, _ := startFakeContainerd(t)
+
+	for _, idOrName := range []string{"web", "f3f177b2b3b4", webID} {
+		metrics, err := collector.CollectContainer(context.Background(), idOrName)
+		if assert.NoError(t, err, idOrName) {
+			assert.Equal(t, "web", metrics.ContainerName)
+		}
+	}
+
+	_, err := collector.CollectContainer(context.Background(), "missing")
+	if httpErr, ok := err.(*echo.HTTPError); assert.True(t, ok) {
+		assert.Equal(t, 404, httpErr.Code)
+	}
+}
+
+func TestCollectContainerPrecedence(t *testing.T) {
+	// An exact ID wins over a name, a name over an ID prefix, and a prefix must match a single ID.
+	collector, fake := startFakeContainerd(t)
+	fake.extra = []*containersapi.Container{
+		{ID: "redis-cache", Image: "docker.io/library/redis:7"},
+		{ID: "redis", Image: "docker.io/library/redis:7"},
+		{ID: "cafe" + webID[4:], Labels: map[string]string{nameLabel: "worker"}},
+		{ID: "cafe0" + webID[5:], Labels: map[string]string{nameLabel: "cafe"}},
+	}
+
+	for idOrName, name := range map[string]string{
+		"redis":            "redis",
+		"redis-c":          "redis-cache",
+		"cafe":             "cafe",
+		"cafe7":            "worker",
+		"cafe" + webID[4:]: "worker",
+	} {
+		metrics, err := collector.CollectContainer(context.Background(), idOrName)
+		if assert.NoError(t, err, idOrName) {
+			assert.Equal(t, name, metrics.ContainerName, idOrName)
+		}
+	}
+
+	_, err := collector.CollectContainer(context.Background(), "caf")
+	if httpErr, ok := err.(*echo.HTTPError); assert.True(t, ok) {
+		assert.Equal(t, 400, httpErr.Code)
+	}
+}
+
+func TestCollectFilterSkipsSampling(t *testing.T) {
+	collector, fake := startFakeContainerd(t)
+
+	list, err := collector.Collect(context.Background(), types.ContainerFilter{Labels: []string{"tier=backend"}})
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+	assert.Zero(t, fake.metricsCalls)
+}
+
+func TestCollectPrunesSamples(t *testing.T) {
+	// Samples of exited tasks and old samples are discarded, those of other namespaces are kept while recent.
+	collector, _ := startFakeContainerd(t)
+	collector.samples["default/exited"] = cpuSample{recorded: time.Now()}
+	collector.samples["other/old"] = cpuSample{recorded: time.Now().Add(-2 * maxSampleAge)}
+	collector.samples["other/recent"] = cpuSample{recorded: time.Now()}
+
+	_, err := collector.Collect(context.Background(), types.ContainerFilter{})
+	if assert.NoError(t, err) {
+		assert.ElementsMatch(t, []string{"default/" + webID, "other/recent"}, slices.Collect(maps.Keys(collector.samples)))
+	}
+}
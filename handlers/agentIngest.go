@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"vchan.in/doctor-metrics/types"
+)
+
+// IngestStore stores the batches of container metrics pushed by agents.
+type IngestStore interface {
+	// Authenticate returns the agent a bearer token belongs to.
+	Authenticate(token string) (string, bool)
+	// Ingest stores a batch of an agent and returns whether it was newer than the stored one.
+	Ingest(agent string, batch types.IngestBatch) bool
+	// Agents returns the status of every configured agent.
+	Agents() []types.AgentStatus
+}
+
+// The store of pushed metrics, nil unless agents are allowed to push with SetIngestStore.
+var ingestStore IngestStore
+
+// Routes authenticated with an agent token instead of basic authentication.
+var tokenAuthenticatedRoutes = map[string]bool{"/api/ingest": true}
+
+func SetIngestStore(store IngestStore) {
+	/*
+		SetIngestStore enables POST /api/ingest and GET /api/agents with the given store.
+		It must be called before the server starts handling requests.
+	*/
+	ingestStore = store
+}
+
+func PostIngest(c echo.Context) error {
+	/*
+		Receive a batch of container metrics pushed by an agent.
+
+		The agent authenticates with its token in the "Authorization: Bearer <token>" header.
+		Function returns HTTP 202 when the batch was stored, HTTP 200 when a newer batch was already stored,
+		HTTP 401 for an unknown token and HTTP 400 for an invalid batch.
+	*/
+	if ingestStore == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Metrics ingestion is not enabled")
+	}
+
+	scheme, token, ok := strings.Cut(c.Request().Header.Get(echo.HeaderAuthorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		rejected(c, "missing_token")
+		return echo.ErrUnauthorized
+	}
+	agent, ok := ingestStore.Authenticate(strings.TrimSpace(token))
+	if !ok {
+		rejected(c, "invalid_token")
+		return echo.ErrUnauthorized
+	}
+	c.Set(userContextKey, agent)
+
+	var batch types.IngestBatch
+	if err := c.Bind(&batch); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Failed to parse the metrics batch")
+	}
+	if batch.Epoch <= 0 || batch.ContainerMetrics == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Metrics batch must have an epoch and container metrics")
+	}
+
+	response := types.APIResponse{Status: "success", Message: "Metrics batch stored"}
+	response.Data.ContainerMetrics = []types.ContainerMetrics{}
+	if !ingestStore.Ingest(agent, batch) {
+		response.Message = "Metrics batch already received"
+		return c.JSON(http.StatusOK, response)
+	}
+	return c.JSON(http.StatusAccepted, response)
+}
+
+func GetAgents(c echo.Context) error {
+	/*
+		Get the agents allowed to push metrics and when they were last seen.
+
+		{
+		  "agents": [
+		    {
+		      "agent": "web-01",
+		      "last_seen": "2021-09-01T12:34:56Z",
+		      "last_collected_at": "2021-09-01T12:34:55Z",
+		      "sequence": 42,
+		      "containers": 12,
+		      "stale": false
+		    },
+		    ...
+		  ]
+		}
+
+		Function returns a JSON response with the agents ordered by name,
+		or an HTTP 404 error when ingestion is not enabled.
+	*/
+	if ingestStore == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Metrics ingestion is not enabled")
+	}
+
+	response := types.AgentsResponse{
+		Status:  "success",
+		Message: "Agents retrieved successfully",
+	}
+	response.Data.Agents = ingestStore.Agents()
+
+	return c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/types"
+)
+
+// fakeIngestStore accepts batches from the agent "nat-01" with the token "def".
+type fakeIngestStore struct {
+	batches []types.IngestBatch
+}
+
+func (f *fakeIngestStore) Authenticate(token string) (string, bool) {
+	return "nat-01", token == "def"
+}
+
+func (f *fakeIngestStore) Ingest(agent string, batch types.IngestBatch) bool {
+	if n := len(f.batches); n > 0 && batch.Sequence <= f.batches[n-1].Sequence {
+		return false
+	}
+	f.batches = append(f.batches, batch)
+	return true
+}
+
+func (f *fakeIngestStore) Agents() []types.AgentStatus {
+	return []types.AgentStatus{{Agent: "nat-01", Sequence: uint64(len(f.batches))}}
+}
+
+func TestPostIngest(t *testing.T) {
+	store := &fakeIngestStore{}
+	SetIngestStore(store)
+	defer SetIngestStore(nil)
+
+	// The ingest route skips basic authentication, the other routes keep it.
+	e := echo.New()
+	e.Use(HandleAuthMiddleware)
+	e.POST("api/ingest", PostIngest)
+	e.GET("api/agents", GetAgents)
+
+	post := func(authorization, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/ingest", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if authorization != "" {
+			req.Header.Set(echo.HeaderAuthorization, authorization)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	batch := `{"epoch": 1, "sequence": 1, "collected_at": "2021-09-01T12:00:00Z", "container_metrics": [{"container_name": "nginx"}]}`
+
+	assert.Equal(t, http.StatusUnauthorized, post("", batch).Code)
+	assert.Equal(t, http.StatusUnauthorized, post("Bearer wrong", batch).Code)
+	assert.Equal(t, http.StatusUnauthorized, post("Basic ZGg6c2VjcmV0", batch).Code)
+	assert.Equal(t, http.StatusBadRequest, post("Bearer def", "{").Code)
+	assert.Equal(t, http.StatusBadRequest, post("Bearer def", `{"sequence": 1}`).Code)
+	assert.Equal(t, http.StatusAccepted, post("Bearer def", batch).Code)
+	assert.Equal(t, http.StatusOK, post("bearer def", batch).Code)
+	if assert.Len(t, store.batches, 1) {
+		assert.Equal(t, "nginx", store.batches[0].ContainerMetrics[0].ContainerName)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/agents", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer def")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/agents", nil), rec)
+	if assert.NoError(t, GetAgents(c)) {
+		var response types.AgentsResponse
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		assert.Equal(t, []types.AgentStatus{{Agent: "nat-01", Sequence: 1}}, response.Data.Agents)
+	}
+}
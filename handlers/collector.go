@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+
+	"vchan.in/doctor-metrics/types"
+)
+
+// Collector collects container metrics from a container runtime.
+type Collector interface {
+	// Collect returns the metrics of all containers matching the filter, including stopped ones.
+	Collect(ctx context.Context, filter types.ContainerFilter) ([]types.ContainerMetrics, error)
+	// CollectContainer returns the metrics of a single container by ID or name.
+	CollectContainer(ctx context.Context, idOrName string) (types.ContainerMetrics, error)
+}
+
+// hostCollector is implemented by collectors that merge the containers of several hosts.
+type hostCollector interface {
+	// CollectHosts is like Collect and also returns the hosts that could not be collected.
+	CollectHosts(ctx context.Context, filter types.ContainerFilter) ([]types.ContainerMetrics, []types.HostError, error)
+}
+
+// pinger is implemented by collectors that can check that their container runtime is reachable without collecting.
+type pinger interface {
+	// Ping returns an error when the container runtime cannot be reached.
+	Ping(ctx context.Context) error
+}
+
+// The collector used by the metrics handlers, the docker CLI unless replaced with SetCollector.
+var collector Collector = DockerCollector{}
+
+func SetCollector(c Collector) {
+	/*
+		SetCollector replaces the collector used by the metrics handlers.
+		It must be called before the server starts handling requests.
+	*/
+	collector = c
+}
+
+func CurrentCollector() Collector {
+	// CurrentCollector returns the collector used by the metrics handlers.
+	return collector
+}
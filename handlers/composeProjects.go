@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/labstack/echo/v4"
+	"vchan.in/doctor-metrics/types"
+)
+
+// Labels set by Docker Compose on the containers it creates.
+const (
+	composeProjectLabel = "com.docker.compose.project"
+	composeServiceLabel = "com.docker.compose.service"
+	composeOneoffLabel  = "com.docker.compose.oneoff"
+)
+
+func groupComposeServices(list []types.ContainerMetrics) map[string][]types.ComposeService {
+	/*
+		Group container metrics by compose project and service.
+
+		The desired replica count is the number of containers compose created for a service,
+		since compose removes surplus containers when a service is scaled down.
+		One-off containers from "docker compose run" count towards usage but not towards replicas.
+		Function returns the services of each project ordered by service name.
+	*/
+	type serviceKey struct{ project, service string }
+	members := make(map[serviceKey][]types.ContainerMetrics)
+	for _, metrics := range list {
+		project, ok := metrics.ContainerLabels[composeProjectLabel]
+		if !ok {
+			continue
+		}
+		key := serviceKey{project, metrics.ContainerLabels[composeServiceLabel]}
+		members[key] = append(members[key], metrics)
+	}
+
+	projects := make(map[string][]types.ComposeService)
+	for key, containers := range members {
+		service := types.ComposeService{
+			Project:    key.project,
+			Service:    key.service,
+			Usage:      sumUsage(containers),
+			Containers: []string{},
+		}
+		for _, metrics := range containers {
+			service.Containers = append(service.Containers, metrics.ContainerName)
+			if metrics.ContainerLabels[composeOneoffLabel] == "True" {
+				continue
+			}
+			service.Replicas.Desired++
+			if metrics.Active {
+				service.Replicas.Running++
+			}
+		}
+		sort.Strings(service.Containers)
+		projects[key.project] = append(projects[key.project], service)
+	}
+
+	for _, services := range projects {
+		sort.Slice(services, func(i, j int) bool { return services[i].Service < services[j].Service })
+	}
+	return projects
+}
+
+func groupComposeProjects(list []types.ContainerMetrics) []types.ComposeProject {
+	// Summarize each compose project over all of its services, ordered by project name.
+	projects := []types.ComposeProject{}
+	for name, services := range groupComposeServices(list) {
+		project := types.ComposeProject{Project: name, Services: []string{}}
+		var containers []types.ContainerMetrics
+		for _, service := range services {
+			project.Services = append(project.Services, service.Service)
+			project.Replicas.Running += service.Replicas.Running
+			project.Replicas.Desired += service.Replicas.Desired
+		}
+		for _, metrics := range list {
+			if metrics.ContainerLabels[composeProjectLabel] == name {
+				containers = append(containers, metrics)
+			}
+		}
+		project.Usage = sumUsage(containers)
+		projects = append(projects, project)
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Project < projects[j].Project })
+	return projects
+}
+
+func GetComposeProjects(c echo.Context) error {
+	/*
+		Get aggregated metrics for every Docker Compose project.
+
+		{
+		  "projects": [
+		    {
+		      "project": "shop",
+		      "services": ["db", "web"],
+		      "replicas": {"running": 3, "desired": 3},
+		      "usage": {"cpu_usage_percent_total": 52.5, "memory_usage_bytes": 123456, ...}
+		    },
+		    ...
+		  ]
+		}
+
+		Function returns a JSON response with the projects ordered by name.
+	*/
+	listMetrics, err := collector.Collect(c.Request().Context(), types.ContainerFilter{Labels: []string{composeProjectLabel}})
+	if err != nil {
+		return err
+	}
+
+	response := types.ProjectsResponse{
+		Status:  "success",
+		Message: "Compose projects retrieved successfully",
+	}
+	response.Data.Projects = groupComposeProjects(listMetrics)
+
+	return c.JSON(http.StatusOK, response)
+}
+
+func GetComposeServices(c echo.Context) error {
+	/*
+		Get aggregated metrics for the services of a Docker Compose project.
+
+		{
+		  "project": "shop",
+		  "services": [
+		    {
+		      "project": "shop",
+		      "service": "web",
+		      "replicas": {"running": 2, "desired": 2},
+		      "usage": {"cpu_usage_percent_total": 52.5, "cpu_usage_percent_avg": 26.25, ...},
+		      "containers": ["shop-web-1", "shop-web-2"]
+		    },
+		    ...
+		  ]
+		}
+
+		Function takes a project name as input.
+		Function returns a JSON response with the services ordered by name, or 404 if the project has no containers.
+	*/
+	project := c.Param("project")
+
+	listMetrics, err := collector.Collect(c.Request().Context(), types.ContainerFilter{Labels: []string{composeProjectLabel + "=" + project}})
+	if err != nil {
+		return err
+	}
+
+	services, ok := groupComposeServices(listMetrics)[project]
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "Compose project not found")
+	}
+
+	response := types.ServicesResponse{
+		Status:  "success",
+		Message: "Compose services retrieved successfully",
+	}
+	response.Data.Project = project
+	response.Data.Services = services
+
+	return c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/types"
+)
+
+func composeContainer(name, project, service string, active bool, cpu float64, memory int64) types.ContainerMetrics {
+	return types.ContainerMetrics{
+		Active:                    active,
+		ContainerName:             name,
+		ContainerCpuUsagePercent:  cpu,
+		ContainerMemoryUsageBytes: memory,
+		ContainerMemoryLimitBytes: 1024,
+		ContainerLabels: map[string]string{
+			composeProjectLabel: project,
+			composeServiceLabel: service,
+		},
+	}
+}
+
+func composeFixture() []types.ContainerMetrics {
+	oneoff := composeContainer("shop-web-run-1", "shop", "web", true, 1, 10)
+	oneoff.ContainerLabels[composeOneoffLabel] = "True"
+	return []types.ContainerMetrics{
+		composeContainer("shop-web-2", "shop", "web", true, 30, 200),
+		composeContainer("shop-web-1", "shop", "web", true, 20, 100),
+		composeContainer("shop-web-3", "shop", "web", false, 0, 0),
+		composeContainer("shop-db-1", "shop", "db", true, 5.5, 500),
+		composeContainer("blog-app-1", "blog", "app", true, 1.25, 50),
+		oneoff,
+		{ContainerName: "standalone", Active: true, ContainerCpuUsagePercent: 99},
+	}
+}
+
+func TestGroupComposeServices(t *testing.T) {
+	projects := groupComposeServices(composeFixture())
+	assert.Len(t, projects, 2)
+
+	services := projects["shop"]
+	if assert.Len(t, services, 2) {
+		assert.Equal(t, "db", services[0].Service)
+		web := services[1]
+		assert.Equal(t, "web", web.Service)
+		assert.Equal(t, types.Replicas{Running: 2, Desired: 3}, web.Replicas)
+		assert.Equal(t, []string{"shop-web-1", "shop-web-2", "shop-web-3", "shop-web-run-1"}, web.Containers)
+		assert.Equal(t, 51.0, web.Usage.CpuUsagePercentTotal)
+		assert.Equal(t, 17.0, web.Usage.CpuUsagePercentAvg)
+		assert.Equal(t, int64(310), web.Usage.MemoryUsageBytes)
+		assert.Equal(t, int64(4096), web.Usage.MemoryLimitBytes)
+	}
+}
+
+func TestGroupComposeProjects(t *testing.T) {
+	projects := groupComposeProjects(composeFixture())
+	if assert.Len(t, projects, 2) {
+		assert.Equal(t, "blog", projects[0].Project)
+		shop := projects[1]
+		assert.Equal(t, "shop", shop.Project)
+		assert.Equal(t, []string{"db", "web"}, shop.Services)
+		assert.Equal(t, types.Replicas{Running: 3, Desired: 4}, shop.Replicas)
+		assert.Equal(t, 56.5, shop.Usage.CpuUsagePercentTotal)
+		assert.Equal(t, int64(810), shop.Usage.MemoryUsageBytes)
+	}
+}
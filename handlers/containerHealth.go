@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"vchan.in/doctor-metrics/types"
+)
+
+// Defaults of the healthcheck log length and flapping detection.
+const (
+	DefaultHealthLogEntries   = 5
+	DefaultHealthFlapChanges  = 3
+	DefaultHealthFlapInterval = 10 * time.Minute
+)
+
+// Number of healthcheck results reported per container, docker keeps at most 5.
+var healthLogEntries = DefaultHealthLogEntries
+
+// healthRecord is the status history of one container.
+type healthRecord struct {
+	status    string      // Last "healthy" or "unhealthy" status
+	updatedAt time.Time   // Time of the last observation
+	changes   []time.Time // Status changes within the flapping window, oldest first
+}
+
+// healthHistory records the healthcheck status changes of containers to detect flapping.
+type healthHistory struct {
+	maxChanges int           // A container is flapping with more status changes than this within the window
+	window     time.Duration // Period status changes are counted over
+
+	mu      sync.Mutex
+	records map[string]*healthRecord // Records by host and short container ID
+}
+
+var containerHealth = newHealthHistory(DefaultHealthFlapChanges, DefaultHealthFlapInterval)
+
+func newHealthHistory(maxChanges int, window time.Duration) *healthHistory {
+	return &healthHistory{maxChanges: maxChanges, window: window, records: make(map[string]*healthRecord)}
+}
+
+func ConfigureHealthChecks(logEntries, flapChanges int, flapInterval time.Duration) {
+	/*
+		ConfigureHealthChecks sets the number of healthcheck results reported per container, and flags a container
+		as flapping when its status changed more than flapChanges times within flapInterval.
+		It must be called before the server starts handling requests.
+	*/
+	healthLogEntries = logEntries
+	containerHealth = newHealthHistory(flapChanges, flapInterval)
+}
+
+func healthKey(host, containerID string) string {
+	// Containers are keyed by host in aggregator mode, docker events report the full container ID.
+	if len(containerID) > 12 {
+		containerID = containerID[:12]
+	}
+	return host + "/" + containerID
+}
+
+func (h *healthHistory) observe(key, status string, at time.Time) {
+	/*
+		Record the healthcheck status of a container at a point in time.
+
+		Only changes between "healthy" and "unhealthy" count, "starting" after a restart keeps the last status.
+		Observations older than the last one are ignored, so a collection that started before
+		a docker health_status event cannot undo the change the event reported.
+	*/
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	record, ok := h.records[key]
+	if !ok {
+		record = &healthRecord{}
+		h.records[key] = record
+	}
+	if at.Before(record.updatedAt) {
+		return
+	}
+	record.updatedAt = at
+	if status != "healthy" && status != "unhealthy" {
+		return
+	}
+	if record.status != "" && record.status != status {
+		record.changes = append(record.changes, at)
+	}
+	record.status = status
+}
+
+func (h *healthHistory) observeAll(list []types.ContainerMetrics, at time.Time) {
+	// Record the status of every container with a healthcheck and forget containers not seen within the window.
+	for _, metrics := range list {
+		if metrics.ContainerHealthStatus != "" {
+			h.observe(healthKey(metrics.Host, metrics.ContainerID), metrics.ContainerHealthStatus, at)
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for key, record := range h.records {
+		if at.Sub(record.updatedAt) > h.window {
+			delete(h.records, key)
+		}
+	}
+}
+
+func (h *healthHistory) changes(key string, now time.Time) ([]time.Time, bool) {
+	// Return the status changes of a container within the window and whether it is flapping.
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	record, ok := h.records[key]
+	if !ok {
+		return nil, false
+	}
+	recent := record.changes[:0]
+	for _, change := range record.changes {
+		if now.Sub(change) <= h.window {
+			recent = append(recent, change)
+		}
+	}
+	record.changes = recent
+	return slices.Clone(recent), len(recent) > h.maxChanges
+}
+
+func healthChecks(inspect types.DockerInspect) []types.HealthCheck {
+	// Convert the healthcheck log of docker inspect to the latest results, newest first.
+	if inspect.State.Health == nil {
+		return nil
+	}
+	log := inspect.State.Health.Log
+	checks := []types.HealthCheck{}
+	for i := len(log) - 1; i >= 0 && len(checks) < healthLogEntries; i-- {
+		check := types.HealthCheck{
+			Start:    log[i].Start,
+			End:      log[i].End,
+			ExitCode: log[i].ExitCode,
+			Output:   log[i].Output,
+		}
+		start, startErr := time.Parse(time.RFC3339Nano, log[i].Start)
+		end, endErr := time.Parse(time.RFC3339Nano, log[i].End)
+		if startErr == nil && endErr == nil && end.After(start) {
+			check.DurationSeconds = end.Sub(start).Seconds()
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+func summarizeHealth(list []types.ContainerMetrics, all bool, now time.Time) (types.HealthSummary, []types.ContainerHealth) {
+	/*
+		Count the containers with a healthcheck by status and list the unhealthy and flapping ones,
+		or every container with a healthcheck if all is set.
+		Containers are ordered unhealthy first, then by the number of status changes and by name.
+	*/
+	summary := types.HealthSummary{}
+	containers := []types.ContainerHealth{}
+	for _, metrics := range list {
+		if metrics.ContainerHealthStatus == "" {
+			continue
+		}
+		changes, flapping := containerHealth.changes(healthKey(metrics.Host, metrics.ContainerID), now)
+		summary.Total++
+		switch metrics.ContainerHealthStatus {
+		case "healthy":
+			summary.Healthy++
+		case "unhealthy":
+			summary.Unhealthy++
+		case "starting":
+			summary.Starting++
+		}
+		if flapping {
+			summary.Flapping++
+		}
+		if !all && !flapping && metrics.ContainerHealthStatus != "unhealthy" {
+			continue
+		}
+
+		health := types.ContainerHealth{
+			ContainerID:   metrics.ContainerID,
+			ContainerName: metrics.ContainerName,
+			Host:          metrics.Host,
+			Status:        metrics.ContainerHealthStatus,
+			FailingStreak: metrics.ContainerHealthFailures,
+			StatusChanges: len(changes),
+			Flapping:      flapping,
+			Log:           metrics.ContainerHealthLog,
+		}
+		if len(changes) > 0 {
+			health.LastChangeAt = changes[len(changes)-1].UTC().Format(time.RFC3339)
+		}
+		if health.Log == nil {
+			health.Log = []types.HealthCheck{}
+		}
+		containers = append(containers, health)
+	}
+
+	slices.SortFunc(containers, func(a, b types.ContainerHealth) int {
+		if (a.Status == "unhealthy") != (b.Status == "unhealthy") {
+			if a.Status == "unhealthy" {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Or(
+			cmp.Compare(b.StatusChanges, a.StatusChanges),
+			cmp.Compare(a.ContainerName, b.ContainerName),
+			cmp.Compare(a.Host, b.Host),
+		)
+	})
+	return summary, containers
+}
+
+func GetContainerHealth(c echo.Context) error {
+	/*
+		Get the healthcheck status of the containers, listing the unhealthy and flapping ones.
+
+		{
+		  "summary": {"total": 12, "healthy": 10, "unhealthy": 1, "starting": 1, "flapping": 1},
+		  "containers": [
+		    {
+		      "container_id": "f3f177b2b3b4",
+		      "container_name": "shop-web-1",
+		      "status": "unhealthy",
+		      "failing_streak": 3,
+		      "status_changes": 4,
+		      "flapping": true,
+		      "last_change_at": "2021-09-01T12:30:00Z",
+		      "log": [{"start": "...", "end": "...", "exit_code": 1, "output": "curl: (7) ...", "duration_seconds": 0.1}, ...]
+		    },
+		    ...
+		  ]
+		}
+
+		A container is flapping when its status changed between healthy and unhealthy more than
+		DM_HEALTH_FLAP_CHANGES times within DM_HEALTH_FLAP_INTERVAL. Status changes are taken from the docker events
+		stream when it is connected, and from every collection of the container metrics otherwise.
+		Function takes an optional "all" query parameter to list every container with a healthcheck.
+		Function returns a JSON response with the summary and the containers.
+	*/
+	all := false
+	if value := c.QueryParam("all"); value != "" {
+		var err error
+		if all, err = strconv.ParseBool(value); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid all parameter, expected true or false")
+		}
+	}
+
+	var listMetrics []types.ContainerMetrics
+	var hostErrors []types.HostError
+	var err error
+	collectedAt := time.Now()
+	if hosts, ok := collector.(hostCollector); ok {
+		listMetrics, hostErrors, err = hosts.CollectHosts(c.Request().Context(), types.ContainerFilter{})
+	} else {
+		listMetrics, err = collector.Collect(c.Request().Context(), types.ContainerFilter{})
+	}
+	if err != nil {
+		return err
+	}
+	containerHealth.observeAll(listMetrics, collectedAt)
+
+	response := types.HealthResponse{
+		Status:  "success",
+		Message: "Container health retrieved successfully",
+	}
+	response.Data.Summary, response.Data.Containers = summarizeHealth(listMetrics, all, time.Now())
+	response.Data.Errors = hostErrors
+
+	return c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/types"
+)
+
+// staticCollector returns the same container metrics on every collection.
+type staticCollector []types.ContainerMetrics
+
+func (s staticCollector) Collect(ctx context.Context, filter types.ContainerFilter) ([]types.ContainerMetrics, error) {
+	return s, nil
+}
+
+func (s staticCollector) CollectContainer(ctx context.Context, idOrName string) (types.ContainerMetrics, error) {
+	return types.ContainerMetrics{}, echo.NewHTTPError(http.StatusNotFound, "Container not found")
+}
+
+func TestHealthHistory(t *testing.T) {
+	history := newHealthHistory(2, 10*time.Minute)
+	start := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+	key := healthKey("", "f3f177b2b3b4c1d2e3f4a5b6c7d8e9f0")
+	assert.Equal(t, "/f3f177b2b3b4", key)
+
+	history.observe(key, "healthy", start)
+	history.observe(key, "unhealthy", start.Add(time.Minute))
+	// A restart resets the status to starting, which does not count as a change.
+	history.observe(key, "starting", start.Add(2*time.Minute))
+	history.observe(key, "unhealthy", start.Add(3*time.Minute))
+	history.observe(key, "healthy", start.Add(4*time.Minute))
+	// A collection that started before the last change is ignored.
+	history.observe(key, "unhealthy", start.Add(3*time.Minute+30*time.Second))
+
+	changes, flapping := history.changes(key, start.Add(5*time.Minute))
+	assert.Equal(t, []time.Time{start.Add(time.Minute), start.Add(4 * time.Minute)}, changes)
+	assert.False(t, flapping)
+
+	history.observe(key, "unhealthy", start.Add(5*time.Minute))
+	_, flapping = history.changes(key, start.Add(5*time.Minute))
+	assert.True(t, flapping)
+
+	// Changes older than the window are dropped.
+	changes, flapping = history.changes(key, start.Add(12*time.Minute))
+	assert.Len(t, changes, 2)
+	assert.False(t, flapping)
+
+	// Containers not seen within the window are forgotten.
+	history.observeAll(nil, start.Add(30*time.Minute))
+	changes, _ = history.changes(key, start.Add(30*time.Minute))
+	assert.Empty(t, changes)
+}
+
+func TestHealthChecks(t *testing.T) {
+	var inspect types.DockerInspect
+	err := json.Unmarshal([]byte(`{"State": {"Health": {"Status": "unhealthy", "FailingStreak": 2, "Log": [
+		{"Start": "2021-09-01T12:00:00Z", "End": "2021-09-01T12:00:00.1Z", "ExitCode": 0, "Output": "ok"},
+		{"Start": "2021-09-01T12:00:30Z", "End": "2021-09-01T12:00:30.25Z", "ExitCode": 1, "Output": "refused"},
+		{"Start": "2021-09-01T12:01:00Z", "End": "2021-09-01T12:01:05Z", "ExitCode": -1, "Output": "Health check exceeded timeout (5s)"}
+	]}}}`), &inspect)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal inspect: %v", err)
+	}
+
+	previous := healthLogEntries
+	defer func() { healthLogEntries = previous }()
+	healthLogEntries = 2
+
+	var metrics types.ContainerMetrics
+	applyInspect(&metrics, inspect, time.Now())
+	assert.Equal(t, "unhealthy", metrics.ContainerHealthStatus)
+	assert.Equal(t, 2, metrics.ContainerHealthFailures)
+	assert.Equal(t, []types.HealthCheck{
+		{Start: "2021-09-01T12:01:00Z", End: "2021-09-01T12:01:05Z", ExitCode: -1, Output: "Health check exceeded timeout (5s)", DurationSeconds: 5},
+		{Start: "2021-09-01T12:00:30Z", End: "2021-09-01T12:00:30.25Z", ExitCode: 1, Output: "refused", DurationSeconds: 0.25},
+	}, metrics.ContainerHealthLog)
+}
+
+func TestGetContainerHealth(t *testing.T) {
+	previous, previousHealth := collector, containerHealth
+	defer func() {
+		SetCollector(previous)
+		containerHealth = previousHealth
+	}()
+	containerHealth = newHealthHistory(1, time.Hour)
+
+	list := staticCollector{
+		{ContainerID: "aaaaaaaaaaaa", ContainerName: "web", ContainerHealthStatus: "healthy"},
+		{ContainerID: "bbbbbbbbbbbb", ContainerName: "db", ContainerHealthStatus: "unhealthy", ContainerHealthFailures: 4,
+			ContainerHealthLog: []types.HealthCheck{{ExitCode: 1, Output: "refused"}}},
+		{ContainerID: "cccccccccccc", ContainerName: "worker", ContainerHealthStatus: "starting"},
+		{ContainerID: "dddddddddddd", ContainerName: "job"},
+	}
+	SetCollector(list)
+
+	// The web container went from healthy to unhealthy and back before this request.
+	now := time.Now()
+	containerHealth.observe(healthKey("", "aaaaaaaaaaaa"), "healthy", now.Add(-3*time.Minute))
+	containerHealth.observe(healthKey("", "aaaaaaaaaaaa"), "unhealthy", now.Add(-2*time.Minute))
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/health/containers", nil), rec)
+	if !assert.NoError(t, GetContainerHealth(c)) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response types.HealthResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	assert.Equal(t, types.HealthSummary{Total: 3, Healthy: 1, Unhealthy: 1, Starting: 1, Flapping: 1}, response.Data.Summary)
+	if assert.Len(t, response.Data.Containers, 2) {
+		db, web := response.Data.Containers[0], response.Data.Containers[1]
+		assert.Equal(t, "db", db.ContainerName)
+		assert.Equal(t, 4, db.FailingStreak)
+		assert.False(t, db.Flapping)
+		assert.Equal(t, []types.HealthCheck{{ExitCode: 1, Output: "refused"}}, db.Log)
+		assert.Equal(t, "web", web.ContainerName)
+		assert.Equal(t, 2, web.StatusChanges)
+		assert.True(t, web.Flapping)
+		assert.NotEmpty(t, web.LastChangeAt)
+		assert.Equal(t, []types.HealthCheck{}, web.Log)
+	}
+
+	rec = httptest.NewRecorder()
+	c = e.NewContext(httptest.NewRequest(http.MethodGet, "/api/health/containers?all=true", nil), rec)
+	if assert.NoError(t, GetContainerHealth(c)) {
+		var response types.HealthResponse
+		_ = json.Unmarshal(rec.Body.Bytes(), &response)
+		assert.Len(t, response.Data.Containers, 3)
+	}
+
+	c = e.NewContext(httptest.NewRequest(http.MethodGet, "/api/health/containers?all=maybe", nil), httptest.NewRecorder())
+	err := GetContainerHealth(c)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	}
+}
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"vchan.in/doctor-metrics/selfmetrics"
+	"vchan.in/doctor-metrics/types"
+)
+
+// Error of inspectContainer when docker inspect returns no container.
+var errNoSuchContainer = errors.New("no such container")
+
+// Container event actions that change the output of docker inspect.
+var invalidatingActions = map[string]bool{
+	"create":        true,
+	"start":         true,
+	"restart":       true,
+	"die":           true,
+	"stop":          true,
+	"pause":         true,
+	"unpause":       true,
+	"rename":        true,
+	"update":        true,
+	"destroy":       true,
+	"oom":           true,
+	"health_status": true,
+}
+
+// inspectCache caches docker inspect results while the docker events stream is connected.
+type inspectCache struct {
+	mu         sync.Mutex
+	watching   bool                           // Whether the events stream is connected, entries are only trusted while it is
+	generation uint64                         // Incremented on every invalidation to discard results of in-flight inspects
+	containers map[string]types.DockerInspect // Inspect results keyed by the container ID or name they were requested with
+	digests    map[string]string              // Repository digests keyed by image ID, images are immutable so never invalidated
+}
+
+var containerCache = newInspectCache()
+
+func newInspectCache() *inspectCache {
+	return &inspectCache{
+		containers: make(map[string]types.DockerInspect),
+		digests:    make(map[string]string),
+	}
+}
+
+func (c *inspectCache) get(key string) (types.DockerInspect, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	inspect, ok := c.containers[key]
+	return inspect, c.generation, ok && c.watching
+}
+
+func (c *inspectCache) put(key string, inspect types.DockerInspect, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Drop the result if an event arrived while docker inspect was running.
+	if c.watching && c.generation == generation {
+		c.containers[key] = inspect
+	}
+}
+
+func (c *inspectCache) invalidate(fullID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for key, inspect := range c.containers {
+		if inspect.ID == fullID {
+			delete(c.containers, key)
+		}
+	}
+}
+
+func (c *inspectCache) setWatching(watching bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Events may have been missed while disconnected, start over either way.
+	c.watching = watching
+	c.generation++
+	c.containers = make(map[string]types.DockerInspect)
+}
+
+func inspectContainer(ctx context.Context, containerID string) (types.DockerInspect, error) {
+	/*
+		Get the docker inspect output of a container.
+
+		Function input is a container ID or name like "f3f177b2b3b4".
+		Results are served from the cache while WatchContainerEvents is connected to the docker events stream.
+	*/
+	inspect, generation, ok := containerCache.get(containerID)
+	if ok {
+		return inspect, nil
+	}
+
+	output, err := dockerOutput(ctx, "inspect", containerID)
+	if err != nil {
+		return types.DockerInspect{}, err
+	}
+
+	var inspects []types.DockerInspect
+	if err := json.Unmarshal(output, &inspects); err != nil {
+		return types.DockerInspect{}, err
+	}
+	if len(inspects) == 0 {
+		return types.DockerInspect{}, fmt.Errorf("%w: %s", errNoSuchContainer, containerID)
+	}
+
+	containerCache.put(containerID, inspects[0], generation)
+	return inspects[0], nil
+}
+
+func isNoSuchContainer(err error) bool {
+	// Whether docker inspect failed because the container does not exist, e.g. "Error: No such object: web".
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return strings.Contains(strings.ToLower(string(exitErr.Stderr)), "no such")
+	}
+	return errors.Is(err, errNoSuchContainer)
+}
+
+func imageDigest(ctx context.Context, imageID string) string {
+	/*
+		Get the repository digest of an image like "nginx@sha256:0b970013351...".
+		Returns an empty string for images that were built locally and never pushed or pulled.
+	*/
+	containerCache.mu.Lock()
+	digest, ok := containerCache.digests[imageID]
+	containerCache.mu.Unlock()
+	if ok {
+		return digest
+	}
+
+	output, err := dockerOutput(ctx, "image", "inspect", "--format={{json .RepoDigests}}", imageID)
+	if err != nil {
+		return ""
+	}
+	var repoDigests []string
+	if err := json.Unmarshal(output, &repoDigests); err != nil {
+		return ""
+	}
+	if len(repoDigests) > 0 {
+		digest = repoDigests[0]
+	}
+
+	containerCache.mu.Lock()
+	containerCache.digests[imageID] = digest
+	containerCache.mu.Unlock()
+	return digest
+}
+
+func applyInspect(metrics *types.ContainerMetrics, inspect types.DockerInspect, now time.Time) {
+	// Copy container metadata from docker inspect output into the metrics.
+	metrics.ContainerName = strings.TrimPrefix(inspect.Name, "/")
+	metrics.ContainerImage = inspect.Config.Image
+	metrics.ContainerImageID = inspect.Image
+	metrics.ContainerLabels = inspect.Config.Labels
+	metrics.ContainerCreatedAt = formatDockerTime(inspect.Created)
+	metrics.ContainerStartedAt = formatDockerTime(inspect.State.StartedAt)
+	metrics.ContainerState = inspect.State.Status
+	metrics.ContainerExitCode = inspect.State.ExitCode
+	metrics.ContainerRestartCount = inspect.RestartCount
+	metrics.ContainerRestartPolicy = inspect.HostConfig.RestartPolicy.Name
+	if metrics.ContainerRestartPolicy == "" {
+		metrics.ContainerRestartPolicy = "no"
+	}
+	if inspect.State.Health != nil {
+		metrics.ContainerHealthStatus = inspect.State.Health.Status
+		metrics.ContainerHealthFailures = inspect.State.Health.FailingStreak
+		metrics.ContainerHealthLog = healthChecks(inspect)
+	}
+
+	startedAt, err := time.Parse(time.RFC3339Nano, inspect.State.StartedAt)
+	if err == nil && inspect.State.Status == "running" {
+		metrics.ContainerUptimeSeconds = int64(now.Sub(startedAt).Seconds())
+	}
+}
+
+func formatDockerTime(value string) string {
+	// Convert a docker timestamp to RFC3339, the zero time docker uses for "never" becomes empty.
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil || t.IsZero() || t.Year() <= 1 {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func WatchContainerEvents(ctx context.Context) {
+	/*
+		WatchContainerEvents follows "docker events" and invalidates cached inspect results of containers
+		that were started, stopped, renamed, updated, removed or changed health status.
+		Health status changes are also recorded for the flapping detection of GET /api/health/containers.
+
+		The inspect cache is only used while the stream is connected. If docker events exits,
+		it is restarted with an increasing delay until the context is cancelled.
+	*/
+	backoff := time.Second
+	for {
+		started := time.Now()
+		err := followContainerEvents(ctx)
+		containerCache.setWatching(false)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			selfmetrics.CountDockerError("cli", runtimeErrorType(ctx, err))
+		}
+		slog.Warn("Docker events stream disconnected, inspect cache disabled", "error", err, "retry_in", backoff.String())
+
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+func eventTime(event types.DockerEvent) time.Time {
+	// Return when docker emitted an event, or the current time for events without a timestamp.
+	if event.TimeNano > 0 {
+		return time.Unix(0, event.TimeNano)
+	}
+	return time.Now()
+}
+
+func followContainerEvents(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "docker", "events", "--filter", "type=container", "--format", "{{json .}}")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	containerCache.setWatching(true)
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		var event types.DockerEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		action, status, _ := strings.Cut(event.Action, ":")
+		if invalidatingActions[action] {
+			containerCache.invalidate(event.Actor.ID)
+		}
+		if action == "health_status" {
+			containerHealth.observe(healthKey("", event.Actor.ID), strings.TrimSpace(status), eventTime(event))
+		}
+	}
+	// Stop trusting the cache before waiting for the process to exit.
+	containerCache.setWatching(false)
+	if err := scanner.Err(); err != nil {
+		_ = cmd.Wait()
+		return err
+	}
+	return cmd.Wait()
+}
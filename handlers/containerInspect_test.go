@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/types"
+)
+
+const inspectFixture = `[
+	{
+		"Id": "f3f177b2b3b4c1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6",
+		"Name": "/shop-web-1",
+		"Created": "2021-09-01T12:00:00.123456789Z",
+		"Image": "sha256:3b25b682ea82b2db3cc4fd48db818be788ee3f902ac7378090cf2624ec2442df",
+		"RestartCount": 2,
+		"State": {
+			"Status": "running",
+			"Pid": 4242,
+			"ExitCode": 0,
+			"StartedAt": "2021-09-01T12:30:00.5Z",
+			"FinishedAt": "0001-01-01T00:00:00Z",
+			"Health": {"Status": "healthy"}
+		},
+		"Config": {
+			"Image": "nginx:1.27",
+			"Labels": {"com.docker.compose.project": "shop", "com.docker.compose.service": "web"}
+		},
+		"HostConfig": {"RestartPolicy": {"Name": "unless-stopped"}}
+	}
+]`
+
+func TestApplyInspect(t *testing.T) {
+	var inspects []types.DockerInspect
+	if err := json.Unmarshal([]byte(inspectFixture), &inspects); err != nil {
+		t.Fatalf("Failed to unmarshal inspect fixture: %v", err)
+	}
+
+	var metrics types.ContainerMetrics
+	now := time.Date(2021, 9, 1, 13, 30, 0, 500000000, time.UTC)
+	applyInspect(&metrics, inspects[0], now)
+
+	assert.Equal(t, "shop-web-1", metrics.ContainerName)
+	assert.Equal(t, "nginx:1.27", metrics.ContainerImage)
+	assert.Equal(t, "sha256:3b25b682ea82b2db3cc4fd48db818be788ee3f902ac7378090cf2624ec2442df", metrics.ContainerImageID)
+	assert.Equal(t, "shop", metrics.ContainerLabels["com.docker.compose.project"])
+	assert.Equal(t, "2021-09-01T12:00:00Z", metrics.ContainerCreatedAt)
+	assert.Equal(t, "2021-09-01T12:30:00Z", metrics.ContainerStartedAt)
+	assert.Equal(t, int64(3600), metrics.ContainerUptimeSeconds)
+	assert.Equal(t, "running", metrics.ContainerState)
+	assert.Equal(t, 2, metrics.ContainerRestartCount)
+	assert.Equal(t, "unless-stopped", metrics.ContainerRestartPolicy)
+	assert.Equal(t, "healthy", metrics.ContainerHealthStatus)
+}
+
+func TestApplyInspectExited(t *testing.T) {
+	var inspect types.DockerInspect
+	inspect.Name = "/job"
+	inspect.State.Status = "exited"
+	inspect.State.ExitCode = 137
+	inspect.State.StartedAt = "2021-09-01T12:30:00Z"
+
+	var metrics types.ContainerMetrics
+	applyInspect(&metrics, inspect, time.Now())
+
+	assert.Equal(t, "exited", metrics.ContainerState)
+	assert.Equal(t, 137, metrics.ContainerExitCode)
+	assert.Equal(t, int64(0), metrics.ContainerUptimeSeconds)
+	assert.Equal(t, "no", metrics.ContainerRestartPolicy)
+	assert.Empty(t, metrics.ContainerHealthStatus)
+}
+
+func TestInspectCacheInvalidation(t *testing.T) {
+	cache := newInspectCache()
+	inspect := types.DockerInspect{ID: "f3f177b2b3b4c1d2"}
+
+	// Nothing is cached while the events stream is disconnected.
+	_, generation, _ := cache.get("f3f177b2b3b4")
+	cache.put("f3f177b2b3b4", inspect, generation)
+	_, _, ok := cache.get("f3f177b2b3b4")
+	assert.False(t, ok)
+
+	cache.setWatching(true)
+	_, generation, _ = cache.get("f3f177b2b3b4")
+	cache.put("f3f177b2b3b4", inspect, generation)
+	cache.put("shop-web-1", inspect, generation)
+	_, _, ok = cache.get("f3f177b2b3b4")
+	assert.True(t, ok)
+
+	// An event for the full ID removes the entries under every key.
+	cache.invalidate("f3f177b2b3b4c1d2")
+	_, _, ok = cache.get("f3f177b2b3b4")
+	assert.False(t, ok)
+	_, _, ok = cache.get("shop-web-1")
+	assert.False(t, ok)
+
+	// Results of an inspect that raced with an event are discarded.
+	_, generation, _ = cache.get("f3f177b2b3b4")
+	cache.invalidate("0123456789ab")
+	cache.put("f3f177b2b3b4", inspect, generation)
+	_, _, ok = cache.get("f3f177b2b3b4")
+	assert.False(t, ok)
+}
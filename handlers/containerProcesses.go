@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"vchan.in/doctor-metrics/procfs"
+	"vchan.in/doctor-metrics/types"
+)
+
+// Arguments of the ps command the Docker daemon runs for GET /containers/{id}/top.
+const topPsArgs = "-eo pid,ppid,user,pcpu,rss,args"
+
+// processLister is implemented by collectors that can list the processes of a container.
+type processLister interface {
+	// ContainerProcesses returns the processes of a running container by ID, ID prefix or name.
+	ContainerProcesses(ctx context.Context, idOrName string) (types.ContainerProcesses, error)
+}
+
+// Order of the processes by JSON field, used for sorting.
+var processSortFields = map[string]func(a, b types.ContainerProcess) int{
+	"pid":         func(a, b types.ContainerProcess) int { return cmp.Compare(a.PID, b.PID) },
+	"ppid":        func(a, b types.ContainerProcess) int { return cmp.Compare(a.PPID, b.PPID) },
+	"user":        func(a, b types.ContainerProcess) int { return cmp.Compare(a.User, b.User) },
+	"command":     func(a, b types.ContainerProcess) int { return cmp.Compare(a.Command, b.Command) },
+	"cpu_percent": func(a, b types.ContainerProcess) int { return cmp.Compare(a.CPUPercent, b.CPUPercent) },
+	"rss_bytes":   func(a, b types.ContainerProcess) int { return cmp.Compare(a.RSSBytes, b.RSSBytes) },
+}
+
+// processSample is the state of the processes of a container at one point in time.
+type processSample struct {
+	at    time.Time
+	stats map[int]procfs.ProcessStat // Process state by PID
+}
+
+// processSampler keeps the last process sample of each container to compute CPU usage between requests.
+type processSampler struct {
+	sampleInterval time.Duration // Wait between two samples when no recent sample exists
+
+	mu       sync.Mutex
+	previous map[string]processSample // Last sample by full container ID
+}
+
+var containerProcessSampler = &processSampler{sampleInterval: time.Second, previous: make(map[string]processSample)}
+
+func (s *processSampler) sample(fs procfs.FS, pid int) (processSample, error) {
+	// Read the state of every process in the cgroup of the container init process.
+	pids, err := fs.CgroupProcesses(pid)
+	if err != nil {
+		return processSample{}, err
+	}
+	sample := processSample{at: time.Now(), stats: make(map[int]procfs.ProcessStat, len(pids))}
+	for _, pid := range pids {
+		stat, err := fs.ProcessStat(pid)
+		if err != nil {
+			continue // Exited since the cgroup was read
+		}
+		sample.stats[pid] = stat
+	}
+	return sample, nil
+}
+
+func (s *processSampler) processes(ctx context.Context, fs procfs.FS, containerID string, pid int) ([]types.ContainerProcess, error) {
+	/*
+		Get the processes of a container and their CPU usage since the previous sample of the container.
+
+		Without a sample from the last minute, the processes are sampled again after a short wait.
+		Function returns the processes ordered by PID.
+	*/
+	current, err := s.sample(fs, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	previous, ok := s.previous[containerID]
+	s.mu.Unlock()
+	if !ok || time.Since(previous.at) > maxSampleAge {
+		previous = current
+		select {
+		case <-time.After(s.sampleInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if current, err = s.sample(fs, pid); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	s.previous[containerID] = current
+	for id, sample := range s.previous {
+		if time.Since(sample.at) > maxSampleAge {
+			delete(s.previous, id) // Containers that are no longer requested
+		}
+	}
+	s.mu.Unlock()
+
+	users := fs.UserNames(pid)
+	elapsed := current.at.Sub(previous.at)
+	processes := make([]types.ContainerProcess, 0, len(current.stats))
+	for _, stat := range current.stats {
+		user, ok := users[stat.UID]
+		if !ok {
+			user = strconv.Itoa(stat.UID)
+		}
+		processes = append(processes, types.ContainerProcess{
+			PID:        stat.PID,
+			PPID:       stat.PPID,
+			User:       user,
+			Command:    stat.Command,
+			CPUPercent: procfs.ProcessCPUPercent(previous.stats[stat.PID], stat, elapsed),
+			RSSBytes:   stat.RSSBytes,
+		})
+	}
+	slices.SortFunc(processes, func(a, b types.ContainerProcess) int { return cmp.Compare(a.PID, b.PID) })
+	return processes, nil
+}
+
+func localContainerProcesses(ctx context.Context, fs procfs.FS, inspect types.DockerInspect) (types.ContainerProcesses, error) {
+	// List the processes of a container on this host from procfs, located through the PID of its init process.
+	if inspect.State.Pid == 0 {
+		return types.ContainerProcesses{}, echo.NewHTTPError(http.StatusConflict, "Container is not running")
+	}
+	processes, err := containerProcessSampler.processes(ctx, fs, inspect.ID, inspect.State.Pid)
+	if err != nil {
+		return types.ContainerProcesses{}, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve container processes").SetInternal(err)
+	}
+	return types.ContainerProcesses{
+		Timestamp:     time.Now().UTC().Format(time.RFC3339),
+		ContainerID:   inspect.ID[:min(12, len(inspect.ID))],
+		ContainerName: strings.TrimPrefix(inspect.Name, "/"),
+		ProcessCount:  len(processes),
+		Processes:     processes,
+	}, nil
+}
+
+func (DockerCollector) ContainerProcesses(ctx context.Context, idOrName string) (types.ContainerProcesses, error) {
+	inspect, err := inspectContainer(ctx, idOrName)
+	if err != nil {
+		return types.ContainerProcesses{}, echo.NewHTTPError(http.StatusNotFound, "Container not found")
+	}
+	return localContainerProcesses(ctx, procfs.NewFS(), inspect)
+}
+
+func (p *PodmanCollector) ContainerProcesses(ctx context.Context, idOrName string) (types.ContainerProcesses, error) {
+	var inspect types.DockerInspect
+	err := p.client.getJSON(ctx, "/containers/"+url.PathEscape(idOrName)+"/json", nil, &inspect)
+	var engineErr *engineError
+	if errors.As(err, &engineErr) && engineErr.StatusCode == http.StatusNotFound {
+		return types.ContainerProcesses{}, echo.NewHTTPError(http.StatusNotFound, "Container not found")
+	}
+	if err != nil {
+		return types.ContainerProcesses{}, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve container processes").SetInternal(err)
+	}
+	return localContainerProcesses(ctx, p.fs, inspect)
+}
+
+func (e *EngineCollector) ContainerProcesses(ctx context.Context, idOrName string) (types.ContainerProcesses, error) {
+	/*
+		List the processes of a container with the top endpoint of the Engine API, which runs ps on the daemon host.
+		The CPU usage reported by ps is the average over the lifetime of each process.
+	*/
+	var inspect types.DockerInspect
+	err := e.client.getJSON(ctx, "/containers/"+url.PathEscape(idOrName)+"/json", nil, &inspect)
+	var engineErr *engineError
+	if errors.As(err, &engineErr) && engineErr.StatusCode == http.StatusNotFound {
+		return types.ContainerProcesses{}, echo.NewHTTPError(http.StatusNotFound, "Container not found")
+	}
+	if err != nil {
+		return types.ContainerProcesses{}, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve container processes").SetInternal(err)
+	}
+	if inspect.State.Status != "running" {
+		return types.ContainerProcesses{}, echo.NewHTTPError(http.StatusConflict, "Container is not running")
+	}
+
+	var top types.DockerTop
+	err = e.client.getJSON(ctx, "/containers/"+inspect.ID+"/top", url.Values{"ps_args": {topPsArgs}}, &top)
+	if errors.As(err, &engineErr) && engineErr.StatusCode == http.StatusConflict {
+		return types.ContainerProcesses{}, echo.NewHTTPError(http.StatusConflict, "Container is not running")
+	}
+	if err != nil {
+		return types.ContainerProcesses{}, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve container processes").SetInternal(err)
+	}
+	processes, err := parseTop(top)
+	if err != nil {
+		return types.ContainerProcesses{}, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve container processes").SetInternal(err)
+	}
+	return types.ContainerProcesses{
+		Timestamp:     time.Now().UTC().Format(time.RFC3339),
+		ContainerID:   inspect.ID[:min(12, len(inspect.ID))],
+		ContainerName: strings.TrimPrefix(inspect.Name, "/"),
+		ProcessCount:  len(processes),
+		Processes:     processes,
+	}, nil
+}
+
+func parseTop(top types.DockerTop) ([]types.ContainerProcess, error) {
+	/*
+		Parse the output of ps -eo pid,ppid,user,pcpu,rss,args returned by the top endpoint.
+
+		{"Titles": ["PID", "PPID", "USER", "%CPU", "RSS", "COMMAND"], "Processes": [["4242", "4200", "root", "0.5", "10240", "nginx: master process"]]}
+
+		RSS is reported by ps in KiB. Function returns the processes ordered by PID.
+	*/
+	columns := make(map[string]int, len(top.Titles))
+	for i, title := range top.Titles {
+		columns[title] = i
+	}
+	for _, title := range []string{"PID", "PPID", "USER", "%CPU", "RSS", "COMMAND"} {
+		if _, ok := columns[title]; !ok {
+			return nil, fmt.Errorf("missing %s column in top output", title)
+		}
+	}
+
+	processes := make([]types.ContainerProcess, 0, len(top.Processes))
+	for _, row := range top.Processes {
+		if len(row) != len(top.Titles) {
+			return nil, fmt.Errorf("malformed top output row %q", row)
+		}
+		var process types.ContainerProcess
+		var err1, err2 error
+		process.PID, err1 = strconv.Atoi(row[columns["PID"]])
+		process.PPID, err2 = strconv.Atoi(row[columns["PPID"]])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("malformed top output row %q", row)
+		}
+		process.User = row[columns["USER"]]
+		process.Command = row[columns["COMMAND"]]
+		process.CPUPercent, _ = strconv.ParseFloat(row[columns["%CPU"]], 64)
+		rss, _ := strconv.ParseInt(row[columns["RSS"]], 10, 64)
+		process.RSSBytes = rss * 1024
+		processes = append(processes, process)
+	}
+	slices.SortFunc(processes, func(a, b types.ContainerProcess) int { return cmp.Compare(a.PID, b.PID) })
+	return processes, nil
+}
+
+func (h *HostsCollector) ContainerProcesses(ctx context.Context, idOrName string) (types.ContainerProcesses, error) {
+	/*
+		List the processes of a container by ID or name from the first host in configuration order that has it.
+		Each host is called with its own timeout, a host that does not answer in time counts as unreachable.
+		Function returns an HTTP 404 error when no reachable host has the container.
+	*/
+	failed := 0
+	for _, host := range h.hosts {
+		lister, ok := host.Collector.(processLister)
+		if !ok {
+			failed++
+			continue
+		}
+		var processes types.ContainerProcesses
+		err := h.call(ctx, func(ctx context.Context) (err error) {
+			processes, err = lister.ContainerProcesses(ctx, idOrName)
+			return err
+		})
+		if err == nil {
+			processes.Host = host.Name
+			return processes, nil
+		}
+		var httpErr *echo.HTTPError
+		switch {
+		case errors.As(err, &httpErr) && httpErr.Code == http.StatusNotFound:
+		case errors.As(err, &httpErr) && httpErr.Code == http.StatusConflict:
+			return types.ContainerProcesses{}, err // The host has the container, but it is stopped
+		default:
+			failed++
+		}
+	}
+	if failed == len(h.hosts) {
+		return types.ContainerProcesses{}, echo.NewHTTPError(http.StatusBadGateway, "Failed to retrieve container processes from any host")
+	}
+	return types.ContainerProcesses{}, echo.NewHTTPError(http.StatusNotFound, "Container not found")
+}
+
+// processQuery holds the sort order and limit of a container processes request.
+type processQuery struct {
+	compares []func(a, b types.ContainerProcess) int // Sort keys in order of precedence
+	limit    int                                     // Maximum number of processes returned, 0 for no limit
+}
+
+func parseProcessQuery(values url.Values) (processQuery, error) {
+	/*
+		Parse the query parameters of a container processes request.
+
+		?sort=-cpu_percent,pid&limit=10
+
+		Processes are ordered by CPU usage, highest first, unless a sort order is requested.
+		Function returns an error describing the first invalid parameter.
+	*/
+	var query processQuery
+	sortFields := splitQueryValues(values["sort"])
+	if len(sortFields) == 0 {
+		sortFields = []string{"-cpu_percent", "pid"}
+	}
+	for _, field := range sortFields {
+		name, descending := strings.TrimPrefix(field, "-"), strings.HasPrefix(field, "-")
+		compare, ok := processSortFields[name]
+		if !ok {
+			return query, fmt.Errorf("unknown sort field %q", name)
+		}
+		if descending {
+			compare = func(a, b types.ContainerProcess) int { return processSortFields[name](b, a) }
+		}
+		query.compares = append(query.compares, compare)
+	}
+	var err error
+	if query.limit, err = parseNonNegative(values.Get("limit")); err != nil {
+		return query, fmt.Errorf("invalid limit: %w", err)
+	}
+	return query, nil
+}
+
+func (q processQuery) apply(processes []types.ContainerProcess) []types.ContainerProcess {
+	// Sort and limit the processes of a container.
+	slices.SortStableFunc(processes, func(a, b types.ContainerProcess) int {
+		for _, compare := range q.compares {
+			if result := compare(a, b); result != 0 {
+				return result
+			}
+		}
+		return 0
+	})
+	if q.limit > 0 && len(processes) > q.limit {
+		processes = processes[:q.limit]
+	}
+	return processes
+}
+
+func GetContainerProcesses(c echo.Context) error {
+	/*
+		Get the processes running in a container, like docker top.
+
+		GET /api/containers/web/processes?sort=-rss_bytes&limit=10
+
+		{
+		  "container_processes": {
+		    "timestamp": "2021-09-01T12:34:56Z",
+		    "container_id": "f3f177b2b3b4",
+		    "container_name": "web",
+		    "process_count": 5,
+		    "processes": [
+		      {"pid": 4250, "ppid": 4242, "user": "nginx", "command": "nginx: worker process", "cpu_percent": 12.5, "rss_bytes": 10485760},
+		      ...
+		    ]
+		  }
+		}
+
+		Function takes a container ID, ID prefix or name as input.
+		Function returns a JSON response with the sorted and limited processes, an HTTP 404 error when
+		the container or process listing is not available, or an HTTP 409 error when the container is not running.
+	*/
+	lister, ok := collector.(processLister)
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "Process listing is not available with the configured runtime")
+	}
+	query, err := parseProcessQuery(c.QueryParams())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	processes, err := lister.ContainerProcesses(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	processes.Processes = query.apply(processes.Processes)
+
+	response := types.ContainerProcessesResponse{
+		Status:  "success",
+		Message: "Container processes retrieved successfully",
+	}
+	response.Data.ContainerProcesses = processes
+
+	return c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/procfs"
+	"vchan.in/doctor-metrics/types"
+)
+
+func TestPodmanContainerProcesses(t *testing.T) {
+	podman, _ := startFakePodman(t)
+
+	// The init process of the web container runs as root and a worker as nginx in a child cgroup.
+	root := t.TempDir()
+	proc, cgroup := filepath.Join(root, "proc"), filepath.Join(root, "cgroup")
+	scope := filepath.Join(cgroup, "user.slice", "libpod-a1b2c3d4e5f6.scope")
+	writeFakeFile(t, filepath.Join(cgroup, "cgroup.controllers"), "cpu pids\n")
+	writeFakeFile(t, filepath.Join(scope, "cgroup.procs"), "4242\n")
+	writeFakeFile(t, filepath.Join(scope, "worker", "cgroup.procs"), "4250\n")
+	writeFakeFile(t, filepath.Join(proc, "4242", "cgroup"), "0::/user.slice/libpod-a1b2c3d4e5f6.scope\n")
+	writeFakeFile(t, filepath.Join(proc, "4242", "root", "etc", "passwd"), "root:x:0:0:root:/root:/bin/sh\nnginx:x:101:101::/:/bin/false\n")
+	for pid, process := range map[string]struct{ stat, status, cmdline string }{
+		"4242": {"4242 (nginx) S 1 4242 4242 0 -1 0 0 0 0 0 20 10 0 0 20 0 1 0 1000 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0\n",
+			"Name:\tnginx\nPPid:\t4200\nUid:\t0\t0\t0\t0\nVmRSS:\t10240 kB\n", "nginx: master process\x00"},
+		"4250": {"4250 (nginx) R 4242 4242 4242 0 -1 0 0 0 0 0 150 50 0 0 20 0 1 0 2000 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0\n",
+			"Name:\tnginx\nPPid:\t4242\nUid:\t101\t101\t101\t101\nVmRSS:\t20480 kB\n", "nginx: worker process\x00"},
+	} {
+		writeFakeFile(t, filepath.Join(proc, pid, "stat"), process.stat)
+		writeFakeFile(t, filepath.Join(proc, pid, "status"), process.status)
+		writeFakeFile(t, filepath.Join(proc, pid, "cmdline"), process.cmdline)
+	}
+	podman.fs = procfs.FS{ProcRoot: proc, CgroupRoot: cgroup}
+
+	// Two seconds ago the worker had used 100 fewer ticks, half a core since then.
+	containerProcessSampler.previous[podmanWebID] = processSample{
+		at: time.Now().Add(-2 * time.Second),
+		stats: map[int]procfs.ProcessStat{
+			4242: {PID: 4242, CPUTicks: 30, StartTicks: 1000},
+			4250: {PID: 4250, CPUTicks: 100, StartTicks: 2000},
+		},
+	}
+	defer delete(containerProcessSampler.previous, podmanWebID)
+
+	processes, err := podman.ContainerProcesses(context.Background(), "shop-web")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "a1b2c3d4e5f6", processes.ContainerID)
+	assert.Equal(t, "shop-web", processes.ContainerName)
+	if assert.Len(t, processes.Processes, 2) {
+		assert.InDelta(t, 50, processes.Processes[1].CPUPercent, 1)
+		processes.Processes[1].CPUPercent = 0
+	}
+	assert.Equal(t, 2, processes.ProcessCount)
+	assert.Equal(t, []types.ContainerProcess{
+		{PID: 4242, PPID: 4200, User: "root", Command: "nginx: master process", RSSBytes: 10 << 20},
+		{PID: 4250, PPID: 4242, User: "nginx", Command: "nginx: worker process", RSSBytes: 20 << 20},
+	}, processes.Processes)
+
+	_, err = podman.ContainerProcesses(context.Background(), podmanDBID)
+	if httpErr, ok := err.(*echo.HTTPError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusConflict, httpErr.Code)
+	}
+	_, err = podman.ContainerProcesses(context.Background(), "missing")
+	if httpErr, ok := err.(*echo.HTTPError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusNotFound, httpErr.Code)
+	}
+}
+
+func TestParseTopMalformed(t *testing.T) {
+	_, err := parseTop(types.DockerTop{Titles: []string{"UID", "PID", "CMD"}})
+	assert.Error(t, err)
+	_, err = parseTop(types.DockerTop{
+		Titles:    []string{"PID", "PPID", "USER", "%CPU", "RSS", "COMMAND"},
+		Processes: [][]string{{"4242", "4200", "root"}},
+	})
+	assert.Error(t, err)
+}
+
+func TestGetContainerProcesses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(fakeEngine))
+	defer server.Close()
+	previous := collector
+	defer SetCollector(previous)
+	SetCollector(NewHostsCollector([]NamedCollector{
+		{Name: "build-01", Collector: newEngineCollector(&engineClient{http: server.Client(), baseURL: server.URL})},
+	}, 0))
+
+	e := echo.New()
+	get := func(target string) (*httptest.ResponseRecorder, error) {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, target, nil), rec)
+		c.SetParamNames("id")
+		c.SetParamValues("web")
+		return rec, GetContainerProcesses(c)
+	}
+
+	rec, err := get("/api/containers/web/processes?limit=2")
+	if !assert.NoError(t, err) {
+		return
+	}
+	var response types.ContainerProcessesResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	processes := response.Data.ContainerProcesses
+	assert.Equal(t, "build-01", processes.Host)
+	assert.Equal(t, "d1e2f3a4b5c6", processes.ContainerID)
+	assert.Equal(t, 3, processes.ProcessCount)
+	// Ordered by CPU usage by default, RSS is converted from KiB.
+	if assert.Len(t, processes.Processes, 2) {
+		assert.Equal(t, types.ContainerProcess{PID: 4250, PPID: 4242, User: "101", Command: "nginx: worker process", CPUPercent: 12.5, RSSBytes: 20 << 20}, processes.Processes[0])
+		assert.Equal(t, 4251, processes.Processes[1].PID)
+	}
+
+	rec, err = get("/api/containers/web/processes?sort=-rss_bytes")
+	if assert.NoError(t, err) {
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		if assert.Len(t, response.Data.ContainerProcesses.Processes, 3) {
+			assert.Equal(t, 4251, response.Data.ContainerProcesses.Processes[0].PID)
+			assert.Equal(t, 4242, response.Data.ContainerProcesses.Processes[2].PID)
+		}
+	}
+
+	_, err = get("/api/containers/web/processes?sort=-memory")
+	if httpErr, ok := err.(*echo.HTTPError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusBadRequest, httpErr.Code)
+	}
+	_, err = get("/api/containers/web/processes?limit=-1")
+	if httpErr, ok := err.(*echo.HTTPError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusBadRequest, httpErr.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/containers/missing/processes", nil), rec)
+	c.SetParamNames("id")
+	c.SetParamValues("missing")
+	err = GetContainerProcesses(c)
+	if httpErr, ok := err.(*echo.HTTPError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusNotFound, httpErr.Code)
+	}
+}
@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"vchan.in/doctor-metrics/selfmetrics"
+	"vchan.in/doctor-metrics/types"
+)
+
+// DefaultDiskUsageInterval is the time between two disk usage collections unless DM_DISK_USAGE_INTERVAL is set.
+const DefaultDiskUsageInterval = 5 * time.Minute
+
+// diskUsageCollector is implemented by collectors that can report the disk usage of their Docker objects.
+type diskUsageCollector interface {
+	// DiskUsage returns the disk usage of the images, containers, volumes and build cache of the host.
+	DiskUsage(ctx context.Context) (types.DiskUsage, error)
+}
+
+// hostDiskUsageCollector is implemented by collectors that merge the disk usage of several hosts.
+type hostDiskUsageCollector interface {
+	// DiskUsageHosts is like DiskUsage for every host and also returns the hosts that could not be collected.
+	DiskUsageHosts(ctx context.Context) ([]types.DiskUsage, []types.HostError, error)
+}
+
+// diskUsageCache keeps the last disk usage collection, which is too expensive to run on every request.
+type diskUsageCache struct {
+	collecting sync.Mutex // Held during a collection, so that concurrent collections do not pile up
+
+	mu          sync.Mutex
+	usage       []types.DiskUsage
+	errors      []types.HostError
+	collectedAt time.Time
+}
+
+var diskUsageSnapshot = &diskUsageCache{}
+
+func (d *diskUsageCache) snapshot() ([]types.DiskUsage, []types.HostError, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.usage, d.errors, !d.collectedAt.IsZero()
+}
+
+func (d *diskUsageCache) refresh(ctx context.Context, c Collector, onlyIfEmpty bool) error {
+	/*
+		Collect the disk usage and replace the cached one.
+
+		With onlyIfEmpty, nothing is collected when a previous collection already succeeded,
+		e.g. by the scheduled refresh while waiting for the collecting lock.
+		A failed collection keeps the previous disk usage.
+	*/
+	d.collecting.Lock()
+	defer d.collecting.Unlock()
+	if _, _, ok := d.snapshot(); ok && onlyIfEmpty {
+		return nil
+	}
+
+	usage, hostErrors, err := collectDiskUsage(ctx, c)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.usage, d.errors, d.collectedAt = usage, hostErrors, time.Now()
+	selfmetrics.MarkSnapshot("disk_usage", d.collectedAt)
+	d.mu.Unlock()
+	return nil
+}
+
+func (d *diskUsageCache) get(ctx context.Context, c Collector) ([]types.DiskUsage, []types.HostError, error) {
+	// Return the cached disk usage, collecting it first if no collection succeeded yet.
+	if usage, hostErrors, ok := d.snapshot(); ok {
+		return usage, hostErrors, nil
+	}
+	if err := d.refresh(ctx, c, true); err != nil {
+		return nil, nil, err
+	}
+	usage, hostErrors, _ := d.snapshot()
+	return usage, hostErrors, nil
+}
+
+func supportsDiskUsage(c Collector) bool {
+	switch c.(type) {
+	case diskUsageCollector, hostDiskUsageCollector:
+		return true
+	}
+	return false
+}
+
+func collectDiskUsage(ctx context.Context, c Collector) ([]types.DiskUsage, []types.HostError, error) {
+	// Collect the disk usage of the hosts of the collector, returning an HTTP error when it cannot report one.
+	switch c := c.(type) {
+	case hostDiskUsageCollector:
+		return c.DiskUsageHosts(ctx)
+	case diskUsageCollector:
+		usage, err := c.DiskUsage(ctx)
+		if err != nil {
+			return nil, nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve Docker disk usage").SetInternal(err)
+		}
+		return []types.DiskUsage{usage}, nil, nil
+	}
+	return nil, nil, echo.NewHTTPError(http.StatusNotFound, "Disk usage is only available with the Docker and Podman runtimes")
+}
+
+func WatchDiskUsage(ctx context.Context, interval time.Duration) {
+	/*
+		WatchDiskUsage collects the disk usage of the configured collector every interval until the context is cancelled.
+
+		Collections are logged and skipped when they fail or take longer than the interval,
+		GET /api/disk keeps serving the last successful one.
+	*/
+	if !supportsDiskUsage(collector) {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		collectCtx, cancel := context.WithTimeout(ctx, interval)
+		err := diskUsageSnapshot.refresh(collectCtx, collector, false)
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("Failed to refresh Docker disk usage", "error", hostErrorMessage(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func summarizeDiskUsage(df types.DockerSystemDF, now time.Time) types.DiskUsage {
+	/*
+		Convert the Engine API disk usage to the API format and compute the totals like docker system df.
+
+		Reclaimable space is the size of the unused objects, except for images, where the layers
+		unique to the images of existing containers are subtracted from the size of all layers.
+		Function returns each kind of object ordered by size, largest first.
+	*/
+	usage := types.DiskUsage{
+		CollectedAt: now.UTC().Format(time.RFC3339),
+		Images:      make([]types.DiskImage, 0, len(df.Images)),
+		Containers:  make([]types.DiskContainer, 0, len(df.Containers)),
+		Volumes:     make([]types.DiskVolume, 0, len(df.Volumes)),
+	}
+
+	var usedLayers int64
+	for _, image := range df.Images {
+		uniqueSize := int64(-1)
+		if image.SharedSize >= 0 {
+			uniqueSize = image.Size - image.SharedSize
+		}
+		repoTags := []string{}
+		for _, tag := range image.RepoTags {
+			if tag != "<none>:<none>" {
+				repoTags = append(repoTags, tag)
+			}
+		}
+		imageID := strings.TrimPrefix(image.ID, "sha256:")
+		usage.Images = append(usage.Images, types.DiskImage{
+			ImageID:         imageID[:min(12, len(imageID))],
+			RepoTags:        repoTags,
+			Created:         time.Unix(image.Created, 0).UTC().Format(time.RFC3339),
+			SizeBytes:       image.Size,
+			SharedSizeBytes: image.SharedSize,
+			UniqueSizeBytes: uniqueSize,
+			Containers:      image.Containers,
+		})
+		if image.Containers > 0 {
+			usage.Totals.Images.Active++
+			if uniqueSize >= 0 {
+				usedLayers += uniqueSize
+			}
+		}
+	}
+	usage.Totals.Images.Count = len(df.Images)
+	usage.Totals.Images.SizeBytes = df.LayersSize
+	usage.Totals.Images.ReclaimableBytes = max(df.LayersSize-usedLayers, 0)
+
+	for _, container := range df.Containers {
+		name := ""
+		if len(container.Names) > 0 {
+			name = strings.TrimPrefix(container.Names[0], "/")
+		}
+		usage.Containers = append(usage.Containers, types.DiskContainer{
+			ContainerID:     container.ID[:min(12, len(container.ID))],
+			ContainerName:   name,
+			Image:           container.Image,
+			State:           container.State,
+			SizeRwBytes:     container.SizeRw,
+			SizeRootFsBytes: container.SizeRootFs,
+		})
+		usage.Totals.Containers.SizeBytes += container.SizeRw
+		switch container.State {
+		case "running", "paused", "restarting":
+			usage.Totals.Containers.Active++
+		default:
+			usage.Totals.Containers.ReclaimableBytes += container.SizeRw
+		}
+	}
+	usage.Totals.Containers.Count = len(df.Containers)
+
+	for _, volume := range df.Volumes {
+		size, refCount := int64(-1), int64(-1)
+		if volume.UsageData != nil {
+			size, refCount = volume.UsageData.Size, volume.UsageData.RefCount
+		}
+		usage.Volumes = append(usage.Volumes, types.DiskVolume{
+			Name:       volume.Name,
+			Driver:     volume.Driver,
+			Mountpoint: volume.Mountpoint,
+			SizeBytes:  size,
+			RefCount:   refCount,
+		})
+		if refCount > 0 {
+			usage.Totals.Volumes.Active++
+		}
+		if size > 0 {
+			usage.Totals.Volumes.SizeBytes += size
+			if refCount == 0 {
+				usage.Totals.Volumes.ReclaimableBytes += size
+			}
+		}
+	}
+	usage.Totals.Volumes.Count = len(df.Volumes)
+
+	for _, record := range df.BuildCache {
+		if record.InUse {
+			usage.Totals.BuildCache.Active++
+		}
+		if record.Shared {
+			continue
+		}
+		usage.Totals.BuildCache.SizeBytes += record.Size
+		if !record.InUse {
+			usage.Totals.BuildCache.ReclaimableBytes += record.Size
+		}
+	}
+	usage.Totals.BuildCache.Count = len(df.BuildCache)
+
+	slices.SortStableFunc(usage.Images, func(a, b types.DiskImage) int {
+		return cmp.Or(cmp.Compare(b.SizeBytes, a.SizeBytes), cmp.Compare(a.ImageID, b.ImageID))
+	})
+	slices.SortStableFunc(usage.Containers, func(a, b types.DiskContainer) int {
+		return cmp.Or(cmp.Compare(b.SizeRwBytes, a.SizeRwBytes), cmp.Compare(a.ContainerName, b.ContainerName))
+	})
+	slices.SortStableFunc(usage.Volumes, func(a, b types.DiskVolume) int {
+		return cmp.Or(cmp.Compare(b.SizeBytes, a.SizeBytes), cmp.Compare(a.Name, b.Name))
+	})
+	return usage
+}
+
+func engineDiskUsage(ctx context.Context, client *engineClient) (types.DiskUsage, error) {
+	// Both the Docker Engine API and the Docker-compatible Podman API report disk usage on /system/df.
+	var df types.DockerSystemDF
+	if err := client.getJSON(ctx, "/system/df", nil, &df); err != nil {
+		return types.DiskUsage{}, err
+	}
+	return summarizeDiskUsage(df, time.Now()), nil
+}
+
+func (e *EngineCollector) DiskUsage(ctx context.Context) (types.DiskUsage, error) {
+	return engineDiskUsage(ctx, e.client)
+}
+
+func (p *PodmanCollector) DiskUsage(ctx context.Context) (types.DiskUsage, error) {
+	return engineDiskUsage(ctx, p.client)
+}
+
+func (DockerCollector) DiskUsage(ctx context.Context) (types.DiskUsage, error) {
+	/*
+		The docker CLI only prints rounded sizes, so the disk usage is read from the Engine API
+		of the daemon the CLI talks to, selected with DOCKER_HOST like the CLI, with the TLS configuration of SetDockerTLS.
+	*/
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = "unix:///var/run/docker.sock"
+	}
+	endpoints, err := ParseDockerEndpoints(host, dockerTLS)
+	if err != nil {
+		return types.DiskUsage{}, err
+	}
+	engine, err := NewEngineCollector(endpoints[0])
+	if err != nil {
+		return types.DiskUsage{}, err
+	}
+	return engine.DiskUsage(ctx)
+}
+
+func (h *HostsCollector) DiskUsageHosts(ctx context.Context) ([]types.DiskUsage, []types.HostError, error) {
+	/*
+		Collect the disk usage of every host concurrently with its own timeout, tagging each with its host name.
+
+		Function returns the disk usage of the reachable hosts in configuration order and an error per unreachable host,
+		ordered by host name. It returns an HTTP 502 error only when no host could be collected.
+	*/
+	type hostResult struct {
+		usage types.DiskUsage
+		err   error
+	}
+	results := make([]*hostResult, len(h.hosts))
+	var wg sync.WaitGroup
+	for i, host := range h.hosts {
+		hostCollector, ok := host.Collector.(diskUsageCollector)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var usage types.DiskUsage
+			err := h.call(ctx, func(ctx context.Context) (err error) {
+				usage, err = hostCollector.DiskUsage(ctx)
+				return err
+			})
+			results[i] = &hostResult{usage: usage, err: err}
+		}(i)
+	}
+	wg.Wait()
+
+	usage := []types.DiskUsage{}
+	var hostErrors []types.HostError
+	for i, result := range results {
+		if result == nil {
+			continue
+		}
+		if result.err != nil {
+			hostErrors = append(hostErrors, types.HostError{Host: h.hosts[i].Name, Error: hostErrorMessage(result.err)})
+			continue
+		}
+		result.usage.Host = h.hosts[i].Name
+		usage = append(usage, result.usage)
+	}
+	slices.SortFunc(hostErrors, func(a, b types.HostError) int { return cmp.Compare(a.Host, b.Host) })
+
+	if len(usage) == 0 {
+		return nil, hostErrors, echo.NewHTTPError(http.StatusBadGateway, "Failed to retrieve disk usage from any host")
+	}
+	return usage, hostErrors, nil
+}
+
+func GetDiskUsage(c echo.Context) error {
+	/*
+		Get the disk usage of the images, containers, volumes and build cache, like docker system df -v.
+
+		{
+		  "disk_usage": [
+		    {
+		      "collected_at": "2021-09-01T12:30:00Z",
+		      "totals": {
+		        "images": {"count": 12, "active": 8, "size_bytes": 4294967296, "reclaimable_bytes": 1073741824},
+		        "containers": {"count": 10, "active": 8, ...},
+		        "volumes": {"count": 4, "active": 3, ...},
+		        "build_cache": {"count": 57, "active": 0, ...}
+		      },
+		      "images": [{"image_id": "4f7c1f2d3e4a", "repo_tags": ["nginx:1.27"], "size_bytes": 187654321, "shared_size_bytes": 77812345, ...}, ...],
+		      "containers": [{"container_id": "d1e2f3a4b5c6", "container_name": "web", "size_rw_bytes": 1048576, ...}, ...],
+		      "volumes": [{"name": "shop_db", "size_bytes": 536870912, "ref_count": 1, ...}, ...]
+		    }
+		  ]
+		}
+
+		The disk usage is refreshed in the background every DM_DISK_USAGE_INTERVAL, so it can be that old.
+		Function returns a JSON response with the disk usage per host,
+		or an HTTP 404 error when the configured runtime cannot report disk usage.
+	*/
+	usage, hostErrors, err := diskUsageSnapshot.get(c.Request().Context(), collector)
+	if err != nil {
+		return err
+	}
+
+	response := types.DiskUsageResponse{
+		Status:  "success",
+		Message: "Disk usage retrieved successfully",
+	}
+	response.Data.DiskUsage = usage
+	response.Data.Errors = hostErrors
+
+	return c.JSON(http.StatusOK, response)
+}
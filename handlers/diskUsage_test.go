@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/types"
+)
+
+func TestSummarizeDiskUsage(t *testing.T) {
+	data, err := os.ReadFile("testdata/system_df.json")
+	if err != nil {
+		t.Fatalf("Failed to read disk usage fixture: %v", err)
+	}
+	var df types.DockerSystemDF
+	if err := json.Unmarshal(data, &df); err != nil {
+		t.Fatalf("Failed to unmarshal disk usage fixture: %v", err)
+	}
+	usage := summarizeDiskUsage(df, time.Date(2021, 9, 1, 12, 30, 0, 0, time.UTC))
+
+	assert.Equal(t, "2021-09-01T12:30:00Z", usage.CollectedAt)
+	// Only the 110 MB unique to nginx are used by a container, the shared layers can be pruned with the unused images.
+	assert.Equal(t, types.DiskUsageTotals{
+		Images:     types.DiskUsageTotal{Count: 3, Active: 1, SizeBytes: 300000000, ReclaimableBytes: 190000000},
+		Containers: types.DiskUsageTotal{Count: 2, Active: 1, SizeBytes: 5242880, ReclaimableBytes: 4194304},
+		Volumes:    types.DiskUsageTotal{Count: 3, Active: 1, SizeBytes: 536872960, ReclaimableBytes: 2048},
+		BuildCache: types.DiskUsageTotal{Count: 3, Active: 1, SizeBytes: 8000, ReclaimableBytes: 5000},
+	}, usage.Totals)
+
+	if assert.Len(t, usage.Images, 3) {
+		assert.Equal(t, types.DiskImage{
+			ImageID: "4f7c1f2d3e4a", RepoTags: []string{"nginx:1.27"}, Created: "2021-09-01T12:00:00Z",
+			SizeBytes: 190000000, SharedSizeBytes: 80000000, UniqueSizeBytes: 110000000, Containers: 2,
+		}, usage.Images[0])
+		assert.Equal(t, []string{"redis:7"}, usage.Images[1].RepoTags)
+		assert.Empty(t, usage.Images[2].RepoTags)
+	}
+	if assert.Len(t, usage.Containers, 2) {
+		assert.Equal(t, "old", usage.Containers[0].ContainerName)
+		assert.Equal(t, "d1e2f3a4b5c6", usage.Containers[1].ContainerID)
+		assert.Equal(t, int64(1048576), usage.Containers[1].SizeRwBytes)
+	}
+	if assert.Len(t, usage.Volumes, 3) {
+		assert.Equal(t, "shop_db", usage.Volumes[0].Name)
+		assert.Equal(t, types.DiskVolume{Name: "nfs", Driver: "nfs", SizeBytes: -1, RefCount: -1}, usage.Volumes[2])
+	}
+}
+
+func TestDockerCollectorDiskUsage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(fakeEngine))
+	defer server.Close()
+	t.Setenv("DOCKER_HOST", "tcp://"+strings.TrimPrefix(server.URL, "http://"))
+	t.Setenv("DOCKER_CERT_PATH", "")
+	t.Setenv("DOCKER_TLS_VERIFY", "")
+
+	usage, err := DockerCollector{}.DiskUsage(context.Background())
+	if assert.NoError(t, err) {
+		assert.Empty(t, usage.Host)
+		assert.Equal(t, 3, usage.Totals.Images.Count)
+	}
+}
+
+func TestGetDiskUsage(t *testing.T) {
+	server, certPath := startTLSEngine(t)
+	address := "tcp://" + strings.TrimPrefix(server.URL, "https://")
+	engine, _ := NewEngineCollector(DockerEndpoint{Name: "build-01", Host: address, CertPath: certPath})
+	down, _ := NewEngineCollector(DockerEndpoint{Name: "build-02", Host: address, CertPath: t.TempDir()})
+
+	previous := collector
+	defer func() {
+		SetCollector(previous)
+		diskUsageSnapshot = &diskUsageCache{}
+	}()
+	SetCollector(NewHostsCollector([]NamedCollector{{Name: "build-01", Collector: engine}, {Name: "build-02", Collector: down}}, 0))
+	diskUsageSnapshot = &diskUsageCache{}
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/disk", nil), rec)
+	if !assert.NoError(t, GetDiskUsage(c)) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response types.DiskUsageResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if assert.Len(t, response.Data.DiskUsage, 1) {
+		assert.Equal(t, "build-01", response.Data.DiskUsage[0].Host)
+		assert.Equal(t, int64(300000000), response.Data.DiskUsage[0].Totals.Images.SizeBytes)
+	}
+	if assert.Len(t, response.Data.Errors, 1) {
+		assert.Equal(t, "build-02", response.Data.Errors[0].Host)
+	}
+
+	// Later requests are served from the cache until the next scheduled refresh.
+	server.Close()
+	rec = httptest.NewRecorder()
+	c = e.NewContext(httptest.NewRequest(http.MethodGet, "/api/disk", nil), rec)
+	if assert.NoError(t, GetDiskUsage(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+	assert.Error(t, diskUsageSnapshot.refresh(context.Background(), collector, false))
+	usage, _, ok := diskUsageSnapshot.snapshot()
+	assert.True(t, ok)
+	assert.Len(t, usage, 1)
+}
+
+func TestGetDiskUsageUnsupported(t *testing.T) {
+	previous := collector
+	defer SetCollector(previous)
+	SetCollector(struct{ Collector }{})
+	diskUsageSnapshot = &diskUsageCache{}
+
+	e := echo.New()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/disk", nil), httptest.NewRecorder())
+	err := GetDiskUsage(c)
+	if httpErr, ok := err.(*echo.HTTPError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusNotFound, httpErr.Code)
+	}
+}
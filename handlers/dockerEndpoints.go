@@ -0,0 +1,560 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"vchan.in/doctor-metrics/selfmetrics"
+	"vchan.in/doctor-metrics/types"
+)
+
+// DockerEndpoint is a Docker daemon collected through the Engine API.
+type DockerEndpoint struct {
+	Name          string // Host name the metrics are tagged with e.g. "build-01"
+	Host          string // Daemon address like DOCKER_HOST e.g. "tcp://10.0.0.1:2376" or "ssh://dh@10.0.0.1"
+	CertPath      string // Directory with ca.pem, cert.pem and key.pem for TCP endpoints, plain TCP if empty
+	TLSSkipVerify bool   // Whether the daemon certificate is not verified against ca.pem, not recommended
+}
+
+// DockerTLS is the TLS configuration of the tcp:// Docker endpoints, like DOCKER_CERT_PATH and DOCKER_TLS_VERIFY.
+type DockerTLS struct {
+	CertPath   string // Directory with ca.pem, cert.pem and key.pem, ~/.docker if empty and Verify is set
+	Verify     bool   // Whether TLS is required for every tcp:// endpoint
+	SkipVerify bool   // Whether the daemon certificate is not verified, not recommended
+}
+
+func (t DockerTLS) ResolvedCertPath() string {
+	// ResolvedCertPath returns the certificate directory, like the docker CLI DOCKER_TLS_VERIFY alone uses ~/.docker.
+	if t.CertPath == "" && t.Verify {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, ".docker")
+		}
+	}
+	return t.CertPath
+}
+
+// TLS configuration of the daemon of the docker CLI, see SetDockerTLS.
+var dockerTLS DockerTLS
+
+func SetDockerTLS(tls DockerTLS) {
+	// SetDockerTLS sets the TLS configuration of a tcp:// DOCKER_HOST, used to read its disk usage. Call it before serving.
+	dockerTLS = tls
+}
+
+func ParseDockerEndpoints(value string, tls DockerTLS) ([]DockerEndpoint, error) {
+	/*
+		ParseDockerEndpoints parses a comma-separated list of Docker daemons.
+
+		build-01=tcp://10.0.0.1:2376,ci=ssh://dh@10.0.0.2,unix:///var/run/docker.sock
+
+		The name before "=" is optional and defaults to the host of the address.
+		TCP endpoints use the certificates in <cert path>/<name> when that directory exists, otherwise in the cert path,
+		like DOCKER_CERT_PATH does for the docker CLI. The daemon certificate is verified unless tls.SkipVerify is set.
+		Function returns an error for unsupported addresses and duplicate names, and for a TCP endpoint
+		without certificates when tls.Verify is set, instead of falling back to plain TCP.
+	*/
+	certPath := tls.ResolvedCertPath()
+
+	var endpoints []DockerEndpoint
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, address, ok := strings.Cut(entry, "=")
+		if !ok || strings.Contains(name, "://") {
+			name, address = "", entry
+		}
+		parsed, err := url.Parse(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Docker endpoint %q", address)
+		}
+
+		endpoint := DockerEndpoint{Name: strings.TrimSpace(name), Host: address}
+		switch parsed.Scheme {
+		case "tcp":
+			if parsed.Host == "" {
+				return nil, fmt.Errorf("invalid Docker endpoint %q", address)
+			}
+			if endpoint.Name == "" {
+				endpoint.Name = parsed.Hostname()
+			}
+			if certPath != "" {
+				endpoint.CertPath = certPath
+				if info, err := os.Stat(filepath.Join(certPath, endpoint.Name)); err == nil && info.IsDir() {
+					endpoint.CertPath = filepath.Join(certPath, endpoint.Name)
+				}
+				endpoint.TLSSkipVerify = tls.SkipVerify
+			}
+			if tls.Verify && !hasCertificates(endpoint.CertPath) {
+				return nil, fmt.Errorf("TLS is required for Docker endpoint %q but no ca.pem or cert.pem was found in %q", endpoint.Name, endpoint.CertPath)
+			}
+		case "ssh":
+			if parsed.Host == "" {
+				return nil, fmt.Errorf("invalid Docker endpoint %q", address)
+			}
+			if endpoint.Name == "" {
+				endpoint.Name = parsed.Hostname()
+			}
+		case "unix":
+			if parsed.Path == "" {
+				return nil, fmt.Errorf("invalid Docker endpoint %q", address)
+			}
+			if endpoint.Name == "" {
+				endpoint.Name = "local"
+			}
+		default:
+			return nil, fmt.Errorf("unsupported Docker endpoint %q, expected tcp://, ssh:// or unix://", address)
+		}
+
+		if seen[endpoint.Name] {
+			return nil, fmt.Errorf("duplicate Docker endpoint name %q", endpoint.Name)
+		}
+		seen[endpoint.Name] = true
+		endpoints = append(endpoints, endpoint)
+	}
+	if len(endpoints) == 0 {
+		return nil, errors.New("no Docker endpoints configured")
+	}
+	return endpoints, nil
+}
+
+func hasCertificates(certPath string) bool {
+	if certPath == "" {
+		return false
+	}
+	for _, file := range []string{"ca.pem", "cert.pem"} {
+		if _, err := os.Stat(filepath.Join(certPath, file)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// EngineCollector collects container metrics from a Docker daemon through the Engine API.
+//
+// Unlike the docker CLI collector it works with remote daemons, so it has no access to
+// the procfs and cgroups of the containers and reports no pressure stall information.
+type EngineCollector struct {
+	client *engineClient
+
+	mu      sync.Mutex
+	info    *types.DockerInfo // Host info, fetched once
+	digests map[string]string // Repository digests keyed by image ID
+}
+
+func NewEngineCollector(endpoint DockerEndpoint) (*EngineCollector, error) {
+	/*
+		NewEngineCollector returns a collector for the daemon of the endpoint.
+		Function returns an error when the certificates of a TLS endpoint cannot be loaded.
+	*/
+	parsed, err := url.Parse(endpoint.Host)
+	if err != nil {
+		return nil, err
+	}
+	switch parsed.Scheme {
+	case "tcp":
+		if endpoint.CertPath == "" {
+			return newEngineCollector(newTCPEngineClient(parsed.Host, nil)), nil
+		}
+		tlsConfig, err := engineTLSConfig(endpoint.CertPath, endpoint.TLSSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+		return newEngineCollector(newTCPEngineClient(parsed.Host, tlsConfig)), nil
+	case "ssh":
+		return newEngineCollector(newSSHEngineClient(parsed)), nil
+	case "unix":
+		return newEngineCollector(newUnixEngineClient(parsed.Path)), nil
+	}
+	return nil, fmt.Errorf("unsupported Docker endpoint %q", endpoint.Host)
+}
+
+func newEngineCollector(client *engineClient) *EngineCollector {
+	return &EngineCollector{client: client, digests: make(map[string]string)}
+}
+
+func (e *EngineCollector) Collect(ctx context.Context, filter types.ContainerFilter) (_ []types.ContainerMetrics, err error) {
+	/*
+		Collect metrics for all containers matching the filter, including stopped ones.
+
+		The filter is passed to the daemon like docker ps --filter does.
+		Function returns the metrics of every listed container in no particular order.
+	*/
+	defer selfmetrics.ObserveCollection("docker_engine", time.Now(), &err)
+	query := url.Values{"all": {"true"}}
+	filters := make(map[string][]string)
+	if len(filter.Labels) > 0 {
+		filters["label"] = filter.Labels
+	}
+	if len(filter.States) > 0 {
+		filters["status"] = filter.States
+	}
+	if len(filters) > 0 {
+		encoded, err := json.Marshal(filters)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("filters", string(encoded))
+	}
+	var containers []types.DockerContainerList
+	if err := e.client.getJSON(ctx, "/containers/json", query, &containers); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve container list").SetInternal(err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	listMetrics := []types.ContainerMetrics{}
+	sem := make(chan struct{}, 10)
+	for _, container := range containers {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			start := time.Now()
+			metrics, err := e.containerMetrics(ctx, id)
+			if err == nil {
+				selfmetrics.ObserveContainer("docker_engine", metrics.ContainerName, time.Since(start))
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			var engineErr *engineError
+			switch {
+			case errors.As(err, &engineErr) && engineErr.StatusCode == http.StatusNotFound:
+				// Removed since it was listed
+			case err != nil:
+				if firstErr == nil {
+					firstErr = err
+				}
+			default:
+				listMetrics = append(listMetrics, metrics)
+			}
+		}(container.ID)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve container metrics").SetInternal(firstErr)
+	}
+	return listMetrics, nil
+}
+
+func (e *EngineCollector) Ping(ctx context.Context) error {
+	return e.client.ping(ctx)
+}
+
+func (e *EngineCollector) CollectContainer(ctx context.Context, idOrName string) (types.ContainerMetrics, error) {
+	/*
+		Collect metrics for a single container by ID, ID prefix or name.
+
+		Function returns an HTTP 404 error when no container matches.
+	*/
+	metrics, err := e.containerMetrics(ctx, idOrName)
+	var engineErr *engineError
+	if errors.As(err, &engineErr) && engineErr.StatusCode == http.StatusNotFound {
+		return types.ContainerMetrics{}, echo.NewHTTPError(http.StatusNotFound, "Container not found")
+	}
+	if err != nil {
+		return types.ContainerMetrics{}, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve container metrics")
+	}
+	return metrics, nil
+}
+
+func (e *EngineCollector) containerMetrics(ctx context.Context, idOrName string) (types.ContainerMetrics, error) {
+	// Inspect a container and add the stats of running containers.
+	var inspect types.DockerInspect
+	if err := e.client.getJSON(ctx, "/containers/"+url.PathEscape(idOrName)+"/json", nil, &inspect); err != nil {
+		return types.ContainerMetrics{}, err
+	}
+
+	now := time.Now()
+	var metrics types.ContainerMetrics
+	metrics.Timestamp = now.UTC().Format(time.RFC3339)
+	metrics.ContainerID = inspect.ID[:min(12, len(inspect.ID))]
+	applyInspect(&metrics, inspect, now)
+	metrics.ContainerImageDigest = e.imageDigest(ctx, inspect.Image)
+	metrics.Active = metrics.ContainerState == "running"
+	if !metrics.Active {
+		return metrics, nil
+	}
+
+	// Without one-shot the daemon waits for a second sample, so precpu_stats is set.
+	var stats types.DockerEngineStats
+	err := e.client.getJSON(ctx, "/containers/"+inspect.ID+"/stats", url.Values{"stream": {"false"}}, &stats)
+	var engineErr *engineError
+	if errors.As(err, &engineErr) && engineErr.StatusCode == http.StatusConflict {
+		return metrics, nil // Stopped since it was inspected
+	}
+	if err != nil {
+		return types.ContainerMetrics{}, err
+	}
+	applyEngineStats(&metrics, stats)
+	if info, err := e.hostInfo(ctx); err == nil {
+		metrics.SetHostShare(info.NCPU, info.MemTotal)
+	}
+	return metrics, nil
+}
+
+func (e *EngineCollector) hostInfo(ctx context.Context) (types.DockerInfo, error) {
+	// Get the CPU count and memory of the daemon host, fetched once.
+	e.mu.Lock()
+	info := e.info
+	e.mu.Unlock()
+	if info != nil {
+		return *info, nil
+	}
+
+	info = &types.DockerInfo{}
+	if err := e.client.getJSON(ctx, "/info", nil, info); err != nil {
+		return types.DockerInfo{}, err
+	}
+	e.mu.Lock()
+	e.info = info
+	e.mu.Unlock()
+	return *info, nil
+}
+
+func applyEngineStats(metrics *types.ContainerMetrics, stats types.DockerEngineStats) {
+	/*
+		Set the resource metrics from Engine API stats, computed like docker stats does.
+
+		The CPU usage is the container share of the host CPU time between the two samples, scaled to the
+		number of CPUs, and the memory usage excludes the inactive page cache.
+	*/
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	cpus := float64(stats.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		metrics.ContainerCpuUsagePercent = roundPercent(cpuDelta / systemDelta * cpus * 100)
+	}
+
+	usage := stats.MemoryStats.Usage
+	inactive, ok := stats.MemoryStats.Stats["total_inactive_file"] // cgroup v1
+	if !ok {
+		inactive = stats.MemoryStats.Stats["inactive_file"] // cgroup v2
+	}
+	if inactive < usage {
+		usage -= inactive
+	}
+	metrics.ContainerMemoryUsageBytes = int64(usage)
+	metrics.ContainerMemoryLimitBytes = int64(stats.MemoryStats.Limit)
+	if stats.MemoryStats.Limit > 0 {
+		metrics.ContainerMemoryUsagePercent = roundPercent(float64(usage) / float64(stats.MemoryStats.Limit) * 100)
+	}
+
+	for _, network := range stats.Networks {
+		metrics.ContainerNetworkReceiveBytesTotal += int64(network.RxBytes)
+		metrics.ContainerNetworkTransmitBytesTotal += int64(network.TxBytes)
+	}
+	for _, entry := range stats.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			metrics.ContainerBlockReadBytes += int64(entry.Value)
+		case "write":
+			metrics.ContainerBlockWriteBytes += int64(entry.Value)
+		}
+	}
+	metrics.ContainerPIDs = int(stats.PidsStats.Current)
+}
+
+func (e *EngineCollector) imageDigest(ctx context.Context, imageID string) string {
+	// Get the repository digest of an image, empty for images that were never pushed or pulled.
+	e.mu.Lock()
+	digest, ok := e.digests[imageID]
+	e.mu.Unlock()
+	if ok || imageID == "" {
+		return digest
+	}
+
+	var image struct {
+		RepoDigests []string `json:"RepoDigests"`
+	}
+	if err := e.client.getJSON(ctx, "/images/"+url.PathEscape(imageID)+"/json", nil, &image); err != nil {
+		return ""
+	}
+	if len(image.RepoDigests) > 0 {
+		digest = image.RepoDigests[0]
+	}
+
+	e.mu.Lock()
+	e.digests[imageID] = digest
+	e.mu.Unlock()
+	return digest
+}
+
+// NamedCollector is the collector of one host of a HostsCollector.
+type NamedCollector struct {
+	Name      string // Host name the metrics are tagged with e.g. "build-01"
+	Collector Collector
+}
+
+// DefaultEndpointTimeout bounds each request to a Docker endpoint unless DM_DOCKER_ENDPOINT_TIMEOUT is set.
+const DefaultEndpointTimeout = 10 * time.Second
+
+// HostsCollector merges the container metrics of several hosts, tagging each container with its host.
+type HostsCollector struct {
+	hosts   []NamedCollector
+	timeout time.Duration // Time allowed to each host e.g. "10s"
+}
+
+func NewHostsCollector(hosts []NamedCollector, timeout time.Duration) *HostsCollector {
+	// Each call to a host is cancelled after the timeout, DefaultEndpointTimeout if it is 0.
+	if timeout <= 0 {
+		timeout = DefaultEndpointTimeout
+	}
+	return &HostsCollector{hosts: hosts, timeout: timeout}
+}
+
+func (h *HostsCollector) call(ctx context.Context, host func(ctx context.Context) error) error {
+	// Call a host with its own timeout, reporting an expired timeout instead of the error it caused.
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	err := host(ctx)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("no response within %s", h.timeout)
+	}
+	return err
+}
+
+func (h *HostsCollector) CollectHosts(ctx context.Context, filter types.ContainerFilter) ([]types.ContainerMetrics, []types.HostError, error) {
+	/*
+		Collect the metrics of all containers matching the filter from every host concurrently, each with its own timeout.
+
+		Function returns the merged metrics of the reachable hosts and an error per unreachable host,
+		ordered by host name. It returns an HTTP 502 error only when no host could be collected.
+	*/
+	type hostResult struct {
+		metrics []types.ContainerMetrics
+		err     error
+	}
+	results := make([]hostResult, len(h.hosts))
+	var wg sync.WaitGroup
+	for i, host := range h.hosts {
+		wg.Add(1)
+		go func(i int, host NamedCollector) {
+			defer wg.Done()
+			var metrics []types.ContainerMetrics
+			err := h.call(ctx, func(ctx context.Context) (err error) {
+				metrics, err = host.Collector.Collect(ctx, filter)
+				return err
+			})
+			results[i] = hostResult{metrics: metrics, err: err}
+		}(i, host)
+	}
+	wg.Wait()
+
+	listMetrics := []types.ContainerMetrics{}
+	var hostErrors []types.HostError
+	for i, result := range results {
+		if result.err != nil {
+			hostErrors = append(hostErrors, types.HostError{Host: h.hosts[i].Name, Error: hostErrorMessage(result.err)})
+			continue
+		}
+		for _, metrics := range result.metrics {
+			metrics.Host = h.hosts[i].Name
+			listMetrics = append(listMetrics, metrics)
+		}
+	}
+	sort.Slice(hostErrors, func(i, j int) bool { return hostErrors[i].Host < hostErrors[j].Host })
+
+	if len(hostErrors) == len(h.hosts) {
+		return nil, hostErrors, echo.NewHTTPError(http.StatusBadGateway, "Failed to retrieve container metrics from any host")
+	}
+	return listMetrics, hostErrors, nil
+}
+
+func hostErrorMessage(err error) string {
+	// Report the cause of HTTP errors of a host collector along with their message.
+	var httpErr *echo.HTTPError
+	if !errors.As(err, &httpErr) {
+		return err.Error()
+	}
+	if httpErr.Internal != nil {
+		return fmt.Sprintf("%v: %v", httpErr.Message, httpErr.Internal)
+	}
+	return fmt.Sprint(httpErr.Message)
+}
+
+func (h *HostsCollector) Collect(ctx context.Context, filter types.ContainerFilter) ([]types.ContainerMetrics, error) {
+	listMetrics, _, err := h.CollectHosts(ctx, filter)
+	return listMetrics, err
+}
+
+func (h *HostsCollector) Ping(ctx context.Context) error {
+	// Like a collection, the hosts are reachable when at least one of them answers.
+	var errs []error
+	for _, host := range h.hosts {
+		p, ok := host.Collector.(pinger)
+		if !ok {
+			return nil
+		}
+		err := p.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", host.Name, err))
+	}
+	return errors.Join(errs...)
+}
+
+func (h *HostsCollector) CollectContainer(ctx context.Context, idOrName string) (types.ContainerMetrics, error) {
+	/*
+		Collect metrics for a single container by ID or name from the hosts.
+
+		When several hosts have a matching container, the first host in configuration order wins.
+		Function returns an HTTP 404 error when no reachable host has the container.
+	*/
+	results := make([]error, len(h.hosts))
+	found := make([]*types.ContainerMetrics, len(h.hosts))
+	var wg sync.WaitGroup
+	for i, host := range h.hosts {
+		wg.Add(1)
+		go func(i int, host NamedCollector) {
+			defer wg.Done()
+			var metrics types.ContainerMetrics
+			err := h.call(ctx, func(ctx context.Context) (err error) {
+				metrics, err = host.Collector.CollectContainer(ctx, idOrName)
+				return err
+			})
+			if err == nil {
+				metrics.Host = host.Name
+				found[i] = &metrics
+			}
+			results[i] = err
+		}(i, host)
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, metrics := range found {
+		if metrics != nil {
+			return *metrics, nil
+		}
+		var httpErr *echo.HTTPError
+		if !errors.As(results[i], &httpErr) || httpErr.Code != http.StatusNotFound {
+			failed++
+		}
+	}
+	if failed == len(h.hosts) {
+		return types.ContainerMetrics{}, echo.NewHTTPError(http.StatusBadGateway, "Failed to retrieve container metrics from any host")
+	}
+	return types.ContainerMetrics{}, echo.NewHTTPError(http.StatusNotFound, "Container not found")
+}
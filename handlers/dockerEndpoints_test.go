@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/types"
+)
+
+const (
+	engineWebID = "d1e2f3a4b5c60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90"
+	engineOldID = "e2f3a4b5c6d10718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90"
+)
+
+// fakeEngine impersonates the Engine API of a Docker daemon with a running and an exited container.
+func fakeEngine(w http.ResponseWriter, r *http.Request) {
+	writeJSON := func(v any) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+	inspect := func(id, name, status string, exitCode int) map[string]any {
+		return map[string]any{
+			"Id": id, "Name": "/" + name, "Created": "2021-09-01T12:00:00.123456789Z", "Image": "sha256:" + id[:12],
+			"State":      map[string]any{"Status": status, "Pid": 4242, "ExitCode": exitCode, "StartedAt": "2021-09-01T12:30:00Z"},
+			"Config":     map[string]any{"Image": name + ":latest", "Labels": map[string]string{"app": name}},
+			"HostConfig": map[string]any{"RestartPolicy": map[string]any{"Name": "always"}},
+		}
+	}
+
+	switch path := r.URL.Path; {
+	case path == "/containers/json":
+		all := []map[string]any{{"Id": engineWebID, "Names": []string{"/web"}, "State": "running"}}
+		if !strings.Contains(r.URL.Query().Get("filters"), "running") {
+			all = append(all, map[string]any{"Id": engineOldID, "Names": []string{"/old"}, "State": "exited"})
+		}
+		writeJSON(all)
+	case path == "/containers/"+engineWebID+"/json" || path == "/containers/web/json":
+		writeJSON(inspect(engineWebID, "web", "running", 0))
+	case path == "/containers/"+engineOldID+"/json":
+		writeJSON(inspect(engineOldID, "old", "exited", 1))
+	case path == "/containers/"+engineWebID+"/stats":
+		// Half a core on a 4 CPU host, 80 MiB used of which 16 MiB inactive page cache.
+		writeJSON(map[string]any{
+			"cpu_stats":    map[string]any{"cpu_usage": map[string]any{"total_usage": 1_500_000_000}, "system_cpu_usage": 8_000_000_000, "online_cpus": 4},
+			"precpu_stats": map[string]any{"cpu_usage": map[string]any{"total_usage": 1_000_000_000}, "system_cpu_usage": 4_000_000_000},
+			"memory_stats": map[string]any{"usage": 80 << 20, "limit": 256 << 20, "stats": map[string]any{"inactive_file": 16 << 20}},
+			"networks":     map[string]any{"eth0": map[string]any{"rx_bytes": 1000, "tx_bytes": 2000}, "eth1": map[string]any{"rx_bytes": 10, "tx_bytes": 20}},
+			"blkio_stats": map[string]any{"io_service_bytes_recursive": []map[string]any{
+				{"op": "read", "value": 4096}, {"op": "write", "value": 8192},
+			}},
+			"pids_stats": map[string]any{"current": 7},
+		})
+	case path == "/info":
+		writeJSON(map[string]any{"NCPU": 4, "MemTotal": 1 << 30})
+	case path == "/containers/"+engineWebID+"/top":
+		if r.URL.Query().Get("ps_args") != topPsArgs {
+			w.WriteHeader(http.StatusInternalServerError)
+			writeJSON(map[string]string{"message": "unexpected ps arguments"})
+			return
+		}
+		writeJSON(map[string]any{
+			"Titles": []string{"PID", "PPID", "USER", "%CPU", "RSS", "COMMAND"},
+			"Processes": [][]string{
+				{"4242", "4200", "root", "0.1", "10240", "nginx: master process nginx -g daemon off;"},
+				{"4250", "4242", "101", "12.5", "20480", "nginx: worker process"},
+				{"4251", "4242", "101", "3.0", "30720", "nginx: worker process"},
+			},
+		})
+	case path == "/system/df":
+		data, _ := os.ReadFile("testdata/system_df.json")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	case path == "/images/sha256:"+engineWebID[:12]+"/json":
+		writeJSON(map[string]any{"RepoDigests": []string{"web@sha256:0b97"}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(map[string]string{"message": "No such container"})
+	}
+}
+
+func writePEM(t *testing.T, path, blockType string, bytes []byte) {
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: bytes}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func startTLSEngine(t *testing.T) (*httptest.Server, string) {
+	/*
+		Start a fake daemon requiring a client certificate, like dockerd with --tlsverify.
+		Function returns the server and a DOCKER_CERT_PATH directory with ca.pem, cert.pem and key.pem.
+	*/
+	certPath := t.TempDir()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "dh"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(certPath, "cert.pem"), "CERTIFICATE", der)
+	writePEM(t, filepath.Join(certPath, "key.pem"), "EC PRIVATE KEY", keyDER)
+
+	clientCert, _ := x509.ParseCertificate(der)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(fakeEngine))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	writePEM(t, filepath.Join(certPath, "ca.pem"), "CERTIFICATE", server.Certificate().Raw)
+	return server, certPath
+}
+
+func TestParseDockerEndpoints(t *testing.T) {
+	certPath := t.TempDir()
+	os.Mkdir(filepath.Join(certPath, "build-02"), 0o700)
+
+	endpoints, err := ParseDockerEndpoints("build-01=tcp://10.0.0.1:2376, build-02=tcp://10.0.0.2:2376,ssh://dh@10.0.0.3:2222,unix:///var/run/docker.sock", DockerTLS{CertPath: certPath})
+	if assert.NoError(t, err) && assert.Len(t, endpoints, 4) {
+		assert.Equal(t, DockerEndpoint{Name: "build-01", Host: "tcp://10.0.0.1:2376", CertPath: certPath}, endpoints[0])
+		assert.Equal(t, filepath.Join(certPath, "build-02"), endpoints[1].CertPath)
+		assert.Equal(t, DockerEndpoint{Name: "10.0.0.3", Host: "ssh://dh@10.0.0.3:2222"}, endpoints[2])
+		assert.Equal(t, "local", endpoints[3].Name)
+	}
+
+	// The daemon certificate is verified unless verification is skipped explicitly.
+	endpoints, err = ParseDockerEndpoints("tcp://10.0.0.1:2376", DockerTLS{CertPath: certPath, SkipVerify: true})
+	if assert.NoError(t, err) {
+		assert.True(t, endpoints[0].TLSSkipVerify)
+	}
+	tlsConfig, err := engineTLSConfig(certPath, false)
+	if assert.NoError(t, err) {
+		assert.False(t, tlsConfig.InsecureSkipVerify)
+	}
+
+	// Without DOCKER_CERT_PATH the daemon is reached over plain TCP.
+	endpoints, err = ParseDockerEndpoints("tcp://10.0.0.1:2375", DockerTLS{})
+	if assert.NoError(t, err) {
+		assert.Empty(t, endpoints[0].CertPath)
+	}
+
+	// DOCKER_TLS_VERIFY alone uses ~/.docker like the docker CLI, and refuses plain TCP without certificates.
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	_, err = ParseDockerEndpoints("tcp://10.0.0.1:2376", DockerTLS{Verify: true})
+	assert.ErrorContains(t, err, "TLS is required")
+	_, err = ParseDockerEndpoints("tcp://10.0.0.1:2376", DockerTLS{CertPath: certPath, Verify: true})
+	assert.Error(t, err)
+	os.Mkdir(filepath.Join(home, ".docker"), 0o700)
+	os.WriteFile(filepath.Join(home, ".docker", "ca.pem"), nil, 0o600)
+	endpoints, err = ParseDockerEndpoints("tcp://10.0.0.1:2376", DockerTLS{Verify: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, filepath.Join(home, ".docker"), endpoints[0].CertPath)
+	}
+
+	for _, value := range []string{"", "http://10.0.0.1:2375", "tcp://", "a=tcp://h1:2376,a=ssh://h2"} {
+		_, err := ParseDockerEndpoints(value, DockerTLS{})
+		assert.Error(t, err, value)
+	}
+}
+
+func TestEngineCollectorTLS(t *testing.T) {
+	server, certPath := startTLSEngine(t)
+	host := "tcp://" + strings.TrimPrefix(server.URL, "https://")
+
+	engine, err := NewEngineCollector(DockerEndpoint{Name: "build-01", Host: host, CertPath: certPath})
+	if !assert.NoError(t, err) {
+		return
+	}
+	list, err := engine.Collect(context.Background(), types.ContainerFilter{States: []string{"running"}})
+	if !assert.NoError(t, err) || !assert.Len(t, list, 1) {
+		return
+	}
+	web := list[0]
+	assert.Equal(t, "d1e2f3a4b5c6", web.ContainerID)
+	assert.Equal(t, "web", web.ContainerName)
+	assert.True(t, web.Active)
+	assert.Equal(t, "always", web.ContainerRestartPolicy)
+	assert.Equal(t, "web@sha256:0b97", web.ContainerImageDigest)
+	assert.Equal(t, 50.0, web.ContainerCpuUsagePercent)
+	assert.Equal(t, int64(64<<20), web.ContainerMemoryUsageBytes)
+	assert.Equal(t, int64(256<<20), web.ContainerMemoryLimitBytes)
+	assert.Equal(t, 25.0, web.ContainerMemoryUsagePercent)
+	assert.Equal(t, 12.5, web.ContainerCpuHostPercent)
+	assert.Equal(t, 6.25, web.ContainerMemoryHostPercent)
+	assert.Equal(t, int64(1010), web.ContainerNetworkReceiveBytesTotal)
+	assert.Equal(t, int64(2020), web.ContainerNetworkTransmitBytesTotal)
+	assert.Equal(t, int64(4096), web.ContainerBlockReadBytes)
+	assert.Equal(t, int64(8192), web.ContainerBlockWriteBytes)
+	assert.Equal(t, 7, web.ContainerPIDs)
+	assert.Nil(t, web.ContainerPressure)
+
+	_, err = engine.CollectContainer(context.Background(), "missing")
+	if httpErr, ok := err.(*echo.HTTPError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusNotFound, httpErr.Code)
+	}
+
+	// Without a client certificate the daemon refuses the connection.
+	os.Remove(filepath.Join(certPath, "cert.pem"))
+	os.Remove(filepath.Join(certPath, "key.pem"))
+	engine, err = NewEngineCollector(DockerEndpoint{Name: "build-01", Host: host, CertPath: certPath})
+	if assert.NoError(t, err) {
+		_, err = engine.Collect(context.Background(), types.ContainerFilter{})
+		assert.Error(t, err)
+	}
+}
+
+func TestHostsCollector(t *testing.T) {
+	server, certPath := startTLSEngine(t)
+	engine, err := NewEngineCollector(DockerEndpoint{
+		Name: "build-01", Host: "tcp://" + strings.TrimPrefix(server.URL, "https://"), CertPath: certPath,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	// An endpoint without the daemon certificate in its CA fails verification.
+	untrusted := t.TempDir()
+	down, _ := NewEngineCollector(DockerEndpoint{Name: "build-02", Host: "tcp://" + strings.TrimPrefix(server.URL, "https://"), CertPath: untrusted})
+
+	hosts := NewHostsCollector([]NamedCollector{{Name: "build-01", Collector: engine}, {Name: "build-02", Collector: down}}, 0)
+	list, hostErrors, err := hosts.CollectHosts(context.Background(), types.ContainerFilter{})
+	if assert.NoError(t, err) && assert.Len(t, list, 2) {
+		for _, metrics := range list {
+			assert.Equal(t, "build-01", metrics.Host)
+		}
+	}
+	if assert.Len(t, hostErrors, 1) {
+		assert.Equal(t, "build-02", hostErrors[0].Host)
+		assert.Contains(t, hostErrors[0].Error, "certificate")
+	}
+
+	metrics, err := hosts.CollectContainer(context.Background(), "web")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "build-01", metrics.Host)
+	}
+
+	hosts = NewHostsCollector([]NamedCollector{{Name: "build-02", Collector: down}}, 0)
+	_, _, err = hosts.CollectHosts(context.Background(), types.ContainerFilter{})
+	if httpErr, ok := err.(*echo.HTTPError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusBadGateway, httpErr.Code)
+	}
+}
+
+func TestHostsCollectorTimeout(t *testing.T) {
+	// A host that does not answer in time is reported as an error instead of holding up the others.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+	hung, err := NewEngineCollector(DockerEndpoint{Name: "build-03", Host: "tcp://" + strings.TrimPrefix(server.URL, "http://")})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	hosts := NewHostsCollector([]NamedCollector{{Name: "build-03", Collector: hung}}, 50*time.Millisecond)
+	_, hostErrors, err := hosts.CollectHosts(context.Background(), types.ContainerFilter{})
+	assert.Error(t, err)
+	assert.Equal(t, []types.HostError{{Host: "build-03", Error: "no response within 50ms"}}, hostErrors)
+	_, hostErrors, _ = hosts.DiskUsageHosts(context.Background())
+	assert.Equal(t, []types.HostError{{Host: "build-03", Error: "no response within 50ms"}}, hostErrors)
+}
+
+func TestSSHEngineClient(t *testing.T) {
+	// The ssh client is replaced by cat, which echoes the request back like a connection to itself.
+	var args []string
+	sshCommand = func(name string, arg ...string) *exec.Cmd {
+		args = arg
+		return exec.Command("cat")
+	}
+	defer func() { sshCommand = exec.Command }()
+
+	target, _ := url.Parse("ssh://dh@10.0.0.3:2222")
+	client := newSSHEngineClient(target)
+	conn, err := client.http.Transport.(*http.Transport).DialContext(context.Background(), "tcp", "docker.ssh:80")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("ping"))
+	assert.NoError(t, err)
+	reply := make([]byte, 4)
+	_, err = io.ReadFull(conn, reply)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "ping", string(reply))
+	}
+	assert.Equal(t, []string{"-o", "ConnectTimeout=30", "-o", "BatchMode=yes", "-T", "-l", "dh", "-p", "2222", "--", "10.0.0.3", "docker", "system", "dial-stdio"}, args)
+}
@@ -1,42 +1,69 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os/exec"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"vchan.in/doctor-metrics/procfs"
+	"vchan.in/doctor-metrics/selfmetrics"
 	"vchan.in/doctor-metrics/types"
 )
 
-func getMetrics(containerID string) (types.ContainerMetrics, error) {
+// DockerCollector collects container metrics with the docker CLI.
+type DockerCollector struct{}
+
+func (DockerCollector) Collect(ctx context.Context, filter types.ContainerFilter) (_ []types.ContainerMetrics, err error) {
+	defer selfmetrics.ObserveCollection("docker", time.Now(), &err)
+	return collectDockerMetrics(ctx, filter)
+}
+
+func (DockerCollector) CollectContainer(ctx context.Context, idOrName string) (types.ContainerMetrics, error) {
+	return getMetrics(ctx, idOrName)
+}
+
+func (DockerCollector) Ping(ctx context.Context) error {
+	// The docker CLI only reports the server version when the daemon answers.
+	if _, err := dockerOutput(ctx, "version", "--format", "{{.Server.Version}}"); err != nil {
+		return fmt.Errorf("docker daemon unreachable: %w", err)
+	}
+	return nil
+}
+
+func getMetrics(ctx context.Context, containerID string) (types.ContainerMetrics, error) {
 	/*
 		Get container metrics.
 
-		Function input is a container ID like "f3f177b2b3b4".
-		Function returns a ContainerMetrics struct with container metrics.
+		Function input is a container ID or name like "f3f177b2b3b4" or "web".
+		Function returns a ContainerMetrics struct with container metrics, an HTTP 404 error when the container does not exist.
 	*/
 	var metrics types.ContainerMetrics
 	metrics.Timestamp = time.Now().UTC().Format(time.RFC3339)
 	metrics.ContainerID = containerID
 
-	// Get container name using docker inspect (remove leading "/" if present)
-	containerName, err := exec.Command("docker", "inspect", "--format={{.Name}}", containerID).Output()
-	if err == nil {
-		name := strings.TrimSpace(string(containerName))
-		name = strings.TrimPrefix(name, "/")
-		metrics.ContainerName = name
-	} else {
+	// Get container metadata and init PID using the cached docker inspect output
+	var pid int
+	inspect, err := inspectContainer(ctx, containerID)
+	switch {
+	case err == nil:
+		metrics.ContainerID = inspect.ID[:min(12, len(inspect.ID))]
+		applyInspect(&metrics, inspect, time.Now())
+		metrics.ContainerImageDigest = imageDigest(ctx, inspect.Image)
+		pid = inspect.State.Pid
+	case isNoSuchContainer(err):
+		return metrics, echo.NewHTTPError(http.StatusNotFound, "Container not found")
+	default:
 		metrics.ContainerName = "N/A"
 	}
 
 	// Use docker stats to get container metrics in JSON format.
-	statsOutput, err := exec.Command("docker", "stats", containerID, "--no-stream", "--format", "{{json .}}").Output()
+	statsOutput, err := dockerOutput(ctx, "stats", containerID, "--no-stream", "--format", "{{json .}}")
 	if err != nil {
 		return metrics, err
 	}
@@ -89,12 +116,40 @@ func getMetrics(containerID string) (types.ContainerMetrics, error) {
 	pids, _ := strconv.Atoi(ds.PIDs)
 	metrics.ContainerPIDs = pids
 
-	// Set active status based on the presence of PIDs
-	metrics.Active = pids > 0
+	// Set active status from the container state, falling back to the presence of PIDs
+	if metrics.ContainerState != "" {
+		metrics.Active = metrics.ContainerState == "running"
+	} else {
+		metrics.Active = pids > 0
+	}
+
+	// Read pressure stall information from the container's cgroup (cgroup v2 only).
+	fs := procfs.NewFS()
+	if pid > 0 {
+		pressure, err := fs.CgroupPressure(pid)
+		if err == nil {
+			metrics.ContainerPressure = &pressure
+		}
+		applyDescriptors(&metrics, fs, pid)
+	}
+	metrics.SetHostShare(hostCapacity(fs))
 
 	return metrics, nil
 }
 
+func applyDescriptors(metrics *types.ContainerMetrics, fs procfs.FS, pid int) {
+	// Read the open file descriptors, nofile limit and TCP connections of a container through the PID of its init process.
+	if open, err := fs.OpenFDs(pid); err == nil {
+		metrics.ContainerOpenFDs = open
+	}
+	if limit, err := fs.NofileLimit(pid); err == nil {
+		metrics.ContainerFDLimit = limit
+	}
+	if connections, err := fs.TCPConnections(pid); err == nil {
+		metrics.ContainerTCPConnections = &connections
+	}
+}
+
 func convertToBytes(s string) (int64, error) {
 	// Convert a value like "1.2MB" or "3.4KB" to bytes.
 	s = strings.ToUpper(strings.TrimSpace(s))
@@ -122,32 +177,24 @@ func convertToBytes(s string) (int64, error) {
 	return 0, fmt.Errorf("unknown byte unit in %s", s)
 }
 
-func GetDockerMetrics(c echo.Context) error {
+func collectDockerMetrics(ctx context.Context, filter types.ContainerFilter) ([]types.ContainerMetrics, error) {
 	/*
-		Get metrics for all containers, including offline ones.
-
-		[
-			{
-			"Container": "f3f177b2b3b4",
-			"Name": "my-container",
-			"CPUPerc": "0.07%",
-			"MemUsage": "34.5MiB / 1.945GiB",
-			"MemPerc": "0.79%",
-			"NetIO": "1.2MB / 3.4MB",
-			"BlockIO": "73.7kB / 0B",
-			"PIDs": 123
-			},
-			...
-		]
+		Collect metrics for all containers matching the filter, including offline ones.
 
-		Function returns a JSON response with the container metrics.
+		The filter is passed to docker ps, so excluded containers never cost a docker stats call.
+		Function returns the metrics of every listed container in no particular order.
 	*/
-	listMetrics := []types.ContainerMetrics{}
-
 	// List all container IDs (including stopped ones) using docker ps -a
-	containerIDsBytes, err := exec.Command("docker", "ps", "-aq").Output()
+	args := []string{"ps", "-aq"}
+	for _, label := range filter.Labels {
+		args = append(args, "--filter", "label="+label)
+	}
+	for _, state := range filter.States {
+		args = append(args, "--filter", "status="+state)
+	}
+	containerIDsBytes, err := dockerOutput(ctx, args...)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve container list")
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve container list")
 	}
 	containerIDs := strings.Fields(string(containerIDsBytes))
 
@@ -166,11 +213,13 @@ func GetDockerMetrics(c echo.Context) error {
 			sem <- struct{}{}        // Acquire semaphore
 			defer func() { <-sem }() // Release semaphore
 
-			metrics, err := getMetrics(containerID)
+			start := time.Now()
+			metrics, err := getMetrics(ctx, containerID)
 			if err != nil {
 				errorChan <- err
 				return
 			}
+			selfmetrics.ObserveContainer("docker", metrics.ContainerName, time.Since(start))
 			metricsChan <- metrics
 		}(containerID)
 	}
@@ -180,21 +229,73 @@ func GetDockerMetrics(c echo.Context) error {
 	close(errorChan)
 
 	if len(errorChan) > 0 {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve container metrics")
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve container metrics")
 	}
 
+	listMetrics := []types.ContainerMetrics{}
 	for metrics := range metricsChan {
 		listMetrics = append(listMetrics, metrics)
 	}
-	response := types.APIResponse{
+	return listMetrics, nil
+}
+
+func GetDockerMetrics(c echo.Context) error {
+	/*
+		Get metrics for all containers, including offline ones.
+
+		GET /api/metrics?label=com.docker.compose.project=shop&name=web-*&state=running
+		               &sort=-container_cpu_usage_percent&limit=10&offset=20
+		               &fields=container_name,container_cpu_usage_percent
+
+		{
+		  "container_metrics": [
+		    {"container_name": "web-1", "container_cpu_usage_percent": 12.5},
+		    ...
+		  ],
+		  "pagination": {"total": 250, "count": 10, "limit": 10, "offset": 20},
+		  "errors": [{"host": "web-03", "error": "context deadline exceeded"}]
+		}
+
+		Function returns a JSON response with the filtered, sorted and paginated container metrics.
+		In aggregator mode the hosts that could not be collected are listed in "errors".
+		Containers are ordered by name unless a sort order is requested.
+	*/
+	query, err := parseMetricsQuery(c.QueryParams())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	var listMetrics []types.ContainerMetrics
+	var hostErrors []types.HostError
+	collectedAt := time.Now()
+	if hosts, ok := collector.(hostCollector); ok {
+		listMetrics, hostErrors, err = hosts.CollectHosts(c.Request().Context(), query.containerFilter())
+	} else {
+		listMetrics, err = collector.Collect(c.Request().Context(), query.containerFilter())
+	}
+	if err != nil {
+		return err
+	}
+	containerHealth.observeAll(listMetrics, collectedAt)
+
+	page, total := query.apply(listMetrics)
+	projected, err := query.project(page)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to encode container metrics")
+	}
+
+	response := types.MetricsListResponse{
 		Status:  "success",
 		Message: "Container metrics retrieved successfully",
-		Data: struct {
-			ContainerMetrics []types.ContainerMetrics `json:"container_metrics"`
-		}{
-			ContainerMetrics: listMetrics,
-		},
 	}
+	response.Data.ContainerMetrics = projected
+	response.Data.Pagination = types.Pagination{
+		Total:  total,
+		Count:  len(page),
+		Limit:  query.limit,
+		Offset: query.offset,
+	}
+	response.Data.Errors = hostErrors
 
 	return c.JSON(http.StatusOK, response)
 }
@@ -220,14 +321,7 @@ func GetMetricsContainerByName(c echo.Context) error {
 
 	containerName := c.Param("containerName")
 
-	// Get container ID using docker ps
-	containerIDBytes, err := exec.Command("docker", "ps", "--filter", "name="+containerName, "--format", "{{.ID}}").Output()
-	if err != nil {
-		return err
-	}
-	containerID := strings.TrimSpace(string(containerIDBytes))
-
-	metrics, err := getMetrics(containerID)
+	metrics, err := collector.CollectContainer(c.Request().Context(), containerName)
 	if err != nil {
 		return err
 	}
@@ -266,7 +360,7 @@ func GetMetricsContainerByID(c echo.Context) error {
 
 	containerID := c.Param("containerID")
 
-	metrics, err := getMetrics(containerID)
+	metrics, err := collector.CollectContainer(c.Request().Context(), containerID)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"vchan.in/doctor-metrics/selfmetrics"
+)
+
+// engineClient calls the Docker Engine API, or the compatible REST API of Podman.
+type engineClient struct {
+	http    *http.Client
+	baseURL string // Scheme and host requests are sent to e.g. "http://localhost"
+}
+
+// engineError is a non-2xx response of the Engine API.
+type engineError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *engineError) Error() string {
+	return fmt.Sprintf("engine API returned %d: %s", e.StatusCode, e.Message)
+}
+
+func newUnixEngineClient(socket string) *engineClient {
+	// Return a client that sends every request to a unix socket, the host in the URL is ignored.
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+	}
+	return &engineClient{
+		http:    &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		baseURL: "http://localhost",
+	}
+}
+
+func newTCPEngineClient(address string, tlsConfig *tls.Config) *engineClient {
+	// Return a client for a daemon listening on TCP e.g. "10.0.0.1:2376", with TLS if tlsConfig is set.
+	transport := &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment}
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+	return &engineClient{
+		http:    &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		baseURL: scheme + "://" + address,
+	}
+}
+
+// Starts the ssh client of SSH connections, replaced in tests.
+var sshCommand = exec.Command
+
+func newSSHEngineClient(target *url.URL) *engineClient {
+	/*
+		Return a client for a daemon reached over SSH, like the docker CLI does for ssh://user@host:port.
+
+		Every connection runs "docker system dial-stdio" on the remote host and talks to its stdin and stdout,
+		so authentication is left to the ssh client configuration of the user running dh.
+	*/
+	args := []string{"-o", "ConnectTimeout=30", "-o", "BatchMode=yes", "-T"}
+	if target.User != nil {
+		args = append(args, "-l", target.User.Username())
+	}
+	if port := target.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	args = append(args, "--", target.Hostname(), "docker", "system", "dial-stdio")
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialCommand(sshCommand("ssh", args...))
+		},
+		// The remote daemon sees one client per ssh session, keep a few sessions open.
+		MaxIdleConnsPerHost: 4,
+	}
+	return &engineClient{
+		http:    &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		baseURL: "http://docker.ssh",
+	}
+}
+
+func engineTLSConfig(certPath string, skipVerify bool) (*tls.Config, error) {
+	/*
+		Load the client TLS configuration from a directory with ca.pem, cert.pem and key.pem,
+		the files DOCKER_CERT_PATH points to. The daemon certificate is verified against ca.pem,
+		or the system roots without it, unless skipVerify is set.
+	*/
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: skipVerify}
+
+	ca, err := os.ReadFile(filepath.Join(certPath, "ca.pem"))
+	switch {
+	case err == nil:
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", filepath.Join(certPath, "ca.pem"))
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	certFile, keyFile := filepath.Join(certPath, "cert.pem"), filepath.Join(certPath, "key.pem")
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+	if certErr == nil || keyErr == nil {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+// commandConn is a connection to the stdin and stdout of a command.
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+}
+
+func dialCommand(cmd *exec.Cmd) (net.Conn, error) {
+	// Start the command and return a connection to it, closing the connection stops the command.
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &commandConn{cmd: cmd, stdin: stdin, stdout: stdout}, nil
+}
+
+func (c *commandConn) Read(p []byte) (int, error)  { return c.stdout.Read(p) }
+func (c *commandConn) Write(p []byte) (int, error) { return c.stdin.Write(p) }
+
+func (c *commandConn) Close() error {
+	c.stdin.Close()
+	if c.cmd.Process != nil {
+		c.cmd.Process.Kill()
+	}
+	c.cmd.Wait()
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr                { return commandAddr{} }
+func (c *commandConn) RemoteAddr() net.Addr               { return commandAddr{} }
+func (c *commandConn) SetDeadline(t time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// commandAddr is the address of a command connection.
+type commandAddr struct{}
+
+func (commandAddr) Network() string { return "command" }
+func (commandAddr) String() string  { return "command" }
+
+func (c *engineClient) getJSON(ctx context.Context, path string, query url.Values, v any) (err error) {
+	/*
+		Send a GET request and decode the JSON response into v.
+
+		Function returns an *engineError with the message of the response body for non-2xx responses,
+		e.g. {"message": "no such container"}. Failures are counted in the self metrics.
+	*/
+	defer func() {
+		if err != nil {
+			selfmetrics.CountDockerError("api", runtimeErrorType(ctx, err))
+		}
+	}()
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	response, err := c.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 64*1024))
+		var message struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &message) != nil || message.Message == "" {
+			message.Message = http.StatusText(response.StatusCode)
+		}
+		return &engineError{StatusCode: response.StatusCode, Message: message.Message}
+	}
+	return json.NewDecoder(response.Body).Decode(v)
+}
+
+func (c *engineClient) ping(ctx context.Context) error {
+	// Request the daemon version, the cheapest JSON endpoint of the Docker and Podman APIs.
+	var version struct {
+		Version string `json:"Version"`
+	}
+	return c.getJSON(ctx, "/version", nil, &version)
+}
@@ -1,18 +1,26 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/auth"
+	"vchan.in/doctor-metrics/logging"
 	"vchan.in/doctor-metrics/types"
 )
 
@@ -117,6 +125,171 @@ func TestHandleAuthMiddlewareInvalidCredentials(t *testing.T) {
 			assert.Equal(t, http.StatusUnauthorized, httpError.Code)
 		}
 	}
+	assert.Equal(t, `Basic realm="dh"`, rec.Header().Get(echo.HeaderWWWAuthenticate))
+}
+
+func TestHandleAuthMiddlewareConfiguredUsers(t *testing.T) {
+	defer access.Store(nil)
+	hash, err := auth.Hash("readonly", auth.SchemeArgon2id)
+	if err != nil {
+		t.Fatalf("Failed to hash the password: %v", err)
+	}
+	SetAccessControl(newStore(t, auth.User{Username: "admin", Password: "s3cret"}, auth.User{Username: "grafana", PasswordHash: hash}), []string{"127.0.0.1"})
+
+	handler := HandleAuthMiddleware(func(c echo.Context) error {
+		return c.String(http.StatusOK, "test")
+	})
+	for credentials, allowed := range map[string]bool{
+		"admin:s3cret":      true,
+		"grafana:readonly":  true,
+		"grafana:s3cret":    false,
+		"user:password@123": false,
+	} {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+		assert.Equal(t, allowed, err == nil, credentials)
+	}
+}
+
+func newStore(t *testing.T, users ...auth.User) *auth.Store {
+	store, err := auth.NewStore(users)
+	if err != nil {
+		t.Fatalf("Failed to create the user store: %v", err)
+	}
+	return store
+}
+
+func TestHandleAuthMiddlewareMalformedHeader(t *testing.T) {
+	// Other schemes and headers shorter than the scheme are rejected without a panic.
+	defer access.Store(nil)
+	SetAccessControl(newStore(t, auth.User{Username: "admin", Password: "s3cret"}), []string{"127.0.0.1"})
+
+	handler := HandleAuthMiddleware(func(c echo.Context) error {
+		return c.String(http.StatusOK, "test")
+	})
+	for _, header := range []string{
+		"B",
+		"Basic",
+		"Basic ",
+		"Basic !!!",
+		"Basic " + base64.StdEncoding.EncodeToString([]byte("admin")),
+		"Bearer " + base64.StdEncoding.EncodeToString([]byte("admin:s3cret")),
+		"Digest username=\"admin\"",
+	} {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", header)
+		rec := httptest.NewRecorder()
+		err := handler(e.NewContext(req, rec))
+		if assert.Error(t, err, header) {
+			httpError, ok := err.(*echo.HTTPError)
+			if assert.True(t, ok, header) {
+				assert.Equal(t, http.StatusUnauthorized, httpError.Code, header)
+			}
+		}
+		assert.Equal(t, `Basic realm="dh"`, rec.Header().Get(echo.HeaderWWWAuthenticate), header)
+	}
+
+	// The scheme is case-insensitive
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "basic "+base64.StdEncoding.EncodeToString([]byte("admin:s3cret")))
+	assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())))
+}
+
+func TestSetRateLimit(t *testing.T) {
+	defer SetRateLimit(defaultRateLimit, 0)
+	SetRateLimit(1, 2)
+
+	e := echo.New()
+	e.Use(RateLimiter())
+	e.GET("/", func(c echo.Context) error {
+		return c.String(http.StatusOK, "test")
+	})
+	request := func() int {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusOK, request())
+	assert.Equal(t, http.StatusOK, request())
+	assert.Equal(t, http.StatusTooManyRequests, request())
+
+	// A new limit applies to the next request.
+	SetRateLimit(100, 10)
+	assert.Equal(t, http.StatusOK, request())
+}
+
+func TestAccessAndAuditLogs(t *testing.T) {
+	defer access.Store(nil)
+	defer slog.SetDefault(slog.Default())
+	SetAccessControl(newStore(t, auth.User{Username: "admin", Password: "s3cret"}), []string{"192.0.2.1"})
+	var out bytes.Buffer
+	if err := logging.Configure(logging.Config{Level: "debug", Format: logging.FormatJSON, Access: true}, &out); err != nil {
+		t.Fatalf("Failed to configure the logs: %v", err)
+	}
+	defer logging.Configure(logging.Config{Level: "info", Format: logging.FormatText}, io.Discard)
+
+	e := echo.New()
+	e.Use(middleware.RequestID(), AccessLog, FilterIP, HandleAuthMiddleware)
+	e.GET("/api/metrics/:containerName", func(c echo.Context) error {
+		return c.String(http.StatusOK, "test")
+	})
+	request := func(remoteAddr, credentials string) map[string]any {
+		// Serve a request and return its access log record.
+		out.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/api/metrics/web", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(echo.HeaderXRequestID, "req-1")
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+		e.ServeHTTP(httptest.NewRecorder(), req)
+		return lastRecord(t, &out)
+	}
+
+	record := request("192.0.2.1:41000", "admin:s3cret")
+	assert.Equal(t, "access", record["log"])
+	assert.Equal(t, "req-1", record["request_id"])
+	assert.Equal(t, "admin", record["user"])
+	assert.Equal(t, "192.0.2.1", record["client_ip"])
+	assert.Equal(t, "/api/metrics/:containerName", record["route"])
+	assert.Equal(t, "/api/metrics/web", record["path"])
+	assert.Equal(t, float64(http.StatusOK), record["status"])
+	assert.Contains(t, record, "latency_ms")
+
+	// Rejected requests are logged to the audit log before the access log
+	record = request("192.0.2.1:41000", "admin:wrong")
+	assert.Equal(t, float64(http.StatusUnauthorized), record["status"])
+	assert.Empty(t, record["user"])
+	audit := firstRecord(t, &out)
+	assert.Equal(t, "audit", audit["log"])
+	assert.Equal(t, "invalid_credentials", audit["reason"])
+	assert.Equal(t, "admin", audit["user"])
+	assert.Equal(t, "req-1", audit["request_id"])
+
+	request("198.51.100.7:41000", "admin:s3cret")
+	audit = firstRecord(t, &out)
+	assert.Equal(t, "ip_not_allowed", audit["reason"])
+	assert.Equal(t, "198.51.100.7", audit["client_ip"])
+}
+
+func firstRecord(t *testing.T, out *bytes.Buffer) map[string]any {
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	return decodeRecord(t, lines[0])
+}
+
+func lastRecord(t *testing.T, out *bytes.Buffer) map[string]any {
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	return decodeRecord(t, lines[len(lines)-1])
+}
+
+func decodeRecord(t *testing.T, line []byte) map[string]any {
+	var record map[string]any
+	if err := json.Unmarshal(line, &record); err != nil {
+		t.Fatalf("Failed to decode log record %q: %v", line, err)
+	}
+	return record
 }
 
 func TestGetDockerMetrics(t *testing.T) {
@@ -204,6 +377,37 @@ func TestGetMetricsContainerByNameError(t *testing.T) {
 	}
 }
 
+func TestGetMetricsContainerByNameID(t *testing.T) {
+	// A container requested by name is reported with its short ID, and an unknown name is not found.
+	bin := t.TempDir()
+	script := `#!/bin/sh
+case "$1" in
+inspect)
+	if [ "$2" != by-name-web ]; then echo "Error: No such object: $2" >&2; exit 1; fi
+	echo '[{"Id": "0123456789abcdef0123456789abcdef", "Name": "/by-name-web", "State": {"Status": "running"}, "Config": {"Image": "nginx"}}]' ;;
+stats)
+	echo '{"CPUPerc": "0.07%", "MemUsage": "34.5MiB / 1.945GiB", "PIDs": "3"}' ;;
+*)
+	exit 1 ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0o755); err != nil {
+		t.Fatalf("Failed to write the fake docker CLI: %v", err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	metrics, err := DockerCollector{}.CollectContainer(context.Background(), "by-name-web")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "0123456789ab", metrics.ContainerID)
+		assert.Equal(t, "by-name-web", metrics.ContainerName)
+	}
+
+	_, err = DockerCollector{}.CollectContainer(context.Background(), "by-name-missing")
+	if httpError, ok := err.(*echo.HTTPError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusNotFound, httpError.Code)
+	}
+}
+
 func TestGetMetricsContainerByID(t *testing.T) {
 	e := echo.New()
 	req := httptest.NewRequest(http.MethodGet, "/api/metrics/containerID", nil)
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"vchan.in/doctor-metrics/procfs"
+	"vchan.in/doctor-metrics/types"
+)
+
+// DefaultDockerDataRoot is the data root of the Docker daemon unless DM_DOCKER_DATA_ROOT is set.
+const DefaultDockerDataRoot = "/var/lib/docker"
+
+// hostSampler keeps the last /proc/stat sample to compute the host CPU usage between requests.
+type hostSampler struct {
+	sampleInterval time.Duration // Wait between two CPU samples when no recent sample exists
+
+	mu         sync.Mutex
+	previous   []procfs.CPUStat
+	previousAt time.Time
+}
+
+var hostCPU = &hostSampler{sampleInterval: time.Second}
+
+func (h *hostSampler) cpuUsage(ctx context.Context, fs procfs.FS) ([]types.HostCPU, error) {
+	/*
+		Get the usage of all cores and of each core since the previous sample.
+
+		Without a sample from the last minute, /proc/stat is sampled again after a short wait.
+		Function returns the usage of all cores first, then each core.
+	*/
+	current, err := fs.CPUStats()
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	previous, previousAt := h.previous, h.previousAt
+	h.mu.Unlock()
+	if previous == nil || time.Since(previousAt) > time.Minute {
+		previous = current
+		select {
+		case <-time.After(h.sampleInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if current, err = fs.CPUStats(); err != nil {
+			return nil, err
+		}
+	}
+
+	h.mu.Lock()
+	h.previous, h.previousAt = current, time.Now()
+	h.mu.Unlock()
+
+	byName := make(map[string]procfs.CPUStat, len(previous))
+	for _, stat := range previous {
+		byName[stat.CPU] = stat
+	}
+	usage := make([]types.HostCPU, 0, len(current))
+	for _, stat := range current {
+		usage = append(usage, procfs.CPUUsage(byName[stat.CPU], stat))
+	}
+	return usage, nil
+}
+
+func dockerDataRoot() string {
+	// The directory the Docker data root filesystem usage is reported for, mounted from the host when dh runs in a container.
+	if root := os.Getenv("DM_DOCKER_DATA_ROOT"); root != "" {
+		return root
+	}
+	return DefaultDockerDataRoot
+}
+
+func hostCapacity(fs procfs.FS) (int, int64) {
+	// Return the number of CPUs and the memory of the host, 0 if they cannot be read.
+	cpus, _ := fs.CPUCount()
+	memTotal, _ := fs.MemTotal()
+	return cpus, memTotal
+}
+
+func collectHostMetrics(ctx context.Context, fs procfs.FS, dataRoot string) (types.HostMetrics, error) {
+	// Collect the metrics of the host from procfs and sysfs.
+	now := time.Now()
+	host := types.HostMetrics{Timestamp: now.UTC().Format(time.RFC3339)}
+
+	usage, err := hostCPU.cpuUsage(ctx, fs)
+	if err != nil {
+		return types.HostMetrics{}, err
+	}
+	host.CPU, host.Cores = usage[0], usage[1:]
+	host.CPUCount = len(host.Cores)
+
+	if host.Load, err = fs.LoadAvg(); err != nil {
+		return types.HostMetrics{}, err
+	}
+	if host.Memory, err = fs.HostMemory(); err != nil {
+		return types.HostMetrics{}, err
+	}
+	uptime, err := fs.Uptime()
+	if err != nil {
+		return types.HostMetrics{}, err
+	}
+	host.UptimeSeconds = int64(uptime)
+	if bootTime, err := fs.BootTime(); err == nil {
+		host.BootTime = bootTime.Format(time.RFC3339)
+	}
+
+	if host.NetworkInterfaces, err = fs.HostNetworkInterfaces(); err != nil {
+		host.NetworkInterfaces = []types.HostNetworkInterface{}
+	}
+	if filesystem, err := procfs.FilesystemUsage(dataRoot); err == nil {
+		host.Filesystem = &filesystem
+	}
+	return host, nil
+}
+
+func GetHostMetrics(c echo.Context) error {
+	/*
+		Get metrics of the host the containers run on.
+
+		{
+		  "timestamp": "2021-09-01T12:34:56Z",
+		  "uptime_seconds": 2096,
+		  "cpu_count": 2,
+		  "cpu": {"cpu": "cpu", "usage_percent": 37.5, "user_percent": 30.25, ...},
+		  "cores": [{"cpu": "cpu0", "usage_percent": 40.0, ...}, ...],
+		  "load": {"load1": 0.52, "load5": 0.61, "load15": 0.58, ...},
+		  "memory": {"total_bytes": 2097152000, "used_bytes": 1048576000, "usage_percent": 50.0, ...},
+		  "filesystem": {"path": "/var/lib/docker", "usage_percent": 52.63, ...},
+		  "network_interfaces": [{"interface": "eth0", "oper_state": "up", "receive_bytes": 123456, ...}, ...]
+		}
+
+		Function returns a JSON response with the host metrics read from /proc and /sys,
+		or an HTTP 503 error when procfs cannot be read.
+	*/
+	host, err := collectHostMetrics(c.Request().Context(), procfs.NewFS(), dockerDataRoot())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Host metrics are not available on this host")
+	}
+
+	response := types.HostResponse{
+		Status:  "success",
+		Message: "Host metrics retrieved successfully",
+	}
+	response.Data.HostMetrics = host
+
+	return c.JSON(http.StatusOK, response)
+}
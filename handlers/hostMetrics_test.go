@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/procfs"
+	"vchan.in/doctor-metrics/types"
+)
+
+func writeFakeFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetHostMetrics(t *testing.T) {
+	// Fake procfs and sysfs roots of a 2 core host with 2 GB of memory.
+	root := t.TempDir()
+	proc, sys := filepath.Join(root, "proc"), filepath.Join(root, "sys")
+	writeFakeFile(t, filepath.Join(proc, "stat"), "cpu  700 0 200 1000 100 0 0 0 0 0\n"+
+		"cpu0 400 0 100 400 100 0 0 0 0 0\ncpu1 300 0 100 600 0 0 0 0 0 0\nbtime 1630497600\n")
+	writeFakeFile(t, filepath.Join(proc, "loadavg"), "1.50 1.00 0.50 3/420 4242\n")
+	writeFakeFile(t, filepath.Join(proc, "uptime"), "3600.42 7000.00\n")
+	writeFakeFile(t, filepath.Join(proc, "meminfo"), "MemTotal:        2048000 kB\nMemFree:          512000 kB\n"+
+		"MemAvailable:     512000 kB\nSwapTotal:             0 kB\nSwapFree:              0 kB\n")
+	writeFakeFile(t, filepath.Join(proc, "1", "net", "dev"), `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+  ens3:  987654     900    0    0    0     0          0         0   123456     800    0    0    0     0       0          0
+`)
+	writeFakeFile(t, filepath.Join(sys, "class", "net", "ens3", "operstate"), "up\n")
+	writeFakeFile(t, filepath.Join(sys, "class", "net", "ens3", "speed"), "10000\n")
+	t.Setenv("DM_PROC_ROOT", proc)
+	t.Setenv("DM_SYS_ROOT", sys)
+	t.Setenv("DM_DOCKER_DATA_ROOT", root)
+
+	// A recent previous sample avoids waiting for a second one.
+	hostCPU.previous = []procfs.CPUStat{
+		{CPU: "cpu", User: 300, System: 100, Idle: 500, IOWait: 100},
+		{CPU: "cpu0", User: 200, System: 50, Idle: 200, IOWait: 50},
+		{CPU: "cpu1", User: 100, System: 50, Idle: 350},
+	}
+	hostCPU.previousAt = time.Now()
+	defer func() { hostCPU.previous = nil }()
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/host", nil), rec)
+	if !assert.NoError(t, GetHostMetrics(c)) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response types.HostResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	host := response.Data.HostMetrics
+
+	assert.Equal(t, 2, host.CPUCount)
+	assert.Equal(t, types.HostCPU{CPU: "cpu", UsagePercent: 50, UserPercent: 40, SystemPercent: 10}, host.CPU)
+	if assert.Len(t, host.Cores, 2) {
+		assert.Equal(t, 50.0, host.Cores[0].UsagePercent)
+		assert.Equal(t, 10.0, host.Cores[0].IOWaitPercent)
+		assert.Equal(t, 50.0, host.Cores[1].UsagePercent)
+	}
+	assert.Equal(t, types.HostLoad{Load1: 1.5, Load5: 1, Load15: 0.5, RunningProcesses: 3, TotalProcesses: 420}, host.Load)
+	assert.Equal(t, 75.0, host.Memory.UsagePercent)
+	assert.Zero(t, host.Memory.SwapUsagePercent)
+	assert.Equal(t, int64(3600), host.UptimeSeconds)
+	assert.Equal(t, "2021-09-01T12:00:00Z", host.BootTime)
+	if assert.Len(t, host.NetworkInterfaces, 1) {
+		assert.Equal(t, "ens3", host.NetworkInterfaces[0].Interface)
+		assert.Equal(t, int64(987654), host.NetworkInterfaces[0].ReceiveBytes)
+		assert.Equal(t, int64(10000), host.NetworkInterfaces[0].SpeedMbps)
+	}
+	if assert.NotNil(t, host.Filesystem) {
+		assert.Equal(t, root, host.Filesystem.Path)
+		assert.Positive(t, host.Filesystem.TotalBytes)
+	}
+}
+
+func TestGetHostMetricsUnavailable(t *testing.T) {
+	t.Setenv("DM_PROC_ROOT", t.TempDir())
+
+	e := echo.New()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/host", nil), httptest.NewRecorder())
+	err := GetHostMetrics(c)
+	if httpErr, ok := err.(*echo.HTTPError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusServiceUnavailable, httpErr.Code)
+	}
+}
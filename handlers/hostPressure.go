@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"vchan.in/doctor-metrics/procfs"
+	"vchan.in/doctor-metrics/types"
+)
+
+func GetHostPressure(c echo.Context) error {
+	/*
+		Get host-level pressure stall information.
+
+		{
+		  "cpu": {"some": {"avg10": 0.59, "avg60": 1.01, "avg300": 1.63, "total": 11076292}},
+		  "memory": {"some": {...}, "full": {...}},
+		  "io": {"some": {...}, "full": {...}}
+		}
+
+		Function returns a JSON response with the contents of /proc/pressure/{cpu,memory,io}.
+	*/
+	pressure, err := procfs.NewFS().HostPressure()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Pressure stall information is not available on this host")
+	}
+
+	response := types.HostPressureResponse{
+		Status:  "success",
+		Message: "Host pressure retrieved successfully",
+	}
+	response.Data.HostPressure = pressure
+
+	return c.JSON(http.StatusOK, response)
+}
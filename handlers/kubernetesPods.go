@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"vchan.in/doctor-metrics/types"
+)
+
+// Labels set by dockershim and cri-dockerd on the containers of a Kubernetes pod.
+const (
+	kubernetesPodNameLabel       = "io.kubernetes.pod.name"
+	kubernetesPodNamespaceLabel  = "io.kubernetes.pod.namespace"
+	kubernetesPodUIDLabel        = "io.kubernetes.pod.uid"
+	kubernetesContainerNameLabel = "io.kubernetes.container.name"
+	kubernetesDockerTypeLabel    = "io.kubernetes.docker.type"
+	kubernetesRestartCountLabel  = "annotation.io.kubernetes.container.restartCount"
+	criContainerdKindLabel       = "io.cri-containerd.kind"
+)
+
+func isPodSandbox(metrics types.ContainerMetrics) bool {
+	// Sandbox (pause) containers hold the pod network namespace, older dockershim versions only name them "POD".
+	return metrics.ContainerLabels[kubernetesDockerTypeLabel] == "podsandbox" ||
+		metrics.ContainerLabels[criContainerdKindLabel] == "sandbox" ||
+		metrics.ContainerLabels[kubernetesContainerNameLabel] == "POD"
+}
+
+func groupKubernetesPods(list []types.ContainerMetrics) []types.KubernetesPod {
+	/*
+		Group container metrics by Kubernetes pod.
+
+		Application containers join the network namespace of the pod sandbox, so the pod network usage
+		is taken from its sandbox containers only and application containers do not count it twice.
+		CPU, memory, block I/O and PIDs are summed over all containers of the pod including the sandbox.
+		Function returns the pods ordered by namespace and name.
+	*/
+	type podKey struct{ namespace, name, uid string }
+	members := make(map[podKey][]types.ContainerMetrics)
+	for _, metrics := range list {
+		name, ok := metrics.ContainerLabels[kubernetesPodNameLabel]
+		if !ok {
+			continue
+		}
+		key := podKey{metrics.ContainerLabels[kubernetesPodNamespaceLabel], name, metrics.ContainerLabels[kubernetesPodUIDLabel]}
+		members[key] = append(members[key], metrics)
+	}
+
+	pods := []types.KubernetesPod{}
+	for key, containers := range members {
+		pod := types.KubernetesPod{
+			Namespace:  key.namespace,
+			Pod:        key.name,
+			UID:        key.uid,
+			Usage:      sumUsage(containers),
+			Containers: []types.KubernetesContainer{},
+		}
+
+		var sandboxes []types.ContainerMetrics
+		for _, metrics := range containers {
+			if isPodSandbox(metrics) {
+				sandboxes = append(sandboxes, metrics)
+				if metrics.Active || pod.SandboxID == "" {
+					pod.SandboxID = metrics.ContainerID
+				}
+				continue
+			}
+			restartCount, _ := strconv.Atoi(metrics.ContainerLabels[kubernetesRestartCountLabel])
+			pod.Containers = append(pod.Containers, types.KubernetesContainer{
+				Name:                      metrics.ContainerLabels[kubernetesContainerNameLabel],
+				ContainerID:               metrics.ContainerID,
+				ContainerName:             metrics.ContainerName,
+				State:                     metrics.ContainerState,
+				RestartCount:              restartCount,
+				ContainerCpuUsagePercent:  metrics.ContainerCpuUsagePercent,
+				ContainerMemoryUsageBytes: metrics.ContainerMemoryUsageBytes,
+			})
+			if metrics.Active {
+				pod.Running++
+			}
+		}
+
+		if len(sandboxes) > 0 {
+			network := sumUsage(sandboxes)
+			pod.Usage.NetworkReceiveBytesTotal = network.NetworkReceiveBytesTotal
+			pod.Usage.NetworkTransmitBytesTotal = network.NetworkTransmitBytesTotal
+		}
+		if pod.Running > 0 {
+			// Average over application containers, a running pause container would halve the average.
+			pod.Usage.CpuUsagePercentAvg = roundPercent(pod.Usage.CpuUsagePercentTotal / float64(pod.Running))
+		}
+
+		sort.Slice(pod.Containers, func(i, j int) bool {
+			if pod.Containers[i].Name != pod.Containers[j].Name {
+				return pod.Containers[i].Name < pod.Containers[j].Name
+			}
+			return pod.Containers[i].RestartCount > pod.Containers[j].RestartCount
+		})
+		pods = append(pods, pod)
+	}
+
+	sort.Slice(pods, func(i, j int) bool {
+		if pods[i].Namespace != pods[j].Namespace {
+			return pods[i].Namespace < pods[j].Namespace
+		}
+		if pods[i].Pod != pods[j].Pod {
+			return pods[i].Pod < pods[j].Pod
+		}
+		return pods[i].UID < pods[j].UID
+	})
+	return pods
+}
+
+func groupKubernetesNamespaces(pods []types.KubernetesPod) []types.KubernetesNamespace {
+	// Sum the pod usage per namespace, pods must be ordered by namespace.
+	namespaces := []types.KubernetesNamespace{}
+	for _, pod := range pods {
+		if len(namespaces) == 0 || namespaces[len(namespaces)-1].Namespace != pod.Namespace {
+			namespaces = append(namespaces, types.KubernetesNamespace{Namespace: pod.Namespace})
+		}
+		namespace := &namespaces[len(namespaces)-1]
+		namespace.Pods++
+		namespace.Containers += len(pod.Containers)
+		namespace.Usage.CpuUsagePercentTotal = roundPercent(namespace.Usage.CpuUsagePercentTotal + pod.Usage.CpuUsagePercentTotal)
+		namespace.Usage.MemoryUsageBytes += pod.Usage.MemoryUsageBytes
+		namespace.Usage.MemoryLimitBytes += pod.Usage.MemoryLimitBytes
+		namespace.Usage.NetworkReceiveBytesTotal += pod.Usage.NetworkReceiveBytesTotal
+		namespace.Usage.NetworkTransmitBytesTotal += pod.Usage.NetworkTransmitBytesTotal
+		namespace.Usage.BlockReadBytes += pod.Usage.BlockReadBytes
+		namespace.Usage.BlockWriteBytes += pod.Usage.BlockWriteBytes
+		namespace.Usage.PIDs += pod.Usage.PIDs
+	}
+	for i := range namespaces {
+		if namespaces[i].Pods > 0 {
+			namespaces[i].Usage.CpuUsagePercentAvg = roundPercent(namespaces[i].Usage.CpuUsagePercentTotal / float64(namespaces[i].Pods))
+		}
+	}
+	return namespaces
+}
+
+func GetKubernetesPods(c echo.Context) error {
+	/*
+		Get aggregated metrics for the Kubernetes pods and namespaces running on this node.
+
+		GET /api/pods?namespace=shop
+
+		{
+		  "namespaces": [{"namespace": "shop", "pods": 2, "containers": 3, "usage": {...}}],
+		  "pods": [
+		    {
+		      "namespace": "shop",
+		      "pod": "web-7d9f8",
+		      "sandbox_id": "a1b2c3d4e5f6",
+		      "running": 2,
+		      "containers": [{"name": "nginx", "state": "running", ...}],
+		      "usage": {"cpu_usage_percent_total": 12.5, "network_receive_bytes_total": 123456, ...}
+		    },
+		    ...
+		  ]
+		}
+
+		Pods are identified by the labels cri-dockerd (or dockershim) sets on their containers.
+		Function returns a JSON response with the namespaces ordered by name and the pods ordered by namespace and name.
+	*/
+	filter := types.ContainerFilter{Labels: []string{kubernetesPodNameLabel}}
+	if namespace := c.QueryParam("namespace"); namespace != "" {
+		filter.Labels = append(filter.Labels, kubernetesPodNamespaceLabel+"="+namespace)
+	}
+
+	listMetrics, err := collector.Collect(c.Request().Context(), filter)
+	if err != nil {
+		return err
+	}
+
+	pods := groupKubernetesPods(listMetrics)
+	response := types.PodsResponse{
+		Status:  "success",
+		Message: "Kubernetes pods retrieved successfully",
+	}
+	response.Data.Namespaces = groupKubernetesNamespaces(pods)
+	response.Data.Pods = pods
+
+	return c.JSON(http.StatusOK, response)
+}
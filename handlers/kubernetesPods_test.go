@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/types"
+)
+
+func podContainer(id, namespace, pod, container, dockerType string, active bool) types.ContainerMetrics {
+	metrics := types.ContainerMetrics{
+		Active:        active,
+		ContainerID:   id,
+		ContainerName: "k8s_" + container + "_" + pod + "_" + namespace + "_uid-" + pod + "_0",
+		ContainerLabels: map[string]string{
+			kubernetesPodNameLabel:       pod,
+			kubernetesPodNamespaceLabel:  namespace,
+			kubernetesPodUIDLabel:        "uid-" + pod,
+			kubernetesContainerNameLabel: container,
+			kubernetesDockerTypeLabel:    dockerType,
+		},
+	}
+	if active {
+		metrics.ContainerState = "running"
+		metrics.ContainerCpuUsagePercent = 10
+		metrics.ContainerMemoryUsageBytes = 100
+		metrics.ContainerPIDs = 2
+	} else {
+		metrics.ContainerState = "exited"
+	}
+	return metrics
+}
+
+func podsFixture() []types.ContainerMetrics {
+	sandbox := podContainer("s1", "shop", "web-7d9f8", "POD", "podsandbox", true)
+	sandbox.ContainerCpuUsagePercent = 0
+	sandbox.ContainerNetworkReceiveBytesTotal = 5000
+	sandbox.ContainerNetworkTransmitBytesTotal = 7000
+
+	oldSandbox := podContainer("s0", "shop", "web-7d9f8", "POD", "podsandbox", false)
+
+	nginx := podContainer("c1", "shop", "web-7d9f8", "nginx", "container", true)
+	nginx.ContainerLabels[kubernetesRestartCountLabel] = "1"
+	// Application containers report the shared sandbox network, which must not be counted twice.
+	nginx.ContainerNetworkReceiveBytesTotal = 5000
+
+	crashed := podContainer("c0", "shop", "web-7d9f8", "nginx", "container", false)
+	crashed.ContainerLabels[kubernetesRestartCountLabel] = "0"
+
+	return []types.ContainerMetrics{
+		nginx,
+		sandbox,
+		oldSandbox,
+		crashed,
+		podContainer("c2", "shop", "web-7d9f8", "sidecar", "container", true),
+		podContainer("s2", "shop", "db-0", "POD", "podsandbox", true),
+		podContainer("c3", "shop", "db-0", "postgres", "container", true),
+		podContainer("s3", "kube-system", "coredns-5d78c", "POD", "podsandbox", true),
+		podContainer("c4", "kube-system", "coredns-5d78c", "coredns", "container", true),
+		{ContainerID: "x1", ContainerName: "standalone", Active: true},
+	}
+}
+
+func TestGroupKubernetesPods(t *testing.T) {
+	pods := groupKubernetesPods(podsFixture())
+	if !assert.Len(t, pods, 3) {
+		return
+	}
+	assert.Equal(t, "kube-system", pods[0].Namespace)
+	assert.Equal(t, "db-0", pods[1].Pod)
+
+	web := pods[2]
+	assert.Equal(t, "web-7d9f8", web.Pod)
+	assert.Equal(t, "uid-web-7d9f8", web.UID)
+	assert.Equal(t, "s1", web.SandboxID)
+	assert.Equal(t, 2, web.Running)
+	if assert.Len(t, web.Containers, 3) {
+		assert.Equal(t, "nginx", web.Containers[0].Name)
+		assert.Equal(t, 1, web.Containers[0].RestartCount)
+		assert.Equal(t, "exited", web.Containers[1].State)
+		assert.Equal(t, "sidecar", web.Containers[2].Name)
+	}
+	assert.Equal(t, int64(5000), web.Usage.NetworkReceiveBytesTotal)
+	assert.Equal(t, int64(7000), web.Usage.NetworkTransmitBytesTotal)
+	assert.Equal(t, 20.0, web.Usage.CpuUsagePercentTotal)
+	assert.Equal(t, 10.0, web.Usage.CpuUsagePercentAvg)
+	assert.Equal(t, int64(300), web.Usage.MemoryUsageBytes)
+}
+
+func TestGroupKubernetesNamespaces(t *testing.T) {
+	namespaces := groupKubernetesNamespaces(groupKubernetesPods(podsFixture()))
+	if assert.Len(t, namespaces, 2) {
+		assert.Equal(t, "kube-system", namespaces[0].Namespace)
+		shop := namespaces[1]
+		assert.Equal(t, 2, shop.Pods)
+		assert.Equal(t, 4, shop.Containers)
+		assert.Equal(t, 40.0, shop.Usage.CpuUsagePercentTotal)
+		assert.Equal(t, 20.0, shop.Usage.CpuUsagePercentAvg)
+		assert.Equal(t, int64(5000), shop.Usage.NetworkReceiveBytesTotal)
+	}
+}
+
+func TestIsPodSandbox(t *testing.T) {
+	for labels, expected := range map[string]bool{
+		kubernetesDockerTypeLabel + "=podsandbox": true,
+		criContainerdKindLabel + "=sandbox":       true,
+		kubernetesContainerNameLabel + "=POD":     true,
+		criContainerdKindLabel + "=container":     false,
+	} {
+		key, value, _ := strings.Cut(labels, "=")
+		metrics := types.ContainerMetrics{ContainerLabels: map[string]string{key: value}}
+		assert.Equal(t, expected, isPodSandbox(metrics), labels)
+	}
+}
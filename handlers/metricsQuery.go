@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"vchan.in/doctor-metrics/types"
+)
+
+// Index of the ContainerMetrics struct fields by JSON name, used for sorting and field selection.
+var metricsFields = func() map[string]int {
+	fields := make(map[string]int)
+	t := reflect.TypeOf(types.ContainerMetrics{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = i
+		}
+	}
+	return fields
+}()
+
+// Container states accepted by the state parameter, the states of the Docker Engine API.
+var containerStates = []string{"created", "restarting", "running", "removing", "paused", "exited", "dead"}
+
+// labelSelector matches containers by label key, and by value if one was given.
+type labelSelector struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+// sortKey orders containers by a single JSON field.
+type sortKey struct {
+	field      string
+	index      int
+	descending bool
+}
+
+// metricsQuery holds the filters, sort order, pagination and field selection of a metrics request.
+type metricsQuery struct {
+	labels []labelSelector // All selectors must match e.g. "com.docker.compose.project=shop"
+	names  []string        // Any glob pattern must match the container name e.g. "web-*"
+	states []string        // Any state must match e.g. "running"
+	hosts  []string        // Any host must match in aggregator mode e.g. "web-01"
+	sort   []sortKey       // Sort keys in order of precedence e.g. "-container_cpu_usage_percent"
+	limit  int             // Maximum number of containers returned, 0 for no limit
+	offset int             // Number of containers skipped after sorting
+	fields []string        // JSON fields to return, empty for all fields
+}
+
+func splitQueryValues(values []string) []string {
+	// Accept both repeated parameters and comma-separated lists.
+	var result []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				result = append(result, part)
+			}
+		}
+	}
+	return result
+}
+
+func parseMetricsQuery(values url.Values) (metricsQuery, error) {
+	/*
+		Parse the query parameters of a metrics request.
+
+		?label=com.docker.compose.project=shop&label=com.docker.compose.service
+		?name=web-*&state=running,paused&host=web-01
+		?sort=-container_cpu_usage_percent,container_name
+		?limit=10&offset=20
+		?fields=container_name,container_cpu_usage_percent
+
+		Function returns an error describing the first invalid parameter.
+	*/
+	var query metricsQuery
+
+	// Label values may contain commas, so labels are only accepted as repeated parameters.
+	for _, label := range values["label"] {
+		key, value, hasValue := strings.Cut(label, "=")
+		if key == "" {
+			return query, fmt.Errorf("invalid label selector %q", label)
+		}
+		query.labels = append(query.labels, labelSelector{key: key, value: value, hasValue: hasValue})
+	}
+
+	for _, name := range splitQueryValues(values["name"]) {
+		if _, err := path.Match(name, ""); err != nil {
+			return query, fmt.Errorf("invalid name pattern %q", name)
+		}
+		query.names = append(query.names, name)
+	}
+
+	for _, state := range splitQueryValues(values["state"]) {
+		if !slices.Contains(containerStates, state) {
+			return query, fmt.Errorf("invalid state %q, expected one of %s", state, strings.Join(containerStates, ", "))
+		}
+		query.states = append(query.states, state)
+	}
+	query.hosts = splitQueryValues(values["host"])
+
+	for _, field := range splitQueryValues(values["sort"]) {
+		key := sortKey{field: strings.TrimPrefix(field, "-"), descending: strings.HasPrefix(field, "-")}
+		index, ok := metricsFields[key.field]
+		if !ok {
+			return query, fmt.Errorf("unknown sort field %q", key.field)
+		}
+		switch reflect.TypeOf(types.ContainerMetrics{}).Field(index).Type.Kind() {
+		case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		default:
+			return query, fmt.Errorf("cannot sort by field %q", key.field)
+		}
+		key.index = index
+		query.sort = append(query.sort, key)
+	}
+
+	var err error
+	if query.limit, err = parseNonNegative(values.Get("limit")); err != nil {
+		return query, fmt.Errorf("invalid limit: %w", err)
+	}
+	if query.offset, err = parseNonNegative(values.Get("offset")); err != nil {
+		return query, fmt.Errorf("invalid offset: %w", err)
+	}
+
+	for _, field := range splitQueryValues(values["fields"]) {
+		if _, ok := metricsFields[field]; !ok {
+			return query, fmt.Errorf("unknown field %q", field)
+		}
+		query.fields = append(query.fields, field)
+	}
+
+	return query, nil
+}
+
+func parseNonNegative(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+	return n, nil
+}
+
+func (q metricsQuery) containerFilter() types.ContainerFilter {
+	// Label and state filters are passed to the collector so excluded containers are never sampled.
+	filter := types.ContainerFilter{States: q.states}
+	for _, label := range q.labels {
+		if label.hasValue {
+			filter.Labels = append(filter.Labels, label.key+"="+label.value)
+		} else {
+			filter.Labels = append(filter.Labels, label.key)
+		}
+	}
+	return filter
+}
+
+func (q metricsQuery) matches(metrics types.ContainerMetrics) bool {
+	if !q.containerFilter().Matches(metrics.ContainerLabels, metrics.ContainerState) {
+		return false
+	}
+	if len(q.hosts) > 0 && !slices.Contains(q.hosts, metrics.Host) {
+		return false
+	}
+	if len(q.names) == 0 {
+		return true
+	}
+	for _, pattern := range q.names {
+		if ok, _ := path.Match(pattern, metrics.ContainerName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func compareField(a, b reflect.Value) int {
+	switch a.Kind() {
+	case reflect.String:
+		return strings.Compare(a.String(), b.String())
+	case reflect.Bool:
+		switch {
+		case a.Bool() == b.Bool():
+			return 0
+		case b.Bool():
+			return -1
+		default:
+			return 1
+		}
+	case reflect.Int, reflect.Int64:
+		switch {
+		case a.Int() < b.Int():
+			return -1
+		case a.Int() > b.Int():
+			return 1
+		}
+	case reflect.Float64:
+		switch {
+		case a.Float() < b.Float():
+			return -1
+		case a.Float() > b.Float():
+			return 1
+		}
+	}
+	return 0
+}
+
+func (q metricsQuery) apply(list []types.ContainerMetrics) ([]types.ContainerMetrics, int) {
+	/*
+		Filter, sort and paginate container metrics.
+
+		Containers are always ordered by name and ID after the requested sort keys,
+		so repeated requests return the same order and pages do not overlap.
+		Function returns the requested page and the number of containers matching the filters.
+	*/
+	filtered := make([]types.ContainerMetrics, 0, len(list))
+	for _, metrics := range list {
+		if q.matches(metrics) {
+			filtered = append(filtered, metrics)
+		}
+	}
+
+	keys := append(append([]sortKey{}, q.sort...),
+		sortKey{field: "container_name", index: metricsFields["container_name"]},
+		sortKey{field: "container_id", index: metricsFields["container_id"]},
+	)
+	sort.SliceStable(filtered, func(i, j int) bool {
+		a := reflect.ValueOf(filtered[i])
+		b := reflect.ValueOf(filtered[j])
+		for _, key := range keys {
+			cmp := compareField(a.Field(key.index), b.Field(key.index))
+			if key.descending {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+
+	total := len(filtered)
+	start := min(q.offset, total)
+	end := total
+	if q.limit > 0 {
+		end = min(start+q.limit, total)
+	}
+	return filtered[start:end], total
+}
+
+func (q metricsQuery) project(list []types.ContainerMetrics) ([]json.RawMessage, error) {
+	// Encode each container, keeping only the selected fields in the requested order.
+	result := make([]json.RawMessage, 0, len(list))
+	for _, metrics := range list {
+		encoded, err := json.Marshal(metrics)
+		if err != nil {
+			return nil, err
+		}
+		if len(q.fields) == 0 {
+			result = append(result, encoded)
+			continue
+		}
+
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(encoded, &all); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		buf.WriteByte('{')
+		written := 0
+		for _, field := range q.fields {
+			value, ok := all[field]
+			if !ok { // Omitted by omitempty
+				continue
+			}
+			if written > 0 {
+				buf.WriteByte(',')
+			}
+			name, _ := json.Marshal(field)
+			buf.Write(name)
+			buf.WriteByte(':')
+			buf.Write(value)
+			written++
+		}
+		buf.WriteByte('}')
+		result = append(result, buf.Bytes())
+	}
+	return result, nil
+}
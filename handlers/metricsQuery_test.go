@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/types"
+)
+
+func queryFixture() []types.ContainerMetrics {
+	return []types.ContainerMetrics{
+		{ContainerID: "c3", ContainerName: "web-2", ContainerState: "running", ContainerCpuUsagePercent: 40,
+			ContainerLabels: map[string]string{"com.docker.compose.project": "shop", "tier": "frontend"}},
+		{ContainerID: "c1", ContainerName: "web-1", ContainerState: "running", ContainerCpuUsagePercent: 12.5,
+			ContainerLabels: map[string]string{"com.docker.compose.project": "shop", "tier": "frontend"}},
+		{ContainerID: "c2", ContainerName: "db", ContainerState: "exited", ContainerCpuUsagePercent: 0,
+			ContainerLabels: map[string]string{"com.docker.compose.project": "shop"}},
+		{ContainerID: "c4", ContainerName: "blog", ContainerState: "running", ContainerCpuUsagePercent: 40,
+			ContainerLabels: map[string]string{"com.docker.compose.project": "blog"}},
+	}
+}
+
+func containerNames(list []types.ContainerMetrics) []string {
+	names := make([]string, len(list))
+	for i, metrics := range list {
+		names[i] = metrics.ContainerName
+	}
+	return names
+}
+
+func TestMetricsQueryDefaultOrder(t *testing.T) {
+	query, err := parseMetricsQuery(url.Values{})
+	if assert.NoError(t, err) {
+		page, total := query.apply(queryFixture())
+		assert.Equal(t, 4, total)
+		assert.Equal(t, []string{"blog", "db", "web-1", "web-2"}, containerNames(page))
+	}
+}
+
+func TestMetricsQueryFilters(t *testing.T) {
+	values, _ := url.ParseQuery("label=com.docker.compose.project=shop&label=tier&name=web-*&state=running")
+	query, err := parseMetricsQuery(values)
+	if assert.NoError(t, err) {
+		page, total := query.apply(queryFixture())
+		assert.Equal(t, 2, total)
+		assert.Equal(t, []string{"web-1", "web-2"}, containerNames(page))
+		assert.Equal(t, types.ContainerFilter{
+			Labels: []string{"com.docker.compose.project=shop", "tier"},
+			States: []string{"running"},
+		}, query.containerFilter())
+	}
+}
+
+func TestMetricsQuerySortAndPaginate(t *testing.T) {
+	values, _ := url.ParseQuery("sort=-container_cpu_usage_percent&limit=2&offset=1")
+	query, err := parseMetricsQuery(values)
+	if assert.NoError(t, err) {
+		page, total := query.apply(queryFixture())
+		assert.Equal(t, 4, total)
+		// Ties on CPU are broken by name, so "blog" comes before "web-2".
+		assert.Equal(t, []string{"web-2", "web-1"}, containerNames(page))
+	}
+
+	values, _ = url.ParseQuery("offset=10")
+	query, _ = parseMetricsQuery(values)
+	page, total := query.apply(queryFixture())
+	assert.Equal(t, 4, total)
+	assert.Empty(t, page)
+}
+
+func TestMetricsQueryFields(t *testing.T) {
+	values, _ := url.ParseQuery("fields=container_name,container_cpu_usage_percent,container_health_status&limit=1")
+	query, err := parseMetricsQuery(values)
+	if assert.NoError(t, err) {
+		page, _ := query.apply(queryFixture())
+		projected, err := query.project(page)
+		if assert.NoError(t, err) && assert.Len(t, projected, 1) {
+			assert.Equal(t, `{"container_name":"blog","container_cpu_usage_percent":40}`, string(projected[0]))
+		}
+	}
+}
+
+func TestMetricsQueryInvalid(t *testing.T) {
+	for _, rawQuery := range []string{
+		"sort=nonexistent",
+		"sort=container_labels",
+		"fields=nonexistent",
+		"limit=-1",
+		"offset=abc",
+		"label==value",
+		"name=[",
+		"state=runing",
+		"state=running,Exited",
+	} {
+		values, _ := url.ParseQuery(rawQuery)
+		_, err := parseMetricsQuery(values)
+		assert.Error(t, err, rawQuery)
+	}
+}
+
+func TestMetricsQueryHosts(t *testing.T) {
+	list := queryFixture()
+	list[0].Host = "web-01"
+	list[1].Host = "web-02"
+	values, _ := url.ParseQuery("host=web-01,web-03")
+	query, err := parseMetricsQuery(values)
+	if assert.NoError(t, err) {
+		page, total := query.apply(list)
+		assert.Equal(t, 1, total)
+		assert.Equal(t, []string{"web-2"}, containerNames(page))
+	}
+}
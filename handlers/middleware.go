@@ -1,59 +1,228 @@
 package handlers
 
 import (
-	"encoding/base64"
-	"fmt"
 	"log/slog"
 	"net"
 	"os"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/time/rate"
+	"vchan.in/doctor-metrics/auth"
+	"vchan.in/doctor-metrics/logging"
+	"vchan.in/doctor-metrics/selfmetrics"
 )
 
+// accessControl struct to store the API users and the client addresses allowed to use the API.
+type accessControl struct {
+	users      *auth.Store
+	allowedIPs []string // Client IPs and CIDRs e.g. "10.0.0.0/8"
+}
+
+// Key of the authenticated username or agent name in the echo context, logged by AccessLog.
+const userContextKey = "user"
+
+// The configured access control, the DM_USERNAME, DM_PASSWORD and DM_ALLOWED_IPS environment variables if nil.
+var access atomic.Pointer[accessControl]
+
+func SetAccessControl(users *auth.Store, allowedIPs []string) {
+	/*
+		SetAccessControl sets the API users and the allowed client IPs and CIDRs, a nil store rejects every user.
+		It is safe to call while requests are handled, each request uses the setting current when it arrived.
+	*/
+	access.Store(&accessControl{users: users, allowedIPs: allowedIPs})
+}
+
+// rateLimitStore struct to store the per-client rate limiter, replaced as a whole by SetRateLimit.
+type rateLimitStore struct {
+	current atomic.Pointer[middleware.RateLimiterMemoryStore]
+}
+
+func (s *rateLimitStore) Allow(identifier string) (bool, error) {
+	allowed, err := s.current.Load().Allow(identifier)
+	if !allowed {
+		selfmetrics.CountRateLimited()
+	}
+	return allowed, err
+}
+
+// Requests per second allowed per client until SetRateLimit is called.
+const defaultRateLimit = 5
+
+var rateLimits = func() *rateLimitStore {
+	store := &rateLimitStore{}
+	store.current.Store(middleware.NewRateLimiterMemoryStore(defaultRateLimit))
+	return store
+}()
+
+func SetRateLimit(requestsPerSecond float64, burst int) {
+	/*
+		SetRateLimit sets the requests per second and the burst allowed per client, a burst of 0 is the rounded rate.
+		It is safe to call while requests are handled. The request counts of the clients start over.
+	*/
+	rateLimits.current.Store(middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+		Rate:  rate.Limit(requestsPerSecond),
+		Burst: burst,
+	}))
+}
+
+func RateLimiter() echo.MiddlewareFunc {
+	// RateLimiter limits the requests of each client IP to the rate set with SetRateLimit.
+	return middleware.RateLimiter(rateLimits)
+}
+
+func RequestMetrics(next echo.HandlerFunc) echo.HandlerFunc {
+	/*
+		RequestMetrics records the latency and status of every request by route in the self metrics.
+		It must be the first middleware so that requests rejected by the other ones are counted.
+		Errors are rendered here to know their status, like the echo logger middleware does.
+	*/
+	return func(c echo.Context) error {
+		start := time.Now()
+		if err := next(c); err != nil {
+			c.Error(err)
+		}
+		route := c.Path()
+		if route == "" {
+			route = "unmatched" // Unknown paths are not recorded one by one
+		}
+		selfmetrics.ObserveRequest(route, c.Request().Method, c.Response().Status, time.Since(start))
+		return nil
+	}
+}
+
+func AccessLog(next echo.HandlerFunc) echo.HandlerFunc {
+	/*
+		AccessLog logs every request with its request ID, user, client IP, route, status and latency, see logging.Access.
+		It must follow the request ID middleware and precede the access control so that rejected requests are logged.
+		Probes are logged at debug level, server errors at warn level.
+	*/
+	return func(c echo.Context) error {
+		logger := logging.Access()
+		if logger == nil {
+			return next(c)
+		}
+		start := time.Now()
+		if err := next(c); err != nil {
+			c.Error(err)
+		}
+
+		status := c.Response().Status
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelWarn
+		case probeRoutes[c.Path()]:
+			level = slog.LevelDebug
+		}
+		user, _ := c.Get(userContextKey).(string)
+		logger.LogAttrs(c.Request().Context(), level, "HTTP request",
+			slog.String("request_id", c.Response().Header().Get(echo.HeaderXRequestID)),
+			slog.String("user", user),
+			slog.String("client_ip", c.RealIP()),
+			slog.String("method", c.Request().Method),
+			slog.String("route", c.Path()),
+			slog.String("path", c.Request().URL.Path),
+			slog.Int("status", status),
+			slog.Int64("bytes", c.Response().Size),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+		)
+		return nil
+	}
+}
+
+func rejected(c echo.Context, reason string, attrs ...any) {
+	/*
+		Record a request rejected by the access control in the self metrics and the audit log, see logging.Audit.
+		Reasons are the ones of types.AuthFailureCount, attrs are extra key and value pairs e.g. the attempted username.
+	*/
+	selfmetrics.CountAuthFailure(reason)
+	logging.Audit().Warn("Request rejected", append([]any{
+		"reason", reason,
+		"request_id", c.Response().Header().Get(echo.HeaderXRequestID),
+		"client_ip", c.RealIP(),
+		"method", c.Request().Method,
+		"path", c.Request().URL.Path,
+	}, attrs...)...)
+}
+
+func currentAccessControl() *accessControl {
+	// Return the configured access control, or the one of the environment variables.
+	if configured := access.Load(); configured != nil {
+		return configured
+	}
+	current := &accessControl{}
+	if username := os.Getenv("DM_USERNAME"); username != "" {
+		// An invalid user leaves the store nil, which rejects every request
+		current.users, _ = auth.NewStore([]auth.User{{Username: username, Password: os.Getenv("DM_PASSWORD")}})
+	}
+	if allowedIPs := os.Getenv("DM_ALLOWED_IPS"); allowedIPs != "" {
+		current.allowedIPs = strings.Split(allowedIPs, ",")
+	}
+	return current
+}
+
 // Basic authentication middleware
 func HandleAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	/*
 		HandleAuthMiddleware is a middleware function that checks if the provided credentials are valid.
-		It retrieves the environment variables, and checks if the provided credentials match the environment variables.
+		It checks the provided credentials against the configured users in constant time, see SetAccessControl.
 		If the credentials are valid, the request is passed to the next handler.
 		If the credentials are invalid, an HTTP 401 Unauthorized error is returned.
+		Routes authenticated with an agent token, like POST /api/ingest, check their token themselves.
+		The /healthz and /readyz probes are not authenticated.
 	*/
 	return func(c echo.Context) error {
-		// Retrieve the environment variables
-		username := os.Getenv("DM_USERNAME")
-		password := os.Getenv("DM_PASSWORD")
-
-		// Check if the provided credentials are valid
-		auth := c.Request().Header.Get("Authorization")
-		if auth == "" { // Check if the Authorization header is present
-			return echo.ErrUnauthorized
+		if tokenAuthenticatedRoutes[c.Path()] || probeRoutes[c.Path()] {
+			return next(c)
 		}
 
-		payload, err := base64.StdEncoding.DecodeString(auth[len("Basic "):])
-		if err != nil {
-			return echo.ErrUnauthorized
+		users := currentAccessControl().users
+
+		// Check if the Authorization header is present
+		if c.Request().Header.Get(echo.HeaderAuthorization) == "" {
+			return unauthorized(c, "missing_credentials")
 		}
 
-		pair := strings.SplitN(string(payload), ":", 2)
-		if len(pair) != 2 || pair[0] != username || pair[1] != password {
-			return echo.ErrUnauthorized
+		// Other schemes than Basic, e.g. Bearer, and malformed credentials are invalid
+		username, password, ok := c.Request().BasicAuth()
+		if !ok {
+			return unauthorized(c, "invalid_credentials")
+		}
+		if !users.Authenticate(username, password) {
+			return unauthorized(c, "invalid_credentials", "user", username)
 		}
 
+		c.Set(userContextKey, username)
 		return next(c)
 	}
 }
 
+func unauthorized(c echo.Context, reason string, attrs ...any) error {
+	// Challenge the client so browsers opening the web dashboard prompt for credentials.
+	rejected(c, reason, attrs...)
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="dh"`)
+	return echo.ErrUnauthorized
+}
+
 func FilterIP(next echo.HandlerFunc) echo.HandlerFunc {
 	/*
-		FilterIP is a middleware function that only allows requests from specific IP addresses or CIDR ranges listed in the DM_ALLOWED_IPS environment variable.
+		FilterIP is a middleware function that only allows requests from specific IP addresses or CIDR ranges, see SetAccessControl.
 		If the request is from localhost, an HTTP 401 Unauthorized error is returned.
 	*/
 	return func(c echo.Context) error {
-		// Retrieve the environment variable
-		allowedIPs := os.Getenv("DM_ALLOWED_IPS")
-		if allowedIPs == "" {
-			slog.Error("DM_ALLOWED_IPS environment variable not set")
+		// Orchestrators probe from node addresses that are usually not allowed to read metrics
+		if probeRoutes[c.Path()] {
+			return next(c)
+		}
+
+		allowedIPs := currentAccessControl().allowedIPs
+		if len(allowedIPs) == 0 {
+			slog.Error("No allowed client IPs configured")
+			rejected(c, "ip_not_allowed")
 			return echo.ErrUnauthorized
 		}
 
@@ -69,7 +238,7 @@ func FilterIP(next echo.HandlerFunc) echo.HandlerFunc {
 		}
 
 		// Check if the client's IP address is in the allowed IPs list or CIDR ranges
-		for _, ip := range strings.Split(allowedIPs, ",") {
+		for _, ip := range allowedIPs {
 			if ip == clientIP {
 				return next(c)
 			}
@@ -79,7 +248,7 @@ func FilterIP(next echo.HandlerFunc) echo.HandlerFunc {
 			}
 		}
 
-		slog.Error(fmt.Sprintf("Unauthorized client IP: %s", clientIP))
+		rejected(c, "ip_not_allowed")
 		return echo.ErrUnauthorized
 	}
 }
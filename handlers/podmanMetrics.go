@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"vchan.in/doctor-metrics/procfs"
+	"vchan.in/doctor-metrics/selfmetrics"
+	"vchan.in/doctor-metrics/types"
+)
+
+// CPU samples older than this are not used to compute the CPU usage percentage and are discarded,
+// like the samples of the containerd collector and of the process sampler.
+const maxSampleAge = time.Minute
+
+// podmanCPUSample is the cumulative CPU time of a container at a point in time.
+type podmanCPUSample struct {
+	cpuNano    uint64    // Cumulative CPU time in nanoseconds
+	systemNano uint64    // Time Podman took the sample in nanoseconds since the epoch
+	recorded   time.Time // Time the sample was received, used to discard old samples
+}
+
+// PodmanCollector collects container metrics from the Podman REST API.
+//
+// Container metadata comes from the Docker-compatible inspect endpoint, so it matches the docker collector.
+// The list, stats and pods endpoints of the libpod API are used for pod membership and raw CPU counters.
+type PodmanCollector struct {
+	client         *engineClient
+	sampleInterval time.Duration // Wait between two CPU samples when no recent sample exists
+	fs             procfs.FS
+
+	mu      sync.Mutex
+	info    *types.PodmanInfo          // Host info, fetched once
+	samples map[string]podmanCPUSample // Last CPU sample by full container ID
+	digests map[string]string          // Repository digests keyed by image ID
+
+	warnStats sync.Once
+}
+
+func NewPodmanCollector(socket string) *PodmanCollector {
+	/*
+		NewPodmanCollector returns a collector for the Podman API socket,
+		e.g. "/run/podman/podman.sock" or "/run/user/1000/podman/podman.sock".
+	*/
+	return newPodmanCollector(newUnixEngineClient(socket))
+}
+
+func newPodmanCollector(client *engineClient) *PodmanCollector {
+	return &PodmanCollector{
+		client:         client,
+		sampleInterval: time.Second,
+		fs:             procfs.NewFS(),
+		samples:        make(map[string]podmanCPUSample),
+		digests:        make(map[string]string),
+	}
+}
+
+func DefaultPodmanSocket() string {
+	/*
+		DefaultPodmanSocket returns the socket of the Podman API service for the current user,
+		"/run/podman/podman.sock" for root and "$XDG_RUNTIME_DIR/podman/podman.sock" for rootless Podman.
+	*/
+	if os.Geteuid() == 0 {
+		return "/run/podman/podman.sock"
+	}
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = fmt.Sprintf("/run/user/%d", os.Geteuid())
+	}
+	return filepath.Join(runtimeDir, "podman", "podman.sock")
+}
+
+func (p *PodmanCollector) Collect(ctx context.Context, filter types.ContainerFilter) (_ []types.ContainerMetrics, err error) {
+	/*
+		Collect metrics for all containers matching the filter, including stopped ones.
+
+		Labels are filtered by Podman, states after mapping them to the Docker states.
+		Function returns the metrics of every matching container in no particular order.
+	*/
+	defer selfmetrics.ObserveCollection("podman", time.Now(), &err)
+	filters := make(map[string][]string)
+	if len(filter.Labels) > 0 {
+		filters["label"] = filter.Labels
+	}
+	return p.collect(ctx, filters, filter.States)
+}
+
+func (p *PodmanCollector) Ping(ctx context.Context) error {
+	return p.client.ping(ctx)
+}
+
+func (p *PodmanCollector) CollectContainer(ctx context.Context, idOrName string) (types.ContainerMetrics, error) {
+	/*
+		Collect metrics for a single container by ID, ID prefix or name.
+
+		Function returns an HTTP 404 error when no container matches.
+	*/
+	var inspect types.DockerInspect
+	err := p.client.getJSON(ctx, "/containers/"+url.PathEscape(idOrName)+"/json", nil, &inspect)
+	var engineErr *engineError
+	if errors.As(err, &engineErr) && engineErr.StatusCode == http.StatusNotFound {
+		return types.ContainerMetrics{}, echo.NewHTTPError(http.StatusNotFound, "Container not found")
+	}
+	if err != nil {
+		return types.ContainerMetrics{}, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve container metrics")
+	}
+
+	list, err := p.collect(ctx, map[string][]string{"id": {inspect.ID}}, nil)
+	if err != nil {
+		return types.ContainerMetrics{}, err
+	}
+	if len(list) == 0 {
+		return types.ContainerMetrics{}, echo.NewHTTPError(http.StatusNotFound, "Container not found")
+	}
+	return list[0], nil
+}
+
+func (p *PodmanCollector) ListPods(ctx context.Context) ([]types.PodmanPodList, error) {
+	// List the pods with their infra container from the libpod API.
+	var pods []types.PodmanPodList
+	if err := p.client.getJSON(ctx, "/libpod/pods/json", nil, &pods); err != nil {
+		return nil, err
+	}
+	return pods, nil
+}
+
+func podmanState(state string) string {
+	// Map the Podman states without a Docker equivalent to the state Docker reports for them.
+	switch state {
+	case "stopped":
+		return "exited"
+	case "configured", "initialized":
+		return "created"
+	default:
+		return state
+	}
+}
+
+func (p *PodmanCollector) hostInfo(ctx context.Context) (types.PodmanInfo, error) {
+	p.mu.Lock()
+	info := p.info
+	p.mu.Unlock()
+	if info != nil {
+		return *info, nil
+	}
+
+	info = &types.PodmanInfo{}
+	if err := p.client.getJSON(ctx, "/libpod/info", nil, info); err != nil {
+		return types.PodmanInfo{}, err
+	}
+	p.mu.Lock()
+	p.info = info
+	p.mu.Unlock()
+	return *info, nil
+}
+
+func (p *PodmanCollector) collect(ctx context.Context, filters map[string][]string, states []string) ([]types.ContainerMetrics, error) {
+	query := url.Values{"all": {"true"}}
+	if len(filters) > 0 {
+		encoded, err := json.Marshal(filters)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("filters", string(encoded))
+	}
+	var containers []types.PodmanContainerList
+	if err := p.client.getJSON(ctx, "/libpod/containers/json", query, &containers); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve container list")
+	}
+	containers = slices.DeleteFunc(containers, func(container types.PodmanContainerList) bool {
+		return !(types.ContainerFilter{States: states}).Matches(nil, podmanState(container.State))
+	})
+	if len(containers) == 0 {
+		return []types.ContainerMetrics{}, nil
+	}
+
+	info, err := p.hostInfo(ctx)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve Podman host info")
+	}
+
+	inspects, err := p.inspectAll(ctx, containers)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve container metrics")
+	}
+
+	var running []string
+	for _, container := range containers {
+		if container.State == "running" {
+			running = append(running, container.ID)
+		}
+	}
+	stats, err := p.sampleStats(ctx, info, running)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve container metrics")
+	}
+
+	now := time.Now()
+	listMetrics := []types.ContainerMetrics{}
+	for i, container := range containers {
+		inspect, ok := inspects[i]
+		if !ok {
+			continue // Removed since it was listed
+		}
+		var metrics types.ContainerMetrics
+		metrics.Timestamp = now.UTC().Format(time.RFC3339)
+		metrics.ContainerID = container.ID[:min(12, len(container.ID))]
+		metrics.ContainerPod = container.PodName
+		applyInspect(&metrics, inspect, now)
+		metrics.ContainerImageDigest = p.imageDigest(ctx, inspect.Image)
+		metrics.Active = metrics.ContainerState == "running"
+
+		if sample, ok := stats[container.ID]; ok {
+			applyPodmanStats(&metrics, sample.stats, info)
+			metrics.ContainerCpuUsagePercent = sample.cpuPercent
+			metrics.SetHostShare(info.Host.CPUs, info.Host.MemTotal)
+		}
+		if inspect.State.Pid > 0 {
+			if pressure, err := p.fs.CgroupPressure(inspect.State.Pid); err == nil {
+				metrics.ContainerPressure = &pressure
+			}
+			applyDescriptors(&metrics, p.fs, inspect.State.Pid)
+		}
+		listMetrics = append(listMetrics, metrics)
+	}
+	return listMetrics, nil
+}
+
+func (p *PodmanCollector) inspectAll(ctx context.Context, containers []types.PodmanContainerList) (map[int]types.DockerInspect, error) {
+	// Inspect the containers through the Docker-compatible API, at most 10 at a time.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	inspects := make(map[int]types.DockerInspect)
+	sem := make(chan struct{}, 10)
+
+	for i, container := range containers {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			var inspect types.DockerInspect
+			err := p.client.getJSON(ctx, "/containers/"+id+"/json", nil, &inspect)
+			mu.Lock()
+			defer mu.Unlock()
+			var engineErr *engineError
+			switch {
+			case errors.As(err, &engineErr) && engineErr.StatusCode == http.StatusNotFound:
+			case err != nil:
+				if firstErr == nil {
+					firstErr = err
+				}
+			default:
+				inspects[i] = inspect
+			}
+		}(i, container.ID)
+	}
+	wg.Wait()
+	return inspects, firstErr
+}
+
+// podmanSample is the latest stats of a container and its CPU usage percentage since the previous sample.
+type podmanSample struct {
+	stats      types.PodmanStats
+	cpuPercent float64
+}
+
+func (p *PodmanCollector) sampleStats(ctx context.Context, info types.PodmanInfo, ids []string) (map[string]podmanSample, error) {
+	/*
+		Get the stats of running containers.
+
+		The CPU usage Podman reports for a single sample is averaged over the container lifetime,
+		so it is computed from the CPU time between two samples instead. Without a recent previous sample
+		the stats are sampled again after a short wait.
+	*/
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	// Rootless Podman on cgroup v1 cannot read container cgroups, only metadata is reported.
+	if info.Host.Security.Rootless && info.Host.CgroupVersion == "v1" {
+		p.warnStats.Do(func() {
+			slog.Warn("Rootless Podman on cgroup v1 does not support container stats, only metadata is reported")
+		})
+		return nil, nil
+	}
+
+	query := url.Values{"stream": {"false"}, "containers": ids}
+	var report types.PodmanStatsReport
+	if err := p.client.getJSON(ctx, "/libpod/containers/stats", query, &report); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	stale := false
+	for _, stats := range report.Stats {
+		sample, ok := p.samples[stats.ContainerID]
+		if !ok || time.Since(sample.recorded) > maxSampleAge {
+			stale = true
+			break
+		}
+	}
+	p.mu.Unlock()
+	if stale {
+		p.recordStats(ids, report.Stats)
+		select {
+		case <-time.After(p.sampleInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		report = types.PodmanStatsReport{}
+		if err := p.client.getJSON(ctx, "/libpod/containers/stats", query, &report); err != nil {
+			return nil, err
+		}
+	}
+	return p.recordStats(ids, report.Stats), nil
+}
+
+func (p *PodmanCollector) recordStats(ids []string, stats []types.PodmanStats) map[string]podmanSample {
+	/*
+		Store the CPU time of each container and compute the CPU usage percentage since the previous sample.
+		Samples of requested containers missing from the stats, and samples older than maxSampleAge, are discarded.
+	*/
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	samples := make(map[string]podmanSample)
+	for _, current := range stats {
+		sample := podmanSample{stats: current}
+		if previous, ok := p.samples[current.ContainerID]; ok &&
+			current.SystemNano > previous.systemNano && current.CPUNano >= previous.cpuNano {
+			elapsed := float64(current.SystemNano - previous.systemNano)
+			sample.cpuPercent = roundPercent(float64(current.CPUNano-previous.cpuNano) / elapsed * 100)
+		}
+		p.samples[current.ContainerID] = podmanCPUSample{
+			cpuNano:    current.CPUNano,
+			systemNano: current.SystemNano,
+			recorded:   time.Now(),
+		}
+		samples[current.ContainerID] = sample
+	}
+	for _, id := range ids {
+		if _, ok := samples[id]; !ok {
+			delete(p.samples, id) // Containers that stopped since they were listed
+		}
+	}
+	for id, sample := range p.samples {
+		if time.Since(sample.recorded) > maxSampleAge {
+			delete(p.samples, id)
+		}
+	}
+	return samples
+}
+
+func applyPodmanStats(metrics *types.ContainerMetrics, stats types.PodmanStats, info types.PodmanInfo) {
+	/*
+		Set the memory, network, block I/O and PIDs metrics from Podman stats.
+
+		Containers without a memory limit report the host memory as their limit like docker stats does.
+		Podman reports 0 or the maximum cgroup value for them, and rootless containers never have a limit
+		when the memory controller is not delegated to the user.
+	*/
+	metrics.ContainerMemoryUsageBytes = int64(min(stats.MemUsage, math.MaxInt64))
+	limit := stats.MemLimit
+	memoryDelegated := info.Host.CgroupVersion != "v2" || slices.Contains(info.Host.CgroupControllers, "memory")
+	if info.Host.MemTotal > 0 && (!memoryDelegated || limit == 0 || limit > uint64(info.Host.MemTotal)) {
+		limit = uint64(info.Host.MemTotal)
+	}
+	metrics.ContainerMemoryLimitBytes = int64(min(limit, math.MaxInt64))
+	if limit > 0 {
+		metrics.ContainerMemoryUsagePercent = roundPercent(float64(stats.MemUsage) / float64(limit) * 100)
+	}
+	metrics.ContainerNetworkReceiveBytesTotal = int64(stats.NetInput)
+	metrics.ContainerNetworkTransmitBytesTotal = int64(stats.NetOutput)
+	metrics.ContainerBlockReadBytes = int64(stats.BlockInput)
+	metrics.ContainerBlockWriteBytes = int64(stats.BlockOutput)
+	metrics.ContainerPIDs = int(stats.PIDs)
+}
+
+func (p *PodmanCollector) imageDigest(ctx context.Context, imageID string) string {
+	// Get the repository digest of an image, empty for images that were never pushed or pulled.
+	p.mu.Lock()
+	digest, ok := p.digests[imageID]
+	p.mu.Unlock()
+	if ok || imageID == "" {
+		return digest
+	}
+
+	var image struct {
+		RepoDigests []string `json:"RepoDigests"`
+	}
+	if err := p.client.getJSON(ctx, "/images/"+url.PathEscape(imageID)+"/json", nil, &image); err != nil {
+		return ""
+	}
+	if len(image.RepoDigests) > 0 {
+		digest = image.RepoDigests[0]
+	}
+
+	p.mu.Lock()
+	p.digests[imageID] = digest
+	p.mu.Unlock()
+	return digest
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/procfs"
+	"vchan.in/doctor-metrics/types"
+)
+
+const (
+	podmanWebID   = "a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90"
+	podmanInfraID = "b2c3d4e5f6a10718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90"
+	podmanDBID    = "c3d4e5f6a1b20718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90"
+)
+
+// fakePodman impersonates a rootless Podman API service on cgroup v2 without a delegated memory controller.
+type fakePodman struct {
+	mu         sync.Mutex
+	statsCalls int
+	filters    string // Filters of the last container list request
+}
+
+func (f *fakePodman) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeJSON := func(v any) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+	inspect := func(id, name, status string, pid, exitCode int) map[string]any {
+		return map[string]any{
+			"Id": id, "Name": "/" + name, "Created": "2021-09-01T12:00:00.123456789Z", "Image": "sha256:" + id[:12],
+			"State":      map[string]any{"Status": status, "Pid": pid, "ExitCode": exitCode, "StartedAt": "2021-09-01T12:30:00Z"},
+			"Config":     map[string]any{"Image": "docker.io/library/" + name + ":latest", "Labels": map[string]string{"app": name}},
+			"HostConfig": map[string]any{"RestartPolicy": map[string]any{"Name": ""}},
+		}
+	}
+
+	switch path := r.URL.Path; {
+	case path == "/libpod/info":
+		writeJSON(map[string]any{"host": map[string]any{
+			"cgroupVersion":     "v2",
+			"cgroupControllers": []string{"cpu", "pids"},
+			"memTotal":          2 << 30,
+			"cpus":              2,
+			"security":          map[string]any{"rootless": true},
+		}})
+	case path == "/libpod/containers/json":
+		f.mu.Lock()
+		f.filters = r.URL.Query().Get("filters")
+		f.mu.Unlock()
+		all := []map[string]any{
+			{"Id": podmanWebID, "Names": []string{"shop-web"}, "State": "running", "Pod": "p1", "PodName": "shop"},
+			{"Id": podmanInfraID, "Names": []string{"b2c3d4e5f6a1-infra"}, "State": "running", "Pod": "p1", "PodName": "shop", "IsInfra": true},
+			{"Id": podmanDBID, "Names": []string{"db"}, "State": "stopped"},
+		}
+		if strings.Contains(f.filters, podmanWebID) {
+			all = all[:1]
+		}
+		writeJSON(all)
+	case path == "/containers/"+podmanWebID+"/json" || path == "/containers/shop-web/json":
+		writeJSON(inspect(podmanWebID, "shop-web", "running", 4242, 0))
+	case path == "/containers/"+podmanInfraID+"/json":
+		writeJSON(inspect(podmanInfraID, "b2c3d4e5f6a1-infra", "running", 4243, 0))
+	case path == "/containers/"+podmanDBID+"/json":
+		writeJSON(inspect(podmanDBID, "db", "exited", 0, 137))
+	case path == "/libpod/containers/stats":
+		f.mu.Lock()
+		f.statsCalls++
+		call := uint64(f.statsCalls)
+		f.mu.Unlock()
+		// Each sample is one second apart, the web container uses a quarter core.
+		at := uint64(time.Date(2021, 9, 1, 13, 0, 0, 0, time.UTC).UnixNano()) + call*uint64(time.Second)
+		writeJSON(map[string]any{"Error": nil, "Stats": []map[string]any{
+			{"ContainerID": podmanWebID, "CPUNano": call * 250_000_000, "SystemNano": at, "MemUsage": 64 << 20, "MemLimit": 0,
+				"NetInput": 1000, "NetOutput": 2000, "BlockInput": 4096, "BlockOutput": 8192, "PIDs": 5},
+			{"ContainerID": podmanInfraID, "CPUNano": 1000, "SystemNano": at, "MemUsage": 1 << 20, "MemLimit": 0,
+				"NetInput": 1000, "NetOutput": 2000, "PIDs": 1},
+		}})
+	case path == "/images/sha256:"+podmanWebID[:12]+"/json":
+		writeJSON(map[string]any{"RepoDigests": []string{"docker.io/library/shop-web@sha256:0b97"}})
+	case path == "/libpod/pods/json":
+		writeJSON([]map[string]any{{"Id": "d4e5f6a1b2c30718", "Name": "shop", "Status": "Running", "InfraId": podmanInfraID}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(map[string]string{"message": "no such container"})
+	}
+}
+
+func startFakePodman(t *testing.T) (*PodmanCollector, *fakePodman) {
+	fake := &fakePodman{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	podman := newPodmanCollector(&engineClient{http: server.Client(), baseURL: server.URL})
+	podman.sampleInterval = time.Millisecond
+	podman.fs = procfs.FS{ProcRoot: t.TempDir(), CgroupRoot: t.TempDir()}
+	return podman, fake
+}
+
+func TestPodmanCollect(t *testing.T) {
+	podman, fake := startFakePodman(t)
+
+	list, err := podman.Collect(context.Background(), types.ContainerFilter{})
+	if !assert.NoError(t, err) || !assert.Len(t, list, 3) {
+		return
+	}
+	// Without a previous sample the stats are sampled twice.
+	assert.Equal(t, 2, fake.statsCalls)
+
+	web := list[0]
+	assert.True(t, web.Active)
+	assert.Equal(t, "a1b2c3d4e5f6", web.ContainerID)
+	assert.Equal(t, "shop-web", web.ContainerName)
+	assert.Equal(t, "shop", web.ContainerPod)
+	assert.Equal(t, "no", web.ContainerRestartPolicy)
+	assert.Equal(t, "2021-09-01T12:00:00Z", web.ContainerCreatedAt)
+	assert.Equal(t, 25.0, web.ContainerCpuUsagePercent)
+	// Rootless without the memory controller: the host memory is the limit.
+	assert.Equal(t, int64(64<<20), web.ContainerMemoryUsageBytes)
+	assert.Equal(t, int64(2<<30), web.ContainerMemoryLimitBytes)
+	assert.Equal(t, 3.13, web.ContainerMemoryUsagePercent)
+	assert.Equal(t, 12.5, web.ContainerCpuHostPercent)
+	assert.Equal(t, 3.13, web.ContainerMemoryHostPercent)
+	assert.Equal(t, int64(1000), web.ContainerNetworkReceiveBytesTotal)
+	assert.Equal(t, int64(8192), web.ContainerBlockWriteBytes)
+	assert.Equal(t, 5, web.ContainerPIDs)
+	assert.Equal(t, "docker.io/library/shop-web@sha256:0b97", web.ContainerImageDigest)
+
+	db := list[2]
+	assert.False(t, db.Active)
+	assert.Equal(t, "exited", db.ContainerState)
+	assert.Equal(t, 137, db.ContainerExitCode)
+	assert.Empty(t, db.ContainerPod)
+	assert.Zero(t, db.ContainerMemoryLimitBytes)
+
+	// States are filtered after mapping "stopped" to "exited", labels are passed to Podman.
+	list, err = podman.Collect(context.Background(), types.ContainerFilter{Labels: []string{"app"}, States: []string{"exited"}})
+	if assert.NoError(t, err) && assert.Len(t, list, 1) {
+		assert.Equal(t, "db", list[0].ContainerName)
+		assert.JSONEq(t, `{"label":["app"]}`, fake.filters)
+	}
+}
+
+func TestPodmanCollectContainer(t *testing.T) {
+	podman, _ := startFakePodman(t)
+
+	metrics, err := podman.CollectContainer(context.Background(), "shop-web")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "a1b2c3d4e5f6", metrics.ContainerID)
+		assert.Equal(t, "shop", metrics.ContainerPod)
+	}
+
+	_, err = podman.CollectContainer(context.Background(), "missing")
+	if httpErr, ok := err.(*echo.HTTPError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusNotFound, httpErr.Code)
+	}
+}
+
+func TestPodmanCollectPrunesSamples(t *testing.T) {
+	// Samples of stopped containers and old samples are discarded, those of containers not requested are kept while recent.
+	podman, _ := startFakePodman(t)
+	podman.samples["stopped"] = podmanCPUSample{recorded: time.Now()}
+	podman.samples["old"] = podmanCPUSample{recorded: time.Now().Add(-2 * maxSampleAge)}
+	podman.samples["other"] = podmanCPUSample{recorded: time.Now()}
+
+	podman.recordStats([]string{podmanWebID, "stopped"}, []types.PodmanStats{{ContainerID: podmanWebID, CPUNano: 1, SystemNano: 1}})
+	assert.ElementsMatch(t, []string{podmanWebID, "other"}, slices.Collect(maps.Keys(podman.samples)))
+}
+
+func TestGroupPodmanPods(t *testing.T) {
+	podman, _ := startFakePodman(t)
+	list, err := podman.Collect(context.Background(), types.ContainerFilter{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	pods, err := podman.ListPods(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	grouped := groupPodmanPods(list, pods)
+	if assert.Len(t, grouped, 1) {
+		shop := grouped[0]
+		assert.Equal(t, "shop", shop.Pod)
+		assert.Equal(t, "b2c3d4e5f6a1", shop.InfraID)
+		assert.Equal(t, 1, shop.Running)
+		if assert.Len(t, shop.Containers, 1) {
+			assert.Equal(t, "shop-web", shop.Containers[0].ContainerName)
+		}
+		// The infra container and the web container share the network namespace, it is counted once.
+		assert.Equal(t, int64(1000), shop.Usage.NetworkReceiveBytesTotal)
+		assert.Equal(t, int64(65<<20), shop.Usage.MemoryUsageBytes)
+		assert.Equal(t, 6, shop.Usage.PIDs)
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"vchan.in/doctor-metrics/types"
+)
+
+// podLister is implemented by collectors of runtimes with a native pod concept.
+type podLister interface {
+	ListPods(ctx context.Context) ([]types.PodmanPodList, error)
+}
+
+func groupPodmanPods(list []types.ContainerMetrics, pods []types.PodmanPodList) []types.PodmanPod {
+	/*
+		Group container metrics by Podman pod.
+
+		Like Kubernetes sandboxes, the infra container holds the network namespace of the pod, so the pod
+		network usage is taken from the infra container only and the other containers do not count it again.
+		Function returns the pods ordered by name.
+	*/
+	members := make(map[string][]types.ContainerMetrics)
+	for _, metrics := range list {
+		if metrics.ContainerPod != "" {
+			members[metrics.ContainerPod] = append(members[metrics.ContainerPod], metrics)
+		}
+	}
+
+	result := []types.PodmanPod{}
+	for _, listed := range pods {
+		containers := members[listed.Name]
+		pod := types.PodmanPod{
+			PodID:      listed.ID[:min(12, len(listed.ID))],
+			Pod:        listed.Name,
+			Status:     listed.Status,
+			Usage:      sumUsage(containers),
+			Containers: []types.PodmanPodContainer{},
+		}
+		if listed.InfraID != "" {
+			pod.InfraID = listed.InfraID[:min(12, len(listed.InfraID))]
+		}
+
+		var infra []types.ContainerMetrics
+		for _, metrics := range containers {
+			if pod.InfraID != "" && strings.HasPrefix(listed.InfraID, metrics.ContainerID) {
+				infra = append(infra, metrics)
+				continue
+			}
+			pod.Containers = append(pod.Containers, types.PodmanPodContainer{
+				ContainerID:               metrics.ContainerID,
+				ContainerName:             metrics.ContainerName,
+				State:                     metrics.ContainerState,
+				ContainerCpuUsagePercent:  metrics.ContainerCpuUsagePercent,
+				ContainerMemoryUsageBytes: metrics.ContainerMemoryUsageBytes,
+			})
+			if metrics.Active {
+				pod.Running++
+			}
+		}
+
+		if len(infra) > 0 {
+			network := sumUsage(infra)
+			pod.Usage.NetworkReceiveBytesTotal = network.NetworkReceiveBytesTotal
+			pod.Usage.NetworkTransmitBytesTotal = network.NetworkTransmitBytesTotal
+		}
+		// Average over the pod containers only, a running infra container would lower the average.
+		pod.Usage.CpuUsagePercentAvg = 0
+		if pod.Running > 0 {
+			pod.Usage.CpuUsagePercentAvg = roundPercent(pod.Usage.CpuUsagePercentTotal / float64(pod.Running))
+		}
+
+		sort.Slice(pod.Containers, func(i, j int) bool { return pod.Containers[i].ContainerName < pod.Containers[j].ContainerName })
+		result = append(result, pod)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Pod < result[j].Pod })
+	return result
+}
+
+func GetPodmanPods(c echo.Context) error {
+	/*
+		Get aggregated metrics for the Podman pods.
+
+		{
+		  "pods": [
+		    {
+		      "pod_id": "a1b2c3d4e5f6",
+		      "pod": "shop",
+		      "status": "Running",
+		      "infra_id": "b2c3d4e5f6a1",
+		      "running": 2,
+		      "containers": [{"container_name": "shop-web", "state": "running", ...}],
+		      "usage": {"cpu_usage_percent_total": 12.5, "network_receive_bytes_total": 123456, ...}
+		    },
+		    ...
+		  ]
+		}
+
+		Function returns a JSON response with the pods ordered by name,
+		or an HTTP 404 error when the configured runtime has no pods.
+	*/
+	lister, ok := collector.(podLister)
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "Pods are only available with the Podman runtime")
+	}
+
+	pods, err := lister.ListPods(c.Request().Context())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve Podman pods")
+	}
+	listMetrics, err := collector.Collect(c.Request().Context(), types.ContainerFilter{})
+	if err != nil {
+		return err
+	}
+
+	response := types.PodmanPodsResponse{
+		Status:  "success",
+		Message: "Podman pods retrieved successfully",
+	}
+	response.Data.Pods = groupPodmanPods(listMetrics, pods)
+
+	return c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"vchan.in/doctor-metrics/types"
+)
+
+// Time between two attempts of the first sample while the container runtime is unreachable.
+const firstSampleRetry = 5 * time.Second
+
+// Time allowed to each attempt of the first sample.
+const firstSampleTimeout = 30 * time.Second
+
+// Time allowed to the container runtime to answer a readiness check.
+const readinessTimeout = 5 * time.Second
+
+// Routes open to orchestrator probes, without authentication or client IP filtering.
+var probeRoutes = map[string]bool{"/healthz": true, "/readyz": true}
+
+// Readiness reported by GET /readyz.
+var (
+	firstSample atomic.Bool // Set once the containers were collected successfully
+	draining    atomic.Bool // Set when the server stops accepting new requests
+)
+
+func TakeFirstSample(ctx context.Context) {
+	/*
+		TakeFirstSample collects the containers once with the configured collector, which also warms its caches,
+		retrying every firstSampleRetry until a collection succeeds or the context is cancelled.
+		GET /readyz reports ready only after it returned.
+	*/
+	for {
+		collectCtx, cancel := context.WithTimeout(ctx, firstSampleTimeout)
+		_, err := collector.Collect(collectCtx, types.ContainerFilter{})
+		cancel()
+		if err == nil {
+			firstSample.Store(true)
+			slog.Info("First sample of the containers collected, ready to serve")
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("Failed to collect the first sample of the containers", "error", hostErrorMessage(err), "retry_in", firstSampleRetry.String())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(firstSampleRetry):
+		}
+	}
+}
+
+func StartDraining() {
+	// StartDraining makes GET /readyz fail so load balancers stop sending requests during the shutdown.
+	draining.Store(true)
+}
+
+func GetHealthz(c echo.Context) error {
+	/*
+		GetHealthz is a handler function for liveness probes.
+		It returns HTTP 200 as long as the process serves requests, whatever the state of the container runtime.
+	*/
+	return c.JSON(http.StatusOK, types.APIResponse{
+		Status:  "success",
+		Message: "Doctor Metrics is alive",
+	})
+}
+
+func GetReadyz(c echo.Context) error {
+	/*
+		GetReadyz is a handler function for readiness probes.
+		It returns HTTP 200 once the first sample of the containers is collected and while the container runtime answers,
+		and HTTP 503 before, when the runtime is unreachable or when the server is shutting down.
+	*/
+	if draining.Load() {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Shutting down")
+	}
+	if !firstSample.Load() {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Waiting for the first sample of the containers")
+	}
+	if p, ok := collector.(pinger); ok {
+		ctx, cancel := context.WithTimeout(c.Request().Context(), readinessTimeout)
+		defer cancel()
+		if err := p.Ping(ctx); err != nil {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "Container runtime unreachable").SetInternal(err)
+		}
+	}
+	return c.JSON(http.StatusOK, types.APIResponse{
+		Status:  "success",
+		Message: "Doctor Metrics is ready",
+	})
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// pingCollector is a staticCollector whose runtime answers pings with err.
+type pingCollector struct {
+	staticCollector
+	err error
+}
+
+func (p *pingCollector) Ping(ctx context.Context) error {
+	return p.err
+}
+
+func probe(path string) *httptest.ResponseRecorder {
+	// Serve a probe through the access control middlewares, with no allowed IPs and no credentials.
+	e := echo.New()
+	e.Use(FilterIP, HandleAuthMiddleware)
+	e.GET("/healthz", GetHealthz)
+	e.GET("/readyz", GetReadyz)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestGetHealthz(t *testing.T) {
+	access.Store(&accessControl{})
+	defer access.Store(nil)
+
+	rec := probe("/healthz")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"message":"Doctor Metrics is alive"`)
+}
+
+func TestGetReadyz(t *testing.T) {
+	access.Store(&accessControl{})
+	previous := CurrentCollector()
+	defer func() {
+		access.Store(nil)
+		SetCollector(previous)
+		firstSample.Store(false)
+		draining.Store(false)
+	}()
+	runtime := &pingCollector{}
+	SetCollector(runtime)
+
+	rec := probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.JSONEq(t, `{"message": "Waiting for the first sample of the containers"}`, rec.Body.String())
+
+	TakeFirstSample(context.Background())
+	rec = probe("/readyz")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"message":"Doctor Metrics is ready"`)
+
+	runtime.err = errors.New("connection refused")
+	rec = probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.JSONEq(t, `{"message": "Container runtime unreachable"}`, rec.Body.String())
+
+	runtime.err = nil
+	StartDraining()
+	rec = probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.JSONEq(t, `{"message": "Shutting down"}`, rec.Body.String())
+
+	// Other routes still require an allowed client IP.
+	e := echo.New()
+	e.Use(FilterIP)
+	e.GET("/api/metrics", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/metrics", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestHostsCollectorPing(t *testing.T) {
+	down := &pingCollector{err: errors.New("connection refused")}
+	hosts := NewHostsCollector([]NamedCollector{{Name: "web-01", Collector: down}, {Name: "web-02", Collector: down}}, 0)
+	assert.EqualError(t, hosts.Ping(context.Background()), "web-01: connection refused\nweb-02: connection refused")
+
+	// One reachable host is enough, like a collection.
+	hosts = NewHostsCollector([]NamedCollector{{Name: "web-01", Collector: down}, {Name: "web-02", Collector: &pingCollector{}}}, 0)
+	assert.NoError(t, hosts.Ping(context.Background()))
+}
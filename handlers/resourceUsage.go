@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"math"
+
+	"vchan.in/doctor-metrics/types"
+)
+
+func sumUsage(list []types.ContainerMetrics) types.ResourceUsage {
+	/*
+		Sum the resource usage of a group of containers.
+		The average CPU usage only counts running containers, so stopped replicas do not pull it down.
+	*/
+	var usage types.ResourceUsage
+	running := 0
+	for _, metrics := range list {
+		usage.CpuUsagePercentTotal += metrics.ContainerCpuUsagePercent
+		usage.MemoryUsageBytes += metrics.ContainerMemoryUsageBytes
+		usage.MemoryLimitBytes += metrics.ContainerMemoryLimitBytes
+		usage.NetworkReceiveBytesTotal += metrics.ContainerNetworkReceiveBytesTotal
+		usage.NetworkTransmitBytesTotal += metrics.ContainerNetworkTransmitBytesTotal
+		usage.BlockReadBytes += metrics.ContainerBlockReadBytes
+		usage.BlockWriteBytes += metrics.ContainerBlockWriteBytes
+		usage.PIDs += metrics.ContainerPIDs
+		if metrics.Active {
+			running++
+		}
+	}
+	usage.CpuUsagePercentTotal = roundPercent(usage.CpuUsagePercentTotal)
+	if running > 0 {
+		usage.CpuUsagePercentAvg = roundPercent(usage.CpuUsagePercentTotal / float64(running))
+	}
+	return usage
+}
+
+func roundPercent(value float64) float64 {
+	// Round to two decimals like the percentages reported by docker stats.
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os/exec"
+
+	"vchan.in/doctor-metrics/selfmetrics"
+)
+
+func dockerOutput(ctx context.Context, args ...string) ([]byte, error) {
+	// Run the docker CLI and return its standard output, failures are counted in the self metrics.
+	output, err := exec.CommandContext(ctx, "docker", args...).Output()
+	if err != nil {
+		selfmetrics.CountDockerError("cli", runtimeErrorType(ctx, err))
+	}
+	return output, err
+}
+
+func runtimeErrorType(ctx context.Context, err error) string {
+	/*
+		Classify a failed call to the container runtime for the self metrics.
+		The context is checked first since the docker CLI killed on timeout only reports its exit status.
+	*/
+	var engineErr *engineError
+	var exitErr *exec.ExitError
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded) || errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(ctx.Err(), context.Canceled) || errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &engineErr):
+		switch {
+		case engineErr.StatusCode == http.StatusNotFound:
+			return "not_found"
+		case engineErr.StatusCode >= 500:
+			return "server_error"
+		}
+		return "client_error"
+	case errors.Is(err, exec.ErrNotFound):
+		return "cli_not_found"
+	case errors.As(err, &exitErr):
+		return "exit_status"
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return "timeout"
+		}
+		return "connection"
+	case errors.As(err, &syntaxErr) || errors.As(err, &typeErr):
+		return "decode"
+	}
+	return "other"
+}
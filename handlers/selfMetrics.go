@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"vchan.in/doctor-metrics/selfmetrics"
+	"vchan.in/doctor-metrics/types"
+)
+
+func GetSelfMetrics(c echo.Context) error {
+	/*
+		GetSelfMetrics is a handler function that returns the operational metrics of dh itself:
+		collection durations, container runtime errors, snapshot ages, runtime memory, HTTP requests and access control rejections.
+	*/
+	response := types.SelfMetricsResponse{
+		Status:  "success",
+		Message: "Self metrics retrieved successfully",
+	}
+	response.Data.SelfMetrics = selfmetrics.Snapshot()
+
+	return c.JSON(http.StatusOK, response)
+}
+
+func GetPrometheusMetrics(c echo.Context) error {
+	// GetPrometheusMetrics is a handler function that returns the self metrics in the Prometheus text exposition format.
+	c.Response().Header().Set(echo.HeaderContentType, selfmetrics.ContentType)
+	c.Response().WriteHeader(http.StatusOK)
+	return selfmetrics.WritePrometheus(c.Response(), selfmetrics.Snapshot())
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/auth"
+	"vchan.in/doctor-metrics/selfmetrics"
+	"vchan.in/doctor-metrics/types"
+)
+
+func routeRequests(route, status string) int64 {
+	// Return the requests to a route with a status recorded in the self metrics.
+	for _, requests := range selfmetrics.Snapshot().HTTPRequests {
+		if requests.Route == route && requests.Method == http.MethodGet {
+			return requests.Statuses[status]
+		}
+	}
+	return 0
+}
+
+func authFailures(reason string) int64 {
+	for _, count := range selfmetrics.Snapshot().AuthFailures {
+		if count.Reason == reason {
+			return count.Count
+		}
+	}
+	return 0
+}
+
+func TestRequestMetrics(t *testing.T) {
+	defer access.Store(nil)
+	SetAccessControl(newStore(t, auth.User{Username: "admin", Password: "s3cret"}), []string{"192.0.2.1"})
+
+	e := echo.New()
+	e.Use(RequestMetrics, HandleAuthMiddleware)
+	e.GET("/api/self", GetSelfMetrics)
+	request := func(path, credentials string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if credentials != "" {
+			req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	ok, unauthorized := routeRequests("/api/self", "200"), routeRequests("/api/self", "401")
+	missing, invalid := authFailures("missing_credentials"), authFailures("invalid_credentials")
+
+	rec := request("/api/self", "admin:s3cret")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response types.SelfMetricsResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "Self metrics retrieved successfully", response.Message)
+	assert.Positive(t, response.Data.SelfMetrics.Goroutines)
+
+	// Rejected requests are recorded with their status, errors are still rendered
+	assert.Equal(t, http.StatusUnauthorized, request("/api/self", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, request("/api/self", "admin:wrong").Code)
+	assert.Equal(t, http.StatusNotFound, request("/unknown", "admin:s3cret").Code)
+
+	assert.Equal(t, ok+1, routeRequests("/api/self", "200"))
+	assert.Equal(t, unauthorized+2, routeRequests("/api/self", "401"))
+	assert.Positive(t, routeRequests("unmatched", "404"))
+	assert.Equal(t, missing+1, authFailures("missing_credentials"))
+	assert.Equal(t, invalid+1, authFailures("invalid_credentials"))
+}
+
+func TestGetPrometheusMetrics(t *testing.T) {
+	selfmetrics.CountRateLimited()
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/metrics", nil), rec)
+	if assert.NoError(t, GetPrometheusMetrics(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, selfmetrics.ContentType, rec.Header().Get(echo.HeaderContentType))
+		assert.Contains(t, rec.Body.String(), "# TYPE dh_rate_limit_rejections_total counter\n")
+		assert.Contains(t, rec.Body.String(), "\ngo_goroutines ")
+	}
+}
+
+func TestRuntimeErrorType(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithTimeout(context.Background(), 0)
+	defer cancelExpired()
+
+	for name, test := range map[string]struct {
+		ctx  context.Context
+		err  error
+		kind string
+	}{
+		"timeout":       {expired, errors.New("signal: killed"), "timeout"},
+		"canceled":      {cancelled, errors.New("signal: killed"), "canceled"},
+		"not found":     {context.Background(), &engineError{StatusCode: http.StatusNotFound}, "not_found"},
+		"server error":  {context.Background(), fmt.Errorf("inspect: %w", &engineError{StatusCode: http.StatusInternalServerError}), "server_error"},
+		"client error":  {context.Background(), &engineError{StatusCode: http.StatusBadRequest}, "client_error"},
+		"cli not found": {context.Background(), &exec.Error{Name: "docker", Err: exec.ErrNotFound}, "cli_not_found"},
+		"exit status":   {context.Background(), exec.Command("false").Run(), "exit_status"},
+		"decode":        {context.Background(), json.Unmarshal([]byte("{"), &struct{}{}), "decode"},
+		"other":         {context.Background(), errors.New("unexpected"), "other"},
+	} {
+		assert.Equal(t, test.kind, runtimeErrorType(test.ctx, test.err), name)
+	}
+}
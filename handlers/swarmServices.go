@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"vchan.in/doctor-metrics/types"
+)
+
+// Labels set by Docker Swarm on task containers.
+const (
+	swarmServiceIDLabel   = "com.docker.swarm.service.id"
+	swarmServiceNameLabel = "com.docker.swarm.service.name"
+	swarmTaskIDLabel      = "com.docker.swarm.task.id"
+	swarmTaskNameLabel    = "com.docker.swarm.task.name"
+	swarmNodeIDLabel      = "com.docker.swarm.node.id"
+)
+
+func parseServiceList(output []byte) ([]types.DockerServiceList, error) {
+	/*
+		Parse the output of docker service ls --format '{{json .}}', one service per line.
+
+		{"ID":"m1n2k3p4q8r7","Image":"nginx:1.27","Mode":"replicated","Name":"shop_web","Ports":"","Replicas":"2/3"}
+	*/
+	var services []types.DockerServiceList
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var service types.DockerServiceList
+		if err := json.Unmarshal(line, &service); err != nil {
+			return nil, err
+		}
+		services = append(services, service)
+	}
+	return services, scanner.Err()
+}
+
+func parseReplicas(value string) (types.Replicas, bool) {
+	// Parse "running/desired" from values like "2/3" or "1/1 (max 1 per node)".
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return types.Replicas{}, false
+	}
+	runningStr, desiredStr, ok := strings.Cut(fields[0], "/")
+	if !ok {
+		return types.Replicas{}, false
+	}
+	running, err1 := strconv.Atoi(runningStr)
+	desired, err2 := strconv.Atoi(desiredStr)
+	if err1 != nil || err2 != nil {
+		return types.Replicas{}, false
+	}
+	return types.Replicas{Running: running, Desired: desired}, true
+}
+
+func listSwarmServices(ctx context.Context) ([]types.DockerServiceList, bool) {
+	// Only managers can list services, workers fall back to the tasks they run themselves.
+	output, err := dockerOutput(ctx, "service", "ls", "--format", "{{json .}}")
+	if err != nil {
+		return nil, false
+	}
+	services, err := parseServiceList(output)
+	if err != nil {
+		return nil, false
+	}
+	return services, true
+}
+
+func swarmTaskSlot(serviceName, taskName string) string {
+	// Task names are "<service>.<slot>.<task id>" for replicated and "<service>.<node id>.<task id>" for global services.
+	rest, ok := strings.CutPrefix(taskName, serviceName+".")
+	if !ok {
+		return ""
+	}
+	slot, _, _ := strings.Cut(rest, ".")
+	if _, err := strconv.Atoi(slot); err != nil {
+		return ""
+	}
+	return slot
+}
+
+func replicaHealth(replicas types.Replicas, unhealthy int) string {
+	switch {
+	case replicas.Desired > 0 && replicas.Running == 0:
+		return "down"
+	case replicas.Running < replicas.Desired || unhealthy > 0:
+		return "degraded"
+	default:
+		return "healthy"
+	}
+}
+
+func groupSwarmServices(list []types.ContainerMetrics, services []types.DockerServiceList, manager bool) []types.SwarmService {
+	/*
+		Group task container metrics by swarm service.
+
+		On managers the running and desired replicas come from docker service ls and cover the whole cluster,
+		and services without a task on this node are listed too. On workers they are derived from the local tasks:
+		each replica slot (or node, for global services) counts as one desired replica, so the exited containers
+		swarm keeps as task history do not count as missing replicas.
+		Function returns the services ordered by name.
+	*/
+	grouped := make(map[string]*types.SwarmService)
+	members := make(map[string][]types.ContainerMetrics)
+	for _, metrics := range list {
+		name, ok := metrics.ContainerLabels[swarmServiceNameLabel]
+		if !ok {
+			continue
+		}
+		if _, ok := grouped[name]; !ok {
+			grouped[name] = &types.SwarmService{
+				ServiceID:   metrics.ContainerLabels[swarmServiceIDLabel],
+				ServiceName: name,
+			}
+		}
+		members[name] = append(members[name], metrics)
+	}
+
+	clusterReplicas := make(map[string]types.Replicas)
+	for _, listed := range services {
+		service, ok := grouped[listed.Name]
+		if !ok {
+			service = &types.SwarmService{ServiceID: listed.ID, ServiceName: listed.Name}
+			grouped[listed.Name] = service
+		}
+		service.Mode = listed.Mode
+		service.Image = listed.Image
+		if replicas, ok := parseReplicas(listed.Replicas); ok {
+			clusterReplicas[listed.Name] = replicas
+		}
+	}
+
+	result := []types.SwarmService{}
+	for name, service := range grouped {
+		containers := members[name]
+		service.Usage = sumUsage(containers)
+		service.Tasks = []types.SwarmTask{}
+		service.Nodes = []types.SwarmNodePlacement{}
+
+		nodes := make(map[string]*types.SwarmNodePlacement)
+		slots := make(map[string]bool) // Slot key to whether a task in the slot is running
+		unhealthy := 0
+		for _, metrics := range containers {
+			task := types.SwarmTask{
+				TaskID:                    metrics.ContainerLabels[swarmTaskIDLabel],
+				TaskName:                  metrics.ContainerLabels[swarmTaskNameLabel],
+				NodeID:                    metrics.ContainerLabels[swarmNodeIDLabel],
+				ContainerID:               metrics.ContainerID,
+				ContainerName:             metrics.ContainerName,
+				State:                     metrics.ContainerState,
+				HealthStatus:              metrics.ContainerHealthStatus,
+				ContainerCpuUsagePercent:  metrics.ContainerCpuUsagePercent,
+				ContainerMemoryUsageBytes: metrics.ContainerMemoryUsageBytes,
+			}
+			task.Slot = swarmTaskSlot(name, task.TaskName)
+			service.Tasks = append(service.Tasks, task)
+
+			node, ok := nodes[task.NodeID]
+			if !ok {
+				node = &types.SwarmNodePlacement{NodeID: task.NodeID}
+				nodes[task.NodeID] = node
+			}
+			node.Tasks++
+
+			slotKey := task.Slot
+			if slotKey == "" {
+				slotKey = task.NodeID
+			}
+			slots[slotKey] = slots[slotKey] || metrics.Active
+			if metrics.Active {
+				node.Running++
+				if metrics.ContainerHealthStatus == "unhealthy" {
+					unhealthy++
+				}
+			}
+		}
+
+		for _, node := range nodes {
+			service.Nodes = append(service.Nodes, *node)
+		}
+		sort.Slice(service.Nodes, func(i, j int) bool { return service.Nodes[i].NodeID < service.Nodes[j].NodeID })
+		sort.Slice(service.Tasks, func(i, j int) bool { return service.Tasks[i].TaskName < service.Tasks[j].TaskName })
+
+		if replicas, ok := clusterReplicas[name]; ok && manager {
+			service.Replicas = replicas
+			service.ReplicasSource = "cluster"
+		} else {
+			for _, running := range slots {
+				service.Replicas.Desired++
+				if running {
+					service.Replicas.Running++
+				}
+			}
+			service.ReplicasSource = "local"
+		}
+		service.ReplicaHealth = replicaHealth(service.Replicas, unhealthy)
+
+		result = append(result, *service)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ServiceName < result[j].ServiceName })
+	return result
+}
+
+func GetSwarmServices(c echo.Context) error {
+	/*
+		Get aggregated metrics and replica health for every swarm service.
+
+		{
+		  "manager": true,
+		  "services": [
+		    {
+		      "service_name": "shop_web",
+		      "mode": "replicated",
+		      "replicas": {"running": 2, "desired": 3},
+		      "replicas_source": "cluster",
+		      "replica_health": "degraded",
+		      "nodes": [{"node_id": "q8r7m1n2k3p4", "tasks": 1, "running": 1}],
+		      "tasks": [{"task_name": "shop_web.1.xk2p9q3r7m1n", "slot": "1", ...}],
+		      "usage": {"cpu_usage_percent_total": 12.5, ...}
+		    },
+		    ...
+		  ]
+		}
+
+		Function returns a JSON response with the services ordered by name.
+		Tasks, node placement and usage only cover the task containers running on this node.
+	*/
+	listMetrics, err := collector.Collect(c.Request().Context(), types.ContainerFilter{Labels: []string{swarmServiceNameLabel}})
+	if err != nil {
+		return err
+	}
+	services, manager := listSwarmServices(c.Request().Context())
+
+	response := types.SwarmServicesResponse{
+		Status:  "success",
+		Message: "Swarm services retrieved successfully",
+	}
+	response.Data.Manager = manager
+	response.Data.Services = groupSwarmServices(listMetrics, services, manager)
+
+	return c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/types"
+)
+
+func swarmFixture(t *testing.T) []types.ContainerMetrics {
+	data, err := os.ReadFile("testdata/swarm_inspect.json")
+	if err != nil {
+		t.Fatalf("Failed to read inspect fixture: %v", err)
+	}
+	var inspects []types.DockerInspect
+	if err := json.Unmarshal(data, &inspects); err != nil {
+		t.Fatalf("Failed to unmarshal inspect fixture: %v", err)
+	}
+
+	list := make([]types.ContainerMetrics, len(inspects))
+	for i, inspect := range inspects {
+		list[i].ContainerID = inspect.ID[:12]
+		applyInspect(&list[i], inspect, time.Now())
+		list[i].Active = list[i].ContainerState == "running"
+		if list[i].Active {
+			list[i].ContainerCpuUsagePercent = 10
+			list[i].ContainerMemoryUsageBytes = 1000
+		}
+	}
+	return list
+}
+
+func TestParseServiceList(t *testing.T) {
+	data, err := os.ReadFile("testdata/swarm_service_ls.txt")
+	if err != nil {
+		t.Fatalf("Failed to read service list fixture: %v", err)
+	}
+	services, err := parseServiceList(data)
+	if assert.NoError(t, err) && assert.Len(t, services, 3) {
+		assert.Equal(t, "shop_web", services[0].Name)
+		assert.Equal(t, "global", services[1].Mode)
+	}
+
+	replicas, ok := parseReplicas("0/1 (max 1 per node)")
+	assert.True(t, ok)
+	assert.Equal(t, types.Replicas{Running: 0, Desired: 1}, replicas)
+	_, ok = parseReplicas("")
+	assert.False(t, ok)
+}
+
+func TestGroupSwarmServicesManager(t *testing.T) {
+	data, _ := os.ReadFile("testdata/swarm_service_ls.txt")
+	services, _ := parseServiceList(data)
+
+	grouped := groupSwarmServices(swarmFixture(t), services, true)
+	if !assert.Len(t, grouped, 3) {
+		return
+	}
+
+	agent := grouped[0]
+	assert.Equal(t, "shop_agent", agent.ServiceName)
+	assert.Equal(t, "global", agent.Mode)
+	assert.Equal(t, "healthy", agent.ReplicaHealth)
+	if assert.Len(t, agent.Tasks, 1) {
+		assert.Empty(t, agent.Tasks[0].Slot)
+	}
+
+	cache := grouped[1]
+	assert.Equal(t, "shop_cache", cache.ServiceName)
+	assert.Equal(t, "down", cache.ReplicaHealth)
+	assert.Empty(t, cache.Tasks)
+
+	web := grouped[2]
+	assert.Equal(t, "shop_web", web.ServiceName)
+	assert.Equal(t, "cluster", web.ReplicasSource)
+	assert.Equal(t, types.Replicas{Running: 3, Desired: 4}, web.Replicas)
+	assert.Equal(t, "degraded", web.ReplicaHealth)
+	assert.Equal(t, []types.SwarmNodePlacement{{NodeID: "q8r7m1n2k3p4", Tasks: 3, Running: 2}}, web.Nodes)
+	if assert.Len(t, web.Tasks, 3) {
+		assert.Equal(t, "1", web.Tasks[0].Slot)
+		assert.Equal(t, "xk2p9q3r7m1n", web.Tasks[0].TaskID)
+	}
+	assert.Equal(t, 20.0, web.Usage.CpuUsagePercentTotal)
+}
+
+func TestGroupSwarmServicesWorker(t *testing.T) {
+	list := swarmFixture(t)
+	// Without the unhealthy task every local replica slot is running.
+	list[1].ContainerHealthStatus = "healthy"
+
+	grouped := groupSwarmServices(list, nil, false)
+	if assert.Len(t, grouped, 2) {
+		web := grouped[1]
+		assert.Equal(t, "local", web.ReplicasSource)
+		// The exited task in slot 1 is history, not a missing replica.
+		assert.Equal(t, types.Replicas{Running: 2, Desired: 2}, web.Replicas)
+		assert.Equal(t, "healthy", web.ReplicaHealth)
+		assert.Empty(t, web.Mode)
+	}
+}
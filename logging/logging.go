@@ -0,0 +1,191 @@
+// Package logging configures the slog logger of dh: the level and format of its logs,
+// the access log of the HTTP requests and the audit log of the rejected requests.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// LevelFatal is the level of the errors dh exits on, above slog.LevelError.
+const LevelFatal = slog.Level(12)
+
+// Formats of the logs.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Defaults of the audit log file rotation.
+const (
+	DefaultAuditMaxSizeMB  = 100
+	DefaultAuditMaxBackups = 5
+)
+
+// Config struct to store the logging configuration.
+type Config struct {
+	Level           string // Minimum level of the logs e.g. "info", see ParseLevel
+	Format          string // FormatText or FormatJSON
+	Access          bool   // Whether every HTTP request is logged
+	AuditFile       string // File the audit log is written to, the main log if empty e.g. "/var/log/dh/audit.log"
+	AuditMaxSizeMB  int    // Size in megabytes above which the audit log file is rotated e.g. 100
+	AuditMaxBackups int    // Rotated audit log files kept e.g. 5
+}
+
+// loggers struct to store the loggers of a configuration, replaced as a whole by Configure.
+type loggers struct {
+	access *slog.Logger // nil when the access log is disabled
+	audit  *slog.Logger // Never nil, writes to auditOutput
+}
+
+// auditWriter struct to store where the audit records are written, the main log output or a rotating file.
+// Audit loggers of every configuration write through it, so a record logged with the logger of a
+// previous configuration goes to the current output instead of a closed file.
+type auditWriter struct {
+	mu   sync.Mutex
+	w    io.Writer
+	file *RotatingFile // nil when the audit log is written to the main log
+}
+
+func (a *auditWriter) Write(p []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.w.Write(p)
+}
+
+func (a *auditWriter) swap(w io.Writer, file *RotatingFile) (previous *RotatingFile) {
+	// Write the next records to w, and return the file written to so far for the caller to close.
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	previous, a.w, a.file = a.file, w, file
+	return previous
+}
+
+var (
+	current     atomic.Pointer[loggers]
+	configure   sync.Mutex // Serializes Configure so each audit file is closed once
+	auditOutput = &auditWriter{w: io.Discard}
+)
+
+func ParseLevel(level string) (slog.Level, error) {
+	// ParseLevel returns the level named debug, info, warn, error or fatal, in any case.
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	case "fatal":
+		return LevelFatal, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn, error or fatal", level)
+}
+
+func Configure(cfg Config, stderr io.Writer) error {
+	/*
+		Configure replaces the default slog logger, which the standard log package also writes to,
+		and the access and audit loggers with the ones of the configuration.
+		It is safe to call while requests are logged. The audit log file of the previous configuration is closed,
+		records logged afterwards with an audit logger taken before are written to the new audit log.
+		Function returns an error for an invalid level or format, or when the audit log file cannot be opened,
+		in which case the current loggers are kept.
+	*/
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+	if cfg.Format != FormatText && cfg.Format != FormatJSON {
+		return fmt.Errorf("unknown log format %q, expected text or json", cfg.Format)
+	}
+
+	configure.Lock()
+	defer configure.Unlock()
+	next := &loggers{}
+	main := slog.New(newHandler(stderr, cfg.Format, level))
+	if cfg.Access {
+		next.access = main.With("log", "access")
+	}
+	// Audit records are kept whatever the level of the main log
+	var auditFile *RotatingFile
+	if cfg.AuditFile == "" {
+		next.audit = slog.New(newHandler(auditOutput, cfg.Format, slog.LevelInfo)).With("log", "audit")
+	} else {
+		auditFile, err = OpenRotatingFile(cfg.AuditFile, int64(cfg.AuditMaxSizeMB)<<20, cfg.AuditMaxBackups)
+		if err != nil {
+			return err
+		}
+		next.audit = slog.New(newHandler(auditOutput, cfg.Format, slog.LevelInfo))
+	}
+
+	slog.SetDefault(main)
+	auditTarget := io.Writer(stderr)
+	if auditFile != nil {
+		auditTarget = auditFile
+	}
+	if previous := auditOutput.swap(auditTarget, auditFile); previous != nil {
+		previous.Close()
+	}
+	current.Store(next)
+	return nil
+}
+
+func newHandler(w io.Writer, format string, level slog.Level) slog.Handler {
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: replaceLevel}
+	if format == FormatJSON {
+		return slog.NewJSONHandler(w, options)
+	}
+	return slog.NewTextHandler(w, options)
+}
+
+func replaceLevel(groups []string, attr slog.Attr) slog.Attr {
+	// Name LevelFatal "FATAL" instead of "ERROR+4".
+	if attr.Key == slog.LevelKey && len(groups) == 0 {
+		if level, ok := attr.Value.Any().(slog.Level); ok && level == LevelFatal {
+			attr.Value = slog.StringValue("FATAL")
+		}
+	}
+	return attr
+}
+
+func Access() *slog.Logger {
+	// Access returns the logger of the HTTP requests, nil when the access log is disabled.
+	if l := current.Load(); l != nil {
+		return l.access
+	}
+	return nil
+}
+
+func Audit() *slog.Logger {
+	// Audit returns the logger of the rejected requests, the default logger until Configure is called.
+	if l := current.Load(); l != nil {
+		return l.audit
+	}
+	return slog.Default().With("log", "audit")
+}
+
+func Fatal(msg string, args ...any) {
+	// Fatal logs at LevelFatal and exits with status 1.
+	slog.Log(context.Background(), LevelFatal, msg, args...)
+	os.Exit(1)
+}
+
+func Close() error {
+	// Close closes the audit log file, records logged afterwards are lost.
+	configure.Lock()
+	defer configure.Unlock()
+	auditOutput.mu.Lock()
+	defer auditOutput.mu.Unlock()
+	if auditOutput.file != nil {
+		return auditOutput.file.Close()
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func restoreDefault(t *testing.T) {
+	// Restore the default logger and loggers replaced by Configure at the end of the test.
+	previous, previousLoggers := slog.Default(), current.Load()
+	auditOutput.mu.Lock()
+	previousAudit, previousAuditFile := auditOutput.w, auditOutput.file
+	auditOutput.mu.Unlock()
+	flags := log.Flags()
+	t.Cleanup(func() {
+		slog.SetDefault(previous)
+		current.Store(previousLoggers)
+		auditOutput.swap(previousAudit, previousAuditFile)
+		log.SetFlags(flags)
+	})
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, expected := range map[string]slog.Level{
+		"debug": slog.LevelDebug,
+		"INFO":  slog.LevelInfo,
+		"warn":  slog.LevelWarn,
+		"error": slog.LevelError,
+		"fatal": LevelFatal,
+	} {
+		level, err := ParseLevel(name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, expected, level, name)
+	}
+	_, err := ParseLevel("verbose")
+	assert.EqualError(t, err, `unknown log level "verbose", expected debug, info, warn, error or fatal`)
+}
+
+func TestConfigure(t *testing.T) {
+	restoreDefault(t)
+	var out bytes.Buffer
+	assert.NoError(t, Configure(Config{Level: "warn", Format: FormatJSON, Access: true}, &out))
+
+	slog.Info("dropped")
+	slog.Warn("kept", "container", "web")
+	log.Print("from the log package")
+	Access().Warn("request", "status", 500)
+	Audit().Info("Request rejected", "reason", "invalid_credentials")
+
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	if assert.Len(t, lines, 3) {
+		var record map[string]any
+		assert.NoError(t, json.Unmarshal(lines[0], &record))
+		assert.Equal(t, "WARN", record["level"])
+		assert.Equal(t, "kept", record["msg"])
+		assert.Equal(t, "web", record["container"])
+		assert.NoError(t, json.Unmarshal(lines[1], &record))
+		assert.Equal(t, "access", record["log"])
+		// Audit records are kept below the level of the main log
+		assert.NoError(t, json.Unmarshal(lines[2], &record))
+		assert.Equal(t, "audit", record["log"])
+		assert.Equal(t, "INFO", record["level"])
+	}
+
+	// The access log is disabled and an invalid configuration keeps the current loggers
+	out.Reset()
+	assert.NoError(t, Configure(Config{Level: "fatal", Format: FormatText}, &out))
+	assert.Nil(t, Access())
+	slog.Log(context.Background(), LevelFatal, "stopping")
+	assert.Contains(t, out.String(), "level=FATAL msg=stopping")
+	assert.Error(t, Configure(Config{Level: "info", Format: "xml"}, &out))
+	assert.Nil(t, Access())
+}
+
+func TestConfigureAuditFile(t *testing.T) {
+	restoreDefault(t)
+	dir := t.TempDir()
+	var out bytes.Buffer
+	first := filepath.Join(dir, "audit", "first.log")
+	assert.NoError(t, Configure(Config{Level: "info", Format: FormatText, AuditFile: first, AuditMaxSizeMB: 1}, &out))
+	Audit().Info("Request rejected", "reason", "ip_not_allowed")
+
+	second := filepath.Join(dir, "second.log")
+	assert.NoError(t, Configure(Config{Level: "info", Format: FormatText, AuditFile: second, AuditMaxSizeMB: 1}, &out))
+	Audit().Info("Request rejected", "reason", "missing_credentials")
+	assert.NoError(t, Close())
+
+	content, err := os.ReadFile(first)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "reason=ip_not_allowed")
+	assert.NotContains(t, string(content), "log=audit")
+	content, err = os.ReadFile(second)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "reason=missing_credentials")
+	assert.Empty(t, out.String())
+
+	assert.Error(t, Configure(Config{Level: "info", Format: FormatText, AuditFile: filepath.Join(second, "audit.log"), AuditMaxSizeMB: 1}, &out))
+}
+
+func TestConfigureKeepsAuditRecords(t *testing.T) {
+	// A record logged with the audit logger of a previous configuration goes to the new audit log.
+	restoreDefault(t)
+	dir := t.TempDir()
+	var out bytes.Buffer
+	first, second := filepath.Join(dir, "first.log"), filepath.Join(dir, "second.log")
+	assert.NoError(t, Configure(Config{Level: "info", Format: FormatText, AuditFile: first, AuditMaxSizeMB: 1}, &out))
+	audit := Audit()
+
+	assert.NoError(t, Configure(Config{Level: "info", Format: FormatText, AuditFile: second, AuditMaxSizeMB: 1}, &out))
+	audit.Info("Request rejected", "reason", "invalid_credentials")
+	assert.NoError(t, Configure(Config{Level: "info", Format: FormatJSON}, &out))
+	audit.Info("Request rejected", "reason", "ip_not_allowed")
+
+	content, err := os.ReadFile(second)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "reason=invalid_credentials")
+	assert.Contains(t, out.String(), "reason=ip_not_allowed")
+}
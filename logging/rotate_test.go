@@ -0,0 +1,55 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	assert.NoError(t, os.WriteFile(path, []byte("0123456789\n"), 0o600))
+
+	r, err := OpenRotatingFile(path, 20, 2)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, record := range []string{"first\n", "second\n", "third\n", "fourth\n", "fifth\n", "sixth\n", "seventh\n", "eighth\n"} {
+		n, err := r.Write([]byte(record))
+		assert.NoError(t, err)
+		assert.Equal(t, len(record), n)
+	}
+	assert.NoError(t, r.Close())
+	_, err = r.Write([]byte("closed\n"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+
+	read := func(name string) string {
+		content, _ := os.ReadFile(name)
+		return string(content)
+	}
+	// The existing content counts towards the size, older files beyond the two backups are dropped
+	assert.Equal(t, "eighth\n", read(path))
+	assert.Equal(t, "fifth\nsixth\nseventh\n", read(path+".1"))
+	assert.Equal(t, "second\nthird\nfourth\n", read(path+".2"))
+	assert.NoFileExists(t, path+".3")
+}
+
+func TestRotatingFileWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	r, err := OpenRotatingFile(path, 10, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer r.Close()
+	r.Write([]byte(strings.Repeat("a", 8) + "\n"))
+	r.Write([]byte("b\n"))
+	content, _ := os.ReadFile(path)
+	assert.Equal(t, "b\n", string(content))
+	assert.NoFileExists(t, path+".1")
+
+	_, err = OpenRotatingFile(path, 0, 1)
+	assert.Error(t, err)
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"os"
+
 	"vchan.in/doctor-metrics/cmd"
 )
 
-var Version string
+// Build information, set at build time e.g. -ldflags "-X main.Version=1.3.0 -X main.Commit=a8f8c54".
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
 
 func main() {
-	Version = "1.2.1"
-	cmd.Server(Version)
+	os.Exit(cmd.Execute(os.Args[1:], cmd.BuildInfo{Version: Version, Commit: Commit, BuildDate: BuildDate}))
 }
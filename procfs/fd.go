@@ -0,0 +1,69 @@
+package procfs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func (fs FS) OpenFDs(pid int) (int, error) {
+	/*
+		OpenFDs returns the number of open file descriptors of all processes in the cgroup of a process,
+		counted from the entries of /proc/<pid>/fd. For a container this sums every process of the container.
+		Processes whose descriptors cannot be listed, e.g. zombies or processes that just exited, are skipped.
+	*/
+	pids, err := fs.CgroupProcesses(pid)
+	if err != nil {
+		return 0, err
+	}
+	open := 0
+	for _, pid := range pids {
+		f, err := os.Open(fs.proc(strconv.Itoa(pid), "fd"))
+		if err != nil {
+			continue
+		}
+		names, err := f.Readdirnames(-1)
+		f.Close()
+		if err == nil {
+			open += len(names)
+		}
+	}
+	return open, nil
+}
+
+func (fs FS) NofileLimit(pid int) (int64, error) {
+	/*
+		NofileLimit returns the soft limit of open file descriptors (RLIMIT_NOFILE) of a process from /proc/<pid>/limits.
+
+		Limit                     Soft Limit           Hard Limit           Units
+		Max open files            1048576              1048576              files
+	*/
+	path := fs.proc(strconv.Itoa(pid), "limits")
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "Max open files")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			break
+		}
+		if fields[0] == "unlimited" {
+			return -1, nil
+		}
+		return strconv.ParseInt(fields[0], 10, 64)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("%s: missing Max open files", path)
+}
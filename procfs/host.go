@@ -0,0 +1,194 @@
+package procfs
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"vchan.in/doctor-metrics/types"
+)
+
+// CPUStat is the cumulative time a CPU spent in each mode, in clock ticks, from a "cpu" line of /proc/stat.
+type CPUStat struct {
+	CPU     string // Core name e.g. "cpu0", "cpu" for the sum of all cores
+	User    uint64
+	Nice    uint64
+	System  uint64
+	Idle    uint64
+	IOWait  uint64
+	IRQ     uint64
+	SoftIRQ uint64
+	Steal   uint64
+}
+
+func (s CPUStat) total() uint64 {
+	// Guest time is already included in user and nice time.
+	return s.User + s.Nice + s.System + s.Idle + s.IOWait + s.IRQ + s.SoftIRQ + s.Steal
+}
+
+func (fs FS) CPUStats() ([]CPUStat, error) {
+	/*
+		CPUStats returns the "cpu" lines of /proc/stat, the sum of all cores first and then each core.
+
+		cpu  10132153 290696 3084719 46828483 16683 0 25195 0 0 0
+		cpu0 1393280 32966 572056 13343292 6130 0 17875 0 0 0
+	*/
+	f, err := os.Open(fs.proc("stat"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var stats []CPUStat
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		if len(fields) < 9 {
+			return nil, fmt.Errorf("%s: malformed line for %s", fs.proc("stat"), fields[0])
+		}
+		values := make([]uint64, 8)
+		for i, field := range fields[1:9] {
+			if values[i], err = strconv.ParseUint(field, 10, 64); err != nil {
+				return nil, fmt.Errorf("%s: %w", fs.proc("stat"), err)
+			}
+		}
+		stats = append(stats, CPUStat{
+			CPU: fields[0], User: values[0], Nice: values[1], System: values[2], Idle: values[3],
+			IOWait: values[4], IRQ: values[5], SoftIRQ: values[6], Steal: values[7],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(stats) == 0 {
+		return nil, fmt.Errorf("%s: missing cpu lines", fs.proc("stat"))
+	}
+	return stats, nil
+}
+
+func (fs FS) CPUCount() (int, error) {
+	// Return the number of online CPU cores of the host, the per-core lines of /proc/stat.
+	stats, err := fs.CPUStats()
+	if err != nil {
+		return 0, err
+	}
+	return len(stats) - 1, nil
+}
+
+func CPUUsage(previous, current CPUStat) types.HostCPU {
+	/*
+		CPUUsage returns the share of time a CPU spent in each mode between two samples.
+		A CPU that went offline between the samples reports no usage.
+	*/
+	usage := types.HostCPU{CPU: current.CPU}
+	elapsed := float64(current.total()) - float64(previous.total())
+	if elapsed <= 0 {
+		return usage
+	}
+	share := func(previous, current uint64) float64 {
+		if current < previous {
+			return 0
+		}
+		return math.Round(float64(current-previous)/elapsed*100*100) / 100
+	}
+	idle := share(previous.Idle+previous.IOWait, current.Idle+current.IOWait)
+	usage.UsagePercent = math.Max(0, math.Round((100-idle)*100)/100)
+	usage.UserPercent = share(previous.User+previous.Nice, current.User+current.Nice)
+	usage.SystemPercent = share(previous.System+previous.IRQ+previous.SoftIRQ, current.System+current.IRQ+current.SoftIRQ)
+	usage.IOWaitPercent = share(previous.IOWait, current.IOWait)
+	usage.StealPercent = share(previous.Steal, current.Steal)
+	return usage
+}
+
+func (fs FS) LoadAvg() (types.HostLoad, error) {
+	/*
+		LoadAvg returns the load average of the host from /proc/loadavg.
+
+		0.52 0.61 0.58 2/812 12345
+	*/
+	data, err := os.ReadFile(fs.proc("loadavg"))
+	if err != nil {
+		return types.HostLoad{}, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 4 {
+		return types.HostLoad{}, fmt.Errorf("%s: malformed", fs.proc("loadavg"))
+	}
+	var load types.HostLoad
+	for i, target := range []*float64{&load.Load1, &load.Load5, &load.Load15} {
+		if *target, err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return types.HostLoad{}, fmt.Errorf("%s: %w", fs.proc("loadavg"), err)
+		}
+	}
+	running, total, ok := strings.Cut(fields[3], "/")
+	if !ok {
+		return types.HostLoad{}, fmt.Errorf("%s: malformed process counts", fs.proc("loadavg"))
+	}
+	load.RunningProcesses, _ = strconv.Atoi(running)
+	load.TotalProcesses, _ = strconv.Atoi(total)
+	return load, nil
+}
+
+func (fs FS) Uptime() (float64, error) {
+	// Uptime returns the seconds since boot from the first field of /proc/uptime.
+	data, err := os.ReadFile(fs.proc("uptime"))
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("%s: malformed", fs.proc("uptime"))
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+func (fs FS) HostNetworkInterfaces() ([]types.HostNetworkInterface, error) {
+	/*
+		HostNetworkInterfaces returns the counters of the host network interfaces with their link state,
+		speed, MTU and address from /sys/class/net.
+
+		The counters are read from the network namespace of PID 1, which is the host namespace
+		even when dh runs in a container with the host procfs mounted.
+	*/
+	stats, err := fs.NetDev(1)
+	if err != nil {
+		return nil, err
+	}
+	interfaces := make([]types.HostNetworkInterface, 0, len(stats))
+	for _, stat := range stats {
+		iface := types.HostNetworkInterface{NetworkInterfaceStats: stat}
+		iface.OperState = fs.readSysString("class", "net", stat.Interface, "operstate")
+		iface.MACAddress = fs.readSysString("class", "net", stat.Interface, "address")
+		// Virtual interfaces report -1 or fail to read the speed.
+		if speed, err := strconv.ParseInt(fs.readSysString("class", "net", stat.Interface, "speed"), 10, 64); err == nil && speed > 0 {
+			iface.SpeedMbps = speed
+		}
+		iface.MTU, _ = strconv.Atoi(fs.readSysString("class", "net", stat.Interface, "mtu"))
+		interfaces = append(interfaces, iface)
+	}
+	sort.Slice(interfaces, func(i, j int) bool { return interfaces[i].Interface < interfaces[j].Interface })
+	return interfaces, nil
+}
+
+func (fs FS) readSysString(elem ...string) string {
+	// Read a single-value sysfs attribute, empty if it cannot be read.
+	data, err := os.ReadFile(fs.sys(elem...))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func percent(used, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return math.Round(float64(used)/float64(total)*100*100) / 100
+}
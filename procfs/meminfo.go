@@ -0,0 +1,92 @@
+package procfs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"vchan.in/doctor-metrics/types"
+)
+
+func (fs FS) meminfo() (map[string]int64, error) {
+	/*
+		Read /proc/meminfo into a map of values in bytes keyed by field name.
+
+		MemTotal:        2048000 kB
+		HugePages_Total:       0
+
+		Values without a unit are counts and are returned as is.
+	*/
+	f, err := os.Open(fs.proc("meminfo"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]int64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value, kb := strings.CutSuffix(strings.TrimSpace(value), " kB")
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", fs.proc("meminfo"), name, err)
+		}
+		if kb {
+			parsed *= 1024
+		}
+		values[name] = parsed
+	}
+	return values, scanner.Err()
+}
+
+func (fs FS) MemTotal() (int64, error) {
+	// Read the total usable memory in bytes from the "MemTotal:" line of /proc/meminfo.
+	values, err := fs.meminfo()
+	if err != nil {
+		return 0, err
+	}
+	total, ok := values["MemTotal"]
+	if !ok {
+		return 0, fmt.Errorf("%s: missing MemTotal", fs.proc("meminfo"))
+	}
+	return total, nil
+}
+
+func (fs FS) HostMemory() (types.HostMemory, error) {
+	/*
+		HostMemory returns the memory and swap usage of the host from /proc/meminfo.
+		Used memory is the memory that is not available, so the reclaimable page cache does not count,
+		and kernels older than 3.14 without MemAvailable fall back to free memory plus buffers and cache.
+	*/
+	values, err := fs.meminfo()
+	if err != nil {
+		return types.HostMemory{}, err
+	}
+	memory := types.HostMemory{
+		TotalBytes:     values["MemTotal"],
+		FreeBytes:      values["MemFree"],
+		BuffersBytes:   values["Buffers"],
+		CachedBytes:    values["Cached"],
+		SwapTotalBytes: values["SwapTotal"],
+		SwapFreeBytes:  values["SwapFree"],
+	}
+	if memory.TotalBytes == 0 {
+		return types.HostMemory{}, fmt.Errorf("%s: missing MemTotal", fs.proc("meminfo"))
+	}
+	available, ok := values["MemAvailable"]
+	if !ok {
+		available = memory.FreeBytes + memory.BuffersBytes + memory.CachedBytes
+	}
+	memory.AvailableBytes = available
+	memory.UsedBytes = memory.TotalBytes - available
+	memory.UsagePercent = percent(memory.UsedBytes, memory.TotalBytes)
+	memory.SwapUsedBytes = memory.SwapTotalBytes - memory.SwapFreeBytes
+	memory.SwapUsagePercent = percent(memory.SwapUsedBytes, memory.SwapTotalBytes)
+	return memory, nil
+}
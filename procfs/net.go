@@ -0,0 +1,160 @@
+package procfs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"vchan.in/doctor-metrics/types"
+)
+
+func (fs FS) NetDev(pid int) ([]types.NetworkInterfaceStats, error) {
+	/*
+		NetDev returns the interface counters of the network namespace a process belongs to.
+
+		Inter-|   Receive                                                |  Transmit
+		 face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+		  eth0: 16433800    2162    0    0    0     0          0         0 16433800    2162    0    0    0     0       0          0
+
+		A PID of 0 reads /proc/net/dev, the network namespace of the process reading it.
+	*/
+	path := fs.proc("net", "dev")
+	if pid > 0 {
+		path = fs.proc(strconv.Itoa(pid), "net", "dev")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var interfaces []types.NetworkInterfaceStats
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, counters, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue // Header lines
+		}
+		fields := strings.Fields(counters)
+		if len(fields) < 16 {
+			return nil, fmt.Errorf("%s: malformed line for %s", path, strings.TrimSpace(name))
+		}
+		values := make([]int64, 16)
+		for i, field := range fields[:16] {
+			if values[i], err = strconv.ParseInt(field, 10, 64); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		interfaces = append(interfaces, types.NetworkInterfaceStats{
+			Interface:       strings.TrimSpace(name),
+			ReceiveBytes:    values[0],
+			ReceivePackets:  values[1],
+			ReceiveErrors:   values[2],
+			ReceiveDropped:  values[3],
+			TransmitBytes:   values[8],
+			TransmitPackets: values[9],
+			TransmitErrors:  values[10],
+			TransmitDropped: values[11],
+		})
+	}
+	return interfaces, scanner.Err()
+}
+
+func (fs FS) NetworkTotals(pid int) (int64, int64, error) {
+	/*
+		NetworkTotals returns the received and transmitted bytes of a process's network namespace,
+		summed over all interfaces except loopback like docker stats does.
+	*/
+	interfaces, err := fs.NetDev(pid)
+	if err != nil {
+		return 0, 0, err
+	}
+	var rx, tx int64
+	for _, iface := range interfaces {
+		if iface.Interface == "lo" {
+			continue
+		}
+		rx += iface.ReceiveBytes
+		tx += iface.TransmitBytes
+	}
+	return rx, tx, nil
+}
+
+func (fs FS) TCPConnections(pid int) (types.TCPConnections, error) {
+	/*
+		TCPConnections counts the TCP sockets of the network namespace a process belongs to by state,
+		from /proc/<pid>/net/tcp and /proc/<pid>/net/tcp6.
+
+		  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+		   0: 00000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 31337 1 ...
+
+		The state "st" is a TCP state of the kernel in hex, e.g. 01 for ESTABLISHED and 0A for LISTEN.
+		/proc/<pid>/net/tcp6 is missing without IPv6 and skipped.
+	*/
+	var connections types.TCPConnections
+	for _, name := range []string{"tcp", "tcp6"} {
+		path := fs.proc(strconv.Itoa(pid), "net", name)
+		f, err := os.Open(path)
+		if name == "tcp6" && errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return types.TCPConnections{}, err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Scan() // Header line
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 4 {
+				continue
+			}
+			state, err := strconv.ParseUint(fields[3], 16, 8)
+			if err != nil {
+				f.Close()
+				return types.TCPConnections{}, fmt.Errorf("%s: malformed state %q", path, fields[3])
+			}
+			connections.Total++
+			if counter := tcpStateCounter(&connections, state); counter != nil {
+				*counter++
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return types.TCPConnections{}, err
+		}
+	}
+	return connections, nil
+}
+
+func tcpStateCounter(connections *types.TCPConnections, state uint64) *int {
+	// Map the TCP states of include/net/tcp_states.h to their counters.
+	switch state {
+	case 0x01:
+		return &connections.Established
+	case 0x02:
+		return &connections.SynSent
+	case 0x03:
+		return &connections.SynRecv
+	case 0x04:
+		return &connections.FinWait1
+	case 0x05:
+		return &connections.FinWait2
+	case 0x06:
+		return &connections.TimeWait
+	case 0x07:
+		return &connections.Close
+	case 0x08:
+		return &connections.CloseWait
+	case 0x09:
+		return &connections.LastAck
+	case 0x0A:
+		return &connections.Listen
+	case 0x0B:
+		return &connections.Closing
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package procfs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"vchan.in/doctor-metrics/types"
+)
+
+// ErrPressureUnavailable is returned when none of the pressure files can be read.
+var ErrPressureUnavailable = errors.New("pressure stall information is not available")
+
+func ReadPressure(path string) (*types.Pressure, error) {
+	/*
+		ReadPressure parses a pressure stall information file like /proc/pressure/io or io.pressure.
+
+		some avg10=0.53 avg60=0.30 avg300=0.40 total=3493145
+		full avg10=0.53 avg60=0.29 avg300=0.37 total=3057571
+
+		The "full" line is optional, older kernels do not report it for CPU.
+	*/
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var pressure types.Pressure
+	var hasSome bool
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		stat, err := parsePressureStat(fields[1:])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		switch fields[0] {
+		case "some":
+			pressure.Some = stat
+			hasSome = true
+		case "full":
+			pressure.Full = &stat
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !hasSome {
+		return nil, fmt.Errorf("%s: missing some line", path)
+	}
+	return &pressure, nil
+}
+
+func parsePressureStat(fields []string) (types.PressureStat, error) {
+	var stat types.PressureStat
+	var err error
+	values := parseKeyValues(fields)
+	if stat.Avg10, err = parseFloat(values, "avg10"); err != nil {
+		return stat, err
+	}
+	if stat.Avg60, err = parseFloat(values, "avg60"); err != nil {
+		return stat, err
+	}
+	if stat.Avg300, err = parseFloat(values, "avg300"); err != nil {
+		return stat, err
+	}
+	if stat.Total, err = strconv.ParseInt(values["total"], 10, 64); err != nil {
+		return stat, fmt.Errorf("invalid total: %w", err)
+	}
+	return stat, nil
+}
+
+func readPressureFiles(cpuPath, memoryPath, ioPath string) (types.PressureMetrics, error) {
+	// Missing files are left nil, the kernel may have PSI disabled for a single controller.
+	var metrics types.PressureMetrics
+	var errs []error
+	var err error
+	if metrics.CPU, err = ReadPressure(cpuPath); err != nil {
+		errs = append(errs, err)
+	}
+	if metrics.Memory, err = ReadPressure(memoryPath); err != nil {
+		errs = append(errs, err)
+	}
+	if metrics.IO, err = ReadPressure(ioPath); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) == 3 {
+		return metrics, fmt.Errorf("%w: %w", ErrPressureUnavailable, errors.Join(errs...))
+	}
+	return metrics, nil
+}
+
+func (fs FS) HostPressure() (types.PressureMetrics, error) {
+	/*
+		HostPressure returns the host-level pressure stall information from /proc/pressure/{cpu,memory,io}.
+		It requires a kernel built with CONFIG_PSI and booted without psi=0.
+	*/
+	return readPressureFiles(
+		fs.proc("pressure", "cpu"),
+		fs.proc("pressure", "memory"),
+		fs.proc("pressure", "io"),
+	)
+}
+
+func (fs FS) CgroupPressure(pid int) (types.PressureMetrics, error) {
+	/*
+		CgroupPressure returns the pressure stall information of the cgroup a process belongs to.
+		For a container this is the cpu.pressure, memory.pressure and io.pressure of its cgroup,
+		located through the PID of the container's init process.
+	*/
+	dir, err := fs.CgroupDir(pid)
+	if err != nil {
+		return types.PressureMetrics{}, err
+	}
+	return readPressureFiles(
+		filepath.Join(dir, "cpu.pressure"),
+		filepath.Join(dir, "memory.pressure"),
+		filepath.Join(dir, "io.pressure"),
+	)
+}
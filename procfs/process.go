@@ -0,0 +1,205 @@
+package procfs
+
+import (
+	"bufio"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProcessStat is the state of a process read from /proc/<pid>.
+type ProcessStat struct {
+	PID        int    // Process ID e.g. 4242
+	PPID       int    // Parent process ID e.g. 4200
+	UID        int    // Effective user ID e.g. 101
+	Command    string // Command line, or the command name in brackets without one like ps e.g. "nginx: worker process"
+	CPUTicks   uint64 // User and system time in clock ticks
+	StartTicks uint64 // Start time in clock ticks after boot, tells processes with a reused PID apart
+	RSSBytes   int64  // Resident set size e.g. 10485760
+}
+
+func (fs FS) cgroupV1Dir(pid int) (string, error) {
+	/*
+		Return the directory of a process in the cgroup v1 pids or memory hierarchy, e.g.
+		"12:memory:/docker/f3f177b2b3b4" in /proc/<pid>/cgroup is "<cgroup root>/memory/docker/f3f177b2b3b4".
+	*/
+	f, err := os.Open(fs.proc(strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	dirs := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		for _, controller := range strings.Split(fields[1], ",") {
+			dirs[controller] = filepath.Join(fs.CgroupRoot, fields[1], fields[2])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	for _, controller := range []string{"pids", "memory"} {
+		if dir, ok := dirs[controller]; ok {
+			return dir, nil
+		}
+	}
+	return "", errors.New("process is not in a cgroup v1 pids or memory hierarchy")
+}
+
+func (fs FS) CgroupProcesses(pid int) ([]int, error) {
+	/*
+		CgroupProcesses returns the PIDs of all processes in the cgroup of a process and its child cgroups,
+		read from the cgroup.procs files of the cgroup v2 hierarchy, or of the cgroup v1 pids or memory hierarchy.
+		For a container this lists every process of the container, located through the PID of its init process.
+	*/
+	dir, err := fs.CgroupDir(pid)
+	if errors.Is(err, ErrNoCgroupV2) {
+		dir, err = fs.cgroupV1Dir(pid)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int
+	err = filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || entry.Name() != "cgroup.procs" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil // Child cgroup removed during the walk
+		}
+		if err != nil {
+			return err
+		}
+		for _, field := range strings.Fields(string(data)) {
+			if pid, err := strconv.Atoi(field); err == nil {
+				pids = append(pids, pid)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(pids)
+	return slices.Compact(pids), nil
+}
+
+func (fs FS) ProcessStat(pid int) (ProcessStat, error) {
+	/*
+		ProcessStat returns the parent, user, command line, CPU time and memory of a process,
+		from /proc/<pid>/stat, /proc/<pid>/status and /proc/<pid>/cmdline.
+	*/
+	stat := ProcessStat{PID: pid}
+	fields, err := fs.processStatFields(pid)
+	if err != nil {
+		return stat, err
+	}
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	stat.CPUTicks = utime + stime
+	stat.StartTicks, _ = strconv.ParseUint(fields[19], 10, 64)
+
+	f, err := os.Open(fs.proc(strconv.Itoa(pid), "status"))
+	if err != nil {
+		return stat, err
+	}
+	defer f.Close()
+	var name string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		values := strings.Fields(value)
+		if len(values) == 0 {
+			continue
+		}
+		switch key {
+		case "Name":
+			name = strings.TrimSpace(value)
+		case "PPid":
+			stat.PPID, _ = strconv.Atoi(values[0])
+		case "Uid":
+			// Real, effective, saved set and filesystem UIDs
+			if len(values) > 1 {
+				stat.UID, _ = strconv.Atoi(values[1])
+			}
+		case "VmRSS":
+			kb, _ := strconv.ParseInt(values[0], 10, 64)
+			stat.RSSBytes = kb * 1024
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return stat, err
+	}
+
+	// Arguments are separated by NUL bytes, kernel threads and zombies have no command line.
+	cmdline, _ := os.ReadFile(fs.proc(strconv.Itoa(pid), "cmdline"))
+	stat.Command = strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+	if stat.Command == "" {
+		stat.Command = "[" + name + "]"
+	}
+	return stat, nil
+}
+
+func (fs FS) UserNames(pid int) map[int]string {
+	/*
+		UserNames returns the user names by UID from the /etc/passwd of the root filesystem of a process,
+		so processes of a container are reported with the users of its image. The map is empty if the file cannot be read.
+	*/
+	names := make(map[int]string)
+	f, err := os.Open(fs.proc(strconv.Itoa(pid), "root", "etc", "passwd"))
+	if err != nil {
+		return names
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// name:password:UID:GID:comment:home:shell
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 3 {
+			continue
+		}
+		if uid, err := strconv.Atoi(fields[2]); err == nil {
+			if _, ok := names[uid]; !ok {
+				names[uid] = fields[0]
+			}
+		}
+	}
+	return names
+}
+
+func ProcessCPUPercent(previous, current ProcessStat, elapsed time.Duration) float64 {
+	/*
+		ProcessCPUPercent returns the CPU usage of a process between two samples, relative to one CPU like docker stats.
+		A previous sample of another process with the same PID, or none at all, counts as zero CPU time.
+	*/
+	if elapsed <= 0 {
+		return 0
+	}
+	var ticks uint64
+	if previous.StartTicks == current.StartTicks && current.CPUTicks >= previous.CPUTicks {
+		ticks = current.CPUTicks - previous.CPUTicks
+	} else {
+		ticks = current.CPUTicks
+	}
+	usage := float64(ticks) / userHZ / elapsed.Seconds() * 100
+	return math.Round(usage*100) / 100
+}
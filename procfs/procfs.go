@@ -0,0 +1,109 @@
+package procfs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrNoCgroupV2 is returned when a process is not attached to a cgroup v2 hierarchy.
+var ErrNoCgroupV2 = errors.New("process is not in a cgroup v2 hierarchy")
+
+// FS locates the host procfs and cgroup filesystems.
+type FS struct {
+	ProcRoot   string // Mount point of the host procfs e.g. "/proc"
+	CgroupRoot string // Mount point of the host cgroup filesystem e.g. "/sys/fs/cgroup"
+	SysRoot    string // Mount point of the host sysfs e.g. "/sys"
+}
+
+func NewFS() FS {
+	/*
+		NewFS returns an FS rooted at the mount points given by the DM_PROC_ROOT, DM_CGROUP_ROOT and DM_SYS_ROOT
+		environment variables, falling back to "/proc", "/sys/fs/cgroup" and "/sys".
+		Overriding the roots is needed when dh runs in a container with the host filesystems mounted elsewhere.
+	*/
+	fs := FS{
+		ProcRoot:   os.Getenv("DM_PROC_ROOT"),
+		CgroupRoot: os.Getenv("DM_CGROUP_ROOT"),
+		SysRoot:    os.Getenv("DM_SYS_ROOT"),
+	}
+	if fs.ProcRoot == "" {
+		fs.ProcRoot = "/proc"
+	}
+	if fs.CgroupRoot == "" {
+		fs.CgroupRoot = "/sys/fs/cgroup"
+	}
+	if fs.SysRoot == "" {
+		fs.SysRoot = "/sys"
+	}
+	return fs
+}
+
+func (fs FS) proc(elem ...string) string {
+	return filepath.Join(append([]string{fs.ProcRoot}, elem...)...)
+}
+
+func (fs FS) sys(elem ...string) string {
+	return filepath.Join(append([]string{fs.SysRoot}, elem...)...)
+}
+
+func (fs FS) unifiedRoot() string {
+	// On hybrid hosts the cgroup v2 hierarchy is mounted below "unified".
+	if _, err := os.Stat(filepath.Join(fs.CgroupRoot, "cgroup.controllers")); err == nil {
+		return fs.CgroupRoot
+	}
+	unified := filepath.Join(fs.CgroupRoot, "unified")
+	if _, err := os.Stat(unified); err == nil {
+		return unified
+	}
+	return fs.CgroupRoot
+}
+
+func (fs FS) CgroupDir(pid int) (string, error) {
+	/*
+		CgroupDir returns the cgroup v2 directory of a process.
+
+		The directory is taken from the "0::" line of /proc/<pid>/cgroup, e.g.
+		"0::/system.slice/docker-f3f177b2b3b4.scope" and joined with the cgroup v2 mount point.
+		ErrNoCgroupV2 is returned if the process only belongs to cgroup v1 hierarchies.
+	*/
+	f, err := os.Open(fs.proc(strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if path, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return filepath.Join(fs.unifiedRoot(), path), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", ErrNoCgroupV2
+}
+
+func parseKeyValues(fields []string) map[string]string {
+	// Parse "key=value" fields into a map, ignoring malformed fields.
+	values := make(map[string]string, len(fields))
+	for _, field := range fields {
+		if key, value, ok := strings.Cut(field, "="); ok {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+func parseFloat(values map[string]string, key string) (float64, error) {
+	value, ok := values[key]
+	if !ok {
+		return 0, fmt.Errorf("missing %s", key)
+	}
+	return strconv.ParseFloat(value, 64)
+}
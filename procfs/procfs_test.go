@@ -0,0 +1,232 @@
+package procfs
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/types"
+)
+
+func testFS() FS {
+	return FS{
+		ProcRoot:   filepath.Join("testdata", "proc"),
+		CgroupRoot: filepath.Join("testdata", "cgroup"),
+		SysRoot:    filepath.Join("testdata", "sys"),
+	}
+}
+
+func TestNewFSDefaults(t *testing.T) {
+	t.Setenv("DM_PROC_ROOT", "")
+	t.Setenv("DM_CGROUP_ROOT", "")
+	t.Setenv("DM_SYS_ROOT", "")
+	assert.Equal(t, FS{ProcRoot: "/proc", CgroupRoot: "/sys/fs/cgroup", SysRoot: "/sys"}, NewFS())
+
+	t.Setenv("DM_PROC_ROOT", "/host/proc")
+	t.Setenv("DM_CGROUP_ROOT", "/host/sys/fs/cgroup")
+	t.Setenv("DM_SYS_ROOT", "/host/sys")
+	assert.Equal(t, FS{ProcRoot: "/host/proc", CgroupRoot: "/host/sys/fs/cgroup", SysRoot: "/host/sys"}, NewFS())
+}
+
+func TestHostPressure(t *testing.T) {
+	pressure, err := testFS().HostPressure()
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0.59, pressure.CPU.Some.Avg10)
+		assert.Equal(t, 1.63, pressure.CPU.Some.Avg300)
+		assert.Equal(t, int64(11076292), pressure.CPU.Some.Total)
+		assert.Nil(t, pressure.CPU.Full)
+		assert.Equal(t, int64(102400), pressure.Memory.Full.Total)
+		assert.Equal(t, 0.29, pressure.IO.Full.Avg60)
+	}
+}
+
+func TestHostPressureUnavailable(t *testing.T) {
+	fs := FS{ProcRoot: t.TempDir(), CgroupRoot: t.TempDir()}
+	_, err := fs.HostPressure()
+	assert.True(t, errors.Is(err, ErrPressureUnavailable))
+}
+
+func TestCgroupPressure(t *testing.T) {
+	pressure, err := testFS().CgroupPressure(4242)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 12.5, pressure.CPU.Some.Avg10)
+		assert.Equal(t, int64(12345678), pressure.CPU.Full.Total)
+		assert.Equal(t, int64(0), pressure.Memory.Some.Total)
+		assert.Equal(t, 0.25, pressure.IO.Full.Avg300)
+	}
+}
+
+func TestCgroupPressureCgroupV1(t *testing.T) {
+	_, err := testFS().CgroupPressure(4343)
+	assert.True(t, errors.Is(err, ErrNoCgroupV2))
+}
+
+func TestReadPressureMalformed(t *testing.T) {
+	_, err := ReadPressure(filepath.Join("testdata", "proc", "4242", "cgroup"))
+	assert.Error(t, err)
+}
+
+func TestNetDev(t *testing.T) {
+	interfaces, err := testFS().NetDev(4242)
+	if assert.NoError(t, err) && assert.Len(t, interfaces, 2) {
+		assert.Equal(t, "eth0", interfaces[1].Interface)
+		assert.Equal(t, int64(123456), interfaces[1].ReceiveBytes)
+		assert.Equal(t, int64(2), interfaces[1].ReceiveDropped)
+		assert.Equal(t, int64(80), interfaces[1].TransmitPackets)
+		assert.Equal(t, int64(3), interfaces[1].TransmitErrors)
+	}
+
+	// Loopback traffic is not counted like in docker stats.
+	rx, tx, err := testFS().NetworkTotals(4242)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(123456), rx)
+		assert.Equal(t, int64(65432), tx)
+	}
+}
+
+func TestStartTime(t *testing.T) {
+	// The command name contains spaces and parentheses.
+	startTime, err := testFS().StartTime(4242)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "2021-09-01T12:30:00Z", startTime.Format(time.RFC3339))
+	}
+	_, err = testFS().StartTime(4343)
+	assert.Error(t, err)
+}
+
+func TestMemTotal(t *testing.T) {
+	total, err := testFS().MemTotal()
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(2048000*1024), total)
+	}
+}
+
+func TestHostMemory(t *testing.T) {
+	memory, err := testFS().HostMemory()
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(2048000*1024), memory.TotalBytes)
+		assert.Equal(t, int64(1024000*1024), memory.UsedBytes)
+		assert.Equal(t, 50.0, memory.UsagePercent)
+		assert.Equal(t, int64(262144*1024), memory.SwapUsedBytes)
+		assert.Equal(t, 25.0, memory.SwapUsagePercent)
+	}
+}
+
+func TestCPUStats(t *testing.T) {
+	stats, err := testFS().CPUStats()
+	if assert.NoError(t, err) && assert.Len(t, stats, 3) {
+		assert.Equal(t, "cpu", stats[0].CPU)
+		assert.Equal(t, uint64(13343292), stats[1].Idle)
+	}
+	count, err := testFS().CPUCount()
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, count)
+	}
+
+	previous := CPUStat{CPU: "cpu0", User: 100, System: 100, Idle: 700, IOWait: 100}
+	current := CPUStat{CPU: "cpu0", User: 350, Nice: 50, System: 150, Idle: 1250, IOWait: 150, SoftIRQ: 25, Steal: 25}
+	assert.Equal(t, types.HostCPU{
+		CPU: "cpu0", UsagePercent: 40, UserPercent: 30, SystemPercent: 7.5, IOWaitPercent: 5, StealPercent: 2.5,
+	}, CPUUsage(previous, current))
+	assert.Equal(t, types.HostCPU{CPU: "cpu0"}, CPUUsage(current, current))
+}
+
+func TestLoadAvgAndUptime(t *testing.T) {
+	load, err := testFS().LoadAvg()
+	if assert.NoError(t, err) {
+		assert.Equal(t, types.HostLoad{Load1: 0.52, Load5: 0.61, Load15: 0.58, RunningProcesses: 2, TotalProcesses: 812}, load)
+	}
+	uptime, err := testFS().Uptime()
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2096.35, uptime)
+	}
+}
+
+func TestHostNetworkInterfaces(t *testing.T) {
+	interfaces, err := testFS().HostNetworkInterfaces()
+	if assert.NoError(t, err) && assert.Len(t, interfaces, 2) {
+		eth0 := interfaces[0]
+		assert.Equal(t, "eth0", eth0.Interface)
+		assert.Equal(t, int64(123456), eth0.ReceiveBytes)
+		assert.Equal(t, "up", eth0.OperState)
+		assert.Equal(t, int64(1000), eth0.SpeedMbps)
+		assert.Equal(t, 1500, eth0.MTU)
+		assert.Equal(t, "02:42:ac:11:00:02", eth0.MACAddress)
+		assert.Zero(t, interfaces[1].SpeedMbps)
+	}
+}
+
+func TestFilesystemUsage(t *testing.T) {
+	usage, err := FilesystemUsage(t.TempDir())
+	if assert.NoError(t, err) {
+		assert.Positive(t, usage.TotalBytes)
+		assert.LessOrEqual(t, usage.AvailableBytes, usage.FreeBytes)
+		assert.Equal(t, usage.TotalBytes-usage.FreeBytes, usage.UsedBytes)
+	}
+	_, err = FilesystemUsage(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestCgroupProcesses(t *testing.T) {
+	fs := testFS()
+	pids, err := fs.CgroupProcesses(4242)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int{4242, 4250}, pids)
+	}
+	pids, err = fs.CgroupProcesses(4343)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int{4343}, pids)
+	}
+}
+
+func TestProcessStat(t *testing.T) {
+	fs := testFS()
+	stat, err := fs.ProcessStat(4242)
+	if assert.NoError(t, err) {
+		assert.Equal(t, ProcessStat{
+			PID: 4242, PPID: 4200, UID: 0, Command: "nginx: master process nginx -g daemon off;",
+			CPUTicks: 35, StartTicks: 180000, RSSBytes: 10 << 20,
+		}, stat)
+	}
+	// Zombies have no command line and no memory.
+	zombie, err := fs.ProcessStat(4250)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "[nginx]", zombie.Command)
+		assert.Equal(t, 101, zombie.UID)
+		assert.Zero(t, zombie.RSSBytes)
+	}
+	assert.Equal(t, map[int]string{0: "root", 101: "nginx"}, fs.UserNames(4242))
+	assert.Empty(t, fs.UserNames(4250))
+
+	previous := ProcessStat{CPUTicks: 300, StartTicks: 180500}
+	assert.Equal(t, 50.0, ProcessCPUPercent(previous, ProcessStat{CPUTicks: 400, StartTicks: 180500}, 2*time.Second))
+	// A reused PID starts over.
+	assert.Equal(t, 25.0, ProcessCPUPercent(previous, ProcessStat{CPUTicks: 50, StartTicks: 190000}, 2*time.Second))
+}
+
+func TestDescriptors(t *testing.T) {
+	fs := testFS()
+	// The zombie worker has no descriptors, only the five of the init process are counted.
+	open, err := fs.OpenFDs(4242)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 5, open)
+	}
+	limit, err := fs.NofileLimit(4242)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1024), limit)
+	}
+	_, err = fs.NofileLimit(4250)
+	assert.Error(t, err)
+}
+
+func TestTCPConnections(t *testing.T) {
+	fs := testFS()
+	connections, err := fs.TCPConnections(4242)
+	if assert.NoError(t, err) {
+		assert.Equal(t, types.TCPConnections{Established: 1, TimeWait: 2, CloseWait: 1, Listen: 2, Total: 6}, connections)
+	}
+	_, err = fs.TCPConnections(4343)
+	assert.Error(t, err)
+}
@@ -0,0 +1,75 @@
+package procfs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Clock ticks per second of the start times in /proc/<pid>/stat, USER_HZ is 100 on all Linux architectures.
+const userHZ = 100
+
+func (fs FS) BootTime() (time.Time, error) {
+	// Read the boot time from the "btime" line of /proc/stat.
+	f, err := os.Open(fs.proc("stat"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "btime "); ok {
+			seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(seconds, 0).UTC(), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return time.Time{}, err
+	}
+	return time.Time{}, fmt.Errorf("%s: missing btime", fs.proc("stat"))
+}
+
+func (fs FS) processStatFields(pid int) ([]string, error) {
+	// Return the fields of /proc/<pid>/stat after the command name, starting with the state (field 3).
+	data, err := os.ReadFile(fs.proc(strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return nil, err
+	}
+	// The command name may contain spaces and parentheses, it ends at the last ")".
+	end := strings.LastIndexByte(string(data), ')')
+	if end < 0 {
+		return nil, fmt.Errorf("malformed stat of pid %d", pid)
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 20 {
+		return nil, fmt.Errorf("malformed stat of pid %d", pid)
+	}
+	return fields, nil
+}
+
+func (fs FS) StartTime(pid int) (time.Time, error) {
+	/*
+		StartTime returns the time a process was started, from field 22 of /proc/<pid>/stat
+		(clock ticks after boot) and the boot time from /proc/stat.
+	*/
+	fields, err := fs.processStatFields(pid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	ticks, err := strconv.ParseInt(fields[19], 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	bootTime, err := fs.BootTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return bootTime.Add(time.Duration(ticks) * time.Second / userHZ), nil
+}
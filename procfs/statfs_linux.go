@@ -0,0 +1,30 @@
+package procfs
+
+import (
+	"syscall"
+
+	"vchan.in/doctor-metrics/types"
+)
+
+func FilesystemUsage(path string) (types.HostFilesystem, error) {
+	/*
+		FilesystemUsage returns the usage of the filesystem holding a directory, like df.
+		The usage percentage is the used share of the space available to unprivileged users.
+	*/
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return types.HostFilesystem{}, err
+	}
+	blockSize := int64(stat.Bsize)
+	usage := types.HostFilesystem{
+		Path:           path,
+		TotalBytes:     int64(stat.Blocks) * blockSize,
+		FreeBytes:      int64(stat.Bfree) * blockSize,
+		AvailableBytes: int64(stat.Bavail) * blockSize,
+		InodesTotal:    int64(stat.Files),
+		InodesFree:     int64(stat.Ffree),
+	}
+	usage.UsedBytes = usage.TotalBytes - usage.FreeBytes
+	usage.UsagePercent = percent(usage.UsedBytes, usage.UsedBytes+usage.AvailableBytes)
+	return usage, nil
+}
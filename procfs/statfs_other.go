@@ -0,0 +1,14 @@
+//go:build !linux
+
+package procfs
+
+import (
+	"errors"
+
+	"vchan.in/doctor-metrics/types"
+)
+
+func FilesystemUsage(path string) (types.HostFilesystem, error) {
+	// Filesystem usage is only read on Linux hosts.
+	return types.HostFilesystem{}, errors.ErrUnsupported
+}
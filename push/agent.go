@@ -0,0 +1,221 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"vchan.in/doctor-metrics/types"
+)
+
+// DefaultInterval is the time between two pushed batches.
+const DefaultInterval = 15 * time.Second
+
+// Collector collects the container metrics pushed by the agent.
+type Collector interface {
+	Collect(ctx context.Context, filter types.ContainerFilter) ([]types.ContainerMetrics, error)
+}
+
+// Config struct to store the push agent configuration.
+type Config struct {
+	URL       string        // Ingest endpoint of the central server e.g. "https://central:9095/api/ingest"
+	Token     string        // Token of this agent on the central server
+	CAFile    string        // PEM file with the CA certificates of the central server, the system pool if empty
+	Interval  time.Duration // Time between two batches, DefaultInterval if 0
+	BufferDir string        // Directory buffering undelivered batches, in memory if empty
+	BufferMax int           // Maximum number of undelivered batches, DefaultBufferMax if 0
+}
+
+// Agent periodically pushes container metrics to a central server, buffering them while it is unreachable.
+type Agent struct {
+	url       string
+	token     string
+	interval  time.Duration
+	client    *http.Client
+	collector Collector
+	spool     *Spool
+	now       func() time.Time
+
+	epoch    int64  // Start time of the agent, orders batches across restarts
+	sequence uint64 // Sequence number of the last batch
+}
+
+func NewAgent(config Config, collector Collector) (*Agent, error) {
+	/*
+		NewAgent returns an agent pushing the metrics of the collector.
+		Function returns an error when the URL is not HTTPS, the CA file is invalid or the buffer directory cannot be created.
+	*/
+	parsed, err := url.Parse(config.URL)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid push URL %q, expected https://host:port/api/ingest", config.URL)
+	}
+	if config.Token == "" {
+		return nil, errors.New("push token not set")
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", config.CAFile)
+		}
+	}
+
+	spool, err := NewSpool(config.BufferDir, config.BufferMax)
+	if err != nil {
+		return nil, err
+	}
+	interval := config.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	return &Agent{
+		url:      parsed.String(),
+		token:    config.Token,
+		interval: interval,
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		},
+		collector: collector,
+		spool:     spool,
+		now:       time.Now,
+		epoch:     time.Now().UnixNano(),
+	}, nil
+}
+
+func (a *Agent) Run(ctx context.Context) {
+	// Push a batch every interval until the context is cancelled.
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		if err := a.Push(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("Failed to push metrics", "buffered", a.spool.Len(), "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Agent) Buffered() int {
+	// Return the number of batches waiting to be delivered.
+	return a.spool.Len()
+}
+
+func (a *Agent) Adopt(previous *Agent) error {
+	// Adopt takes over the undelivered batches of a previous agent, they are sent before the batches of this one.
+	return previous.spool.MoveTo(a.spool)
+}
+
+func (a *Agent) Push(ctx context.Context) error {
+	/*
+		Collect a new batch, buffer it and send every buffered batch oldest first.
+		A failed collection still replays the buffered batches.
+	*/
+	listMetrics, err := a.collector.Collect(ctx, types.ContainerFilter{})
+	if err != nil {
+		slog.Error("Failed to collect metrics to push", "error", err)
+	} else {
+		a.sequence++
+		batch := types.IngestBatch{
+			Epoch:            a.epoch,
+			Sequence:         a.sequence,
+			CollectedAt:      a.now().UTC().Format(time.RFC3339),
+			ContainerMetrics: listMetrics,
+		}
+		if err := a.spool.Push(batch); err != nil {
+			return fmt.Errorf("failed to buffer batch: %w", err)
+		}
+	}
+	return a.Flush(ctx)
+}
+
+func (a *Agent) Flush(ctx context.Context) error {
+	/*
+		Send the buffered batches oldest first and stop at the first failure, so they are replayed in order.
+		Batches rejected by the server as invalid or too large are dropped since sending them again cannot succeed.
+	*/
+	for {
+		batch, ok, err := a.spool.Front()
+		if err != nil || !ok {
+			return err
+		}
+
+		err = a.send(ctx, batch)
+		var rejected *rejectedError
+		if errors.As(err, &rejected) {
+			slog.Error("Dropping batch rejected by the central server", "epoch", batch.Epoch, "sequence", batch.Sequence, "error", err)
+		} else if err != nil {
+			return err
+		}
+		if err := a.spool.Remove(batch); err != nil {
+			return err
+		}
+	}
+}
+
+// rejectedError is a response of the central server that will not change when the batch is sent again.
+type rejectedError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *rejectedError) Error() string {
+	return fmt.Sprintf("central server returned %d: %s", e.StatusCode, e.Message)
+}
+
+func (a *Agent) send(ctx context.Context, batch types.IngestBatch) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	request.Header.Set(echo.HeaderAuthorization, "Bearer "+a.token)
+
+	response, err := a.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		io.Copy(io.Discard, response.Body)
+		return nil
+	}
+
+	content, _ := io.ReadAll(io.LimitReader(response.Body, 64*1024))
+	var message struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(content, &message) != nil || message.Message == "" {
+		message.Message = strings.TrimSpace(http.StatusText(response.StatusCode))
+	}
+	switch response.StatusCode {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		return &rejectedError{StatusCode: response.StatusCode, Message: message.Message}
+	}
+	return fmt.Errorf("central server returned %d: %s", response.StatusCode, message.Message)
+}
@@ -0,0 +1,201 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/types"
+)
+
+// fakeCentral impersonates the ingest endpoint of a central server that can be taken down.
+type fakeCentral struct {
+	mu      sync.Mutex
+	down    bool
+	reject  bool
+	batches []types.IngestBatch
+	tokens  []string
+}
+
+func (f *fakeCentral) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case f.down:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	case f.reject:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Failed to parse the metrics batch"})
+		return
+	}
+	var batch types.IngestBatch
+	json.NewDecoder(r.Body).Decode(&batch)
+	f.batches = append(f.batches, batch)
+	f.tokens = append(f.tokens, r.Header.Get("Authorization"))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (f *fakeCentral) set(down, reject bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down, f.reject = down, reject
+}
+
+// fakeCollector returns one container whose CPU usage grows on every collection.
+type fakeCollector struct {
+	calls int
+	fail  bool
+}
+
+func (f *fakeCollector) Collect(ctx context.Context, filter types.ContainerFilter) ([]types.ContainerMetrics, error) {
+	if f.fail {
+		return nil, errors.New("docker daemon not reachable")
+	}
+	f.calls++
+	return []types.ContainerMetrics{{ContainerID: "c1", ContainerName: "nginx", ContainerCpuUsagePercent: float64(f.calls)}}, nil
+}
+
+func startCentral(t *testing.T) (*httptest.Server, *fakeCentral, string) {
+	// Start a TLS server and write its certificate to a CA file.
+	central := &fakeCentral{}
+	server := httptest.NewTLSServer(central)
+	t.Cleanup(server.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, central, caFile
+}
+
+func TestNewAgent(t *testing.T) {
+	server, _, caFile := startCentral(t)
+
+	_, err := NewAgent(Config{URL: "http://central:9095/api/ingest", Token: "secret"}, &fakeCollector{})
+	assert.Error(t, err)
+	_, err = NewAgent(Config{URL: server.URL + "/api/ingest"}, &fakeCollector{})
+	assert.Error(t, err)
+	_, err = NewAgent(Config{URL: server.URL + "/api/ingest", Token: "secret", CAFile: filepath.Join(t.TempDir(), "missing.pem")}, &fakeCollector{})
+	assert.Error(t, err)
+	_, err = NewAgent(Config{URL: server.URL + "/api/ingest", Token: "secret", CAFile: caFile}, &fakeCollector{})
+	assert.NoError(t, err)
+}
+
+func TestAgentBuffersAndReplaysInOrder(t *testing.T) {
+	for _, bufferDir := range []string{"", t.TempDir()} {
+		server, central, caFile := startCentral(t)
+		collector := &fakeCollector{}
+		agent, err := NewAgent(Config{URL: server.URL + "/api/ingest", Token: "secret", CAFile: caFile, BufferDir: bufferDir, BufferMax: 3}, collector)
+		if !assert.NoError(t, err) {
+			return
+		}
+		ctx := context.Background()
+
+		assert.NoError(t, agent.Push(ctx))
+		assert.Equal(t, 0, agent.spool.Len())
+
+		// While the central server is down batches are buffered, the oldest dropped beyond the maximum.
+		central.set(true, false)
+		for range 4 {
+			assert.Error(t, agent.Push(ctx))
+		}
+		assert.Equal(t, 3, agent.spool.Len())
+
+		// A failed collection still replays the buffer.
+		central.set(false, false)
+		collector.fail = true
+		assert.NoError(t, agent.Push(ctx))
+		assert.Equal(t, 0, agent.spool.Len())
+
+		var sequences []uint64
+		for _, batch := range central.batches {
+			sequences = append(sequences, batch.Sequence)
+			assert.Equal(t, agent.epoch, batch.Epoch)
+			assert.Len(t, batch.ContainerMetrics, 1)
+		}
+		assert.Equal(t, []uint64{1, 3, 4, 5}, sequences, bufferDir)
+		assert.Equal(t, 5.0, central.batches[3].ContainerMetrics[0].ContainerCpuUsagePercent)
+		assert.Equal(t, "Bearer secret", central.tokens[0])
+	}
+}
+
+func TestAgentDropsRejectedBatches(t *testing.T) {
+	server, central, caFile := startCentral(t)
+	agent, err := NewAgent(Config{URL: server.URL + "/api/ingest", Token: "secret", CAFile: caFile}, &fakeCollector{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	central.set(false, true)
+	assert.NoError(t, agent.Push(context.Background()))
+	assert.Equal(t, 0, agent.spool.Len())
+	assert.Empty(t, central.batches)
+}
+
+func TestAgentRejectsUnknownCertificate(t *testing.T) {
+	server, central, _ := startCentral(t)
+	agent, err := NewAgent(Config{URL: server.URL + "/api/ingest", Token: "secret"}, &fakeCollector{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Error(t, agent.Push(context.Background()))
+	assert.Equal(t, 1, agent.spool.Len())
+	assert.Empty(t, central.batches)
+}
+
+func TestSpoolMoveTo(t *testing.T) {
+	// Batches buffered in memory are carried over to a directory in order, a shared directory is left alone.
+	memory, _ := NewSpool("", 10)
+	assert.NoError(t, memory.Push(types.IngestBatch{Epoch: 1, Sequence: 1}))
+	assert.NoError(t, memory.Push(types.IngestBatch{Epoch: 1, Sequence: 2}))
+	dir := t.TempDir()
+	spool, err := NewSpool(dir, 10)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, spool.Push(types.IngestBatch{Epoch: 2, Sequence: 1}))
+
+	assert.NoError(t, memory.MoveTo(spool))
+	assert.Zero(t, memory.Len())
+	assert.Equal(t, 3, spool.Len())
+	batch, _, _ := spool.Front()
+	assert.Equal(t, types.IngestBatch{Epoch: 1, Sequence: 1}, batch)
+
+	same, _ := NewSpool(dir+"/", 10)
+	assert.NoError(t, spool.MoveTo(same))
+	assert.Equal(t, 3, same.Len())
+}
+
+func TestSpoolSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := NewSpool(dir, 10)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, spool.Push(types.IngestBatch{Epoch: 2, Sequence: 1}))
+	assert.NoError(t, spool.Push(types.IngestBatch{Epoch: 1, Sequence: 10}))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "00000000000000000000-00000000000000000000.json"), []byte("{"), 0o600))
+
+	// Batches of a previous agent run come first, unreadable files are skipped.
+	spool, _ = NewSpool(dir, 10)
+	batch, ok, err := spool.Front()
+	if assert.NoError(t, err) && assert.True(t, ok) {
+		assert.Equal(t, types.IngestBatch{Epoch: 1, Sequence: 10}, batch)
+	}
+	assert.NoError(t, spool.Remove(batch))
+	batch, _, _ = spool.Front()
+	assert.Equal(t, int64(2), batch.Epoch)
+	assert.Equal(t, 1, spool.Len())
+}
@@ -0,0 +1,194 @@
+package push
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"vchan.in/doctor-metrics/types"
+)
+
+// DefaultBufferMax is the number of batches buffered while the central server is unreachable.
+const DefaultBufferMax = 1000
+
+// Spool buffers batches in order until they are delivered, in a directory or in memory.
+type Spool struct {
+	dir string // Directory holding one JSON file per batch, empty to buffer in memory
+	max int    // Maximum number of buffered batches, the oldest are dropped first
+
+	mu     sync.Mutex
+	memory []types.IngestBatch
+}
+
+func NewSpool(dir string, max int) (*Spool, error) {
+	/*
+		NewSpool returns a spool buffering at most max batches, DefaultBufferMax if 0.
+		With a directory the batches survive restarts of the agent, otherwise they are kept in memory.
+	*/
+	if max <= 0 {
+		max = DefaultBufferMax
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create buffer directory: %w", err)
+		}
+	}
+	return &Spool{dir: dir, max: max}, nil
+}
+
+func batchFileName(batch types.IngestBatch) string {
+	// Zero-padded names sort in epoch and sequence order.
+	return fmt.Sprintf("%020d-%020d.json", batch.Epoch, batch.Sequence)
+}
+
+func (s *Spool) files() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *Spool) Push(batch types.IngestBatch) error {
+	// Append a batch, dropping the oldest batches beyond the maximum.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dir == "" {
+		s.memory = append(s.memory, batch)
+		if dropped := len(s.memory) - s.max; dropped > 0 {
+			slog.Warn("Push buffer full, dropped the oldest batches", "dropped", dropped)
+			s.memory = s.memory[dropped:]
+		}
+		return nil
+	}
+
+	content, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so a crash never leaves a truncated batch behind.
+	path := filepath.Join(s.dir, batchFileName(batch))
+	if err := os.WriteFile(path+".tmp", content, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+
+	names, err := s.files()
+	if err != nil {
+		return err
+	}
+	if dropped := len(names) - s.max; dropped > 0 {
+		slog.Warn("Push buffer full, dropped the oldest batches", "dropped", dropped)
+		for _, name := range names[:dropped] {
+			os.Remove(filepath.Join(s.dir, name))
+		}
+	}
+	return nil
+}
+
+func (s *Spool) Front() (types.IngestBatch, bool, error) {
+	/*
+		Return the oldest buffered batch without removing it.
+		Unreadable batch files are removed and skipped.
+	*/
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dir == "" {
+		if len(s.memory) == 0 {
+			return types.IngestBatch{}, false, nil
+		}
+		return s.memory[0], true, nil
+	}
+
+	names, err := s.files()
+	if err != nil {
+		return types.IngestBatch{}, false, err
+	}
+	for _, name := range names {
+		path := filepath.Join(s.dir, name)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return types.IngestBatch{}, false, err
+		}
+		var batch types.IngestBatch
+		if err := json.Unmarshal(content, &batch); err != nil {
+			slog.Warn("Removing unreadable push buffer file", "file", name, "error", err)
+			os.Remove(path)
+			continue
+		}
+		return batch, true, nil
+	}
+	return types.IngestBatch{}, false, nil
+}
+
+func (s *Spool) Remove(batch types.IngestBatch) error {
+	// Remove a delivered batch.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dir == "" {
+		for i, buffered := range s.memory {
+			if buffered.Epoch == batch.Epoch && buffered.Sequence == batch.Sequence {
+				s.memory = append(s.memory[:i], s.memory[i+1:]...)
+				break
+			}
+		}
+		return nil
+	}
+
+	err := os.Remove(filepath.Join(s.dir, batchFileName(batch)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *Spool) MoveTo(next *Spool) error {
+	/*
+		Move the buffered batches to another spool oldest first, e.g. when the push configuration is reloaded.
+		Nothing is moved when both spools buffer in the same directory.
+	*/
+	if s == next || (s.dir != "" && filepath.Clean(s.dir) == filepath.Clean(next.dir)) {
+		return nil
+	}
+	for {
+		batch, ok, err := s.Front()
+		if err != nil || !ok {
+			return err
+		}
+		if err := next.Push(batch); err != nil {
+			return err
+		}
+		if err := s.Remove(batch); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Spool) Len() int {
+	// Return the number of buffered batches.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dir == "" {
+		return len(s.memory)
+	}
+	names, _ := s.files()
+	return len(names)
+}
@@ -0,0 +1,146 @@
+package selfmetrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"vchan.in/doctor-metrics/types"
+)
+
+// ContentType is the content type of the Prometheus text exposition format written by WritePrometheus.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// promWriter writes metric families in the Prometheus text format, keeping the first write error.
+type promWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (p *promWriter) printf(format string, args ...any) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, args...)
+	}
+}
+
+func (p *promWriter) family(name, kind, help string) {
+	p.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (p *promWriter) sample(name string, labels []string, value float64) {
+	// Labels are name and value pairs e.g. ["collector", "docker"].
+	p.printf("%s%s %s\n", name, formatLabels(labels), formatValue(value))
+}
+
+func (p *promWriter) histogram(name string, labels []string, h types.DurationHistogram) {
+	for _, bucket := range h.Buckets {
+		p.sample(name+"_bucket", append(labels[:len(labels):len(labels)], "le", formatValue(bucket.LESeconds)), float64(bucket.Count))
+	}
+	p.sample(name+"_bucket", append(labels[:len(labels):len(labels)], "le", "+Inf"), float64(h.Count))
+	p.sample(name+"_sum", labels, h.SumSeconds)
+	p.sample(name+"_count", labels, float64(h.Count))
+}
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+`="`+escape.Replace(labels[i+1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func WritePrometheus(w io.Writer, self types.SelfMetrics) error {
+	/*
+		WritePrometheus writes the self metrics in the Prometheus text exposition format, see ContentType.
+		Metrics of dh are prefixed with dh_, the Go runtime metrics use the names of the Prometheus Go client.
+	*/
+	p := &promWriter{w: bufio.NewWriter(w)}
+
+	p.family("dh_collection_duration_seconds", "histogram", "Duration of the collections of all containers by collector.")
+	for _, collection := range self.Collections {
+		p.histogram("dh_collection_duration_seconds", []string{"collector", collection.Collector}, collection.Duration)
+	}
+	p.family("dh_collection_errors_total", "counter", "Failed collections of all containers by collector.")
+	for _, collection := range self.Collections {
+		p.sample("dh_collection_errors_total", []string{"collector", collection.Collector}, float64(collection.Errors))
+	}
+	p.family("dh_container_collection_duration_seconds", "histogram", "Duration of the collection of a single container.")
+	for _, container := range self.Containers {
+		p.histogram("dh_container_collection_duration_seconds", []string{"collector", container.Collector, "container", container.Container}, container.Duration)
+	}
+	p.family("dh_docker_errors_total", "counter", "Failed calls to the container runtime by source and type.")
+	for _, count := range self.DockerErrors {
+		p.sample("dh_docker_errors_total", []string{"source", count.Source, "type", count.Type}, float64(count.Count))
+	}
+	p.family("dh_snapshot_age_seconds", "gauge", "Seconds since the data served from memory was collected.")
+	for _, snapshot := range self.Snapshots {
+		p.sample("dh_snapshot_age_seconds", []string{"snapshot", snapshot.Name}, snapshot.AgeSeconds)
+	}
+	p.family("dh_http_request_duration_seconds", "histogram", "Time to serve HTTP requests by route and method.")
+	for _, route := range self.HTTPRequests {
+		p.histogram("dh_http_request_duration_seconds", []string{"route", route.Route, "method", route.Method}, route.Duration)
+	}
+	p.family("dh_http_requests_total", "counter", "HTTP requests by route, method and status code.")
+	for _, route := range self.HTTPRequests {
+		for _, status := range sortedKeys(route.Statuses) {
+			p.sample("dh_http_requests_total", []string{"route", route.Route, "method", route.Method, "status", status}, float64(route.Statuses[status]))
+		}
+	}
+	p.family("dh_rate_limit_rejections_total", "counter", "Requests rejected by the rate limiter.")
+	p.sample("dh_rate_limit_rejections_total", nil, float64(self.RateLimitRejections))
+	p.family("dh_auth_failures_total", "counter", "Requests rejected by the access control by reason.")
+	for _, count := range self.AuthFailures {
+		p.sample("dh_auth_failures_total", []string{"reason", count.Reason}, float64(count.Count))
+	}
+	p.family("dh_exporter_queue_depth", "gauge", "Batches waiting to be delivered by an exporter.")
+	for _, queue := range self.ExporterQueues {
+		p.sample("dh_exporter_queue_depth", []string{"exporter", queue.Exporter}, float64(queue.Depth))
+	}
+
+	if started, err := time.Parse(time.RFC3339, self.StartedAt); err == nil {
+		p.family("process_start_time_seconds", "gauge", "Start time of the process since unix epoch in seconds.")
+		p.sample("process_start_time_seconds", nil, float64(started.Unix()))
+	}
+	p.family("go_goroutines", "gauge", "Number of goroutines that currently exist.")
+	p.sample("go_goroutines", nil, float64(self.Goroutines))
+	p.family("go_memstats_heap_alloc_bytes", "gauge", "Number of heap bytes allocated and still in use.")
+	p.sample("go_memstats_heap_alloc_bytes", nil, float64(self.HeapAllocBytes))
+	p.family("go_memstats_heap_inuse_bytes", "gauge", "Number of heap bytes that are in use.")
+	p.sample("go_memstats_heap_inuse_bytes", nil, float64(self.HeapInuseBytes))
+	p.family("go_memstats_heap_objects", "gauge", "Number of allocated objects.")
+	p.sample("go_memstats_heap_objects", nil, float64(self.HeapObjects))
+	p.family("go_memstats_sys_bytes", "gauge", "Number of bytes obtained from system.")
+	p.sample("go_memstats_sys_bytes", nil, float64(self.SysBytes))
+	p.family("go_gc_cycles_total", "counter", "Number of completed GC cycles.")
+	p.sample("go_gc_cycles_total", nil, float64(self.GCCycles))
+
+	if p.err != nil {
+		return p.err
+	}
+	return p.w.Flush()
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
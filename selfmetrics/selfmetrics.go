@@ -0,0 +1,303 @@
+// Package selfmetrics records the operational metrics of dh itself, served by GET /api/self and GET /metrics.
+package selfmetrics
+
+import (
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"vchan.in/doctor-metrics/types"
+)
+
+// Upper bounds in seconds of the duration buckets, from a cached inspect to a slow docker stats.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Containers whose collection was not observed for this long are forgotten, so removed containers do not pile up.
+const containerExpiry = time.Hour
+
+// histogram counts observed durations in durationBuckets.
+type histogram struct {
+	buckets []int64 // Observations per bucket, not cumulative
+	count   int64
+	sum     float64
+	max     float64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	seconds := d.Seconds()
+	if h.buckets == nil {
+		h.buckets = make([]int64, len(durationBuckets))
+	}
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			h.buckets[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += seconds
+	h.max = max(h.max, seconds)
+}
+
+func (h *histogram) export() types.DurationHistogram {
+	// Export with cumulative buckets like Prometheus.
+	exported := types.DurationHistogram{Count: h.count, SumSeconds: h.sum, MaxSeconds: h.max, Buckets: make([]types.HistogramBucket, len(durationBuckets))}
+	var cumulative int64
+	for i, bound := range durationBuckets {
+		if h.buckets != nil {
+			cumulative += h.buckets[i]
+		}
+		exported.Buckets[i] = types.HistogramBucket{LESeconds: bound, Count: cumulative}
+	}
+	return exported
+}
+
+// collectionStats struct to store the collections of a collector.
+type collectionStats struct {
+	duration    histogram
+	errors      int64
+	lastSuccess time.Time
+}
+
+// containerStats struct to store the collections of a container.
+type containerStats struct {
+	duration histogram
+	seenAt   time.Time // Last observation, for containerExpiry
+}
+
+// containerKey identifies a container of a collector.
+type containerKey struct{ collector, container string }
+
+// dockerErrorKey identifies a type of failed call to the container runtime.
+type dockerErrorKey struct{ source, kind string }
+
+// routeKey identifies the requests of a route.
+type routeKey struct{ route, method string }
+
+// routeStats struct to store the requests served by a route.
+type routeStats struct {
+	duration histogram
+	statuses map[int]int64
+}
+
+// registry struct to store every self metric.
+type registry struct {
+	mu           sync.Mutex
+	started      time.Time
+	collections  map[string]*collectionStats
+	containers   map[containerKey]*containerStats
+	dockerErrors map[dockerErrorKey]int64
+	snapshots    map[string]time.Time
+	routes       map[routeKey]*routeStats
+	rateLimited  int64
+	authFailures map[string]int64
+	queues       map[string]func() int // Depth of the exporter queues, read when exported
+	now          func() time.Time
+}
+
+func newRegistry() *registry {
+	return &registry{
+		started:      time.Now(),
+		collections:  make(map[string]*collectionStats),
+		containers:   make(map[containerKey]*containerStats),
+		dockerErrors: make(map[dockerErrorKey]int64),
+		snapshots:    make(map[string]time.Time),
+		routes:       make(map[routeKey]*routeStats),
+		authFailures: make(map[string]int64),
+		queues:       make(map[string]func() int),
+		now:          time.Now,
+	}
+}
+
+// The metrics of this process.
+var metrics = newRegistry()
+
+func ObserveCollection(collector string, start time.Time, err *error) {
+	/*
+		ObserveCollection records a collection of all containers by a collector, e.g. "docker", started at start.
+		It is meant to be deferred with the address of the error returned by the collection.
+		A successful collection also refreshes the "containers" snapshot.
+	*/
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	end := metrics.now()
+	stats := metrics.collections[collector]
+	if stats == nil {
+		stats = &collectionStats{}
+		metrics.collections[collector] = stats
+	}
+	stats.duration.observe(end.Sub(start))
+	if *err != nil {
+		stats.errors++
+		return
+	}
+	stats.lastSuccess = end
+	metrics.snapshots["containers"] = stats.lastSuccess
+}
+
+func ObserveContainer(collector, container string, d time.Duration) {
+	// ObserveContainer records the time a collector spent on a single container.
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	key := containerKey{collector, container}
+	stats := metrics.containers[key]
+	if stats == nil {
+		stats = &containerStats{}
+		metrics.containers[key] = stats
+	}
+	stats.duration.observe(d)
+	stats.seenAt = metrics.now()
+}
+
+func CountDockerError(source, kind string) {
+	// CountDockerError records a failed call to the container runtime, source "cli" or "api", see types.DockerErrorCount.
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	metrics.dockerErrors[dockerErrorKey{source, kind}]++
+}
+
+func MarkSnapshot(name string, at time.Time) {
+	// MarkSnapshot records the time of data served from memory, e.g. "disk_usage".
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	metrics.snapshots[name] = at
+}
+
+// Request methods recorded by name, any other method sent by a client is recorded as "other".
+var requestMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true,
+	"DELETE": true, "CONNECT": true, "OPTIONS": true, "TRACE": true,
+}
+
+func ObserveRequest(route, method string, status int, d time.Duration) {
+	// ObserveRequest records a request served by a route pattern like "/api/metrics/:containerName".
+	if !requestMethods[method] {
+		method = "other" // Clients choose the method, so arbitrary methods must not add series
+	}
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	key := routeKey{route, method}
+	stats := metrics.routes[key]
+	if stats == nil {
+		stats = &routeStats{statuses: make(map[int]int64)}
+		metrics.routes[key] = stats
+	}
+	stats.duration.observe(d)
+	stats.statuses[status]++
+}
+
+func CountRateLimited() {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	metrics.rateLimited++
+}
+
+func CountAuthFailure(reason string) {
+	// CountAuthFailure records a request rejected by the access control, see types.AuthFailureCount.
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	metrics.authFailures[reason]++
+}
+
+func SetQueue(exporter string, depth func() int) {
+	// SetQueue reports the depth of the queue of an exporter, e.g. "push". A nil depth removes the queue.
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if depth == nil {
+		delete(metrics.queues, exporter)
+		return
+	}
+	metrics.queues[exporter] = depth
+}
+
+func Snapshot() types.SelfMetrics {
+	/*
+		Snapshot returns the current self metrics, ordered by name so that consecutive snapshots are comparable.
+		Containers not collected for containerExpiry are dropped.
+	*/
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	now := metrics.now()
+	self := types.SelfMetrics{
+		Timestamp:           now.UTC().Format(time.RFC3339),
+		StartedAt:           metrics.started.UTC().Format(time.RFC3339),
+		UptimeSeconds:       int64(now.Sub(metrics.started).Seconds()),
+		Goroutines:          runtime.NumGoroutine(),
+		HeapAllocBytes:      int64(memory.HeapAlloc),
+		HeapInuseBytes:      int64(memory.HeapInuse),
+		HeapObjects:         int64(memory.HeapObjects),
+		SysBytes:            int64(memory.Sys),
+		GCCycles:            int64(memory.NumGC),
+		Collections:         []types.CollectionMetrics{},
+		Containers:          []types.ContainerCollectionMetrics{},
+		DockerErrors:        []types.DockerErrorCount{},
+		Snapshots:           []types.SnapshotAge{},
+		HTTPRequests:        []types.HTTPRouteMetrics{},
+		RateLimitRejections: metrics.rateLimited,
+		AuthFailures:        []types.AuthFailureCount{},
+		ExporterQueues:      []types.ExporterQueue{},
+	}
+
+	for collector, stats := range metrics.collections {
+		collection := types.CollectionMetrics{Collector: collector, Duration: stats.duration.export(), Errors: stats.errors}
+		if !stats.lastSuccess.IsZero() {
+			collection.LastSuccessAt = stats.lastSuccess.UTC().Format(time.RFC3339)
+		}
+		self.Collections = append(self.Collections, collection)
+	}
+	sort.Slice(self.Collections, func(i, j int) bool { return self.Collections[i].Collector < self.Collections[j].Collector })
+
+	for key, stats := range metrics.containers {
+		if now.Sub(stats.seenAt) > containerExpiry {
+			delete(metrics.containers, key)
+			continue
+		}
+		self.Containers = append(self.Containers, types.ContainerCollectionMetrics{Collector: key.collector, Container: key.container, Duration: stats.duration.export()})
+	}
+	sort.Slice(self.Containers, func(i, j int) bool {
+		a, b := self.Containers[i], self.Containers[j]
+		return a.Collector < b.Collector || (a.Collector == b.Collector && a.Container < b.Container)
+	})
+
+	for key, count := range metrics.dockerErrors {
+		self.DockerErrors = append(self.DockerErrors, types.DockerErrorCount{Source: key.source, Type: key.kind, Count: count})
+	}
+	sort.Slice(self.DockerErrors, func(i, j int) bool {
+		a, b := self.DockerErrors[i], self.DockerErrors[j]
+		return a.Source < b.Source || (a.Source == b.Source && a.Type < b.Type)
+	})
+
+	for name, at := range metrics.snapshots {
+		self.Snapshots = append(self.Snapshots, types.SnapshotAge{Name: name, CollectedAt: at.UTC().Format(time.RFC3339), AgeSeconds: now.Sub(at).Seconds()})
+	}
+	sort.Slice(self.Snapshots, func(i, j int) bool { return self.Snapshots[i].Name < self.Snapshots[j].Name })
+
+	for key, stats := range metrics.routes {
+		statuses := make(map[string]int64, len(stats.statuses))
+		for status, count := range stats.statuses {
+			statuses[strconv.Itoa(status)] = count
+		}
+		self.HTTPRequests = append(self.HTTPRequests, types.HTTPRouteMetrics{Route: key.route, Method: key.method, Duration: stats.duration.export(), Statuses: statuses})
+	}
+	sort.Slice(self.HTTPRequests, func(i, j int) bool {
+		a, b := self.HTTPRequests[i], self.HTTPRequests[j]
+		return a.Route < b.Route || (a.Route == b.Route && a.Method < b.Method)
+	})
+
+	for reason, count := range metrics.authFailures {
+		self.AuthFailures = append(self.AuthFailures, types.AuthFailureCount{Reason: reason, Count: count})
+	}
+	sort.Slice(self.AuthFailures, func(i, j int) bool { return self.AuthFailures[i].Reason < self.AuthFailures[j].Reason })
+
+	for exporter, depth := range metrics.queues {
+		self.ExporterQueues = append(self.ExporterQueues, types.ExporterQueue{Exporter: exporter, Depth: depth()})
+	}
+	sort.Slice(self.ExporterQueues, func(i, j int) bool { return self.ExporterQueues[i].Exporter < self.ExporterQueues[j].Exporter })
+
+	return self
+}
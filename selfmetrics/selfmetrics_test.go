@@ -0,0 +1,174 @@
+package selfmetrics
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"vchan.in/doctor-metrics/types"
+)
+
+func resetMetrics(t *testing.T) *time.Time {
+	// Replace the metrics of the process with an empty registry at a fixed time returned to the test.
+	previous := metrics
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	metrics = newRegistry()
+	metrics.started = now
+	metrics.now = func() time.Time { return now }
+	t.Cleanup(func() { metrics = previous })
+	return &now
+}
+
+func TestHistogram(t *testing.T) {
+	var h histogram
+	h.observe(3 * time.Millisecond)
+	h.observe(200 * time.Millisecond)
+	h.observe(time.Minute)
+
+	exported := h.export()
+	assert.Equal(t, int64(3), exported.Count)
+	assert.InDelta(t, 60.203, exported.SumSeconds, 1e-9)
+	assert.Equal(t, 60.0, exported.MaxSeconds)
+	assert.Len(t, exported.Buckets, len(durationBuckets))
+	assert.Equal(t, types.HistogramBucket{LESeconds: 0.005, Count: 1}, exported.Buckets[0])
+	assert.Equal(t, types.HistogramBucket{LESeconds: 0.25, Count: 2}, exported.Buckets[5])
+	assert.Equal(t, types.HistogramBucket{LESeconds: 30, Count: 2}, exported.Buckets[len(durationBuckets)-1])
+
+	// An empty histogram still exports every bucket
+	var empty histogram
+	assert.Len(t, empty.export().Buckets, len(durationBuckets))
+}
+
+func TestSnapshot(t *testing.T) {
+	now := resetMetrics(t)
+
+	var err error
+	ObserveCollection("podman", now.Add(-time.Second), &err)
+	err = errors.New("docker: command not found")
+	ObserveCollection("docker", now.Add(-time.Second), &err)
+	ObserveContainer("docker", "web", 10*time.Millisecond)
+	ObserveContainer("docker", "db", 20*time.Millisecond)
+	CountDockerError("cli", "exit_status")
+	CountDockerError("api", "timeout")
+	CountDockerError("cli", "exit_status")
+	MarkSnapshot("disk_usage", now.Add(-time.Minute))
+	ObserveRequest("/api/metrics", "GET", 200, time.Millisecond)
+	ObserveRequest("/api/metrics", "GET", 401, time.Millisecond)
+	ObserveRequest("/", "GET", 200, time.Millisecond)
+	CountRateLimited()
+	CountAuthFailure("invalid_credentials")
+	CountAuthFailure("ip_not_allowed")
+	SetQueue("push", func() int { return 3 })
+
+	*now = now.Add(10 * time.Second)
+	self := Snapshot()
+	assert.Equal(t, "2024-05-01T12:00:10Z", self.Timestamp)
+	assert.Equal(t, "2024-05-01T12:00:00Z", self.StartedAt)
+	assert.Equal(t, int64(10), self.UptimeSeconds)
+	assert.Positive(t, self.Goroutines)
+	assert.Positive(t, self.HeapAllocBytes)
+
+	assert.Len(t, self.Collections, 2)
+	assert.Equal(t, "docker", self.Collections[0].Collector)
+	assert.Equal(t, int64(1), self.Collections[0].Errors)
+	assert.Empty(t, self.Collections[0].LastSuccessAt)
+	assert.Equal(t, "podman", self.Collections[1].Collector)
+	assert.Equal(t, "2024-05-01T12:00:00Z", self.Collections[1].LastSuccessAt)
+
+	assert.Len(t, self.Containers, 2)
+	assert.Equal(t, "db", self.Containers[0].Container)
+	assert.Equal(t, "web", self.Containers[1].Container)
+
+	assert.Equal(t, []types.DockerErrorCount{{Source: "api", Type: "timeout", Count: 1}, {Source: "cli", Type: "exit_status", Count: 2}}, self.DockerErrors)
+	assert.Equal(t, []types.SnapshotAge{
+		{Name: "containers", CollectedAt: "2024-05-01T12:00:00Z", AgeSeconds: 10},
+		{Name: "disk_usage", CollectedAt: "2024-05-01T11:59:00Z", AgeSeconds: 70},
+	}, self.Snapshots)
+
+	assert.Len(t, self.HTTPRequests, 2)
+	assert.Equal(t, "/", self.HTTPRequests[0].Route)
+	assert.Equal(t, map[string]int64{"200": 1, "401": 1}, self.HTTPRequests[1].Statuses)
+	assert.Equal(t, int64(2), self.HTTPRequests[1].Duration.Count)
+
+	assert.Equal(t, int64(1), self.RateLimitRejections)
+	assert.Equal(t, []types.AuthFailureCount{{Reason: "invalid_credentials", Count: 1}, {Reason: "ip_not_allowed", Count: 1}}, self.AuthFailures)
+	assert.Equal(t, []types.ExporterQueue{{Exporter: "push", Depth: 3}}, self.ExporterQueues)
+
+	// Removed queues and containers not collected for an hour are dropped
+	SetQueue("push", nil)
+	*now = now.Add(containerExpiry)
+	ObserveContainer("docker", "web", 10*time.Millisecond)
+	self = Snapshot()
+	assert.Empty(t, self.ExporterQueues)
+	assert.Len(t, self.Containers, 1)
+	assert.Equal(t, "web", self.Containers[0].Container)
+}
+
+func TestObserveRequestMethods(t *testing.T) {
+	// Methods outside the standard ones share a single series.
+	resetMetrics(t)
+	ObserveRequest("unmatched", "GET", 404, time.Millisecond)
+	ObserveRequest("unmatched", "FOO", 404, time.Millisecond)
+	ObserveRequest("unmatched", "BAR", 405, time.Millisecond)
+
+	self := Snapshot()
+	if assert.Len(t, self.HTTPRequests, 2) {
+		assert.Equal(t, "GET", self.HTTPRequests[0].Method)
+		assert.Equal(t, "other", self.HTTPRequests[1].Method)
+		assert.Equal(t, map[string]int64{"404": 1, "405": 1}, self.HTTPRequests[1].Statuses)
+	}
+}
+
+func TestSnapshotEmpty(t *testing.T) {
+	// Lists are empty rather than null in the JSON of GET /api/self
+	resetMetrics(t)
+	self := Snapshot()
+	assert.NotNil(t, self.Collections)
+	assert.NotNil(t, self.Containers)
+	assert.NotNil(t, self.DockerErrors)
+	assert.NotNil(t, self.Snapshots)
+	assert.NotNil(t, self.HTTPRequests)
+	assert.NotNil(t, self.AuthFailures)
+	assert.NotNil(t, self.ExporterQueues)
+}
+
+func TestWritePrometheus(t *testing.T) {
+	now := resetMetrics(t)
+	var err error
+	ObserveCollection("docker", now.Add(-30*time.Millisecond), &err)
+	ObserveContainer("docker", `we"b\1`, 10*time.Millisecond)
+	CountDockerError("cli", "exit_status")
+	ObserveRequest("/api/metrics", "GET", 200, 2*time.Millisecond)
+	CountRateLimited()
+	CountAuthFailure("missing_credentials")
+	SetQueue("push", func() int { return 2 })
+
+	var out bytes.Buffer
+	assert.NoError(t, WritePrometheus(&out, Snapshot()))
+	text := out.String()
+
+	for _, line := range []string{
+		"# TYPE dh_collection_duration_seconds histogram",
+		`dh_collection_duration_seconds_bucket{collector="docker",le="0.025"} 0`,
+		`dh_collection_duration_seconds_bucket{collector="docker",le="0.05"} 1`,
+		`dh_collection_duration_seconds_bucket{collector="docker",le="+Inf"} 1`,
+		`dh_collection_duration_seconds_count{collector="docker"} 1`,
+		`dh_collection_errors_total{collector="docker"} 0`,
+		`dh_container_collection_duration_seconds_count{collector="docker",container="we\"b\\1"} 1`,
+		`dh_docker_errors_total{source="cli",type="exit_status"} 1`,
+		`dh_snapshot_age_seconds{snapshot="containers"} 0`,
+		`dh_http_requests_total{route="/api/metrics",method="GET",status="200"} 1`,
+		`dh_http_request_duration_seconds_sum{route="/api/metrics",method="GET"} 0.002`,
+		"dh_rate_limit_rejections_total 1",
+		`dh_auth_failures_total{reason="missing_credentials"} 1`,
+		`dh_exporter_queue_depth{exporter="push"} 2`,
+		"process_start_time_seconds 1.7145648e+09",
+		"# TYPE go_goroutines gauge",
+	} {
+		assert.Contains(t, text, line+"\n")
+	}
+	assert.True(t, strings.HasSuffix(text, "\n"))
+}
@@ -1,20 +1,119 @@
 package types
 
+import (
+	"encoding/json"
+	"math"
+	"strings"
+)
+
 // ContainerMetrics struct to store container metrics.
 type ContainerMetrics struct {
-	Active                             bool    `json:"active"`                                 // Status of the API response e.g. "success"
-	ContainerID                        string  `json:"container_id"`                           // Container ID e.g. "f3f177b2b3b4"
-	ContainerName                      string  `json:"container_name"`                         // Container name e.g. "my-container"
-	Timestamp                          string  `json:"timestamp"`                              // Timestamp in RFC3339 format e.g. "2021-09-01T12:34:56Z"
-	ContainerCpuUsagePercent           float64 `json:"container_cpu_usage_percent"`            // CPU usage percentage e.g. 0.07
-	ContainerMemoryUsageBytes          int64   `json:"container_memory_usage_bytes"`           // Memory usage in bytes e.g. 123456
-	ContainerMemoryLimitBytes          int64   `json:"container_memory_limit_bytes"`           // Memory limit in bytes e.g. 123456
-	ContainerMemoryUsagePercent        float64 `json:"container_memory_usage_percent"`         // Memory usage percentage e.g. 0.79
-	ContainerNetworkReceiveBytesTotal  int64   `json:"container_network_receive_bytes_total"`  // Network receive bytes e.g. 123456
-	ContainerNetworkTransmitBytesTotal int64   `json:"container_network_transmit_bytes_total"` // Network transmit bytes e.g. 123456
-	ContainerBlockReadBytes            int64   `json:"container_block_read_bytes"`             // Block read bytes e.g. 123456
-	ContainerBlockWriteBytes           int64   `json:"container_block_write_bytes"`            // Block write bytes e.g. 123456
-	ContainerPIDs                      int     `json:"container_pids"`                         // Number of PIDs e.g. 123
+	Active                             bool              `json:"active"`                                 // Status of the API response e.g. "success"
+	ContainerID                        string            `json:"container_id"`                           // Container ID e.g. "f3f177b2b3b4"
+	ContainerName                      string            `json:"container_name"`                         // Container name e.g. "my-container"
+	Timestamp                          string            `json:"timestamp"`                              // Timestamp in RFC3339 format e.g. "2021-09-01T12:34:56Z"
+	ContainerCpuUsagePercent           float64           `json:"container_cpu_usage_percent"`            // CPU usage percentage e.g. 0.07
+	ContainerMemoryUsageBytes          int64             `json:"container_memory_usage_bytes"`           // Memory usage in bytes e.g. 123456
+	ContainerMemoryLimitBytes          int64             `json:"container_memory_limit_bytes"`           // Memory limit in bytes e.g. 123456
+	ContainerMemoryUsagePercent        float64           `json:"container_memory_usage_percent"`         // Memory usage percentage e.g. 0.79
+	ContainerCpuHostPercent            float64           `json:"container_cpu_host_percent"`             // CPU usage as a share of all host CPUs e.g. 25.0 for 200% on 8 CPUs
+	ContainerMemoryHostPercent         float64           `json:"container_memory_host_percent"`          // Memory usage as a share of the host memory e.g. 1.56
+	ContainerNetworkReceiveBytesTotal  int64             `json:"container_network_receive_bytes_total"`  // Network receive bytes e.g. 123456
+	ContainerNetworkTransmitBytesTotal int64             `json:"container_network_transmit_bytes_total"` // Network transmit bytes e.g. 123456
+	ContainerBlockReadBytes            int64             `json:"container_block_read_bytes"`             // Block read bytes e.g. 123456
+	ContainerBlockWriteBytes           int64             `json:"container_block_write_bytes"`            // Block write bytes e.g. 123456
+	ContainerPIDs                      int               `json:"container_pids"`                         // Number of PIDs e.g. 123
+	ContainerPressure                  *PressureMetrics  `json:"container_pressure,omitempty"`           // Pressure stall information, only on cgroup v2 hosts
+	ContainerOpenFDs                   int               `json:"container_open_fds,omitempty"`           // Open file descriptors summed over all processes e.g. 42
+	ContainerFDLimit                   int64             `json:"container_fd_limit,omitempty"`           // Soft nofile rlimit of the init process e.g. 1048576
+	ContainerTCPConnections            *TCPConnections   `json:"container_tcp_connections,omitempty"`    // TCP connections of the network namespace by state
+	ContainerImage                     string            `json:"container_image"`                        // Image the container was created from e.g. "nginx:1.27"
+	ContainerImageID                   string            `json:"container_image_id"`                     // Image ID e.g. "sha256:3b25b682ea82..."
+	ContainerImageDigest               string            `json:"container_image_digest,omitempty"`       // Repository digest of the image e.g. "nginx@sha256:0b970013351..."
+	ContainerLabels                    map[string]string `json:"container_labels,omitempty"`             // Container labels e.g. {"com.docker.compose.project": "shop"}
+	ContainerCreatedAt                 string            `json:"container_created_at"`                   // Creation time in RFC3339 format e.g. "2021-09-01T12:00:00Z"
+	ContainerStartedAt                 string            `json:"container_started_at,omitempty"`         // Last start time in RFC3339 format e.g. "2021-09-01T12:30:00Z"
+	ContainerUptimeSeconds             int64             `json:"container_uptime_seconds"`               // Seconds since the last start, 0 if not running e.g. 3600
+	ContainerState                     string            `json:"container_state"`                        // State e.g. "running", "paused", "restarting", "exited", "dead"
+	ContainerExitCode                  int               `json:"container_exit_code"`                    // Exit code of the last run e.g. 137
+	ContainerRestartCount              int               `json:"container_restart_count"`                // Number of restarts by the restart policy e.g. 2
+	ContainerRestartPolicy             string            `json:"container_restart_policy"`               // Restart policy e.g. "unless-stopped"
+	ContainerHealthStatus              string            `json:"container_health_status,omitempty"`      // Healthcheck status e.g. "healthy", absent without a HEALTHCHECK
+	ContainerHealthFailures            int               `json:"container_health_failures,omitempty"`    // Consecutive failed healthchecks e.g. 3
+	ContainerHealthLog                 []HealthCheck     `json:"container_health_log,omitempty"`         // Latest healthcheck results, newest first
+	ContainerNamespace                 string            `json:"container_namespace,omitempty"`          // containerd namespace e.g. "k8s.io", absent for Docker
+	ContainerPod                       string            `json:"container_pod,omitempty"`                // Podman pod name e.g. "shop", absent outside pods
+	Host                               string            `json:"host,omitempty"`                         // Host the container runs on in aggregator mode e.g. "web-01"
+}
+
+// SetHostShare sets the CPU and memory usage as a share of the host capacity, a zero capacity leaves them unset.
+func (m *ContainerMetrics) SetHostShare(cpus int, memTotalBytes int64) {
+	if cpus > 0 {
+		m.ContainerCpuHostPercent = math.Round(m.ContainerCpuUsagePercent/float64(cpus)*100) / 100
+	}
+	if memTotalBytes > 0 {
+		m.ContainerMemoryHostPercent = math.Round(float64(m.ContainerMemoryUsageBytes)/float64(memTotalBytes)*100*100) / 100
+	}
+}
+
+// NetworkInterfaceStats struct to store the traffic counters of a network interface from /proc/net/dev.
+type NetworkInterfaceStats struct {
+	Interface       string `json:"interface"`        // Interface name e.g. "eth0"
+	ReceiveBytes    int64  `json:"receive_bytes"`    // Received bytes e.g. 123456
+	ReceivePackets  int64  `json:"receive_packets"`  // Received packets e.g. 1234
+	ReceiveErrors   int64  `json:"receive_errors"`   // Receive errors e.g. 0
+	ReceiveDropped  int64  `json:"receive_dropped"`  // Dropped received packets e.g. 0
+	TransmitBytes   int64  `json:"transmit_bytes"`   // Transmitted bytes e.g. 123456
+	TransmitPackets int64  `json:"transmit_packets"` // Transmitted packets e.g. 1234
+	TransmitErrors  int64  `json:"transmit_errors"`  // Transmit errors e.g. 0
+	TransmitDropped int64  `json:"transmit_dropped"` // Dropped transmitted packets e.g. 0
+}
+
+// ContainerFilter struct to store the label and state filters passed to a collector.
+type ContainerFilter struct {
+	Labels []string // Label selectors, all must match e.g. "com.docker.compose.project=shop" or "com.docker.compose.project"
+	States []string // Container states, any must match e.g. "running"
+}
+
+// Matches reports whether a container with the given labels and state passes the filter.
+func (f ContainerFilter) Matches(labels map[string]string, state string) bool {
+	for _, selector := range f.Labels {
+		key, value, hasValue := strings.Cut(selector, "=")
+		actual, ok := labels[key]
+		if !ok || (hasValue && actual != value) {
+			return false
+		}
+	}
+	if len(f.States) == 0 {
+		return true
+	}
+	for _, s := range f.States {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// PressureStat struct to store one "some" or "full" line of a pressure stall information file.
+type PressureStat struct {
+	Avg10  float64 `json:"avg10"`  // Percentage of time stalled over the last 10 seconds e.g. 0.59
+	Avg60  float64 `json:"avg60"`  // Percentage of time stalled over the last 60 seconds e.g. 1.01
+	Avg300 float64 `json:"avg300"` // Percentage of time stalled over the last 300 seconds e.g. 1.63
+	Total  int64   `json:"total"`  // Total stall time in microseconds e.g. 11076292
+}
+
+// Pressure struct to store the pressure stall information of a single resource.
+type Pressure struct {
+	Some PressureStat  `json:"some"`           // Time at least one task was stalled on the resource
+	Full *PressureStat `json:"full,omitempty"` // Time all non-idle tasks were stalled at once, absent for host CPU on older kernels
+}
+
+// PressureMetrics struct to store pressure stall information for CPU, memory and IO.
+type PressureMetrics struct {
+	CPU    *Pressure `json:"cpu,omitempty"`    // Contents of cpu.pressure or /proc/pressure/cpu
+	Memory *Pressure `json:"memory,omitempty"` // Contents of memory.pressure or /proc/pressure/memory
+	IO     *Pressure `json:"io,omitempty"`     // Contents of io.pressure or /proc/pressure/io
 }
 
 // Temporary struct to unmarshal docker stats output.
@@ -28,6 +127,140 @@ type DockerStats struct {
 	PIDs      string `json:"PIDs"`      // Number of PIDs
 }
 
+// Temporary struct to unmarshal docker inspect output.
+type DockerInspect struct {
+	ID           string `json:"Id"`           // Full container ID
+	Name         string `json:"Name"`         // Format: "/my-container"
+	Created      string `json:"Created"`      // Format: RFC3339Nano
+	Image        string `json:"Image"`        // Image ID e.g. "sha256:3b25b682ea82..."
+	RestartCount int    `json:"RestartCount"` // Number of restarts by the restart policy
+	State        struct {
+		Status     string `json:"Status"`     // One of "created", "running", "paused", "restarting", "removing", "exited", "dead"
+		Pid        int    `json:"Pid"`        // PID of the container's init process, 0 if not running
+		ExitCode   int    `json:"ExitCode"`   // Exit code of the last run
+		StartedAt  string `json:"StartedAt"`  // Format: RFC3339Nano, "0001-01-01T00:00:00Z" if never started
+		FinishedAt string `json:"FinishedAt"` // Format: RFC3339Nano
+		Health     *struct {
+			Status        string `json:"Status"`        // One of "starting", "healthy", "unhealthy"
+			FailingStreak int    `json:"FailingStreak"` // Consecutive failed healthchecks
+			Log           []struct {
+				Start    string `json:"Start"`    // Format: RFC3339Nano
+				End      string `json:"End"`      // Format: RFC3339Nano
+				ExitCode int    `json:"ExitCode"` // 0 healthy, 1 unhealthy, -1 if the check could not run
+				Output   string `json:"Output"`   // Output of the check, truncated by docker to 4 KiB
+			} `json:"Log"` // Latest healthcheck results, oldest first, at most 5
+		} `json:"Health"` // Only present if the container has a HEALTHCHECK
+	} `json:"State"`
+	Config struct {
+		Image  string            `json:"Image"`  // Image reference used at creation e.g. "nginx:1.27"
+		Labels map[string]string `json:"Labels"` // Container labels
+	} `json:"Config"`
+	HostConfig struct {
+		RestartPolicy struct {
+			Name string `json:"Name"` // One of "", "no", "always", "unless-stopped", "on-failure"
+		} `json:"RestartPolicy"`
+	} `json:"HostConfig"`
+}
+
+// Temporary struct to unmarshal the Engine API container list (GET /containers/json).
+type DockerContainerList struct {
+	ID    string   `json:"Id"`    // Full container ID
+	Names []string `json:"Names"` // Container names with a leading slash e.g. ["/web"]
+	State string   `json:"State"` // One of "created", "running", "paused", "restarting", "removing", "exited", "dead"
+}
+
+// Temporary struct to unmarshal the Engine API system info (GET /info).
+type DockerInfo struct {
+	NCPU     int   `json:"NCPU"`     // Number of host CPUs
+	MemTotal int64 `json:"MemTotal"` // Host memory in bytes
+}
+
+// Temporary struct to unmarshal the CPU usage of Engine API container stats.
+type DockerCPUStats struct {
+	CPUUsage struct {
+		TotalUsage  uint64   `json:"total_usage"`  // Cumulative CPU time of the container in nanoseconds
+		PercpuUsage []uint64 `json:"percpu_usage"` // Cumulative CPU time per core, cgroup v1 only
+	} `json:"cpu_usage"`
+	SystemUsage uint64 `json:"system_cpu_usage"` // Cumulative CPU time of the host in nanoseconds
+	OnlineCPUs  uint32 `json:"online_cpus"`      // Number of CPUs available to the container
+}
+
+// Temporary struct to unmarshal Engine API container stats (GET /containers/{id}/stats?stream=false).
+type DockerEngineStats struct {
+	CPUStats    DockerCPUStats `json:"cpu_stats"`    // CPU usage at the time of the sample
+	PreCPUStats DockerCPUStats `json:"precpu_stats"` // CPU usage at the previous sample, about a second earlier
+	MemoryStats struct {
+		Usage uint64            `json:"usage"` // Memory usage in bytes including the page cache
+		Limit uint64            `json:"limit"` // Memory limit in bytes, the host memory without a limit
+		Stats map[string]uint64 `json:"stats"` // Raw cgroup memory statistics e.g. "inactive_file"
+	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes uint64 `json:"rx_bytes"` // Received bytes
+		TxBytes uint64 `json:"tx_bytes"` // Transmitted bytes
+	} `json:"networks"` // Network statistics keyed by interface e.g. "eth0"
+	BlkioStats struct {
+		IoServiceBytesRecursive []struct {
+			Op    string `json:"op"`    // One of "read", "write" and their capitalized cgroup v1 forms
+			Value uint64 `json:"value"` // Bytes
+		} `json:"io_service_bytes_recursive"`
+	} `json:"blkio_stats"`
+	PidsStats struct {
+		Current uint64 `json:"current"` // Number of PIDs
+	} `json:"pids_stats"`
+}
+
+// Temporary struct to unmarshal the Engine API disk usage (GET /system/df).
+type DockerSystemDF struct {
+	LayersSize int64 `json:"LayersSize"` // Size of all image layers in bytes, shared layers counted once
+	Images     []struct {
+		ID         string   `json:"Id"`         // Image ID e.g. "sha256:4f7c..."
+		RepoTags   []string `json:"RepoTags"`   // Tags e.g. ["nginx:1.27"], ["<none>:<none>"] for dangling images
+		Created    int64    `json:"Created"`    // Creation time in Unix seconds
+		Size       int64    `json:"Size"`       // Size of all layers of the image in bytes
+		SharedSize int64    `json:"SharedSize"` // Size of the layers shared with other images, -1 if not computed
+		Containers int64    `json:"Containers"` // Number of containers using the image, -1 if not computed
+	} `json:"Images"`
+	Containers []struct {
+		ID         string   `json:"Id"`         // Full container ID
+		Names      []string `json:"Names"`      // Container names with a leading slash e.g. ["/web"]
+		Image      string   `json:"Image"`      // Image reference e.g. "nginx:1.27"
+		State      string   `json:"State"`      // One of "created", "running", "paused", "restarting", "removing", "exited", "dead"
+		SizeRw     int64    `json:"SizeRw"`     // Size of the writable layer in bytes
+		SizeRootFs int64    `json:"SizeRootFs"` // Size of the image layers and the writable layer in bytes
+	} `json:"Containers"`
+	Volumes []struct {
+		Name       string `json:"Name"`       // Volume name
+		Driver     string `json:"Driver"`     // Volume driver e.g. "local"
+		Mountpoint string `json:"Mountpoint"` // Path of the volume on the host
+		UsageData  *struct {
+			Size     int64 `json:"Size"`     // Size in bytes, -1 if not available for the driver
+			RefCount int64 `json:"RefCount"` // Number of containers using the volume, -1 if not available
+		} `json:"UsageData"`
+	} `json:"Volumes"`
+	BuildCache []struct {
+		ID     string `json:"ID"`     // Build cache record ID
+		InUse  bool   `json:"InUse"`  // Whether the record is used by a running build
+		Shared bool   `json:"Shared"` // Whether the record is shared with image layers
+		Size   int64  `json:"Size"`   // Size in bytes
+	} `json:"BuildCache"`
+}
+
+// Temporary struct to unmarshal the Engine API process list of a container (GET /containers/{id}/top).
+type DockerTop struct {
+	Titles    []string   `json:"Titles"`    // Column titles of the ps output e.g. ["PID", "PPID", "USER", "%CPU", "RSS", "COMMAND"]
+	Processes [][]string `json:"Processes"` // One row per process with a value per title
+}
+
+// Temporary struct to unmarshal docker events output.
+type DockerEvent struct {
+	Type   string `json:"Type"`   // Object type e.g. "container"
+	Action string `json:"Action"` // Action e.g. "start" or "health_status: healthy"
+	Actor  struct {
+		ID string `json:"ID"` // Full ID of the object
+	} `json:"Actor"`
+	TimeNano int64 `json:"timeNano"` // Time of the event in nanoseconds since the Unix epoch
+}
+
 // APIResponse struct to store API response.
 type APIResponse struct {
 	Status  string `json:"status"`  // Status of the API response e.g. "success"
@@ -36,3 +269,619 @@ type APIResponse struct {
 		ContainerMetrics []ContainerMetrics `json:"container_metrics"` // List of container metrics
 	} `json:"data"` // Data of the API response
 }
+
+// Pagination struct to store the position of a page in a filtered container list.
+type Pagination struct {
+	Total  int `json:"total"`  // Number of containers matching the filters e.g. 250
+	Count  int `json:"count"`  // Number of containers in this page e.g. 10
+	Limit  int `json:"limit"`  // Requested page size, 0 if unlimited e.g. 10
+	Offset int `json:"offset"` // Number of containers skipped e.g. 20
+}
+
+// MetricsListResponse struct to store a filtered and paginated container metrics API response.
+type MetricsListResponse struct {
+	Status  string `json:"status"`  // Status of the API response e.g. "success"
+	Message string `json:"message"` // Message of the API response e.g. "Container metrics retrieved successfully"
+	Data    struct {
+		ContainerMetrics []json.RawMessage `json:"container_metrics"` // Container metrics, reduced to the selected fields if any
+		Pagination       Pagination        `json:"pagination"`        // Position of this page in the filtered list
+		Errors           []HostError       `json:"errors,omitempty"`  // Hosts that could not be collected in aggregator mode
+	} `json:"data"` // Data of the API response
+}
+
+// HostError struct to store why the metrics of a host could not be collected.
+type HostError struct {
+	Host  string `json:"host"`  // Host name e.g. "web-01"
+	Error string `json:"error"` // Error message e.g. "context deadline exceeded"
+}
+
+// IngestBatch struct to store a batch of container metrics pushed by an agent to POST /api/ingest.
+type IngestBatch struct {
+	Epoch            int64              `json:"epoch"`             // Start time of the agent in Unix nanoseconds, orders batches across agent restarts
+	Sequence         uint64             `json:"sequence"`          // Sequence number of the batch within the epoch e.g. 42
+	CollectedAt      string             `json:"collected_at"`      // Collection time in RFC3339 format e.g. "2021-09-01T12:34:56Z"
+	ContainerMetrics []ContainerMetrics `json:"container_metrics"` // Metrics of all containers on the agent host
+}
+
+// AgentStatus struct to store the state of an agent pushing metrics to this instance.
+type AgentStatus struct {
+	Agent           string `json:"agent"`                       // Agent name from the token configuration e.g. "web-01"
+	LastSeen        string `json:"last_seen,omitempty"`         // Time the last batch was received in RFC3339 format, absent if never seen
+	LastCollectedAt string `json:"last_collected_at,omitempty"` // Collection time of the newest batch in RFC3339 format
+	Epoch           int64  `json:"epoch,omitempty"`             // Epoch of the newest batch
+	Sequence        uint64 `json:"sequence,omitempty"`          // Sequence number of the newest batch e.g. 42
+	Containers      int    `json:"containers"`                  // Number of containers in the newest batch e.g. 12
+	Stale           bool   `json:"stale"`                       // Whether no batch was received within the stale timeout
+}
+
+// AgentsResponse struct to store the agents API response.
+type AgentsResponse struct {
+	Status  string `json:"status"`  // Status of the API response e.g. "success"
+	Message string `json:"message"` // Message of the API response e.g. "Agents retrieved successfully"
+	Data    struct {
+		Agents []AgentStatus `json:"agents"` // Agents ordered by name
+	} `json:"data"` // Data of the API response
+}
+
+// ResourceUsage struct to store the resource usage of a group of containers.
+type ResourceUsage struct {
+	CpuUsagePercentTotal      float64 `json:"cpu_usage_percent_total"`      // Summed CPU usage percentage e.g. 52.5
+	CpuUsagePercentAvg        float64 `json:"cpu_usage_percent_avg"`        // Average CPU usage percentage of the running containers e.g. 26.25
+	MemoryUsageBytes          int64   `json:"memory_usage_bytes"`           // Summed memory usage in bytes e.g. 123456
+	MemoryLimitBytes          int64   `json:"memory_limit_bytes"`           // Summed memory limits in bytes e.g. 123456
+	NetworkReceiveBytesTotal  int64   `json:"network_receive_bytes_total"`  // Summed network receive bytes e.g. 123456
+	NetworkTransmitBytesTotal int64   `json:"network_transmit_bytes_total"` // Summed network transmit bytes e.g. 123456
+	BlockReadBytes            int64   `json:"block_read_bytes"`             // Summed block read bytes e.g. 123456
+	BlockWriteBytes           int64   `json:"block_write_bytes"`            // Summed block write bytes e.g. 123456
+	PIDs                      int     `json:"pids"`                         // Summed number of PIDs e.g. 123
+}
+
+// Replicas struct to store the number of running and desired containers of a group.
+type Replicas struct {
+	Running int `json:"running"` // Number of containers in the running state e.g. 2
+	Desired int `json:"desired"` // Number of containers that should be running e.g. 3
+}
+
+// ComposeService struct to store the aggregated metrics of a Docker Compose service.
+type ComposeService struct {
+	Project    string        `json:"project"`    // Value of the com.docker.compose.project label e.g. "shop"
+	Service    string        `json:"service"`    // Value of the com.docker.compose.service label e.g. "web"
+	Replicas   Replicas      `json:"replicas"`   // Running and desired replicas of the service
+	Usage      ResourceUsage `json:"usage"`      // Resource usage summed over the service containers
+	Containers []string      `json:"containers"` // Names of the service containers e.g. ["shop-web-1", "shop-web-2"]
+}
+
+// ComposeProject struct to store the aggregated metrics of a Docker Compose project.
+type ComposeProject struct {
+	Project  string        `json:"project"`  // Value of the com.docker.compose.project label e.g. "shop"
+	Services []string      `json:"services"` // Names of the project services e.g. ["db", "web"]
+	Replicas Replicas      `json:"replicas"` // Running and desired replicas summed over all services
+	Usage    ResourceUsage `json:"usage"`    // Resource usage summed over the project containers
+}
+
+// SwarmTask struct to store the metrics of a swarm task running on this node.
+type SwarmTask struct {
+	TaskID                    string  `json:"task_id"`                      // Value of the com.docker.swarm.task.id label e.g. "xk2p9q3r7m1n"
+	TaskName                  string  `json:"task_name"`                    // Value of the com.docker.swarm.task.name label e.g. "web.1.xk2p9q3r7m1n"
+	Slot                      string  `json:"slot,omitempty"`               // Replica slot of replicated services e.g. "1"
+	NodeID                    string  `json:"node_id"`                      // Value of the com.docker.swarm.node.id label e.g. "q8r7m1n2k3p4"
+	ContainerID               string  `json:"container_id"`                 // Container ID e.g. "f3f177b2b3b4"
+	ContainerName             string  `json:"container_name"`               // Container name e.g. "web.1.xk2p9q3r7m1n"
+	State                     string  `json:"state"`                        // Container state e.g. "running"
+	HealthStatus              string  `json:"health_status,omitempty"`      // Healthcheck status e.g. "healthy"
+	ContainerCpuUsagePercent  float64 `json:"container_cpu_usage_percent"`  // CPU usage percentage e.g. 0.07
+	ContainerMemoryUsageBytes int64   `json:"container_memory_usage_bytes"` // Memory usage in bytes e.g. 123456
+}
+
+// SwarmNodePlacement struct to store how many tasks of a service are placed on a node.
+type SwarmNodePlacement struct {
+	NodeID  string `json:"node_id"` // Swarm node ID e.g. "q8r7m1n2k3p4"
+	Tasks   int    `json:"tasks"`   // Number of task containers on the node e.g. 2
+	Running int    `json:"running"` // Number of running task containers on the node e.g. 2
+}
+
+// SwarmService struct to store the aggregated metrics of a swarm service.
+type SwarmService struct {
+	ServiceID      string               `json:"service_id,omitempty"` // Value of the com.docker.swarm.service.id label e.g. "m1n2k3p4q8r7"
+	ServiceName    string               `json:"service_name"`         // Value of the com.docker.swarm.service.name label e.g. "shop_web"
+	Mode           string               `json:"mode,omitempty"`       // Service mode e.g. "replicated" or "global", only known on managers
+	Image          string               `json:"image,omitempty"`      // Service image e.g. "nginx:1.27", only known on managers
+	Replicas       Replicas             `json:"replicas"`             // Running and desired tasks
+	ReplicasSource string               `json:"replicas_source"`      // "cluster" on managers, "local" if only this node's tasks are known
+	ReplicaHealth  string               `json:"replica_health"`       // "healthy", "degraded" or "down"
+	Nodes          []SwarmNodePlacement `json:"nodes"`                // Placement of the tasks visible on this node
+	Tasks          []SwarmTask          `json:"tasks"`                // Tasks visible on this node
+	Usage          ResourceUsage        `json:"usage"`                // Resource usage summed over the tasks visible on this node
+}
+
+// KubernetesContainer struct to store the metrics of a container that belongs to a Kubernetes pod.
+type KubernetesContainer struct {
+	Name                      string  `json:"name"`                         // Value of the io.kubernetes.container.name label e.g. "nginx"
+	ContainerID               string  `json:"container_id"`                 // Container ID e.g. "f3f177b2b3b4"
+	ContainerName             string  `json:"container_name"`               // Docker container name e.g. "k8s_nginx_web-7d9f8_shop_1a2b3c4d_0"
+	State                     string  `json:"state"`                        // Container state e.g. "running"
+	RestartCount              int     `json:"restart_count"`                // Value of the annotation.io.kubernetes.container.restartCount label e.g. 2
+	ContainerCpuUsagePercent  float64 `json:"container_cpu_usage_percent"`  // CPU usage percentage e.g. 0.07
+	ContainerMemoryUsageBytes int64   `json:"container_memory_usage_bytes"` // Memory usage in bytes e.g. 123456
+}
+
+// KubernetesPod struct to store the aggregated metrics of a Kubernetes pod.
+type KubernetesPod struct {
+	Namespace  string                `json:"namespace"`            // Value of the io.kubernetes.pod.namespace label e.g. "shop"
+	Pod        string                `json:"pod"`                  // Value of the io.kubernetes.pod.name label e.g. "web-7d9f8"
+	UID        string                `json:"uid,omitempty"`        // Value of the io.kubernetes.pod.uid label
+	SandboxID  string                `json:"sandbox_id,omitempty"` // Container ID of the running pause/sandbox container
+	Running    int                   `json:"running"`              // Number of running application containers e.g. 2
+	Containers []KubernetesContainer `json:"containers"`           // Application containers of the pod, without the sandbox
+	Usage      ResourceUsage         `json:"usage"`                // Resource usage of the pod, network usage is taken from the sandbox
+}
+
+// KubernetesNamespace struct to store the aggregated metrics of a Kubernetes namespace.
+type KubernetesNamespace struct {
+	Namespace  string        `json:"namespace"`  // Kubernetes namespace e.g. "shop"
+	Pods       int           `json:"pods"`       // Number of pods on this node e.g. 3
+	Containers int           `json:"containers"` // Number of application containers on this node e.g. 5
+	Usage      ResourceUsage `json:"usage"`      // Resource usage summed over the pods
+}
+
+// PodsResponse struct to store the Kubernetes pods API response.
+type PodsResponse struct {
+	Status  string `json:"status"`  // Status of the API response e.g. "success"
+	Message string `json:"message"` // Message of the API response e.g. "Kubernetes pods retrieved successfully"
+	Data    struct {
+		Namespaces []KubernetesNamespace `json:"namespaces"` // Namespaces ordered by name
+		Pods       []KubernetesPod       `json:"pods"`       // Pods ordered by namespace and name
+	} `json:"data"` // Data of the API response
+}
+
+// Temporary struct to unmarshal the Podman container list (GET /libpod/containers/json).
+type PodmanContainerList struct {
+	ID      string   `json:"Id"`      // Full container ID
+	Names   []string `json:"Names"`   // Container names e.g. ["web"]
+	State   string   `json:"State"`   // One of "created", "running", "paused", "stopped", "exited", "unknown"
+	Pod     string   `json:"Pod"`     // Full ID of the pod, empty outside pods
+	PodName string   `json:"PodName"` // Pod name e.g. "shop"
+	IsInfra bool     `json:"IsInfra"` // Whether this is the infra container holding the pod namespaces
+}
+
+// Temporary struct to unmarshal a container of the Podman stats report (GET /libpod/containers/stats).
+type PodmanStats struct {
+	ContainerID string  `json:"ContainerID"` // Full container ID
+	CPUNano     uint64  `json:"CPUNano"`     // Cumulative CPU time in nanoseconds
+	SystemNano  uint64  `json:"SystemNano"`  // Time of the sample in nanoseconds since the epoch
+	MemUsage    uint64  `json:"MemUsage"`    // Memory usage in bytes
+	MemLimit    uint64  `json:"MemLimit"`    // Memory limit in bytes, 0 or the host memory without a limit
+	MemPerc     float64 `json:"MemPerc"`     // Memory usage percentage
+	NetInput    uint64  `json:"NetInput"`    // Network receive bytes
+	NetOutput   uint64  `json:"NetOutput"`   // Network transmit bytes
+	BlockInput  uint64  `json:"BlockInput"`  // Block read bytes
+	BlockOutput uint64  `json:"BlockOutput"` // Block write bytes
+	PIDs        uint64  `json:"PIDs"`        // Number of PIDs
+}
+
+// Temporary struct to unmarshal the Podman stats report.
+type PodmanStatsReport struct {
+	Error any           `json:"Error"` // Error message, null on success
+	Stats []PodmanStats `json:"Stats"` // Stats of the requested running containers
+}
+
+// Temporary struct to unmarshal the Podman host info (GET /libpod/info).
+type PodmanInfo struct {
+	Host struct {
+		CgroupVersion     string   `json:"cgroupVersion"`     // Format: "v1" or "v2"
+		CgroupControllers []string `json:"cgroupControllers"` // Controllers available to containers e.g. ["cpu", "memory", "pids"]
+		MemTotal          int64    `json:"memTotal"`          // Host memory in bytes
+		CPUs              int      `json:"cpus"`              // Number of host CPUs
+		Security          struct {
+			Rootless bool `json:"rootless"` // Whether Podman runs rootless
+		} `json:"security"`
+	} `json:"host"`
+}
+
+// Temporary struct to unmarshal the Podman pod list (GET /libpod/pods/json).
+type PodmanPodList struct {
+	ID      string `json:"Id"`      // Full pod ID
+	Name    string `json:"Name"`    // Pod name e.g. "shop"
+	Status  string `json:"Status"`  // One of "Created", "Running", "Degraded", "Paused", "Exited", "Stopped", "Dead"
+	InfraID string `json:"InfraId"` // Full ID of the infra container, empty for pods without one
+}
+
+// PodmanPodContainer struct to store the metrics of a container that belongs to a Podman pod.
+type PodmanPodContainer struct {
+	ContainerID               string  `json:"container_id"`                 // Container ID e.g. "f3f177b2b3b4"
+	ContainerName             string  `json:"container_name"`               // Container name e.g. "shop-web"
+	State                     string  `json:"state"`                        // Container state e.g. "running"
+	ContainerCpuUsagePercent  float64 `json:"container_cpu_usage_percent"`  // CPU usage percentage e.g. 0.07
+	ContainerMemoryUsageBytes int64   `json:"container_memory_usage_bytes"` // Memory usage in bytes e.g. 123456
+}
+
+// PodmanPod struct to store the aggregated metrics of a Podman pod.
+type PodmanPod struct {
+	PodID      string               `json:"pod_id"`             // Pod ID e.g. "a1b2c3d4e5f6"
+	Pod        string               `json:"pod"`                // Pod name e.g. "shop"
+	Status     string               `json:"status"`             // Pod status e.g. "Running"
+	InfraID    string               `json:"infra_id,omitempty"` // Container ID of the infra container
+	Running    int                  `json:"running"`            // Number of running containers without the infra container e.g. 2
+	Containers []PodmanPodContainer `json:"containers"`         // Containers of the pod, without the infra container
+	Usage      ResourceUsage        `json:"usage"`              // Resource usage of the pod, network usage is taken from the infra container
+}
+
+// PodmanPodsResponse struct to store the Podman pods API response.
+type PodmanPodsResponse struct {
+	Status  string `json:"status"`  // Status of the API response e.g. "success"
+	Message string `json:"message"` // Message of the API response e.g. "Podman pods retrieved successfully"
+	Data    struct {
+		Pods []PodmanPod `json:"pods"` // Pods ordered by name
+	} `json:"data"` // Data of the API response
+}
+
+// Temporary struct to unmarshal docker service ls output.
+type DockerServiceList struct {
+	ID       string `json:"ID"`       // Service ID
+	Name     string `json:"Name"`     // Service name
+	Mode     string `json:"Mode"`     // Format: "replicated", "global", "replicated-job" or "global-job"
+	Replicas string `json:"Replicas"` // Format: "running/desired" (e.g. "2/3" or "1/1 (max 1 per node)")
+	Image    string `json:"Image"`    // Service image
+}
+
+// SwarmServicesResponse struct to store the swarm services API response.
+type SwarmServicesResponse struct {
+	Status  string `json:"status"`  // Status of the API response e.g. "success"
+	Message string `json:"message"` // Message of the API response e.g. "Swarm services retrieved successfully"
+	Data    struct {
+		Manager  bool           `json:"manager"`  // Whether this node is a swarm manager with a cluster-wide view
+		Services []SwarmService `json:"services"` // Swarm services ordered by name
+	} `json:"data"` // Data of the API response
+}
+
+// ProjectsResponse struct to store the compose projects API response.
+type ProjectsResponse struct {
+	Status  string `json:"status"`  // Status of the API response e.g. "success"
+	Message string `json:"message"` // Message of the API response e.g. "Compose projects retrieved successfully"
+	Data    struct {
+		Projects []ComposeProject `json:"projects"` // Compose projects ordered by name
+	} `json:"data"` // Data of the API response
+}
+
+// ServicesResponse struct to store the compose services API response.
+type ServicesResponse struct {
+	Status  string `json:"status"`  // Status of the API response e.g. "success"
+	Message string `json:"message"` // Message of the API response e.g. "Compose services retrieved successfully"
+	Data    struct {
+		Project  string           `json:"project"`  // Compose project name e.g. "shop"
+		Services []ComposeService `json:"services"` // Services of the project ordered by name
+	} `json:"data"` // Data of the API response
+}
+
+// TCPConnections struct to store the number of TCP sockets of a network namespace by state, IPv4 and IPv6 combined.
+type TCPConnections struct {
+	Established int `json:"established"` // Open connections e.g. 12
+	SynSent     int `json:"syn_sent"`    // Connections being opened e.g. 0
+	SynRecv     int `json:"syn_recv"`    // Connection requests being accepted e.g. 0
+	FinWait1    int `json:"fin_wait1"`   // Closed locally, waiting for the acknowledgement e.g. 0
+	FinWait2    int `json:"fin_wait2"`   // Closed locally, waiting for the peer to close e.g. 0
+	TimeWait    int `json:"time_wait"`   // Closed, waiting for delayed packets e.g. 85
+	Close       int `json:"close"`       // Unused sockets e.g. 0
+	CloseWait   int `json:"close_wait"`  // Closed by the peer, not yet closed locally e.g. 3
+	LastAck     int `json:"last_ack"`    // Closed by both sides, waiting for the last acknowledgement e.g. 0
+	Listen      int `json:"listen"`      // Listening sockets e.g. 2
+	Closing     int `json:"closing"`     // Closed by both sides simultaneously e.g. 0
+	Total       int `json:"total"`       // All TCP sockets e.g. 102
+}
+
+// HealthCheck struct to store the result of a single healthcheck run.
+type HealthCheck struct {
+	Start           string  `json:"start"`            // Start time in RFC3339Nano format e.g. "2021-09-01T12:00:00.123456789Z"
+	End             string  `json:"end"`              // End time in RFC3339Nano format e.g. "2021-09-01T12:00:00.223456789Z"
+	ExitCode        int     `json:"exit_code"`        // 0 healthy, 1 unhealthy, -1 if the check could not run
+	Output          string  `json:"output"`           // Output of the check e.g. "curl: (7) Failed to connect to localhost port 80"
+	DurationSeconds float64 `json:"duration_seconds"` // Run time of the check e.g. 0.1
+}
+
+// ContainerHealth struct to store the healthcheck state and status history of a container.
+type ContainerHealth struct {
+	ContainerID   string        `json:"container_id"`             // Container ID e.g. "f3f177b2b3b4"
+	ContainerName string        `json:"container_name"`           // Container name e.g. "shop-web-1"
+	Host          string        `json:"host,omitempty"`           // Host the container runs on in aggregator mode e.g. "web-01"
+	Status        string        `json:"status"`                   // Healthcheck status e.g. "unhealthy"
+	FailingStreak int           `json:"failing_streak"`           // Consecutive failed healthchecks e.g. 3
+	StatusChanges int           `json:"status_changes"`           // Changes between healthy and unhealthy within the flapping window e.g. 4
+	Flapping      bool          `json:"flapping"`                 // Whether the status changed more often than the flapping threshold
+	LastChangeAt  string        `json:"last_change_at,omitempty"` // Time of the last status change in RFC3339 format e.g. "2021-09-01T12:00:00Z"
+	Log           []HealthCheck `json:"log"`                      // Latest healthcheck results, newest first
+}
+
+// HealthSummary struct to store the number of containers with a healthcheck by status.
+type HealthSummary struct {
+	Total     int `json:"total"`     // Containers with a healthcheck e.g. 12
+	Healthy   int `json:"healthy"`   // Healthy containers e.g. 10
+	Unhealthy int `json:"unhealthy"` // Unhealthy containers e.g. 1
+	Starting  int `json:"starting"`  // Containers waiting for their first successful check e.g. 1
+	Flapping  int `json:"flapping"`  // Containers whose status changes too often e.g. 1
+}
+
+// HealthResponse struct to store the container health API response.
+type HealthResponse struct {
+	Status  string `json:"status"`  // Status of the API response e.g. "success"
+	Message string `json:"message"` // Message of the API response e.g. "Container health retrieved successfully"
+	Data    struct {
+		Summary    HealthSummary     `json:"summary"`          // Number of containers with a healthcheck by status
+		Containers []ContainerHealth `json:"containers"`       // Unhealthy and flapping containers, or all with ?all=true
+		Errors     []HostError       `json:"errors,omitempty"` // Hosts that could not be collected in aggregator mode
+	} `json:"data"` // Data of the API response
+}
+
+// HostPressureResponse struct to store the host pressure API response.
+type HostPressureResponse struct {
+	Status  string `json:"status"`  // Status of the API response e.g. "success"
+	Message string `json:"message"` // Message of the API response e.g. "Host pressure retrieved successfully"
+	Data    struct {
+		HostPressure PressureMetrics `json:"host_pressure"` // Host-level pressure stall information from /proc/pressure
+	} `json:"data"` // Data of the API response
+}
+
+// HostCPU struct to store the usage of a host CPU core, or of all cores, between two samples of /proc/stat.
+type HostCPU struct {
+	CPU           string  `json:"cpu"`            // Core name from /proc/stat e.g. "cpu0", "cpu" for all cores
+	UsagePercent  float64 `json:"usage_percent"`  // Busy time percentage e.g. 37.5
+	UserPercent   float64 `json:"user_percent"`   // Time in user mode including nice e.g. 30.25
+	SystemPercent float64 `json:"system_percent"` // Time in kernel mode including interrupts e.g. 7.25
+	IOWaitPercent float64 `json:"iowait_percent"` // Idle time waiting for I/O e.g. 1.5
+	StealPercent  float64 `json:"steal_percent"`  // Time taken by the hypervisor for other guests e.g. 0.0
+}
+
+// HostLoad struct to store the load average from /proc/loadavg.
+type HostLoad struct {
+	Load1            float64 `json:"load1"`             // Load average over 1 minute e.g. 0.52
+	Load5            float64 `json:"load5"`             // Load average over 5 minutes e.g. 0.61
+	Load15           float64 `json:"load15"`            // Load average over 15 minutes e.g. 0.58
+	RunningProcesses int     `json:"running_processes"` // Runnable threads e.g. 2
+	TotalProcesses   int     `json:"total_processes"`   // Threads on the host e.g. 812
+}
+
+// HostMemory struct to store the memory and swap usage from /proc/meminfo.
+type HostMemory struct {
+	TotalBytes       int64   `json:"total_bytes"`        // Usable memory e.g. 2097152000
+	FreeBytes        int64   `json:"free_bytes"`         // Unused memory e.g. 524288000
+	AvailableBytes   int64   `json:"available_bytes"`    // Memory available without swapping e.g. 1048576000
+	BuffersBytes     int64   `json:"buffers_bytes"`      // Block device buffers e.g. 67108864
+	CachedBytes      int64   `json:"cached_bytes"`       // Page cache e.g. 419430400
+	UsedBytes        int64   `json:"used_bytes"`         // Total minus available memory e.g. 1048576000
+	UsagePercent     float64 `json:"usage_percent"`      // Used memory percentage e.g. 50.0
+	SwapTotalBytes   int64   `json:"swap_total_bytes"`   // Swap space e.g. 1073741824
+	SwapFreeBytes    int64   `json:"swap_free_bytes"`    // Unused swap space e.g. 805306368
+	SwapUsedBytes    int64   `json:"swap_used_bytes"`    // Used swap space e.g. 268435456
+	SwapUsagePercent float64 `json:"swap_usage_percent"` // Used swap percentage, 0 without swap e.g. 25.0
+}
+
+// HostFilesystem struct to store the usage of the filesystem holding a directory.
+type HostFilesystem struct {
+	Path           string  `json:"path"`            // Directory the usage is reported for e.g. "/var/lib/docker"
+	TotalBytes     int64   `json:"total_bytes"`     // Size of the filesystem e.g. 107374182400
+	FreeBytes      int64   `json:"free_bytes"`      // Free space including the space reserved for root e.g. 53687091200
+	AvailableBytes int64   `json:"available_bytes"` // Free space available to unprivileged users e.g. 48318382080
+	UsedBytes      int64   `json:"used_bytes"`      // Total minus free space e.g. 53687091200
+	UsagePercent   float64 `json:"usage_percent"`   // Used share of the space usable by unprivileged users like df e.g. 52.63
+	InodesTotal    int64   `json:"inodes_total"`    // Inodes of the filesystem e.g. 6553600
+	InodesFree     int64   `json:"inodes_free"`     // Free inodes e.g. 6000000
+}
+
+// HostNetworkInterface struct to store the counters and link state of a host network interface.
+type HostNetworkInterface struct {
+	NetworkInterfaceStats
+	OperState  string `json:"oper_state,omitempty"`  // Link state from /sys/class/net e.g. "up"
+	SpeedMbps  int64  `json:"speed_mbps,omitempty"`  // Link speed, absent for virtual interfaces e.g. 1000
+	MTU        int    `json:"mtu,omitempty"`         // Maximum transmission unit e.g. 1500
+	MACAddress string `json:"mac_address,omitempty"` // Hardware address e.g. "02:42:ac:11:00:02"
+}
+
+// HostMetrics struct to store the metrics of the host the containers run on.
+type HostMetrics struct {
+	Timestamp         string                 `json:"timestamp"`            // Timestamp in RFC3339 format e.g. "2021-09-01T12:34:56Z"
+	BootTime          string                 `json:"boot_time"`            // Boot time in RFC3339 format e.g. "2021-09-01T12:00:00Z"
+	UptimeSeconds     int64                  `json:"uptime_seconds"`       // Seconds since boot e.g. 2096
+	CPUCount          int                    `json:"cpu_count"`            // Number of CPU cores e.g. 8
+	CPU               HostCPU                `json:"cpu"`                  // Usage of all cores
+	Cores             []HostCPU              `json:"cores"`                // Usage per core ordered by core number
+	Load              HostLoad               `json:"load"`                 // Load average
+	Memory            HostMemory             `json:"memory"`               // Memory and swap usage
+	Filesystem        *HostFilesystem        `json:"filesystem,omitempty"` // Usage of the filesystem holding the Docker data root, absent if not mounted
+	NetworkInterfaces []HostNetworkInterface `json:"network_interfaces"`   // Network interfaces of the host ordered by name
+}
+
+// HostResponse struct to store the host metrics API response.
+type HostResponse struct {
+	Status  string `json:"status"`  // Status of the API response e.g. "success"
+	Message string `json:"message"` // Message of the API response e.g. "Host metrics retrieved successfully"
+	Data    struct {
+		HostMetrics HostMetrics `json:"host_metrics"` // Metrics of the host
+	} `json:"data"` // Data of the API response
+}
+
+// DiskUsageTotal struct to store the disk usage of one kind of Docker object like docker system df.
+type DiskUsageTotal struct {
+	Count            int   `json:"count"`             // Number of objects e.g. 12
+	Active           int   `json:"active"`            // Objects in use by a container or a running build e.g. 8
+	SizeBytes        int64 `json:"size_bytes"`        // Disk space used by the objects e.g. 1073741824
+	ReclaimableBytes int64 `json:"reclaimable_bytes"` // Disk space freed by pruning the unused objects e.g. 268435456
+}
+
+// DiskUsageTotals struct to store the disk usage totals per kind of Docker object.
+type DiskUsageTotals struct {
+	Images     DiskUsageTotal `json:"images"`      // Images, sized by their layers with shared layers counted once
+	Containers DiskUsageTotal `json:"containers"`  // Writable layers of the containers
+	Volumes    DiskUsageTotal `json:"volumes"`     // Volumes whose size is known
+	BuildCache DiskUsageTotal `json:"build_cache"` // Build cache records not shared with image layers
+}
+
+// DiskImage struct to store the disk usage of an image.
+type DiskImage struct {
+	ImageID         string   `json:"image_id"`          // Short image ID e.g. "4f7c1f2d3e4a"
+	RepoTags        []string `json:"repo_tags"`         // Tags, empty for dangling images e.g. ["nginx:1.27"]
+	Created         string   `json:"created"`           // Creation time in RFC3339 format e.g. "2021-09-01T12:00:00Z"
+	SizeBytes       int64    `json:"size_bytes"`        // Size of all layers of the image e.g. 187654321
+	SharedSizeBytes int64    `json:"shared_size_bytes"` // Size of the layers shared with other images, -1 if unknown e.g. 77812345
+	UniqueSizeBytes int64    `json:"unique_size_bytes"` // Size of the layers only this image uses, -1 if unknown e.g. 109841976
+	Containers      int64    `json:"containers"`        // Number of containers using the image, -1 if unknown e.g. 2
+}
+
+// DiskContainer struct to store the disk usage of a container.
+type DiskContainer struct {
+	ContainerID     string `json:"container_id"`       // Short container ID e.g. "d1e2f3a4b5c6"
+	ContainerName   string `json:"container_name"`     // Container name e.g. "web"
+	Image           string `json:"image"`              // Image reference e.g. "nginx:1.27"
+	State           string `json:"state"`              // Container state e.g. "running"
+	SizeRwBytes     int64  `json:"size_rw_bytes"`      // Size of the writable layer e.g. 1048576
+	SizeRootFsBytes int64  `json:"size_root_fs_bytes"` // Size of the image layers and the writable layer e.g. 188702897
+}
+
+// DiskVolume struct to store the disk usage of a volume.
+type DiskVolume struct {
+	Name       string `json:"name"`       // Volume name e.g. "shop_db"
+	Driver     string `json:"driver"`     // Volume driver e.g. "local"
+	Mountpoint string `json:"mountpoint"` // Path of the volume on the host e.g. "/var/lib/docker/volumes/shop_db/_data"
+	SizeBytes  int64  `json:"size_bytes"` // Size of the volume, -1 if unknown e.g. 536870912
+	RefCount   int64  `json:"ref_count"`  // Number of containers using the volume, -1 if unknown e.g. 1
+}
+
+// DiskUsage struct to store the disk usage of the Docker objects of a host like docker system df -v.
+type DiskUsage struct {
+	Host        string          `json:"host,omitempty"` // Host name with several Docker endpoints e.g. "build-01"
+	CollectedAt string          `json:"collected_at"`   // Collection time in RFC3339 format e.g. "2021-09-01T12:34:56Z"
+	Totals      DiskUsageTotals `json:"totals"`         // Totals per kind of object
+	Images      []DiskImage     `json:"images"`         // Images ordered by size, largest first
+	Containers  []DiskContainer `json:"containers"`     // Containers ordered by writable layer size, largest first
+	Volumes     []DiskVolume    `json:"volumes"`        // Volumes ordered by size, largest first
+}
+
+// DiskUsageResponse struct to store the disk usage API response.
+type DiskUsageResponse struct {
+	Status  string `json:"status"`  // Status of the API response e.g. "success"
+	Message string `json:"message"` // Message of the API response e.g. "Disk usage retrieved successfully"
+	Data    struct {
+		DiskUsage []DiskUsage `json:"disk_usage"`       // Disk usage per host
+		Errors    []HostError `json:"errors,omitempty"` // Hosts whose disk usage could not be collected
+	} `json:"data"` // Data of the API response
+}
+
+// ContainerProcess struct to store a process running in a container.
+type ContainerProcess struct {
+	PID        int     `json:"pid"`         // Process ID in the host PID namespace e.g. 4242
+	PPID       int     `json:"ppid"`        // Parent process ID in the host PID namespace e.g. 4200
+	User       string  `json:"user"`        // User name, or the UID if it has none e.g. "nginx"
+	Command    string  `json:"command"`     // Command line e.g. "nginx: worker process"
+	CPUPercent float64 `json:"cpu_percent"` // CPU usage relative to one CPU like docker stats e.g. 12.5
+	RSSBytes   int64   `json:"rss_bytes"`   // Resident set size e.g. 10485760
+}
+
+// ContainerProcesses struct to store the processes running in a container.
+type ContainerProcesses struct {
+	Timestamp     string             `json:"timestamp"`      // Timestamp in RFC3339 format e.g. "2021-09-01T12:34:56Z"
+	ContainerID   string             `json:"container_id"`   // Short container ID e.g. "f3f177b2b3b4"
+	ContainerName string             `json:"container_name"` // Container name e.g. "web"
+	Host          string             `json:"host,omitempty"` // Host the container runs on with several Docker endpoints e.g. "build-01"
+	ProcessCount  int                `json:"process_count"`  // Number of processes before the limit, threads are not counted e.g. 5
+	Processes     []ContainerProcess `json:"processes"`      // Processes in the requested order
+}
+
+// ContainerProcessesResponse struct to store the container processes API response.
+type ContainerProcessesResponse struct {
+	Status  string `json:"status"`  // Status of the API response e.g. "success"
+	Message string `json:"message"` // Message of the API response e.g. "Container processes retrieved successfully"
+	Data    struct {
+		ContainerProcesses ContainerProcesses `json:"container_processes"` // Processes of the container
+	} `json:"data"` // Data of the API response
+}
+
+// HistogramBucket struct to store the number of observations up to a bound.
+type HistogramBucket struct {
+	LESeconds float64 `json:"le_seconds"` // Upper bound of the bucket e.g. 0.25
+	Count     int64   `json:"count"`      // Observations lower or equal to the bound, cumulative like Prometheus e.g. 42
+}
+
+// DurationHistogram struct to store the distribution of durations.
+type DurationHistogram struct {
+	Count      int64             `json:"count"`       // Number of observations e.g. 120
+	SumSeconds float64           `json:"sum_seconds"` // Sum of the observed durations e.g. 36.5
+	MaxSeconds float64           `json:"max_seconds"` // Longest observed duration e.g. 2.1
+	Buckets    []HistogramBucket `json:"buckets"`     // Cumulative buckets, the observations above the last bound only count in Count
+}
+
+// CollectionMetrics struct to store the container collections of a collector.
+type CollectionMetrics struct {
+	Collector     string            `json:"collector"`                 // Collector e.g. "docker", "docker_engine", "podman", "containerd", "aggregator"
+	Duration      DurationHistogram `json:"duration"`                  // Duration of the collections of all containers
+	Errors        int64             `json:"errors"`                    // Failed collections e.g. 2
+	LastSuccessAt string            `json:"last_success_at,omitempty"` // Time of the last successful collection in RFC3339 format e.g. "2021-09-01T12:34:56Z"
+}
+
+// ContainerCollectionMetrics struct to store the collections of a single container.
+type ContainerCollectionMetrics struct {
+	Collector string            `json:"collector"` // Collector e.g. "docker"
+	Container string            `json:"container"` // Container name e.g. "web-1"
+	Duration  DurationHistogram `json:"duration"`  // Duration of the inspect and stats calls of the container
+}
+
+// DockerErrorCount struct to store the number of failed calls to the container runtime of a type.
+type DockerErrorCount struct {
+	Source string `json:"source"` // "cli" for the docker CLI, "api" for the Docker and Podman Engine APIs
+	Type   string `json:"type"`   // e.g. "timeout", "canceled", "connection", "not_found", "server_error", "exit_status", "decode"
+	Count  int64  `json:"count"`  // e.g. 3
+}
+
+// SnapshotAge struct to store the age of data served from memory.
+type SnapshotAge struct {
+	Name        string  `json:"name"`         // "containers" for the last container collection, "disk_usage" for GET /api/disk
+	CollectedAt string  `json:"collected_at"` // Time of the snapshot in RFC3339 format e.g. "2021-09-01T12:34:56Z"
+	AgeSeconds  float64 `json:"age_seconds"`  // Seconds since the snapshot e.g. 12.5
+}
+
+// HTTPRouteMetrics struct to store the requests served by a route.
+type HTTPRouteMetrics struct {
+	Route    string            `json:"route"`    // Route pattern e.g. "/api/metrics/:containerName", "unmatched" for unknown paths
+	Method   string            `json:"method"`   // HTTP method e.g. "GET"
+	Duration DurationHistogram `json:"duration"` // Time to serve the requests
+	Statuses map[string]int64  `json:"statuses"` // Requests by response status code e.g. {"200": 42, "401": 1}
+}
+
+// AuthFailureCount struct to store the number of rejected requests for a reason.
+type AuthFailureCount struct {
+	Reason string `json:"reason"` // e.g. "missing_credentials", "invalid_credentials", "ip_not_allowed", "invalid_token"
+	Count  int64  `json:"count"`  // e.g. 3
+}
+
+// ExporterQueue struct to store the number of batches waiting in an exporter.
+type ExporterQueue struct {
+	Exporter string `json:"exporter"` // e.g. "push"
+	Depth    int    `json:"depth"`    // Undelivered batches e.g. 4
+}
+
+// SelfMetrics struct to store the operational metrics of dh itself.
+type SelfMetrics struct {
+	Timestamp           string                       `json:"timestamp"`             // Timestamp in RFC3339 format e.g. "2021-09-01T12:34:56Z"
+	StartedAt           string                       `json:"started_at"`            // Start time of dh in RFC3339 format e.g. "2021-09-01T12:00:00Z"
+	UptimeSeconds       int64                        `json:"uptime_seconds"`        // Seconds since dh started e.g. 2096
+	Goroutines          int                          `json:"goroutines"`            // Running goroutines e.g. 24
+	HeapAllocBytes      int64                        `json:"heap_alloc_bytes"`      // Allocated heap objects e.g. 4194304
+	HeapInuseBytes      int64                        `json:"heap_inuse_bytes"`      // Heap spans in use e.g. 6291456
+	HeapObjects         int64                        `json:"heap_objects"`          // Allocated heap objects e.g. 21000
+	SysBytes            int64                        `json:"sys_bytes"`             // Memory obtained from the OS e.g. 16777216
+	GCCycles            int64                        `json:"gc_cycles"`             // Completed garbage collections e.g. 12
+	Collections         []CollectionMetrics          `json:"collections"`           // Container collections by collector
+	Containers          []ContainerCollectionMetrics `json:"containers"`            // Collections by container, for collectors that query containers one by one
+	DockerErrors        []DockerErrorCount           `json:"docker_errors"`         // Failed calls to the container runtime by type
+	Snapshots           []SnapshotAge                `json:"snapshots"`             // Age of the data served from memory
+	HTTPRequests        []HTTPRouteMetrics           `json:"http_requests"`         // Requests by route and method
+	RateLimitRejections int64                        `json:"rate_limit_rejections"` // Requests rejected by the rate limiter e.g. 7
+	AuthFailures        []AuthFailureCount           `json:"auth_failures"`         // Requests rejected by the access control by reason
+	ExporterQueues      []ExporterQueue              `json:"exporter_queues"`       // Batches waiting in the exporters
+}
+
+// SelfMetricsResponse struct to store the self metrics API response.
+type SelfMetricsResponse struct {
+	Status  string `json:"status"`  // Status of the API response e.g. "success"
+	Message string `json:"message"` // Message of the API response e.g. "Self metrics retrieved successfully"
+	Data    struct {
+		SelfMetrics SelfMetrics `json:"self_metrics"` // Operational metrics of dh
+	} `json:"data"` // Data of the API response
+}
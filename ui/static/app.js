@@ -0,0 +1,461 @@
+// Dashboard of the dh JSON API. Served from /ui/, the API is reached relative to it so the
+// dashboard keeps working behind a reverse proxy that mounts dh under a sub path.
+"use strict";
+
+const API = "../api/";
+const HISTORY = 120; // Samples kept per container for the charts
+const COMPOSE_PROJECT = "com.docker.compose.project";
+const COMPOSE_SERVICE = "com.docker.compose.service";
+
+// Columns of the container table. value returns what the column is sorted by, text what is shown.
+const COLUMNS = [
+    { title: "Name", text: true, value: (r) => r.metrics.container_name },
+    { title: "Host", text: true, value: (r) => r.metrics.host || "", optional: true },
+    { title: "State", text: true, value: (r) => stateText(r.metrics), className: (r) => stateClass(r.metrics) },
+    { title: "CPU %", value: (r) => r.metrics.container_cpu_usage_percent, format: percent },
+    { title: "Memory", value: (r) => r.metrics.container_memory_usage_bytes, format: bytes },
+    { title: "Memory %", value: (r) => r.metrics.container_memory_usage_percent, format: percent },
+    { title: "Net RX/s", value: (r) => r.netRx, format: rate },
+    { title: "Net TX/s", value: (r) => r.netTx, format: rate },
+    { title: "Block R/s", value: (r) => r.blockRead, format: rate },
+    { title: "Block W/s", value: (r) => r.blockWrite, format: rate },
+    { title: "PIDs", value: (r) => r.metrics.container_pids, format: String },
+    { title: "Restarts", value: (r) => r.metrics.container_restart_count, format: String },
+];
+
+const state = {
+    rows: new Map(), // Key "host/id" to the latest metrics and the history of the container
+    sortColumn: 3,
+    descending: true,
+    filter: "",
+    grouped: false,
+    selected: null,
+    timer: null,
+    host: null,
+    errors: [],
+};
+
+const $ = (id) => document.getElementById(id);
+
+function percent(value) {
+    return value.toFixed(2) + "%";
+}
+
+function bytes(value) {
+    const units = ["B", "KiB", "MiB", "GiB", "TiB", "PiB"];
+    let unit = 0;
+    while (Math.abs(value) >= 1024 && unit < units.length - 1) {
+        value /= 1024;
+        unit++;
+    }
+    return (unit === 0 ? value.toFixed(0) : value.toFixed(1)) + units[unit];
+}
+
+function rate(value) {
+    return value === null ? "-" : bytes(value) + "/s";
+}
+
+function duration(seconds) {
+    const days = Math.floor(seconds / 86400);
+    const hours = Math.floor((seconds % 86400) / 3600);
+    const minutes = Math.floor((seconds % 3600) / 60);
+    if (days > 0) {
+        return days + "d " + hours + "h";
+    }
+    if (hours > 0) {
+        return hours + "h " + minutes + "m";
+    }
+    return minutes + "m";
+}
+
+function stateText(m) {
+    return m.container_health_status ? m.container_state + " (" + m.container_health_status + ")" : m.container_state;
+}
+
+function stateClass(m) {
+    return m.container_health_status === "unhealthy" ? "health-unhealthy" : "state-" + m.container_state;
+}
+
+function project(m) {
+    return (m.container_labels && m.container_labels[COMPOSE_PROJECT]) || "";
+}
+
+function element(tag, text, className) {
+    // Text is always set with textContent, container names and labels are never parsed as HTML.
+    const node = document.createElement(tag);
+    if (text !== undefined) {
+        node.textContent = text;
+    }
+    if (className) {
+        node.className = className;
+    }
+    return node;
+}
+
+async function get(path) {
+    const response = await fetch(API + path, { credentials: "same-origin", headers: { Accept: "application/json" } });
+    if (!response.ok) {
+        let message = response.status + " " + response.statusText;
+        try {
+            const body = await response.json();
+            message = body.message || message;
+        } catch (_) {
+            // Keep the status line when the body is not JSON
+        }
+        throw new Error(message);
+    }
+    return response.json();
+}
+
+function perSecond(current, previous, seconds) {
+    // Counters reset when a container restarts, no rate is shown for that sample.
+    if (previous === undefined || seconds <= 0 || current < previous) {
+        return null;
+    }
+    return (current - previous) / seconds;
+}
+
+function update(list, at) {
+    const seen = new Set();
+    for (const m of list) {
+        const key = (m.host || "") + "/" + m.container_id;
+        seen.add(key);
+        let row = state.rows.get(key);
+        if (!row) {
+            row = { key: key, history: [], netRx: null, netTx: null, blockRead: null, blockWrite: null };
+            state.rows.set(key, row);
+        }
+        const previous = row.metrics;
+        const seconds = row.at ? (at - row.at) / 1000 : 0;
+        if (previous) {
+            row.netRx = perSecond(m.container_network_receive_bytes_total, previous.container_network_receive_bytes_total, seconds);
+            row.netTx = perSecond(m.container_network_transmit_bytes_total, previous.container_network_transmit_bytes_total, seconds);
+            row.blockRead = perSecond(m.container_block_read_bytes, previous.container_block_read_bytes, seconds);
+            row.blockWrite = perSecond(m.container_block_write_bytes, previous.container_block_write_bytes, seconds);
+        }
+        row.metrics = m;
+        row.at = at;
+        row.history.push({
+            at: at,
+            cpu: m.container_cpu_usage_percent,
+            memory: m.container_memory_usage_bytes,
+            netRx: row.netRx,
+            netTx: row.netTx,
+            blockRead: row.blockRead,
+            blockWrite: row.blockWrite,
+        });
+        if (row.history.length > HISTORY) {
+            row.history.shift();
+        }
+    }
+    for (const key of state.rows.keys()) {
+        if (!seen.has(key)) {
+            state.rows.delete(key);
+        }
+    }
+    if (state.selected && !state.rows.has(state.selected)) {
+        state.selected = null;
+    }
+}
+
+async function refresh() {
+    const status = $("status");
+    try {
+        const [metrics, host] = await Promise.allSettled([get("metrics"), get("host")]);
+        if (metrics.status === "rejected") {
+            throw metrics.reason;
+        }
+        update(metrics.value.data.container_metrics || [], Date.now());
+        state.errors = metrics.value.data.errors || [];
+        // Host metrics are optional, e.g. on Windows or when /proc is not mounted.
+        state.host = host.status === "fulfilled" ? host.value.data.host_metrics : null;
+        status.className = "status";
+        status.textContent = state.errors.length > 0
+            ? state.errors.length + " hosts failed, " + state.errors[0].host + ": " + state.errors[0].error
+            : "Updated " + new Date().toLocaleTimeString();
+        if (state.errors.length > 0) {
+            status.className = "status error";
+        }
+    } catch (err) {
+        status.className = "status error";
+        status.textContent = "Error: " + err.message;
+    }
+    render();
+}
+
+function schedule() {
+    clearInterval(state.timer);
+    const interval = Number($("interval").value);
+    if (interval > 0) {
+        state.timer = setInterval(refresh, interval);
+    }
+}
+
+function card(label, value, sub) {
+    const node = element("div", undefined, "card");
+    node.append(element("div", label, "label"), element("div", value, "value"));
+    if (sub) {
+        node.append(element("div", sub, "sub"));
+    }
+    return node;
+}
+
+function renderSummary() {
+    const summary = $("summary");
+    const cards = [];
+    const host = state.host;
+    if (host) {
+        cards.push(card("Host CPU", percent(host.cpu.usage_percent), host.cpu_count + " cores"));
+        cards.push(card("Load", host.load.load1.toFixed(2), host.load.load5.toFixed(2) + " / " + host.load.load15.toFixed(2) + " (5m / 15m)"));
+        cards.push(card("Host memory", percent(host.memory.usage_percent), bytes(host.memory.used_bytes) + " of " + bytes(host.memory.total_bytes)));
+        if (host.filesystem) {
+            cards.push(card("Disk", percent(host.filesystem.usage_percent), bytes(host.filesystem.available_bytes) + " free on " + host.filesystem.path));
+        }
+        cards.push(card("Uptime", duration(host.uptime_seconds)));
+    }
+
+    // Totals over the containers, per host when the metrics come from an aggregator.
+    const hosts = new Map();
+    for (const row of state.rows.values()) {
+        const name = row.metrics.host || "";
+        const total = hosts.get(name) || { containers: 0, running: 0, cpu: 0, memory: 0 };
+        total.containers++;
+        total.running += row.metrics.container_state === "running" ? 1 : 0;
+        total.cpu += row.metrics.container_cpu_usage_percent;
+        total.memory += row.metrics.container_memory_usage_bytes;
+        hosts.set(name, total);
+    }
+    for (const [name, total] of [...hosts].sort((a, b) => a[0].localeCompare(b[0]))) {
+        cards.push(card(name ? "Containers on " + name : "Containers", total.running + " / " + total.containers + " running",
+            "CPU " + percent(total.cpu) + ", memory " + bytes(total.memory)));
+    }
+    summary.replaceChildren(...cards);
+}
+
+function visibleColumns() {
+    const aggregated = [...state.rows.values()].some((r) => r.metrics.host);
+    return COLUMNS.map((column, index) => ({ column, index })).filter(({ column }) => !column.optional || aggregated);
+}
+
+function visibleRows() {
+    const filter = state.filter.toLowerCase();
+    const rows = [...state.rows.values()].filter((r) => {
+        if (!filter) {
+            return true;
+        }
+        const m = r.metrics;
+        return [m.container_name, m.container_image, m.container_id, project(m), m.host || ""].some((v) => v.toLowerCase().includes(filter));
+    });
+    const column = COLUMNS[state.sortColumn];
+    rows.sort((a, b) => {
+        const x = column.value(a);
+        const y = column.value(b);
+        const order = typeof x === "string" ? x.localeCompare(y) : (x ?? -1) - (y ?? -1);
+        if (order === 0) {
+            return a.metrics.container_name.localeCompare(b.metrics.container_name); // Stable order between refreshes
+        }
+        return state.descending ? -order : order;
+    });
+    return rows;
+}
+
+function renderHeader(columns) {
+    const header = $("containers").tHead.rows[0];
+    header.replaceChildren(...columns.map(({ column, index }) => {
+        let title = column.title;
+        if (index === state.sortColumn) {
+            title += state.descending ? " ↓" : " ↑";
+        }
+        const th = element("th", title, (column.text ? "text" : "") + (index === state.sortColumn ? " sorted" : ""));
+        th.setAttribute("aria-sort", index === state.sortColumn ? (state.descending ? "descending" : "ascending") : "none");
+        th.addEventListener("click", () => {
+            if (state.sortColumn === index) {
+                state.descending = !state.descending;
+            } else {
+                state.sortColumn = index;
+                state.descending = !column.text; // Largest values first, names alphabetically
+            }
+            render();
+        });
+        return th;
+    }));
+}
+
+function containerRow(row, columns, grouped) {
+    const tr = element("tr", undefined, "container" + (grouped ? " grouped" : "") + (row.key === state.selected ? " selected" : ""));
+    for (const { column } of columns) {
+        const value = column.value(row);
+        const text = column.format ? (value === null ? "-" : column.format(value)) : value;
+        tr.append(element("td", text, [column.text ? "text" : "", column.className ? column.className(row) : ""].join(" ").trim()));
+    }
+    tr.addEventListener("click", () => {
+        state.selected = state.selected === row.key ? null : row.key;
+        render();
+    });
+    return tr;
+}
+
+function projectRow(name, rows, columns) {
+    const cpu = rows.reduce((sum, r) => sum + r.metrics.container_cpu_usage_percent, 0);
+    const memory = rows.reduce((sum, r) => sum + r.metrics.container_memory_usage_bytes, 0);
+    const tr = element("tr", undefined, "project");
+    const td = element("td", (name || "(no project)") + " – " + rows.length + " containers, CPU " + percent(cpu) + ", memory " + bytes(memory));
+    td.colSpan = columns.length;
+    tr.append(td);
+    return tr;
+}
+
+function renderTable() {
+    const columns = visibleColumns();
+    if (!columns.some(({ index }) => index === state.sortColumn)) {
+        state.sortColumn = 3;
+        state.descending = true;
+    }
+    renderHeader(columns);
+    const rows = visibleRows();
+    const body = [];
+    if (state.grouped) {
+        // Projects by name, containers outside a Compose project last.
+        const projects = new Map();
+        for (const row of rows) {
+            const name = project(row.metrics);
+            projects.set(name, [...(projects.get(name) || []), row]);
+        }
+        const names = [...projects.keys()].sort((a, b) => (a === "") - (b === "") || a.localeCompare(b));
+        for (const name of names) {
+            body.push(projectRow(name, projects.get(name), columns));
+            body.push(...projects.get(name).map((row) => containerRow(row, columns, true)));
+        }
+    } else {
+        body.push(...rows.map((row) => containerRow(row, columns, false)));
+    }
+    $("containers").tBodies[0].replaceChildren(...body);
+    $("empty").hidden = rows.length > 0;
+}
+
+function renderDetail() {
+    const detail = $("detail");
+    const row = state.rows.get(state.selected);
+    if (!row) {
+        detail.hidden = true;
+        return;
+    }
+    detail.hidden = false;
+    const m = row.metrics;
+    $("detail-title").textContent = m.container_name + " (" + m.container_id + ")";
+    const info = [
+        ["Image", m.container_image],
+        ["State", stateText(m)],
+        ["Host", m.host],
+        ["Project", project(m) && [project(m), m.container_labels[COMPOSE_SERVICE]].filter(Boolean).join(" / ")],
+        ["Uptime", m.container_uptime_seconds > 0 ? duration(m.container_uptime_seconds) : ""],
+        ["Memory limit", m.container_memory_limit_bytes > 0 ? bytes(m.container_memory_limit_bytes) : ""],
+        ["Restart policy", m.container_restart_policy],
+    ];
+    $("detail-info").replaceChildren(...info.filter(([, value]) => value).flatMap(([label, value]) => [element("dt", label), element("dd", value)]));
+
+    const style = getComputedStyle(document.documentElement);
+    const colors = [style.getPropertyValue("--accent").trim(), style.getPropertyValue("--accent-2").trim()];
+    chart($("chart-cpu"), row.history, [(s) => s.cpu], colors, percent, 100);
+    chart($("chart-memory"), row.history, [(s) => s.memory], colors, bytes, m.container_memory_limit_bytes || 0);
+    chart($("chart-network"), row.history, [(s) => s.netRx, (s) => s.netTx], colors, rate, 0);
+    chart($("chart-block"), row.history, [(s) => s.blockRead, (s) => s.blockWrite], colors, rate, 0);
+}
+
+function chart(canvas, history, series, colors, format, ceiling) {
+    /*
+        Line chart of the history, one line per series. The vertical axis starts at 0 and ends at
+        the largest value, or at ceiling when all values are below it e.g. 100 for percentages.
+        Samples without a value, e.g. the first rate of a container, leave a gap in the line.
+    */
+    const ratio = window.devicePixelRatio || 1;
+    const width = canvas.clientWidth || canvas.width;
+    const height = canvas.clientHeight || canvas.height;
+    canvas.width = width * ratio;
+    canvas.height = height * ratio;
+    const context = canvas.getContext("2d");
+    context.scale(ratio, ratio);
+    context.clearRect(0, 0, width, height);
+
+    const style = getComputedStyle(document.documentElement);
+    const muted = style.getPropertyValue("--muted").trim();
+    const border = style.getPropertyValue("--border").trim();
+    const values = history.flatMap((sample) => series.map((value) => value(sample))).filter((v) => v !== null);
+    let top = Math.max(...values, 0);
+    if (ceiling > 0 && top <= ceiling) {
+        top = ceiling;
+    }
+    if (top === 0) {
+        top = 1;
+    }
+
+    const left = 4;
+    const plot = { top: 18, bottom: height - 4, width: width - left - 4 };
+    context.font = "11px system-ui, sans-serif";
+    context.fillStyle = muted;
+    context.textBaseline = "top";
+    context.fillText(format(top), left, 2);
+    context.strokeStyle = border;
+    context.lineWidth = 1;
+    context.beginPath();
+    context.moveTo(left, plot.bottom + 0.5);
+    context.lineTo(left + plot.width, plot.bottom + 0.5);
+    context.stroke();
+
+    const x = (i) => left + (HISTORY > 1 ? (plot.width * (HISTORY - history.length + i)) / (HISTORY - 1) : 0);
+    const y = (v) => plot.bottom - ((plot.bottom - plot.top) * v) / top;
+    series.forEach((value, index) => {
+        context.strokeStyle = colors[index % colors.length];
+        context.lineWidth = 1.5;
+        context.beginPath();
+        let drawing = false;
+        history.forEach((sample, i) => {
+            const v = value(sample);
+            if (v === null) {
+                drawing = false;
+                return;
+            }
+            if (drawing) {
+                context.lineTo(x(i), y(v));
+            } else {
+                context.moveTo(x(i), y(v));
+                drawing = true;
+            }
+        });
+        context.stroke();
+    });
+
+    const latest = history[history.length - 1];
+    if (latest) {
+        const labels = series.map((value) => value(latest)).map((v) => (v === null ? "-" : format(v))).join(" / ");
+        context.fillStyle = muted;
+        context.textAlign = "right";
+        context.fillText(labels, left + plot.width, 2);
+        context.textAlign = "left";
+    }
+}
+
+function render() {
+    renderSummary();
+    renderTable();
+    renderDetail();
+}
+
+document.addEventListener("DOMContentLoaded", () => {
+    $("filter").addEventListener("input", (event) => {
+        state.filter = event.target.value.trim();
+        renderTable();
+    });
+    $("grouped").addEventListener("change", (event) => {
+        state.grouped = event.target.checked;
+        renderTable();
+    });
+    $("interval").addEventListener("change", schedule);
+    $("detail-close").addEventListener("click", () => {
+        state.selected = null;
+        render();
+    });
+    window.addEventListener("resize", renderDetail);
+    refresh();
+    schedule();
+});
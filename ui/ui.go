@@ -0,0 +1,21 @@
+// Package ui embeds the web dashboard served by dh at /ui.
+package ui
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// Dashboard assets, plain HTML, CSS and JavaScript without external dependencies so it works offline.
+//
+//go:embed static
+var static embed.FS
+
+func Files() fs.FS {
+	// Files returns the dashboard assets with index.html at the root.
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err) // The static directory is embedded at build time
+	}
+	return files
+}
@@ -0,0 +1,53 @@
+package ui
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFiles(t *testing.T) {
+	e := echo.New()
+	e.StaticFS("/ui", Files())
+
+	for path, expected := range map[string]int{
+		"/ui/":        http.StatusOK,
+		"/ui/app.js":  http.StatusOK,
+		"/ui/app.css": http.StatusOK,
+		"/ui/missing": http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, expected, rec.Code, path)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui", nil))
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, "/ui/", rec.Header().Get(echo.HeaderLocation))
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/", nil))
+	assert.Contains(t, rec.Body.String(), `<script src="app.js" defer></script>`)
+}
+
+func TestFilesOffline(t *testing.T) {
+	// Assets are loaded from dh itself, never from a CDN.
+	external := regexp.MustCompile(`(src|href)="(https?:)?//|@import|https?://`)
+	err := fs.WalkDir(Files(), ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(Files(), path)
+		if assert.NoError(t, err) {
+			assert.NotRegexp(t, external, string(content), path)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+}